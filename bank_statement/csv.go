@@ -0,0 +1,133 @@
+package bank_statement
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// csvDateLayouts are tried in order when CSVParser.DateLayouts is empty.
+var csvDateLayouts = []string{"2006-01-02", "2006-01-02 15:04:05", "02/01/2006", "02-01-2006"}
+
+// CSVParser reads a CSV export with a header row. Columns are found by name
+// (case-insensitive): date, reference, description, and either amount (negative for
+// debits) or separate credit / debit columns. Only date and an amount column are
+// required.
+type CSVParser struct {
+	// Comma is the field separator; 0 means ','.
+	Comma rune
+	// DecimalComma reads amounts as 1.234,56 instead of 1,234.56.
+	DecimalComma bool
+	// DateLayouts overrides csvDateLayouts.
+	DateLayouts []string
+}
+
+func (p CSVParser) Parse(r io.Reader) ([]Line, error) {
+	cr := csv.NewReader(r)
+	if p.Comma != 0 {
+		cr.Comma = p.Comma
+	}
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+
+	header, err := cr.Read()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, errors.New("csv: empty statement")
+		}
+		return nil, err
+	}
+	col := map[string]int{}
+	for i, name := range header {
+		col[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	if _, ok := col["date"]; !ok {
+		return nil, errors.New("csv: no date column")
+	}
+	_, hasAmount := col["amount"]
+	_, hasCredit := col["credit"]
+	if !hasAmount && !hasCredit {
+		return nil, errors.New("csv: no amount or credit column")
+	}
+	field := func(rec []string, name string) string {
+		i, ok := col[name]
+		if !ok || i >= len(rec) {
+			return ""
+		}
+		return strings.TrimSpace(rec[i])
+	}
+
+	var lines []Line
+	for lineNo := 2; ; lineNo++ {
+		rec, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(rec) == 1 && strings.TrimSpace(rec[0]) == "" {
+			continue
+		}
+
+		raw := field(rec, "credit")
+		if !hasCredit {
+			raw = field(rec, "amount")
+		}
+		if raw == "" {
+			continue // a debit-only row
+		}
+		amount, err := p.parseAmount(raw)
+		if err != nil {
+			return nil, fmt.Errorf("csv line %d: %w", lineNo, err)
+		}
+		if amount <= 0 {
+			continue
+		}
+		date, err := p.parseDate(field(rec, "date"))
+		if err != nil {
+			return nil, fmt.Errorf("csv line %d: %w", lineNo, err)
+		}
+
+		lines = append(lines, Line{
+			LineNo:      lineNo,
+			Date:        date,
+			Amount:      amount,
+			Reference:   field(rec, "reference"),
+			Description: field(rec, "description"),
+		})
+	}
+	return lines, nil
+}
+
+func (p CSVParser) parseAmount(s string) (float64, error) {
+	s = strings.ReplaceAll(s, " ", "")
+	if p.DecimalComma {
+		s = strings.ReplaceAll(s, ".", "")
+		s = strings.ReplaceAll(s, ",", ".")
+	} else {
+		s = strings.ReplaceAll(s, ",", "")
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, fmt.Errorf("bad amount %q", s)
+	}
+	return v, nil
+}
+
+func (p CSVParser) parseDate(s string) (time.Time, error) {
+	layouts := p.DateLayouts
+	if len(layouts) == 0 {
+		layouts = csvDateLayouts
+	}
+	for _, layout := range layouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("bad date %q", s)
+}
@@ -0,0 +1,84 @@
+package bank_statement
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	mt940Tag = regexp.MustCompile(`^:(\d{2}[A-Z]?):(.*)$`)
+	// :61: value date YYMMDD, optional entry date MMDD, mark (C, D, RC, RD), optional
+	// funds code, amount with decimal comma, transaction type, customer reference, and
+	// after // the bank's reference.
+	mt940Entry = regexp.MustCompile(`^(\d{6})(\d{4})?(RC|RD|C|D)([A-Z])?(\d+,\d*)([NSF][A-Z0-9]{3})([^/]*)(?://(.*))?$`)
+)
+
+// MT940Parser reads a SWIFT MT940 customer statement. Every :61: statement line with
+// a credit mark (C, or RD for a reversed debit) becomes a Line; its customer reference
+// (unless NONREF) is the Reference and the following :86: information the Description.
+type MT940Parser struct{}
+
+func (MT940Parser) Parse(r io.Reader) ([]Line, error) {
+	type field struct {
+		tag    string
+		value  string
+		lineNo int
+	}
+	var fields []field
+	sc := bufio.NewScanner(r)
+	for n := 1; sc.Scan(); n++ {
+		text := strings.TrimRight(sc.Text(), "\r")
+		if m := mt940Tag.FindStringSubmatch(text); m != nil {
+			fields = append(fields, field{tag: m[1], value: m[2], lineNo: n})
+			continue
+		}
+		if text == "-" || strings.TrimSpace(text) == "" || len(fields) == 0 {
+			continue
+		}
+		// continuation of the previous field
+		last := &fields[len(fields)-1]
+		last.value += "\n" + text
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+
+	var lines []Line
+	for i, f := range fields {
+		if f.tag != "61" {
+			continue
+		}
+		first, _, _ := strings.Cut(f.value, "\n")
+		m := mt940Entry.FindStringSubmatch(first)
+		if m == nil {
+			return nil, fmt.Errorf("mt940 line %d: bad statement line %q", f.lineNo, first)
+		}
+		if mark := m[3]; mark != "C" && mark != "RD" {
+			continue
+		}
+
+		date, err := time.Parse("060102", m[1])
+		if err != nil {
+			return nil, fmt.Errorf("mt940 line %d: bad value date %q", f.lineNo, m[1])
+		}
+		amount, err := strconv.ParseFloat(strings.Replace(m[5], ",", ".", 1), 64)
+		if err != nil {
+			return nil, fmt.Errorf("mt940 line %d: bad amount %q", f.lineNo, m[5])
+		}
+
+		line := Line{LineNo: f.lineNo, Date: date, Amount: amount}
+		if ref := strings.TrimSpace(m[7]); ref != "NONREF" {
+			line.Reference = ref
+		}
+		if i+1 < len(fields) && fields[i+1].tag == "86" {
+			line.Description = strings.Join(strings.Fields(fields[i+1].value), " ")
+		}
+		lines = append(lines, line)
+	}
+	return lines, nil
+}
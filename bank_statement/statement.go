@@ -0,0 +1,77 @@
+// Package bank_statement parses bank statement files into credit lines, for matching
+// incoming transfers to pending payments. Formats are pluggable: a Parser is
+// registered under a format name, and csv and mt940 are built in.
+package bank_statement
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Line is one credit (incoming transfer) on a statement. Debits are dropped by the
+// parsers. Reference is the transfer reference as the bank reports it, Description
+// the free text (e.g. remittance information); either may carry a payment's
+// document id.
+type Line struct {
+	LineNo      int
+	Date        time.Time
+	Amount      float64
+	Reference   string
+	Description string
+}
+
+// Parser reads a whole statement file and returns its credit lines in file order.
+type Parser interface {
+	Parse(r io.Reader) ([]Line, error)
+}
+
+var (
+	registryMu sync.RWMutex
+	registry   = map[string]Parser{}
+)
+
+// Register makes a parser available under format (case-insensitive), replacing any
+// parser registered under it before.
+func Register(format string, p Parser) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	registry[strings.ToLower(format)] = p
+}
+
+// Lookup returns the parser registered under format.
+func Lookup(format string) (Parser, bool) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	p, ok := registry[strings.ToLower(format)]
+	return p, ok
+}
+
+// Formats lists the registered format names, sorted.
+func Formats() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	out := make([]string, 0, len(registry))
+	for f := range registry {
+		out = append(out, f)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// Parse reads r with the parser registered under format.
+func Parse(format string, r io.Reader) ([]Line, error) {
+	p, ok := Lookup(format)
+	if !ok {
+		return nil, fmt.Errorf("unknown statement format %q (have %s)", format, strings.Join(Formats(), ", "))
+	}
+	return p.Parse(r)
+}
+
+func init() {
+	Register("csv", CSVParser{})
+	Register("mt940", MT940Parser{})
+}
@@ -0,0 +1,90 @@
+package bank_statement_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pdcgo/invoice_service/bank_statement"
+	"github.com/stretchr/testify/assert"
+)
+
+func parseFixture(t *testing.T, p bank_statement.Parser, name string) ([]bank_statement.Line, error) {
+	t.Helper()
+	f, err := os.Open(filepath.Join("testdata", name))
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	defer f.Close()
+	return p.Parse(f)
+}
+
+func TestParsers(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2026, 6, d, 0, 0, 0, 0, time.UTC) }
+
+	// all three fixtures hold the same two credits (the admin fee debit is dropped).
+	want := []struct {
+		date   time.Time
+		amount float64
+		ref    string
+		desc   string
+	}{
+		{day(26), 150000, "INV-001", "TRANSFER FROM PT ABC"},
+		{day(27), 250000, "", "INV-002"},
+	}
+
+	cases := []struct {
+		name   string
+		parser bank_statement.Parser
+		file   string
+		lines  int
+	}{
+		{"csv with signed amount", bank_statement.CSVParser{}, "statement.csv", 3},
+		{"csv with debit and credit columns", bank_statement.CSVParser{Comma: ';', DecimalComma: true}, "statement_credit_debit.csv", 2},
+		{"mt940", bank_statement.MT940Parser{}, "statement.mt940", 3},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			lines, err := parseFixture(t, c.parser, c.file)
+			assert.NoError(t, err)
+			if !assert.Len(t, lines, c.lines) {
+				return
+			}
+			for i, w := range want {
+				assert.True(t, w.date.Equal(lines[i].Date), "line %d date %s", i, lines[i].Date)
+				assert.Equal(t, w.amount, lines[i].Amount)
+				assert.Equal(t, w.ref, lines[i].Reference)
+				assert.Contains(t, lines[i].Description, w.desc)
+				assert.NotZero(t, lines[i].LineNo)
+			}
+		})
+	}
+
+	t.Run("mt940 reversed debit is a credit, NONREF is no reference", func(t *testing.T) {
+		lines, err := parseFixture(t, bank_statement.MT940Parser{}, "statement.mt940")
+		assert.NoError(t, err)
+		if assert.Len(t, lines, 3) {
+			assert.Equal(t, float64(99000), lines[2].Amount)
+			assert.Equal(t, "XYZ", lines[2].Reference)
+			assert.Empty(t, lines[2].Description)
+		}
+	})
+
+	t.Run("bad amount is an error with the line number", func(t *testing.T) {
+		_, err := parseFixture(t, bank_statement.CSVParser{}, "bad_amount.csv")
+		assert.ErrorContains(t, err, "line 2")
+	})
+
+	t.Run("registry", func(t *testing.T) {
+		assert.Equal(t, []string{"csv", "mt940"}, bank_statement.Formats())
+		_, ok := bank_statement.Lookup("MT940")
+		assert.True(t, ok)
+
+		f, err := os.Open(filepath.Join("testdata", "statement.csv"))
+		assert.NoError(t, err)
+		defer f.Close()
+		_, err = bank_statement.Parse("ofx", f)
+		assert.Error(t, err)
+	})
+}
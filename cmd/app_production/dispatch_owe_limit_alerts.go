@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/pdcgo/invoice_service/invoice_models"
+	"github.com/pdcgo/invoice_service/invoice_v2"
+	"github.com/urfave/cli/v3"
+	"gorm.io/gorm"
+)
+
+type DispatchOweLimitAlertsFunc cli.ActionFunc
+
+// NewDispatchOweLimitAlertsFunc builds the `dispatch-owe-limit-alerts` action: one
+// delivery round of the owe-limit alerts recorded since the last one. Meant to run on
+// a short schedule (e.g. every minute). Alerts go to the service log, or are POSTed as
+// JSON to --webhook-url when given.
+func NewDispatchOweLimitAlertsFunc(db *gorm.DB) DispatchOweLimitAlertsFunc {
+	return func(ctx context.Context, c *cli.Command) error {
+		var notifier invoice_v2.OweLimitNotifier = logOweLimitNotifier{}
+		if url := c.String("webhook-url"); url != "" {
+			notifier = &webhookOweLimitNotifier{url: url, client: &http.Client{Timeout: 10 * time.Second}}
+		}
+
+		res, err := invoice_v2.DispatchOweLimitAlerts(ctx, db, notifier, time.Now())
+		if res != nil {
+			log.Printf("dispatch-owe-limit-alerts: notified %d, failed %d", res.Notified, res.Failed)
+		}
+		return err
+	}
+}
+
+// logOweLimitNotifier writes alerts to the service log (structured by cloud logging).
+type logOweLimitNotifier struct{}
+
+func (logOweLimitNotifier) NotifyOweLimit(ctx context.Context, a *invoice_models.OweLimitAlert) error {
+	log.Printf("dispatch-owe-limit-alerts: team %d owes team %d %.2f, %d%% of its %.2f limit (%s)",
+		a.ForTeamID, a.TeamID, a.ProjectedDebt, a.Level, a.Threshold, a.Rule)
+	return nil
+}
+
+// webhookOweLimitNotifier POSTs each alert as JSON to a single endpoint; any non-2xx
+// answer fails the alert so it is retried.
+type webhookOweLimitNotifier struct {
+	url    string
+	client *http.Client
+}
+
+func (n *webhookOweLimitNotifier) NotifyOweLimit(ctx context.Context, a *invoice_models.OweLimitAlert) error {
+	body, err := json.Marshal(map[string]interface{}{
+		"alert_id":       a.ID,
+		"team_id":        a.TeamID,
+		"for_team_id":    a.ForTeamID,
+		"level":          a.Level,
+		"threshold":      a.Threshold,
+		"projected_debt": a.ProjectedDebt,
+		"rule":           a.Rule.String(),
+		"created_at":     a.CreatedAt,
+	})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("webhook answered %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/pdcgo/invoice_service/invoice_models"
+	"github.com/pdcgo/invoice_service/invoice_v2"
+	"github.com/urfave/cli/v3"
+	"gorm.io/gorm"
+)
+
+type ExpirePaymentsFunc cli.ActionFunc
+
+// NewExpirePaymentsFunc builds the `expire-payments` action: one sweep of the payment
+// expiry job, which expires pending payments past their creditor's expiry and reminds
+// creditors of the ones about to expire. Meant to run on a schedule (e.g. hourly);
+// --no-remind skips the reminders.
+func NewExpirePaymentsFunc(db *gorm.DB, oweLimitCache *invoice_v2.OweLimitCache) ExpirePaymentsFunc {
+	return func(ctx context.Context, c *cli.Command) error {
+		ctx, done := oweLimitCache.Track(ctx)
+		defer done()
+
+		var reminder invoice_v2.PaymentReminder = logPaymentReminder{}
+		if c.Bool("no-remind") {
+			reminder = nil
+		}
+
+		res, err := invoice_v2.ExpirePendingPayments(ctx, db, reminder, time.Now())
+		if res != nil {
+			log.Printf("expire-payments: expired %d, reminded %d, failed %d", res.Expired, res.Reminded, res.Failed)
+		}
+		return err
+	}
+}
+
+// logPaymentReminder writes reminders to the service log (structured by cloud logging).
+type logPaymentReminder struct{}
+
+func (logPaymentReminder) RemindPayment(ctx context.Context, p *invoice_models.InvoicePayment, expiresAt time.Time) error {
+	log.Printf("expire-payments: payment #%d from team %d to team %d (%.2f) expires at %s unless answered",
+		p.ID, p.TeamID, p.ForTeamID, p.Amount, expiresAt.Format(time.RFC3339))
+	return nil
+}
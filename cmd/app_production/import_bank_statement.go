@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/pdcgo/invoice_service/invoice_v2"
+	"github.com/urfave/cli/v3"
+	"gorm.io/gorm"
+)
+
+type ImportBankStatementFunc cli.ActionFunc
+
+// NewImportBankStatementFunc builds the `import-bank-statement` action: imports a
+// statement file for --team-id and logs every credit line with the pending payment it
+// was matched to. Nothing is accepted; matched payments still go through AcceptPayment.
+func NewImportBankStatementFunc(db *gorm.DB) ImportBankStatementFunc {
+	return func(ctx context.Context, c *cli.Command) error {
+		teamID := c.Uint64("team-id")
+		path := c.String("file")
+		if teamID == 0 || path == "" {
+			return errors.New("--team-id and --file are required")
+		}
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+
+		err = db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			imp, lines, err := invoice_v2.ImportStatement(tx, invoice_v2.BankStatementInput{
+				TeamID:            teamID,
+				Format:            c.String("format"),
+				FileName:          filepath.Base(path),
+				Content:           content,
+				DateToleranceDays: int(c.Int("date-tolerance")),
+			}, invoice_v2.SystemActorID, time.Now())
+			if err != nil {
+				return err
+			}
+
+			for _, l := range lines {
+				paymentID := uint64(0)
+				if l.PaymentID != nil {
+					paymentID = *l.PaymentID
+				}
+				log.Printf("import-bank-statement: line %d %s %.2f %q -> %s %s payment #%d",
+					l.LineNo, l.Date.Format(time.DateOnly), l.Amount, l.Reference,
+					l.MatchStatus, l.MatchKind, paymentID)
+			}
+			log.Printf("import-bank-statement: import #%d, %d line(s), %d matched",
+				imp.ID, imp.LineCount, imp.MatchedCount)
+			return nil
+		})
+		return err
+	}
+}
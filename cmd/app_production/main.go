@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"os"
+	"time"
 
 	"github.com/pdcgo/san_collection/san_caches"
 	"github.com/pdcgo/san_collection/san_config"
@@ -33,6 +34,13 @@ func NewProjectConfig() *san_config.ProjectConfig {
 func NewApp(
 	serviceApiFunc ServiceApiFunc,
 	syncLegacyFunc SyncLegacyFunc,
+	pruneExactlyOnceFunc PruneExactlyOnceFunc,
+	replayEventsFunc ReplayEventsFunc,
+	expirePaymentsFunc ExpirePaymentsFunc,
+	importBankStatementFunc ImportBankStatementFunc,
+	dispatchOweLimitAlertsFunc DispatchOweLimitAlertsFunc,
+	exportOweLimitsFunc ExportOweLimitsFunc,
+	importOweLimitsFunc ImportOweLimitsFunc,
 ) *cli.Command {
 	return &cli.Command{
 		Name:   "run",
@@ -53,6 +61,121 @@ func NewApp(
 					},
 				},
 			},
+			{
+				Name:   "prune-exactly-once",
+				Action: cli.ActionFunc(pruneExactlyOnceFunc),
+				Flags: []cli.Flag{
+					&cli.DurationFlag{
+						Name:  "retention",
+						Value: 7 * 24 * time.Hour,
+					},
+					&cli.IntFlag{
+						Name:  "batch-size",
+						Value: 1000,
+					},
+					&cli.DurationFlag{
+						Name:  "batch-pause",
+						Value: 100 * time.Millisecond,
+					},
+					&cli.StringSliceFlag{
+						Name: "protect",
+					},
+					&cli.BoolFlag{
+						Name: "dry-run",
+					},
+				},
+			},
+			{
+				Name:   "replay-events",
+				Action: cli.ActionFunc(replayEventsFunc),
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:    "file",
+						Aliases: []string{"f"},
+					},
+					&cli.BoolFlag{
+						Name: "dry-run",
+					},
+					&cli.FloatFlag{
+						Name: "rate",
+					},
+					&cli.BoolFlag{
+						Name: "stop-on-error",
+					},
+					&cli.IntFlag{
+						Name: "from-offset",
+					},
+				},
+			},
+			{
+				Name:   "expire-payments",
+				Action: cli.ActionFunc(expirePaymentsFunc),
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name: "no-remind",
+					},
+				},
+			},
+			{
+				Name:   "import-bank-statement",
+				Action: cli.ActionFunc(importBankStatementFunc),
+				Flags: []cli.Flag{
+					&cli.Uint64Flag{
+						Name: "team-id",
+					},
+					&cli.StringFlag{
+						Name:    "file",
+						Aliases: []string{"f"},
+					},
+					&cli.StringFlag{
+						Name: "format",
+					},
+					&cli.IntFlag{
+						Name: "date-tolerance",
+					},
+				},
+			},
+			{
+				Name:   "dispatch-owe-limit-alerts",
+				Action: cli.ActionFunc(dispatchOweLimitAlertsFunc),
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name: "webhook-url",
+					},
+				},
+			},
+			{
+				Name:   "export-owe-limits",
+				Action: cli.ActionFunc(exportOweLimitsFunc),
+				Flags: []cli.Flag{
+					&cli.Uint64Flag{
+						Name: "team-id",
+					},
+					&cli.StringFlag{
+						Name:    "file",
+						Aliases: []string{"f"},
+					},
+				},
+			},
+			{
+				Name:   "import-owe-limits",
+				Action: cli.ActionFunc(importOweLimitsFunc),
+				Flags: []cli.Flag{
+					&cli.Uint64Flag{
+						Name: "team-id",
+					},
+					&cli.StringFlag{
+						Name:    "file",
+						Aliases: []string{"f"},
+					},
+					&cli.BoolFlag{
+						Name: "delete-missing",
+					},
+					&cli.BoolFlag{
+						Name: "dry-run",
+					},
+				},
+			},
 		},
 	}
 }
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"os"
+	"time"
+
+	"github.com/pdcgo/invoice_service/invoice_v2"
+	"github.com/urfave/cli/v3"
+	"gorm.io/gorm"
+)
+
+type ExportOweLimitsFunc cli.ActionFunc
+
+// NewExportOweLimitsFunc builds the `export-owe-limits` action: writes the custom owe
+// limits of --team-id as CSV to --file, or to stdout without one.
+func NewExportOweLimitsFunc(db *gorm.DB) ExportOweLimitsFunc {
+	return func(ctx context.Context, c *cli.Command) error {
+		teamID := c.Uint64("team-id")
+		if teamID == 0 {
+			return errors.New("--team-id is required")
+		}
+
+		var w io.Writer = os.Stdout
+		if path := c.String("file"); path != "" {
+			f, err := os.Create(path)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			w = f
+		}
+
+		n, err := invoice_v2.ExportOweLimits(db.WithContext(ctx), teamID, w)
+		if err != nil {
+			return err
+		}
+		log.Printf("export-owe-limits: %d custom limit(s) of team %d", n, teamID)
+		return nil
+	}
+}
+
+type ImportOweLimitsFunc cli.ActionFunc
+
+// NewImportOweLimitsFunc builds the `import-owe-limits` action: imports the CSV in
+// --file as the custom owe limits of --team-id and logs what every row does. With
+// --dry-run, or when a row does not validate, nothing is applied.
+func NewImportOweLimitsFunc(db *gorm.DB, oweLimitCache *invoice_v2.OweLimitCache) ImportOweLimitsFunc {
+	return func(ctx context.Context, c *cli.Command) error {
+		teamID := c.Uint64("team-id")
+		path := c.String("file")
+		if teamID == 0 || path == "" {
+			return errors.New("--team-id and --file are required")
+		}
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+
+		ctx, done := oweLimitCache.Track(ctx)
+		defer done()
+
+		var result *invoice_v2.OweLimitImportResult
+		err = db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			var err error
+			result, err = invoice_v2.ImportOweLimits(tx, invoice_v2.OweLimitImportInput{
+				TeamID:        teamID,
+				Content:       content,
+				DeleteMissing: c.Bool("delete-missing"),
+				DryRun:        c.Bool("dry-run"),
+			}, invoice_v2.SystemActorID, time.Now())
+			return err
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, ch := range result.Changes {
+			log.Printf("import-owe-limits: line %d team #%d %q %s threshold %.2f -> %.2f soft %.2f -> %.2f max age %d -> %d",
+				ch.Line, ch.ForTeamID, ch.TeamName, ch.Action,
+				ch.OldThreshold, ch.NewThreshold, ch.OldSoftThreshold, ch.NewSoftThreshold,
+				ch.OldMaxAgeDays, ch.NewMaxAgeDays)
+		}
+		for _, e := range result.Errors {
+			log.Printf("import-owe-limits: line %d: %s", e.Line, e.Message)
+		}
+		if len(result.Errors) > 0 {
+			return errors.New("import-owe-limits: file has errors, nothing applied")
+		}
+		log.Printf("import-owe-limits: %d change(s), applied: %t", len(result.Changes), result.Applied)
+		return nil
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/pdcgo/invoice_service"
+	"github.com/pdcgo/san_collection/san_config"
+	"github.com/urfave/cli/v3"
+	"gorm.io/gorm"
+)
+
+type PruneExactlyOnceFunc cli.ActionFunc
+
+// NewPruneExactlyOnceFunc builds the `prune-exactly-once` action: it deletes
+// invoice_exactly_once_logs rows older than --retention in --batch-size batches.
+// Subscriptions named by --protect (short names, e.g. invoice-selling-sub, resolved
+// against the project) are kept whatever their age — use it while a subscription is
+// replaying a backfill. --dry-run only counts what would be deleted. Safe to run on a
+// schedule: each batch is its own short statement.
+func NewPruneExactlyOnceFunc(db *gorm.DB, projectCfg *san_config.ProjectConfig) PruneExactlyOnceFunc {
+	return func(ctx context.Context, c *cli.Command) error {
+		policy := invoice_service.ExactlyOnceRetention{
+			Window:     c.Duration("retention"),
+			BatchSize:  int(c.Int("batch-size")),
+			BatchPause: c.Duration("batch-pause"),
+		}
+		for _, sub := range c.StringSlice("protect") {
+			policy.ProtectedSubscriptions = append(policy.ProtectedSubscriptions, projectCfg.PubsubSubscriberPath(sub))
+		}
+
+		now := time.Now()
+		if c.Bool("dry-run") {
+			n, err := invoice_service.CountExpiredExactlyOnceLogs(ctx, db, policy, now)
+			if err != nil {
+				return err
+			}
+			log.Printf("prune-exactly-once: dry run, %d row(s) older than %s would be deleted", n, now.Add(-policy.Window).Format(time.RFC3339))
+			return nil
+		}
+
+		res, err := invoice_service.PruneExactlyOnceLogs(ctx, db, policy, now)
+		if res != nil {
+			log.Printf("prune-exactly-once: cutoff %s, deleted %d row(s) in %d batch(es), kept %d protected row(s)",
+				res.Cutoff.Format(time.RFC3339), res.Deleted, res.Batches, res.Protected)
+		}
+		return err
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"github.com/pdcgo/invoice_service"
+	"github.com/pdcgo/san_collection/san_config"
+	"github.com/urfave/cli/v3"
+	"gorm.io/gorm"
+)
+
+type ReplayEventsFunc cli.ActionFunc
+
+// NewReplayEventsFunc builds the `replay-events` action: it reads JSONL events from
+// --file ("-" for stdin) and feeds them through the real push handler in order, e.g. to
+// onboard a new environment or recover from an outage. --dry-run applies each event in a
+// rolled-back transaction, --rate caps events per second, --stop-on-error aborts on the
+// first failure, and --from-offset resumes at a line offset (the summary prints the next
+// one). The inbox dedups already-applied events, so re-running a file is safe.
+func NewReplayEventsFunc(
+	db *gorm.DB,
+	projectCfg *san_config.ProjectConfig,
+	handler invoice_service.InvoicePushHandler,
+) ReplayEventsFunc {
+	return func(ctx context.Context, c *cli.Command) error {
+		path := c.String("file")
+		if path == "" {
+			return fmt.Errorf("--file is required")
+		}
+
+		var in io.Reader = os.Stdin
+		if path != "-" {
+			f, err := os.Open(path)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			in = f
+		}
+
+		opt := invoice_service.ReplayOptions{
+			DryRun:      c.Bool("dry-run"),
+			Rate:        c.Float("rate"),
+			StopOnError: c.Bool("stop-on-error"),
+			FromOffset:  int(c.Int("from-offset")),
+		}
+
+		summary, err := invoice_service.ReplayEvents(ctx, db, projectCfg, handler, in, opt)
+		if summary != nil {
+			mode := ""
+			if opt.DryRun {
+				mode = " (dry run)"
+			}
+			log.Printf("replay-events%s: read %d, posted %d, duplicate %d, skipped %d, failed %d, next offset %d",
+				mode, summary.Read, summary.Posted, summary.Duplicate, summary.Skipped, summary.Failed, summary.NextOffset)
+		}
+		if err != nil {
+			return err
+		}
+		if summary.Failed > 0 {
+			return fmt.Errorf("replay-events: %d event(s) failed", summary.Failed)
+		}
+		return nil
+	}
+}
@@ -8,6 +8,7 @@ import (
 
 	"github.com/google/wire"
 	"github.com/pdcgo/invoice_service"
+	"github.com/pdcgo/invoice_service/invoice_v2"
 	"github.com/pdcgo/shared/configs"
 	"github.com/pdcgo/shared/custom_connect"
 	"github.com/urfave/cli/v3"
@@ -23,11 +24,19 @@ func InitializeApp() (*cli.Command, error) {
 		NewRedisDatabase,
 		NewCacheManager,
 		NewProjectConfig,
+		invoice_v2.NewOweLimitCache,
 		invoice_service.NewInvoicePushHandler,
 		invoice_service.NewInvoicePushHttpHandler,
 		invoice_service.NewRegister,
 		NewServiceApiFunc,
 		NewSyncLegacyFunc,
+		NewPruneExactlyOnceFunc,
+		NewReplayEventsFunc,
+		NewExpirePaymentsFunc,
+		NewImportBankStatementFunc,
+		NewDispatchOweLimitAlertsFunc,
+		NewExportOweLimitsFunc,
+		NewImportOweLimitsFunc,
 		NewApp,
 	)
 
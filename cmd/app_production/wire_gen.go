@@ -8,6 +8,7 @@ package main
 
 import (
 	"github.com/pdcgo/invoice_service"
+	"github.com/pdcgo/invoice_service/invoice_v2"
 	"github.com/pdcgo/shared/configs"
 	"github.com/pdcgo/shared/custom_connect"
 	"github.com/urfave/cli/v3"
@@ -33,12 +34,20 @@ func InitializeApp() (*cli.Command, error) {
 	client := NewRedisDatabase(appConfig)
 	cacheManager := NewCacheManager(client)
 	projectConfig := NewProjectConfig()
-	invoicePushHandler := invoice_service.NewInvoicePushHandler(db, projectConfig)
+	oweLimitCache := invoice_v2.NewOweLimitCache(cacheManager)
+	invoicePushHandler := invoice_service.NewInvoicePushHandler(db, projectConfig, oweLimitCache)
 	invoicePushHttpHandler := invoice_service.NewInvoicePushHttpHandler(invoicePushHandler)
-	registerHandler := invoice_service.NewRegister(serveMux, db, appConfig, defaultInterceptor, cacheManager, invoicePushHttpHandler)
+	registerHandler := invoice_service.NewRegister(serveMux, db, appConfig, defaultInterceptor, cacheManager, projectConfig, invoicePushHttpHandler, oweLimitCache)
 	registerReflectFunc := custom_connect.NewRegisterReflect(serveMux)
 	serviceApiFunc := NewServiceApiFunc(serveMux, registerHandler, registerReflectFunc)
 	syncLegacyFunc := NewSyncLegacyFunc(db, appConfig)
-	command := NewApp(serviceApiFunc, syncLegacyFunc)
+	pruneExactlyOnceFunc := NewPruneExactlyOnceFunc(db, projectConfig)
+	replayEventsFunc := NewReplayEventsFunc(db, projectConfig, invoicePushHandler)
+	expirePaymentsFunc := NewExpirePaymentsFunc(db, oweLimitCache)
+	importBankStatementFunc := NewImportBankStatementFunc(db)
+	dispatchOweLimitAlertsFunc := NewDispatchOweLimitAlertsFunc(db)
+	exportOweLimitsFunc := NewExportOweLimitsFunc(db)
+	importOweLimitsFunc := NewImportOweLimitsFunc(db, oweLimitCache)
+	command := NewApp(serviceApiFunc, syncLegacyFunc, pruneExactlyOnceFunc, replayEventsFunc, expirePaymentsFunc, importBankStatementFunc, dispatchOweLimitAlertsFunc, exportOweLimitsFunc, importOweLimitsFunc)
 	return command, nil
 }
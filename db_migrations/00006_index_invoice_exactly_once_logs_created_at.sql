@@ -0,0 +1,12 @@
+-- +goose Up
+-- +goose StatementBegin
+-- The retention job deletes inbox rows by age; without this index every prune batch
+-- scans the whole table.
+CREATE INDEX IF NOT EXISTS idx_invoice_exactly_once_logs_created_at
+    ON invoice_exactly_once_logs (created_at);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_invoice_exactly_once_logs_created_at;
+-- +goose StatementEnd
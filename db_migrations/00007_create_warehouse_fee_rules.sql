@@ -0,0 +1,46 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE warehouse_fee_rules (
+    id              BIGSERIAL   PRIMARY KEY,
+    warehouse_id    BIGINT      NOT NULL,
+    name            TEXT        NOT NULL,
+    priority        INTEGER     NOT NULL DEFAULT 0,
+    active          BOOLEAN     NOT NULL DEFAULT TRUE,
+    current_version INTEGER     NOT NULL,
+    created_by_id   BIGINT      NOT NULL,
+    created_at      TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at      TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE INDEX idx_warehouse_fee_rules_warehouse ON warehouse_fee_rules (warehouse_id, active, priority DESC, id);
+
+-- Versions are append-only: an edit inserts (rule_id, current_version + 1).
+CREATE TABLE warehouse_fee_rule_versions (
+    rule_id         BIGINT           NOT NULL,
+    version         INTEGER          NOT NULL,
+    order_from      TEXT,
+    for_team_id     BIGINT,
+    min_items       INTEGER          NOT NULL DEFAULT 0,
+    max_items       INTEGER          NOT NULL DEFAULT 0,
+    base_fee        DOUBLE PRECISION NOT NULL DEFAULT 0,
+    per_item_fee    DOUBLE PRECISION NOT NULL DEFAULT 0,
+    created_by_id   BIGINT           NOT NULL,
+    created_at      TIMESTAMPTZ      NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (rule_id, version),
+    CONSTRAINT fk_warehouse_fee_rule_versions_rule
+        FOREIGN KEY (rule_id) REFERENCES warehouse_fee_rules (id)
+);
+
+-- Attribution of rule-priced WAREHOUSE_FEE legs; NULL for fees taken from orders.warehouse_fee.
+ALTER TABLE balance_change_order_sources
+    ADD COLUMN fee_rule_id      BIGINT,
+    ADD COLUMN fee_rule_version INTEGER;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE balance_change_order_sources
+    DROP COLUMN IF EXISTS fee_rule_version,
+    DROP COLUMN IF EXISTS fee_rule_id;
+DROP TABLE IF EXISTS warehouse_fee_rule_versions;
+DROP TABLE IF EXISTS warehouse_fee_rules;
+-- +goose StatementEnd
@@ -0,0 +1,48 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE stock_compensations (
+    id                 BIGSERIAL        PRIMARY KEY,
+    warehouse_id       BIGINT           NOT NULL,
+    team_id            BIGINT           NOT NULL,
+    type               INTEGER          NOT NULL,
+    status             INTEGER          NOT NULL,
+    valuation          INTEGER          NOT NULL,
+    inv_transaction_id BIGINT,
+    inv_tx_item_id     BIGINT,
+    sku_id             TEXT,
+    product_name       TEXT,
+    count              INTEGER          NOT NULL DEFAULT 0,
+    amount             DOUBLE PRECISION NOT NULL,
+    note               TEXT,
+    dispute_reason     TEXT,
+    proposed_by_id     BIGINT           NOT NULL,
+    reviewed_by_id     BIGINT,
+    created_at         TIMESTAMPTZ      NOT NULL DEFAULT NOW(),
+    reviewed_at        TIMESTAMPTZ,
+    updated_at         TIMESTAMPTZ      NOT NULL DEFAULT NOW()
+);
+CREATE INDEX idx_stock_compensations_warehouse_id ON stock_compensations (warehouse_id);
+CREATE INDEX idx_stock_compensations_team_id      ON stock_compensations (team_id);
+CREATE INDEX idx_stock_compensations_status       ON stock_compensations (status);
+-- One event-proposed compensation per problem item and type; manual rows have no item
+-- (NULLs are distinct) and are not constrained.
+CREATE UNIQUE INDEX uniq_stock_compensation_item ON stock_compensations (type, inv_tx_item_id);
+
+CREATE TABLE warehouse_compensation_policies (
+    id            BIGSERIAL        PRIMARY KEY,
+    warehouse_id  BIGINT           NOT NULL,
+    type          INTEGER          NOT NULL,
+    valuation     INTEGER          NOT NULL,
+    fixed_rate    DOUBLE PRECISION NOT NULL DEFAULT 0,
+    updated_by_id BIGINT           NOT NULL,
+    created_at    TIMESTAMPTZ      NOT NULL DEFAULT NOW(),
+    updated_at    TIMESTAMPTZ      NOT NULL DEFAULT NOW()
+);
+CREATE UNIQUE INDEX uniq_warehouse_compensation_policy ON warehouse_compensation_policies (warehouse_id, type);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS warehouse_compensation_policies;
+DROP TABLE IF EXISTS stock_compensations;
+-- +goose StatementEnd
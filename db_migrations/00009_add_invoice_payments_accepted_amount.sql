@@ -0,0 +1,15 @@
+-- +goose Up
+-- +goose StatementBegin
+-- accepted_amount stays NULL on payments accepted before partial acceptance; readers
+-- use COALESCE(accepted_amount, amount).
+ALTER TABLE invoice_payments
+    ADD COLUMN accepted_amount DOUBLE PRECISION,
+    ADD COLUMN partial_reason  TEXT;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE invoice_payments
+    DROP COLUMN IF EXISTS partial_reason,
+    DROP COLUMN IF EXISTS accepted_amount;
+-- +goose StatementEnd
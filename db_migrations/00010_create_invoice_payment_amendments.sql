@@ -0,0 +1,29 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE invoice_payments
+    ADD COLUMN canceled_at TIMESTAMPTZ;
+
+CREATE TABLE invoice_payment_amendments (
+    id                   BIGSERIAL        PRIMARY KEY,
+    payment_id           BIGINT           NOT NULL,
+    previous_amount      DOUBLE PRECISION NOT NULL,
+    new_amount           DOUBLE PRECISION NOT NULL,
+    previous_document_id TEXT,
+    new_document_id      TEXT,
+    previous_note        TEXT,
+    new_note             TEXT,
+    reason               TEXT,
+    amended_by_id        BIGINT           NOT NULL,
+    created_at           TIMESTAMPTZ      NOT NULL DEFAULT NOW(),
+    CONSTRAINT fk_invoice_payment_amendments_payment
+        FOREIGN KEY (payment_id) REFERENCES invoice_payments (id)
+);
+CREATE INDEX idx_invoice_payment_amendments_payment_id ON invoice_payment_amendments (payment_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS invoice_payment_amendments;
+ALTER TABLE invoice_payments
+    DROP COLUMN IF EXISTS canceled_at;
+-- +goose StatementEnd
@@ -0,0 +1,28 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE invoice_payments
+    ADD COLUMN reversed_at     TIMESTAMPTZ,
+    ADD COLUMN reversed_by_id  BIGINT,
+    ADD COLUMN reversal_reason TEXT;
+
+CREATE TABLE balance_change_payment_sources (
+    balance_change_log_id BIGINT      PRIMARY KEY,
+    payment_id            BIGINT      NOT NULL,
+    reversal              BOOLEAN     NOT NULL DEFAULT FALSE,
+    created_at            TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    CONSTRAINT fk_balance_change_payment_sources_log
+        FOREIGN KEY (balance_change_log_id) REFERENCES balance_change_logs (id),
+    CONSTRAINT fk_balance_change_payment_sources_payment
+        FOREIGN KEY (payment_id) REFERENCES invoice_payments (id)
+);
+CREATE INDEX idx_balance_change_payment_sources_payment_id ON balance_change_payment_sources (payment_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS balance_change_payment_sources;
+ALTER TABLE invoice_payments
+    DROP COLUMN IF EXISTS reversed_at,
+    DROP COLUMN IF EXISTS reversed_by_id,
+    DROP COLUMN IF EXISTS reversal_reason;
+-- +goose StatementEnd
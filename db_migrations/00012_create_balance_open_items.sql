@@ -0,0 +1,68 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE balance_open_items (
+    balance_change_log_id BIGINT           PRIMARY KEY,
+    team_id               BIGINT           NOT NULL,
+    for_team_id           BIGINT           NOT NULL,
+    change_type           INTEGER          NOT NULL,
+    amount                DOUBLE PRECISION NOT NULL,
+    remaining             DOUBLE PRECISION NOT NULL,
+    created_at            TIMESTAMPTZ      NOT NULL DEFAULT NOW(),
+    closed_at             TIMESTAMPTZ,
+    updated_at            TIMESTAMPTZ      NOT NULL DEFAULT NOW(),
+    CONSTRAINT fk_balance_open_items_log
+        FOREIGN KEY (balance_change_log_id) REFERENCES balance_change_logs (id)
+);
+CREATE INDEX idx_balance_open_items_pair ON balance_open_items (team_id, for_team_id);
+CREATE INDEX idx_balance_open_items_open ON balance_open_items (team_id, for_team_id, balance_change_log_id)
+    WHERE remaining > 0;
+
+CREATE TABLE balance_open_item_allocations (
+    id            BIGSERIAL        PRIMARY KEY,
+    open_item_id  BIGINT           NOT NULL,
+    credit_log_id BIGINT           NOT NULL,
+    payment_id    BIGINT,
+    amount        DOUBLE PRECISION NOT NULL,
+    created_at    TIMESTAMPTZ      NOT NULL DEFAULT NOW(),
+    released_at   TIMESTAMPTZ,
+    CONSTRAINT fk_balance_open_item_allocations_item
+        FOREIGN KEY (open_item_id) REFERENCES balance_open_items (balance_change_log_id),
+    CONSTRAINT fk_balance_open_item_allocations_credit
+        FOREIGN KEY (credit_log_id) REFERENCES balance_change_logs (id)
+);
+CREATE INDEX idx_balance_open_item_allocations_open_item_id  ON balance_open_item_allocations (open_item_id);
+CREATE INDEX idx_balance_open_item_allocations_credit_log_id ON balance_open_item_allocations (credit_log_id);
+CREATE INDEX idx_balance_open_item_allocations_payment_id    ON balance_open_item_allocations (payment_id);
+
+CREATE TABLE invoice_payment_selections (
+    payment_id            BIGINT           NOT NULL,
+    balance_change_log_id BIGINT           NOT NULL,
+    seq                   INTEGER          NOT NULL,
+    amount                DOUBLE PRECISION NOT NULL,
+    created_at            TIMESTAMPTZ      NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (payment_id, balance_change_log_id),
+    CONSTRAINT fk_invoice_payment_selections_payment
+        FOREIGN KEY (payment_id) REFERENCES invoice_payments (id),
+    CONSTRAINT fk_invoice_payment_selections_item
+        FOREIGN KEY (balance_change_log_id) REFERENCES balance_open_items (balance_change_log_id)
+);
+
+-- Opening items: every PAYABLE account currently in debt carries its balance as
+-- one ADJUSTMENT (1) item keyed by the account's latest debit leg.
+INSERT INTO balance_open_items (balance_change_log_id, team_id, for_team_id, change_type, amount, remaining, created_at, updated_at)
+SELECT DISTINCT ON (l.team_id, l.for_team_id)
+       l.id, l.team_id, l.for_team_id, 1, -b.balance, -b.balance, l.created_at, NOW()
+FROM team_balances b
+JOIN balance_change_logs l
+  ON l.team_id = b.team_id AND l.for_team_id = b.for_team_id
+ AND l.balance_type = b.balance_type AND l.change_amount < 0
+WHERE b.balance_type = 1 AND b.balance < 0
+ORDER BY l.team_id, l.for_team_id, l.id DESC;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS invoice_payment_selections;
+DROP TABLE IF EXISTS balance_open_item_allocations;
+DROP TABLE IF EXISTS balance_open_items;
+-- +goose StatementEnd
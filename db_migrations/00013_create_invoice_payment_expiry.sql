@@ -0,0 +1,28 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE invoice_payments
+    ADD COLUMN expired_at  TIMESTAMPTZ,
+    ADD COLUMN reminded_at TIMESTAMPTZ;
+
+CREATE TABLE invoice_payment_expiry_configs (
+    team_id            BIGINT      PRIMARY KEY,
+    expire_after_days  INTEGER     NOT NULL,
+    remind_before_days INTEGER     NOT NULL DEFAULT 0,
+    updated_by_id      BIGINT      NOT NULL,
+    created_at         TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at         TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- the sweeper scans pending payments per creditor
+CREATE INDEX idx_invoice_payments_pending_for_team ON invoice_payments (for_team_id, created_at)
+    WHERE status = 1;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_invoice_payments_pending_for_team;
+DROP TABLE IF EXISTS invoice_payment_expiry_configs;
+ALTER TABLE invoice_payments
+    DROP COLUMN IF EXISTS expired_at,
+    DROP COLUMN IF EXISTS reminded_at;
+-- +goose StatementEnd
@@ -0,0 +1,27 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE invoice_refunds (
+    id              BIGSERIAL        PRIMARY KEY,
+    team_id         BIGINT           NOT NULL,
+    for_team_id     BIGINT           NOT NULL,
+    document_id     TEXT,
+    amount          DOUBLE PRECISION NOT NULL,
+    note            TEXT,
+    status          INTEGER          NOT NULL,
+    reject_reason   TEXT,
+    created_by_id   BIGINT           NOT NULL,
+    completed_by_id BIGINT,
+    created_at      TIMESTAMPTZ      NOT NULL DEFAULT NOW(),
+    confirmed_at    TIMESTAMPTZ,
+    rejected_at     TIMESTAMPTZ,
+    updated_at      TIMESTAMPTZ      NOT NULL DEFAULT NOW()
+);
+CREATE INDEX idx_invoice_refunds_team_id     ON invoice_refunds (team_id);
+CREATE INDEX idx_invoice_refunds_for_team_id ON invoice_refunds (for_team_id);
+CREATE INDEX idx_invoice_refunds_status      ON invoice_refunds (status);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS invoice_refunds;
+-- +goose StatementEnd
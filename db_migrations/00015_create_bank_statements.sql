@@ -0,0 +1,43 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE bank_statement_imports (
+    id            BIGSERIAL   PRIMARY KEY,
+    team_id       BIGINT      NOT NULL,
+    content_hash  TEXT        NOT NULL,
+    format        TEXT        NOT NULL,
+    file_name     TEXT,
+    line_count    INTEGER     NOT NULL,
+    matched_count INTEGER     NOT NULL,
+    created_by_id BIGINT      NOT NULL,
+    created_at    TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE UNIQUE INDEX idx_bank_statement_imports_content ON bank_statement_imports (team_id, content_hash);
+
+CREATE TABLE bank_statement_lines (
+    id           BIGSERIAL        PRIMARY KEY,
+    import_id    BIGINT           NOT NULL,
+    team_id      BIGINT           NOT NULL,
+    line_no      INTEGER          NOT NULL,
+    date         TIMESTAMPTZ      NOT NULL,
+    amount       DOUBLE PRECISION NOT NULL,
+    reference    TEXT,
+    description  TEXT,
+    match_status INTEGER          NOT NULL,
+    match_kind   INTEGER          NOT NULL DEFAULT 0,
+    payment_id   BIGINT,
+    created_at   TIMESTAMPTZ      NOT NULL DEFAULT NOW(),
+    CONSTRAINT fk_bank_statement_lines_import
+        FOREIGN KEY (import_id) REFERENCES bank_statement_imports (id),
+    CONSTRAINT fk_bank_statement_lines_payment
+        FOREIGN KEY (payment_id) REFERENCES invoice_payments (id)
+);
+CREATE INDEX idx_bank_statement_lines_import_id  ON bank_statement_lines (import_id);
+CREATE INDEX idx_bank_statement_lines_team_id    ON bank_statement_lines (team_id);
+CREATE INDEX idx_bank_statement_lines_payment_id ON bank_statement_lines (payment_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS bank_statement_lines;
+DROP TABLE IF EXISTS bank_statement_imports;
+-- +goose StatementEnd
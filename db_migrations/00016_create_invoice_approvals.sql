@@ -0,0 +1,44 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE invoice_approval_policies (
+    team_id              BIGINT           PRIMARY KEY,
+    payment_threshold    DOUBLE PRECISION NOT NULL DEFAULT 0,
+    adjustment_threshold DOUBLE PRECISION NOT NULL DEFAULT 0,
+    updated_by_id        BIGINT           NOT NULL,
+    created_at           TIMESTAMPTZ      NOT NULL DEFAULT NOW(),
+    updated_at           TIMESTAMPTZ      NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE invoice_approvals (
+    id              BIGSERIAL        PRIMARY KEY,
+    team_id         BIGINT           NOT NULL,
+    for_team_id     BIGINT           NOT NULL,
+    kind            INTEGER          NOT NULL,
+    status          INTEGER          NOT NULL,
+    amount          DOUBLE PRECISION NOT NULL,
+    payment_id      BIGINT,
+    balance_type    INTEGER,
+    change_type     INTEGER,
+    note            TEXT,
+    requested_by_id BIGINT           NOT NULL,
+    requested_at    TIMESTAMPTZ      NOT NULL DEFAULT NOW(),
+    decided_by_id   BIGINT,
+    decided_at      TIMESTAMPTZ,
+    decision_note   TEXT,
+    updated_at      TIMESTAMPTZ      NOT NULL DEFAULT NOW(),
+    CONSTRAINT fk_invoice_approvals_payment
+        FOREIGN KEY (payment_id) REFERENCES invoice_payments (id)
+);
+CREATE INDEX idx_invoice_approvals_team_id    ON invoice_approvals (team_id);
+CREATE INDEX idx_invoice_approvals_status     ON invoice_approvals (status);
+CREATE INDEX idx_invoice_approvals_payment_id ON invoice_approvals (payment_id);
+-- at most one open approval per payment
+CREATE UNIQUE INDEX idx_invoice_approvals_pending_payment
+    ON invoice_approvals (payment_id) WHERE status = 1;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS invoice_approvals;
+DROP TABLE IF EXISTS invoice_approval_policies;
+-- +goose StatementEnd
@@ -0,0 +1,28 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE invoice_bulk_payments (
+    id            BIGSERIAL        PRIMARY KEY,
+    team_id       BIGINT           NOT NULL,
+    document_id   TEXT             NOT NULL,
+    note          TEXT,
+    total_amount  DOUBLE PRECISION NOT NULL,
+    line_count    INTEGER          NOT NULL,
+    created_by_id BIGINT           NOT NULL,
+    created_at    TIMESTAMPTZ      NOT NULL DEFAULT NOW()
+);
+CREATE INDEX idx_invoice_bulk_payments_team_id ON invoice_bulk_payments (team_id);
+
+ALTER TABLE invoice_payments
+    ADD COLUMN bulk_payment_id BIGINT,
+    ADD CONSTRAINT fk_invoice_payments_bulk_payment
+        FOREIGN KEY (bulk_payment_id) REFERENCES invoice_bulk_payments (id);
+CREATE INDEX idx_invoice_payments_bulk_payment_id ON invoice_payments (bulk_payment_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_invoice_payments_bulk_payment_id;
+ALTER TABLE invoice_payments DROP CONSTRAINT IF EXISTS fk_invoice_payments_bulk_payment;
+ALTER TABLE invoice_payments DROP COLUMN IF EXISTS bulk_payment_id;
+DROP TABLE IF EXISTS invoice_bulk_payments;
+-- +goose StatementEnd
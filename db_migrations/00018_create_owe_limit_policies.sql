@@ -0,0 +1,15 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE owe_limit_policies (
+    team_id                BIGINT      PRIMARY KEY,
+    count_pending_payments BOOLEAN     NOT NULL DEFAULT FALSE,
+    updated_by_id          BIGINT      NOT NULL,
+    created_at             TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at             TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS owe_limit_policies;
+-- +goose StatementEnd
@@ -0,0 +1,23 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE owe_limit_overrides (
+    id            BIGSERIAL        PRIMARY KEY,
+    team_id       BIGINT           NOT NULL,
+    for_team_id   BIGINT           NOT NULL,
+    threshold     DOUBLE PRECISION NOT NULL,
+    starts_at     TIMESTAMPTZ      NOT NULL,
+    ends_at       TIMESTAMPTZ      NOT NULL,
+    reason        TEXT,
+    created_by_id BIGINT           NOT NULL,
+    created_at    TIMESTAMPTZ      NOT NULL DEFAULT NOW(),
+    revoked_by_id BIGINT,
+    revoked_at    TIMESTAMPTZ,
+    CONSTRAINT chk_owe_limit_overrides_window CHECK (ends_at > starts_at)
+);
+CREATE INDEX idx_owe_limit_overrides_pair ON owe_limit_overrides (team_id, for_team_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS owe_limit_overrides;
+-- +goose StatementEnd
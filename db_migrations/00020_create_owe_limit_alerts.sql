@@ -0,0 +1,40 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE owe_limit_alert_levels (
+    team_id BIGINT  NOT NULL,
+    percent INTEGER NOT NULL CHECK (percent > 0),
+    PRIMARY KEY (team_id, percent)
+);
+
+CREATE TABLE owe_limit_alert_states (
+    team_id     BIGINT      NOT NULL,
+    for_team_id BIGINT      NOT NULL,
+    level       INTEGER     NOT NULL DEFAULT 0,
+    updated_at  TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (team_id, for_team_id)
+);
+
+CREATE TABLE owe_limit_alerts (
+    id             BIGSERIAL        PRIMARY KEY,
+    team_id        BIGINT           NOT NULL,
+    for_team_id    BIGINT           NOT NULL,
+    level          INTEGER          NOT NULL,
+    threshold      DOUBLE PRECISION NOT NULL,
+    projected_debt DOUBLE PRECISION NOT NULL,
+    rule           INTEGER          NOT NULL,
+    created_at     TIMESTAMPTZ      NOT NULL DEFAULT NOW(),
+    notified_at    TIMESTAMPTZ,
+    attempts       INTEGER          NOT NULL DEFAULT 0,
+    last_error     TEXT
+);
+CREATE INDEX idx_owe_limit_alerts_team_id ON owe_limit_alerts (team_id);
+CREATE INDEX idx_owe_limit_alerts_for_team_id ON owe_limit_alerts (for_team_id);
+CREATE INDEX idx_owe_limit_alerts_undelivered ON owe_limit_alerts (id) WHERE notified_at IS NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS owe_limit_alerts;
+DROP TABLE IF EXISTS owe_limit_alert_states;
+DROP TABLE IF EXISTS owe_limit_alert_levels;
+-- +goose StatementEnd
@@ -0,0 +1,22 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE owe_limit_configuration_history (
+    id               BIGSERIAL        PRIMARY KEY,
+    configuration_id BIGINT           NOT NULL,
+    team_id          BIGINT           NOT NULL,
+    for_team_id      BIGINT,
+    is_default       BOOLEAN          NOT NULL,
+    action           INTEGER          NOT NULL,
+    old_threshold    DOUBLE PRECISION,
+    new_threshold    DOUBLE PRECISION,
+    changed_by_id    BIGINT           NOT NULL,
+    changed_at       TIMESTAMPTZ      NOT NULL DEFAULT NOW()
+);
+CREATE INDEX idx_owe_limit_configuration_history_team_id ON owe_limit_configuration_history (team_id);
+CREATE INDEX idx_owe_limit_configuration_history_for_team_id ON owe_limit_configuration_history (for_team_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS owe_limit_configuration_history;
+-- +goose StatementEnd
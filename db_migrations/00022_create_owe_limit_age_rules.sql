@@ -0,0 +1,21 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE owe_limit_age_rules (
+    configuration_id BIGINT      PRIMARY KEY,
+    max_age_days     BIGINT      NOT NULL CHECK (max_age_days > 0),
+    updated_at       TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+ALTER TABLE owe_limit_configuration_history
+    ADD COLUMN old_max_age_days BIGINT,
+    ADD COLUMN new_max_age_days BIGINT;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE owe_limit_configuration_history
+    DROP COLUMN IF EXISTS new_max_age_days,
+    DROP COLUMN IF EXISTS old_max_age_days;
+
+DROP TABLE IF EXISTS owe_limit_age_rules;
+-- +goose StatementEnd
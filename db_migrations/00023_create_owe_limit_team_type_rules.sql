@@ -0,0 +1,23 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE owe_limit_team_type_rules (
+    team_id       BIGINT           NOT NULL,
+    team_type     VARCHAR(32)      NOT NULL,
+    threshold     DOUBLE PRECISION NOT NULL,
+    max_age_days  BIGINT           NOT NULL DEFAULT 0 CHECK (max_age_days >= 0),
+    updated_by_id BIGINT           NOT NULL,
+    updated_at    TIMESTAMPTZ      NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (team_id, team_type)
+);
+
+ALTER TABLE owe_limit_configuration_history
+    ADD COLUMN team_type VARCHAR(32) NOT NULL DEFAULT '';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE owe_limit_configuration_history
+    DROP COLUMN IF EXISTS team_type;
+
+DROP TABLE IF EXISTS owe_limit_team_type_rules;
+-- +goose StatementEnd
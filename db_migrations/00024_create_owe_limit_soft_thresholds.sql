@@ -0,0 +1,27 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE owe_limit_soft_thresholds (
+    configuration_id BIGINT           PRIMARY KEY,
+    soft_threshold   DOUBLE PRECISION NOT NULL CHECK (soft_threshold > 0),
+    updated_at       TIMESTAMPTZ      NOT NULL DEFAULT NOW()
+);
+
+ALTER TABLE owe_limit_team_type_rules
+    ADD COLUMN soft_threshold DOUBLE PRECISION NOT NULL DEFAULT 0 CHECK (soft_threshold >= 0);
+
+ALTER TABLE owe_limit_configuration_history
+    ADD COLUMN old_soft_threshold DOUBLE PRECISION,
+    ADD COLUMN new_soft_threshold DOUBLE PRECISION;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE owe_limit_configuration_history
+    DROP COLUMN IF EXISTS new_soft_threshold,
+    DROP COLUMN IF EXISTS old_soft_threshold;
+
+ALTER TABLE owe_limit_team_type_rules
+    DROP COLUMN IF EXISTS soft_threshold;
+
+DROP TABLE IF EXISTS owe_limit_soft_thresholds;
+-- +goose StatementEnd
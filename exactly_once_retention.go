@@ -0,0 +1,139 @@
+package invoice_service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/pdcgo/invoice_service/invoice_models"
+	"gorm.io/gorm"
+)
+
+// ExactlyOnceRetention is the retention policy for the invoice_exactly_once_logs inbox.
+// A row only has to outlive the Pub/Sub redelivery window of its message, so anything
+// older than Window can go. Rows of ProtectedSubscriptions (full subscription paths, e.g.
+// a subscription still replaying a backfill) are never pruned, whatever their age.
+type ExactlyOnceRetention struct {
+	Window                 time.Duration
+	BatchSize              int
+	BatchPause             time.Duration
+	ProtectedSubscriptions []string
+}
+
+// ExactlyOncePruneResult reports what a prune run did. Batches counts the batches that
+// deleted rows; Protected counts the rows past the window that were kept because their
+// subscription is protected.
+type ExactlyOncePruneResult struct {
+	Cutoff    time.Time
+	Deleted   int64
+	Batches   int
+	Protected int64
+}
+
+// pruneExactlyOnceBatchSQL deletes one batch of expired inbox rows. The inner SELECT picks
+// at most `limit` primary keys, so each statement is short and only locks the rows it
+// deletes; SKIP LOCKED lets it step over rows a live push transaction is holding.
+//
+// Three positional ? params: cutoff, protected subscriptions, limit. The protected list is
+// never empty (pruneScope pads it) so `NOT IN ?` stays valid SQL.
+const pruneExactlyOnceBatchSQL = `
+DELETE FROM invoice_exactly_once_logs
+WHERE (id, subscription) IN (
+	SELECT id, subscription
+	FROM invoice_exactly_once_logs
+	WHERE created_at < ?
+	  AND subscription NOT IN ?
+	LIMIT ?
+	FOR UPDATE SKIP LOCKED
+)
+`
+
+// PruneExactlyOnceLogs deletes inbox rows older than the retention window in small
+// batches, each in its own short statement (no long-running transaction), pausing
+// BatchPause between batches. It stops when a batch deletes nothing or ctx is done. A
+// short batch is not the end: SKIP LOCKED may have stepped over rows still to go.
+func PruneExactlyOnceLogs(
+	ctx context.Context,
+	db *gorm.DB,
+	policy ExactlyOnceRetention,
+	now time.Time,
+) (*ExactlyOncePruneResult, error) {
+	if policy.Window <= 0 {
+		return nil, errors.New("retention window must be greater than zero")
+	}
+	if policy.BatchSize <= 0 {
+		return nil, errors.New("batch size must be greater than zero")
+	}
+
+	result := &ExactlyOncePruneResult{Cutoff: now.Add(-policy.Window)}
+	protected := pruneScope(policy.ProtectedSubscriptions)
+	db = db.WithContext(ctx)
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return result, err
+		}
+		res := db.Exec(pruneExactlyOnceBatchSQL, result.Cutoff, protected, policy.BatchSize)
+		if res.Error != nil {
+			return result, res.Error
+		}
+		if res.RowsAffected == 0 {
+			break
+		}
+		result.Deleted += res.RowsAffected
+		result.Batches++
+
+		if policy.BatchPause > 0 {
+			select {
+			case <-ctx.Done():
+				return result, ctx.Err()
+			case <-time.After(policy.BatchPause):
+			}
+		}
+	}
+
+	if len(policy.ProtectedSubscriptions) > 0 {
+		err := db.
+			Model(&invoice_models.InvoiceExactlyOnceLog{}).
+			Where("created_at < ?", result.Cutoff).
+			Where("subscription IN ?", policy.ProtectedSubscriptions).
+			Count(&result.Protected).
+			Error
+		if err != nil {
+			return result, err
+		}
+	}
+
+	return result, nil
+}
+
+// CountExpiredExactlyOnceLogs returns how many rows a prune run with this policy would
+// delete, without deleting anything (dry run).
+func CountExpiredExactlyOnceLogs(
+	ctx context.Context,
+	db *gorm.DB,
+	policy ExactlyOnceRetention,
+	now time.Time,
+) (int64, error) {
+	if policy.Window <= 0 {
+		return 0, errors.New("retention window must be greater than zero")
+	}
+	var n int64
+	err := db.
+		WithContext(ctx).
+		Model(&invoice_models.InvoiceExactlyOnceLog{}).
+		Where("created_at < ?", now.Add(-policy.Window)).
+		Where("subscription NOT IN ?", pruneScope(policy.ProtectedSubscriptions)).
+		Count(&n).
+		Error
+	return n, err
+}
+
+// pruneScope returns the protected subscriptions for a `NOT IN ?` filter, padded with an
+// empty string (never a real subscription path) when there are none.
+func pruneScope(protected []string) []string {
+	if len(protected) == 0 {
+		return []string{""}
+	}
+	return protected
+}
@@ -0,0 +1,92 @@
+package invoice_service_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pdcgo/invoice_service"
+	"github.com/pdcgo/invoice_service/invoice_models"
+	"github.com/pdcgo/shared/pkg/moretest"
+	"github.com/pdcgo/shared/pkg/moretest/moretest_mock"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+// TestPruneExactlyOnceLogs covers the inbox retention job: rows past the window are
+// deleted in batches, fresh rows survive, and a protected (backfilling) subscription keeps
+// its rows whatever their age.
+func TestPruneExactlyOnceLogs(t *testing.T) {
+	var scenario moretest_mock.DbScenario
+
+	moretest.Suite(t, "prune exactly once logs",
+		moretest.SetupListFunc{
+			moretest_mock.MockPostgresDatabase(&scenario),
+		},
+		func(t *testing.T) {
+			scenario(t, func(db *gorm.DB) {
+				assert.NoError(t, db.AutoMigrate(&invoice_models.InvoiceExactlyOnceLog{}))
+
+				now := time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC)
+				old := now.Add(-10 * 24 * time.Hour)
+				fresh := now.Add(-time.Hour)
+
+				rows := []*invoice_models.InvoiceExactlyOnceLog{
+					{ID: "old-1", Subscription: "sub-selling", CreatedAt: old},
+					{ID: "old-2", Subscription: "sub-selling", CreatedAt: old},
+					{ID: "old-3", Subscription: "sub-stock", CreatedAt: old},
+					{ID: "old-4", Subscription: "sub-backfill", CreatedAt: old},
+					{ID: "new-1", Subscription: "sub-selling", CreatedAt: fresh},
+				}
+				assert.NoError(t, db.Create(&rows).Error)
+
+				policy := invoice_service.ExactlyOnceRetention{
+					Window:                 7 * 24 * time.Hour,
+					BatchSize:              2,
+					ProtectedSubscriptions: []string{"sub-backfill"},
+				}
+				remaining := func() []string {
+					var ids []string
+					assert.NoError(t, db.Model(&invoice_models.InvoiceExactlyOnceLog{}).Order("id").Pluck("id", &ids).Error)
+					return ids
+				}
+
+				t.Run("dry run counts without deleting", func(t *testing.T) {
+					n, err := invoice_service.CountExpiredExactlyOnceLogs(context.Background(), db, policy, now)
+					assert.NoError(t, err)
+					assert.Equal(t, int64(3), n)
+					assert.Len(t, remaining(), 5)
+				})
+
+				t.Run("a cancelled run stops before the next batch", func(t *testing.T) {
+					ctx, cancel := context.WithCancel(context.Background())
+					cancel()
+					res, err := invoice_service.PruneExactlyOnceLogs(ctx, db, policy, now) // no BatchPause
+					assert.ErrorIs(t, err, context.Canceled)
+					assert.Equal(t, int64(0), res.Deleted)
+					assert.Len(t, remaining(), 5)
+				})
+
+				t.Run("prune deletes expired rows in batches and keeps protected ones", func(t *testing.T) {
+					res, err := invoice_service.PruneExactlyOnceLogs(context.Background(), db, policy, now)
+					assert.NoError(t, err)
+					assert.Equal(t, int64(3), res.Deleted)
+					assert.Equal(t, 2, res.Batches) // 2 + 1 (the empty batch after them ends the run)
+					assert.Equal(t, int64(1), res.Protected)
+					assert.Equal(t, []string{"new-1", "old-4"}, remaining())
+				})
+
+				t.Run("re-run is a no-op", func(t *testing.T) {
+					res, err := invoice_service.PruneExactlyOnceLogs(context.Background(), db, policy, now)
+					assert.NoError(t, err)
+					assert.Equal(t, int64(0), res.Deleted)
+				})
+
+				t.Run("invalid policy is rejected", func(t *testing.T) {
+					_, err := invoice_service.PruneExactlyOnceLogs(context.Background(), db, invoice_service.ExactlyOnceRetention{BatchSize: 10}, now)
+					assert.Error(t, err)
+				})
+			})
+		},
+	)
+}
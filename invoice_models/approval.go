@@ -0,0 +1,46 @@
+package invoice_models
+
+import (
+	"time"
+
+	"github.com/pdcgo/schema/services/invoice_iface/v2"
+)
+
+// InvoiceApprovalPolicy is a team's maker-checker policy. Accepting a payment made to
+// the team for more than PaymentThreshold, or a manual posting (CreateBalanceLog, of
+// any change type) on the team's balance for more than AdjustmentThreshold, needs a
+// second user's approval before it posts. A threshold of 0 (and teams without a row) needs no approval.
+type InvoiceApprovalPolicy struct {
+	TeamID              uint64    `gorm:"primaryKey"`
+	PaymentThreshold    float64   `gorm:"not null"`
+	AdjustmentThreshold float64   `gorm:"not null"`
+	UpdatedByID         uint64    `gorm:"not null"`
+	CreatedAt           time.Time `gorm:"not null"`
+	UpdatedAt           time.Time `gorm:"not null"`
+}
+
+// InvoiceApproval is an action held for approval, and its trail: who requested it,
+// who decided and when. TeamID is the team whose policy applies (the payment's
+// receiver, or the adjusted team); ForTeamID the counterparty. A PAYMENT approval
+// accepts PaymentID for Amount (Note is the partial-acceptance reason, if any); an
+// ADJUSTMENT approval posts the stored ledger change with its ChangeType. Nothing posts until APPROVED by
+// a user other than RequestedByID. CANCELED approvals lost their subject (the
+// payment was answered another way before the decision).
+type InvoiceApproval struct {
+	ID            uint64                       `gorm:"primaryKey"`
+	TeamID        uint64                       `gorm:"index;not null"`
+	ForTeamID     uint64                       `gorm:"not null"`
+	Kind          invoice_iface.ApprovalKind   `gorm:"not null"`
+	Status        invoice_iface.ApprovalStatus `gorm:"index;not null"`
+	Amount        float64                      `gorm:"not null"`
+	PaymentID     *uint64                      `gorm:"index"`
+	BalanceType   invoice_iface.BalanceType
+	ChangeType    invoice_iface.BalanceChangeType
+	Note          string
+	RequestedByID uint64    `gorm:"not null"`
+	RequestedAt   time.Time `gorm:"not null"`
+	DecidedByID   *uint64
+	DecidedAt     *time.Time
+	DecisionNote  string
+	UpdatedAt     time.Time `gorm:"not null"`
+}
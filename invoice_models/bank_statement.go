@@ -0,0 +1,40 @@
+package invoice_models
+
+import (
+	"time"
+
+	"github.com/pdcgo/schema/services/invoice_iface/v2"
+)
+
+// BankStatementImport is one bank statement file a receiving team imported to match
+// incoming transfers against its pending payments. ContentHash (sha256 of the file)
+// keeps the same file from being imported twice by a team.
+type BankStatementImport struct {
+	ID           uint64 `gorm:"primaryKey"`
+	TeamID       uint64 `gorm:"uniqueIndex:idx_bank_statement_imports_content;not null"`
+	ContentHash  string `gorm:"uniqueIndex:idx_bank_statement_imports_content;not null"`
+	Format       string `gorm:"not null"`
+	FileName     string
+	LineCount    int       `gorm:"not null"`
+	MatchedCount int       `gorm:"not null"`
+	CreatedByID  uint64    `gorm:"not null"`
+	CreatedAt    time.Time `gorm:"not null"`
+}
+
+// BankStatementLine is one credit line of an import and its match: MATCHED lines
+// propose PaymentID for acceptance (MatchKind says on what evidence), AMBIGUOUS lines
+// fit several pending payments, UNMATCHED lines none.
+type BankStatementLine struct {
+	ID          uint64    `gorm:"primaryKey"`
+	ImportID    uint64    `gorm:"index;not null"`
+	TeamID      uint64    `gorm:"index;not null"`
+	LineNo      int       `gorm:"not null"`
+	Date        time.Time `gorm:"not null"`
+	Amount      float64   `gorm:"not null"`
+	Reference   string
+	Description string
+	MatchStatus invoice_iface.BankLineMatchStatus `gorm:"not null"`
+	MatchKind   invoice_iface.BankLineMatchKind   `gorm:"not null"`
+	PaymentID   *uint64                           `gorm:"index"`
+	CreatedAt   time.Time                         `gorm:"not null"`
+}
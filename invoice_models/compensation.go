@@ -0,0 +1,52 @@
+package invoice_models
+
+import (
+	"time"
+
+	"github.com/pdcgo/schema/services/invoice_iface/v2"
+)
+
+// StockCompensation is what a warehouse team owes a product team for stock it lost,
+// damaged or let expire. It is proposed (from a StockProblem event or by the warehouse),
+// valued by the warehouse's WarehouseCompensationPolicy, and only posts to the ledger as
+// STOCK_PROBLEM once the product team accepts it; a dispute sends it back to the warehouse
+// to revise. InvTxItemID is set for event-proposed rows and makes re-proposals no-ops.
+type StockCompensation struct {
+	ID          uint64                              `gorm:"primaryKey"`
+	WarehouseID uint64                              `gorm:"index;not null"` // owes
+	TeamID      uint64                              `gorm:"index;not null"` // product team, owed
+	Type        invoice_iface.CompensationType      `gorm:"uniqueIndex:uniq_stock_compensation_item;not null"`
+	Status      invoice_iface.CompensationStatus    `gorm:"index;not null"`
+	Valuation   invoice_iface.CompensationValuation `gorm:"not null"`
+
+	InvTransactionID *uint64
+	InvTxItemID      *uint64 `gorm:"uniqueIndex:uniq_stock_compensation_item"`
+	SkuID            string
+	ProductName      string
+	Count            int     `gorm:"not null"`
+	Amount           float64 `gorm:"not null"`
+
+	Note          string
+	DisputeReason string
+	ProposedByID  uint64 `gorm:"not null"`
+	ReviewedByID  *uint64
+
+	CreatedAt  time.Time `gorm:"not null"`
+	ReviewedAt *time.Time
+	UpdatedAt  time.Time `gorm:"not null"`
+}
+
+// WarehouseCompensationPolicy is how a warehouse values one compensation type. A row with
+// Type UNSPECIFIED is the warehouse's default for types without their own row; with no
+// row at all compensations are valued at cost. FixedRate is per unit.
+type WarehouseCompensationPolicy struct {
+	ID          uint64                              `gorm:"primaryKey"`
+	WarehouseID uint64                              `gorm:"uniqueIndex:uniq_warehouse_compensation_policy;not null"`
+	Type        invoice_iface.CompensationType      `gorm:"uniqueIndex:uniq_warehouse_compensation_policy;not null"`
+	Valuation   invoice_iface.CompensationValuation `gorm:"not null"`
+	FixedRate   float64                             `gorm:"not null"`
+	UpdatedByID uint64                              `gorm:"not null"`
+
+	CreatedAt time.Time `gorm:"not null"`
+	UpdatedAt time.Time `gorm:"not null"`
+}
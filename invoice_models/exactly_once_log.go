@@ -5,9 +5,10 @@ import "time"
 // InvoiceExactlyOnceLog is the message-id inbox for exactly-once processing of pushed
 // events: one row per (Pub/Sub MessageID, subscription), written inside the event's
 // transaction so a redelivery is skipped. The struct name maps to table
-// invoice_exactly_once_logs by GORM's default naming (no TableName override).
+// invoice_exactly_once_logs by GORM's default naming (no TableName override). Rows past
+// the redelivery window are pruned by created_at (see PruneExactlyOnceLogs).
 type InvoiceExactlyOnceLog struct {
 	ID           string    `gorm:"primaryKey;type:varchar(400)"`
 	Subscription string    `gorm:"primaryKey;type:varchar(400)"`
-	CreatedAt    time.Time `gorm:"type:timestamptz;not null;default:now()"`
+	CreatedAt    time.Time `gorm:"index;type:timestamptz;not null;default:now()"`
 }
@@ -24,14 +24,28 @@ type BalanceChangeLog struct {
 // ledger leg (PK = balance_change_log_id), so both the primary and mirror legs —
 // and their cancel reversals — are queryable by order. OrderSystem disambiguates
 // the shared numeric id-space between legacy orders and v3 orders. Purely
-// scope/filter; idempotency is enforced upstream per writer.
+// scope/filter; idempotency is enforced upstream per writer. WAREHOUSE_FEE legs priced by
+// a WarehouseFeeRule record the rule id and version; both are NULL when the fee came from
+// orders.warehouse_fee.
 type BalanceChangeOrderSource struct {
 	BalanceChangeLogID uint64                    `gorm:"primaryKey"`
 	OrderSystem        invoice_iface.OrderSystem `gorm:"not null"`
 	OrderID            uint64                    `gorm:"index:idx_bcos_order;not null"`
 	TeamID             uint64                    `gorm:"not null"` // ordering team, canonical across legs
 	WarehouseID        uint64                    `gorm:"index;not null"`
-	CreatedAt          time.Time                 `gorm:"not null"`
+	FeeRuleID          *uint64
+	FeeRuleVersion     *int
+	CreatedAt          time.Time `gorm:"not null"`
+}
+
+// BalanceChangePaymentSource links a BalanceChangeLog leg to the InvoicePayment whose
+// acceptance (or, with Reversal, reversal) posted it. Legs of payments accepted before
+// the link existed have no row; they are found by their "payment #<id>" note.
+type BalanceChangePaymentSource struct {
+	BalanceChangeLogID uint64    `gorm:"primaryKey"`
+	PaymentID          uint64    `gorm:"index;not null"`
+	Reversal           bool      `gorm:"not null"`
+	CreatedAt          time.Time `gorm:"not null"`
 }
 
 type TeamBalance struct {
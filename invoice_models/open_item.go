@@ -0,0 +1,49 @@
+package invoice_models
+
+import (
+	"time"
+
+	"github.com/pdcgo/schema/services/invoice_iface/v2"
+)
+
+// BalanceOpenItem is one debit on a team's PAYABLE to a counterparty (a fee, a stock
+// problem, an adjustment...) tracked until it is paid off. It is keyed by the debit
+// leg's balance_change_log id; Remaining drops as credits on the same account are
+// allocated to it, and ClosedAt is set once it reaches zero. Balances that existed
+// before open items were tracked are carried as one opening ADJUSTMENT item per
+// account, keyed by the account's latest debit leg.
+type BalanceOpenItem struct {
+	BalanceChangeLogID uint64                          `gorm:"primaryKey"`
+	TeamID             uint64                          `gorm:"index:idx_balance_open_items_pair;not null"`
+	ForTeamID          uint64                          `gorm:"index:idx_balance_open_items_pair;not null"`
+	ChangeType         invoice_iface.BalanceChangeType `gorm:"not null"`
+	Amount             float64                         `gorm:"not null"`
+	Remaining          float64                         `gorm:"not null"`
+	CreatedAt          time.Time                       `gorm:"not null"`
+	ClosedAt           *time.Time
+	UpdatedAt          time.Time `gorm:"not null"`
+}
+
+// BalanceOpenItemAllocation records how much of one credit leg (CreditLogID) paid
+// off one open item. PaymentID is set when the credit settled an InvoicePayment;
+// ReleasedAt when that payment was reversed and the amount reopened on the item.
+type BalanceOpenItemAllocation struct {
+	ID          uint64    `gorm:"primaryKey"`
+	OpenItemID  uint64    `gorm:"index;not null"`
+	CreditLogID uint64    `gorm:"index;not null"`
+	PaymentID   *uint64   `gorm:"index"`
+	Amount      float64   `gorm:"not null"`
+	CreatedAt   time.Time `gorm:"not null"`
+	ReleasedAt  *time.Time
+}
+
+// InvoicePaymentSelection is an open item the payer chose to pay with a payment
+// (CreatePayment allocations). On acceptance selections are paid first, in the
+// order given, before the rest of the payment is allocated FIFO.
+type InvoicePaymentSelection struct {
+	PaymentID          uint64    `gorm:"primaryKey"`
+	BalanceChangeLogID uint64    `gorm:"primaryKey"`
+	Seq                int       `gorm:"not null"`
+	Amount             float64   `gorm:"not null"`
+	CreatedAt          time.Time `gorm:"not null"`
+}
@@ -0,0 +1,131 @@
+package invoice_models
+
+import (
+	"time"
+
+	"github.com/pdcgo/schema/services/invoice_iface/v2"
+)
+
+// OweLimitPolicy is a creditor team's opt-ins for how its owe limits are evaluated.
+// With CountPendingPayments, payments its debtors have submitted but it has not
+// answered yet already count against their debt. Teams without a row opt in to
+// nothing.
+type OweLimitPolicy struct {
+	TeamID               uint64    `gorm:"primaryKey"`
+	CountPendingPayments bool      `gorm:"not null"`
+	UpdatedByID          uint64    `gorm:"not null"`
+	CreatedAt            time.Time `gorm:"not null"`
+	UpdatedAt            time.Time `gorm:"not null"`
+}
+
+// OweLimitOverride temporarily replaces the owe threshold a creditor (TeamID) applies
+// to one debtor (ForTeamID) between StartsAt and EndsAt, e.g. extra room for a
+// campaign week. While active it beats the custom and default rules; outside its
+// window, or once revoked, evaluation falls back to them. Rows are kept as the audit.
+type OweLimitOverride struct {
+	ID          uint64    `gorm:"primaryKey"`
+	TeamID      uint64    `gorm:"index:idx_owe_limit_overrides_pair;not null"`
+	ForTeamID   uint64    `gorm:"index:idx_owe_limit_overrides_pair;not null"`
+	Threshold   float64   `gorm:"not null"`
+	StartsAt    time.Time `gorm:"not null"`
+	EndsAt      time.Time `gorm:"not null"`
+	Reason      string
+	CreatedByID uint64    `gorm:"not null"`
+	CreatedAt   time.Time `gorm:"not null"`
+	RevokedByID *uint64
+	RevokedAt   *time.Time
+}
+
+// OweLimitAlertLevel is one warning level a creditor (TeamID) sets on its owe limits,
+// in percent of the threshold that applies to a debtor (e.g. 80 and 100).
+type OweLimitAlertLevel struct {
+	TeamID  uint64 `gorm:"primaryKey"`
+	Percent uint32 `gorm:"primaryKey"`
+}
+
+// OweLimitAlertState remembers the highest alert level a debtor (ForTeamID) has
+// crossed on a creditor's (TeamID) limit, so each crossing is alerted once. It drops
+// back when the debt falls below a level, re-arming that level.
+type OweLimitAlertState struct {
+	TeamID    uint64    `gorm:"primaryKey"`
+	ForTeamID uint64    `gorm:"primaryKey"`
+	Level     uint32    `gorm:"not null"`
+	UpdatedAt time.Time `gorm:"not null"`
+}
+
+// OweLimitAlert is one crossing of a creditor's (TeamID) alert level by a debtor
+// (ForTeamID). It is written in the transaction that moved the debt and delivered
+// afterwards by DispatchOweLimitAlerts; NotifiedAt is set once the notifier took it.
+type OweLimitAlert struct {
+	ID            uint64                     `gorm:"primaryKey"`
+	TeamID        uint64                     `gorm:"index;not null"`
+	ForTeamID     uint64                     `gorm:"index;not null"`
+	Level         uint32                     `gorm:"not null"`
+	Threshold     float64                    `gorm:"not null"`
+	ProjectedDebt float64                    `gorm:"not null"`
+	Rule          invoice_iface.OweLimitRule `gorm:"not null"`
+	CreatedAt     time.Time                  `gorm:"not null"`
+	NotifiedAt    *time.Time                 `gorm:"index"`
+	Attempts      int                        `gorm:"not null;default:0"`
+	LastError     string
+}
+
+// OweLimitConfigurationHistory is the append-only trail of owe_limit_configurations
+// and owe_limit_team_type_rules: one row per threshold created, changed or deleted,
+// written in the same transaction as the change. The Old fields are nil for a CREATE,
+// the New fields for a DELETE; a max age or soft threshold of 0 means the rule had
+// none.
+type OweLimitConfigurationHistory struct {
+	ID               uint64                              `gorm:"primaryKey"`
+	ConfigurationID  uint64                              `gorm:"not null"`
+	TeamID           uint64                              `gorm:"index;not null"`
+	ForTeamID        *uint64                             `gorm:"index"`
+	IsDefault        bool                                `gorm:"not null"`
+	Action           invoice_iface.OweLimitHistoryAction `gorm:"not null"`
+	OldThreshold     *float64
+	NewThreshold     *float64
+	OldMaxAgeDays    *int64
+	NewMaxAgeDays    *int64
+	OldSoftThreshold *float64
+	NewSoftThreshold *float64
+	ChangedByID      uint64    `gorm:"not null"`
+	ChangedAt        time.Time `gorm:"not null"`
+	// TeamType is set on the changes of an OweLimitTeamTypeRule, which has no
+	// configuration row (ConfigurationID 0).
+	TeamType string `gorm:"type:varchar(32);not null;default:''"`
+}
+
+func (OweLimitConfigurationHistory) TableName() string { return "owe_limit_configuration_history" }
+
+// OweLimitAgeRule adds an age condition to an owe_limit_configurations row (the
+// shared model has no room for it): the debtor is blocked once its oldest unsettled
+// debt is more than MaxAgeDays old, whatever the amount. Combined with the row's
+// threshold both must hold; with threshold 0 only the age counts.
+type OweLimitAgeRule struct {
+	ConfigurationID uint64    `gorm:"primaryKey"`
+	MaxAgeDays      int64     `gorm:"not null"`
+	UpdatedAt       time.Time `gorm:"not null"`
+}
+
+// OweLimitTeamTypeRule is a creditor's (TeamID) owe thresholds and max age for every
+// debtor whose teams.type is TeamType. It sits between the custom rows and the
+// default row of owe_limit_configurations: a custom row for the debtor beats it, and
+// it beats the default.
+type OweLimitTeamTypeRule struct {
+	TeamID        uint64    `gorm:"primaryKey;autoIncrement:false"`
+	TeamType      string    `gorm:"primaryKey;type:varchar(32)"`
+	Threshold     float64   `gorm:"not null"`
+	SoftThreshold float64   `gorm:"not null;default:0"`
+	MaxAgeDays    int64     `gorm:"not null;default:0"`
+	UpdatedByID   uint64    `gorm:"not null"`
+	UpdatedAt     time.Time `gorm:"not null"`
+}
+
+// OweLimitSoftThreshold adds a soft limit to an owe_limit_configurations row, whose
+// threshold is the hard one: above SoftThreshold a debtor may still owe more but is
+// flagged WARN. With a hard threshold of 0 (unlimited) the soft limit only warns.
+type OweLimitSoftThreshold struct {
+	ConfigurationID uint64    `gorm:"primaryKey"`
+	SoftThreshold   float64   `gorm:"not null"`
+	UpdatedAt       time.Time `gorm:"not null"`
+}
@@ -8,7 +8,10 @@ import (
 
 // InvoicePayment is a settlement between two teams: team_id pays for_team_id. It
 // starts PENDING on create and is moved to ACCEPTED / REJECTED via the
-// accept/reject RPCs (which also record who completed it). The name avoids
+// accept/reject RPCs, CANCELED by the payer, or EXPIRED by the expiry sweeper (each
+// records who completed it).
+// Amount is the requested amount; AcceptedAmount what the receiver confirmed —
+// below Amount for a PARTIALLY_ACCEPTED payment, with PartialReason saying why. The name avoids
 // colliding with the legacy `payments` table (this maps to `invoice_payments`).
 type InvoicePayment struct {
 	ID            uint64 `gorm:"primaryKey"`
@@ -21,8 +24,70 @@ type InvoicePayment struct {
 	CreatedByID   uint64                      `gorm:"not null"`
 	CompletedByID *uint64
 
+	// AcceptedAmount is nil on payments accepted before partial acceptance existed;
+	// read it as COALESCE(accepted_amount, amount).
+	AcceptedAmount *float64
+	PartialReason  string
+
+	// BulkPaymentID links the payment to the InvoiceBulkPayment it is a line of.
+	BulkPaymentID *uint64 `gorm:"index"`
+
+	// RemindedAt is set once the receiver was reminded the payment is about to expire.
+	RemindedAt *time.Time
+
+	// Set when an accepted payment is charged back by ReversePayment.
+	ReversedByID   *uint64
+	ReversalReason string
+
 	CreatedAt  time.Time `gorm:"not null"`
 	AcceptedAt *time.Time
 	RejectedAt *time.Time
+	CanceledAt *time.Time
+	ExpiredAt  *time.Time
+	ReversedAt *time.Time
 	UpdatedAt  time.Time `gorm:"not null"`
 }
+
+// InvoicePaymentAmendment records one payer-side edit of a PENDING payment: the
+// amount, document and note before and after, and why. Rows are append-only, so the
+// receiver can see everything that changed before deciding.
+type InvoicePaymentAmendment struct {
+	ID                 uint64  `gorm:"primaryKey"`
+	PaymentID          uint64  `gorm:"index;not null"`
+	PreviousAmount     float64 `gorm:"not null"`
+	NewAmount          float64 `gorm:"not null"`
+	PreviousDocumentID string
+	NewDocumentID      string
+	PreviousNote       string
+	NewNote            string
+	Reason             string
+	AmendedByID        uint64    `gorm:"not null"`
+	CreatedAt          time.Time `gorm:"not null"`
+}
+
+// InvoicePaymentExpiryConfig is a creditor team's expiry policy for payments made to
+// it: a payment still PENDING ExpireAfterDays after it was created is expired, and the
+// team is reminded RemindBeforeDays before that. ExpireAfterDays 0 disables expiry;
+// teams without a row never expire payments.
+type InvoicePaymentExpiryConfig struct {
+	TeamID           uint64    `gorm:"primaryKey"`
+	ExpireAfterDays  int       `gorm:"not null"`
+	RemindBeforeDays int       `gorm:"not null"`
+	UpdatedByID      uint64    `gorm:"not null"`
+	CreatedAt        time.Time `gorm:"not null"`
+	UpdatedAt        time.Time `gorm:"not null"`
+}
+
+// InvoiceBulkPayment is one payer-side document settling several creditors at once:
+// one PENDING InvoicePayment per creditor line, linked by BulkPaymentID. Each
+// receiver still answers its own line; the batch status is derived from the lines.
+type InvoiceBulkPayment struct {
+	ID          uint64 `gorm:"primaryKey"`
+	TeamID      uint64 `gorm:"index;not null"`
+	DocumentID  string `gorm:"not null"`
+	Note        string
+	TotalAmount float64   `gorm:"not null"`
+	LineCount   int       `gorm:"not null"`
+	CreatedByID uint64    `gorm:"not null"`
+	CreatedAt   time.Time `gorm:"not null"`
+}
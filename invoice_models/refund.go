@@ -0,0 +1,28 @@
+package invoice_models
+
+import (
+	"time"
+
+	"github.com/pdcgo/schema/services/invoice_iface/v2"
+)
+
+// InvoiceRefund returns an overpayment credit: team_id (the receiver the payer
+// overpaid, now owing the surplus) pays for_team_id (the original payer) back. It
+// starts PENDING when the refunding team sends the money; the original payer then
+// CONFIRMs receipt, which posts the REFUND ledger entry, or REJECTs it (not received).
+type InvoiceRefund struct {
+	ID            uint64 `gorm:"primaryKey"`
+	TeamID        uint64 `gorm:"index;not null"`
+	ForTeamID     uint64 `gorm:"index;not null"`
+	DocumentID    string
+	Amount        float64 `gorm:"not null"`
+	Note          string
+	Status        invoice_iface.RefundStatus `gorm:"index;not null"`
+	RejectReason  string
+	CreatedByID   uint64 `gorm:"not null"`
+	CompletedByID *uint64
+	CreatedAt     time.Time `gorm:"not null"`
+	ConfirmedAt   *time.Time
+	RejectedAt    *time.Time
+	UpdatedAt     time.Time `gorm:"not null"`
+}
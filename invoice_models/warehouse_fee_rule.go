@@ -0,0 +1,41 @@
+package invoice_models
+
+import "time"
+
+// WarehouseFeeRule is one pricing rule of a warehouse team (warehouse_id is the team that
+// charges the WAREHOUSE_FEE). The rule row only carries identity, ordering and the active
+// flag; its conditions and price live in immutable WarehouseFeeRuleVersion rows, and every
+// edit appends a version, so a posted fee can always be explained by (rule id, version).
+// Deleting a rule deactivates it; versions are never removed.
+type WarehouseFeeRule struct {
+	ID             uint64 `gorm:"primaryKey"`
+	WarehouseID    uint64 `gorm:"index;not null"`
+	Name           string `gorm:"not null"`
+	Priority       int    `gorm:"not null"` // higher is evaluated first; ties by id
+	Active         bool   `gorm:"not null"`
+	CurrentVersion int    `gorm:"not null"`
+	CreatedByID    uint64 `gorm:"not null"`
+
+	CreatedAt time.Time `gorm:"not null"`
+	UpdatedAt time.Time `gorm:"not null"`
+}
+
+// WarehouseFeeRuleVersion is one immutable revision of a WarehouseFeeRule. Zero-valued
+// conditions match anything: an empty OrderFrom any order type, a nil ForTeamID any
+// ordering team, a zero MaxItems no upper bound. The fee is BaseFee plus
+// PerItemFee for every item (sum of order_items.count).
+type WarehouseFeeRuleVersion struct {
+	RuleID  uint64 `gorm:"primaryKey"`
+	Version int    `gorm:"primaryKey"`
+
+	OrderFrom string // db_models.OrderMpType, e.g. "shopee"
+	ForTeamID *uint64
+	MinItems  int `gorm:"not null"`
+	MaxItems  int `gorm:"not null"`
+
+	BaseFee    float64 `gorm:"not null"`
+	PerItemFee float64 `gorm:"not null"`
+
+	CreatedByID uint64    `gorm:"not null"`
+	CreatedAt   time.Time `gorm:"not null"`
+}
@@ -16,7 +16,9 @@ import (
 //
 // The receiver confirms a pending payment: it settles the payer's PAYABLE (a
 // double entry of type PAYMENT), clears the in-flight PendingPaymentAmount on
-// both sides, and marks the payment ACCEPTED.
+// both sides, and marks the payment ACCEPTED. Above the receiver's approval
+// threshold nothing posts yet: the acceptance is returned as a PENDING approval
+// for a second user (see ApprovalApprove).
 func (s *invoiceServiceImpl) AcceptPayment(
 	ctx context.Context,
 	req *connect.Request[invoice_iface.AcceptPaymentRequest],
@@ -30,65 +32,124 @@ func (s *invoiceServiceImpl) AcceptPayment(
 	completedBy := uint64(caller.IdentityId)
 
 	now := time.Now()
+	var approval *invoice_models.InvoiceApproval
 	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
 		p, err := loadPendingPayment(tx, pay.PaymentId, pay.TeamId, pay.ForTeamId)
 		if err != nil {
 			return err
 		}
 
-		note := fmt.Sprintf("payment #%d", p.ID)
-
-		// Split the payment into the debt it settles and any overpayment credit.
-		// PAYABLE(payer, receiver) is <= 0 by convention; its magnitude is the debt owed.
-		bal, err := lockOrCreateBalance(tx, p.TeamID, p.ForTeamID, invoice_iface.BalanceType_BALANCE_TYPE_PAYABLE, now)
-		if err != nil {
+		approval, err = holdPaymentAcceptance(tx, p, p.Amount, "", completedBy, now)
+		if err != nil || approval != nil {
 			return err
 		}
-		outstanding := 0.0
-		if bal.Balance < 0 {
-			outstanding = -bal.Balance
-		}
-		settle := p.Amount
-		if settle > outstanding {
-			settle = outstanding
-		}
-		surplus := p.Amount - settle
+		return acceptPayment(tx, p, p.Amount, "", completedBy, now)
+	})
+	if err != nil {
+		return nil, err
+	}
 
-		// Settle the debt portion: move the payer's PAYABLE toward zero.
-		if settle > 0 {
-			if err := postDoubleEntry(tx, p.TeamID, p.ForTeamID, invoice_iface.BalanceType_BALANCE_TYPE_PAYABLE, invoice_iface.BalanceChangeType_BALANCE_CHANGE_TYPE_PAYMENT, settle, note, completedBy, now, nil); err != nil {
-				return err
-			}
-		}
-		// Overpayment becomes a clean credit: the payer is now owed `surplus` by the
-		// receiver -> RECEIVABLE(payer, receiver), mirrored to PAYABLE(receiver, payer).
-		if surplus > 0 {
-			creditNote := fmt.Sprintf("payment #%d overpayment credit", p.ID)
-			if err := postDoubleEntry(tx, p.TeamID, p.ForTeamID, invoice_iface.BalanceType_BALANCE_TYPE_RECEIVABLE, invoice_iface.BalanceChangeType_BALANCE_CHANGE_TYPE_PAYMENT, surplus, creditNote, completedBy, now, nil); err != nil {
-				return err
-			}
-		}
+	resp := &invoice_iface.AcceptPaymentResponse{}
+	if approval != nil {
+		resp.Approval = toProtoApproval(approval)
+	}
+	return connect.NewResponse(resp), nil
+}
+
+// acceptPayment settles accepted of the pending payment p and marks it ACCEPTED, or
+// PARTIALLY_ACCEPTED with reason when accepted is less than the payment amount, then
+// re-checks the payer's owe-limit alert levels. p is updated to match the stored row.
+func acceptPayment(
+	tx *gorm.DB,
+	p *invoice_models.InvoicePayment,
+	accepted float64,
+	reason string,
+	completedBy uint64,
+	now time.Time,
+) error {
+	status := invoice_iface.PaymentStatus_PAYMENT_STATUS_ACCEPTED
+	if accepted < p.Amount {
+		status = invoice_iface.PaymentStatus_PAYMENT_STATUS_PARTIALLY_ACCEPTED
+	}
+
+	if err := settlePayment(tx, p, accepted, completedBy, now); err != nil {
+		return err
+	}
+	if err := checkOweLimitAlert(tx, p.TeamID, p.ForTeamID, now); err != nil {
+		return err
+	}
+
+	p.Status = status
+	p.AcceptedAmount = &accepted
+	p.PartialReason = reason
+	p.AcceptedAt = &now
+	p.CompletedByID = &completedBy
+	p.UpdatedAt = now
+	return tx.Model(&invoice_models.InvoicePayment{}).
+		Where("id = ?", p.ID).
+		Updates(map[string]interface{}{
+			"status":          p.Status,
+			"accepted_amount": accepted,
+			"partial_reason":  reason,
+			"accepted_at":     now,
+			"completed_by_id": completedBy,
+			"updated_at":      now,
+		}).Error
+}
+
+// settlePayment posts the accepted part of a pending payment: it settles the payer's
+// PAYABLE (a double entry of type PAYMENT) up to the outstanding debt, books any excess
+// as an overpayment credit (every leg is linked to the payment by a PaymentSource, so
+// ReversePayment can undo them exactly), pays off the open items the payer selected
+// and then the oldest ones, and releases the payment's full in-flight amount on both
+// sides — for a partial acceptance the unaccepted remainder is simply no longer pending.
+func settlePayment(
+	tx *gorm.DB,
+	p *invoice_models.InvoicePayment,
+	accepted float64,
+	completedBy uint64,
+	now time.Time,
+) error {
+	note := fmt.Sprintf("payment #%d", p.ID)
+	src := &PaymentSource{PaymentID: p.ID}
+	if err := tx.Where("payment_id = ?", p.ID).Order("seq").Find(&src.selected).Error; err != nil {
+		return err
+	}
+
+	// Split the payment into the debt it settles and any overpayment credit.
+	// PAYABLE(payer, receiver) is <= 0 by convention; its magnitude is the debt owed.
+	bal, err := lockOrCreateBalance(tx, p.TeamID, p.ForTeamID, invoice_iface.BalanceType_BALANCE_TYPE_PAYABLE, now)
+	if err != nil {
+		return err
+	}
+	outstanding := 0.0
+	if bal.Balance < 0 {
+		outstanding = -bal.Balance
+	}
+	settle := accepted
+	if settle > outstanding {
+		settle = outstanding
+	}
+	surplus := accepted - settle
 
-		// Clear the in-flight amount on both sides.
-		if err := adjustPending(tx, p.TeamID, p.ForTeamID, invoice_iface.BalanceType_BALANCE_TYPE_PAYABLE, -p.Amount, now); err != nil {
+	// Settle the debt portion: move the payer's PAYABLE toward zero.
+	if settle > 0 {
+		if err := postDoubleEntry(tx, p.TeamID, p.ForTeamID, invoice_iface.BalanceType_BALANCE_TYPE_PAYABLE, invoice_iface.BalanceChangeType_BALANCE_CHANGE_TYPE_PAYMENT, settle, note, completedBy, now, src); err != nil {
 			return err
 		}
-		if err := adjustPending(tx, p.ForTeamID, p.TeamID, invoice_iface.BalanceType_BALANCE_TYPE_RECEIVABLE, -p.Amount, now); err != nil {
+	}
+	// Overpayment becomes a clean credit: the payer is now owed `surplus` by the
+	// receiver -> RECEIVABLE(payer, receiver), mirrored to PAYABLE(receiver, payer).
+	if surplus > 0 {
+		creditNote := fmt.Sprintf("payment #%d overpayment credit", p.ID)
+		if err := postDoubleEntry(tx, p.TeamID, p.ForTeamID, invoice_iface.BalanceType_BALANCE_TYPE_RECEIVABLE, invoice_iface.BalanceChangeType_BALANCE_CHANGE_TYPE_PAYMENT, surplus, creditNote, completedBy, now, src); err != nil {
 			return err
 		}
-
-		return tx.Model(&invoice_models.InvoicePayment{}).
-			Where("id = ?", p.ID).
-			Updates(map[string]interface{}{
-				"status":          invoice_iface.PaymentStatus_PAYMENT_STATUS_ACCEPTED,
-				"accepted_at":     now,
-				"completed_by_id": completedBy,
-				"updated_at":      now,
-			}).Error
-	})
-	if err != nil {
-		return nil, err
 	}
 
-	return connect.NewResponse(&invoice_iface.AcceptPaymentResponse{}), nil
+	// Clear the in-flight amount on both sides.
+	if err := adjustPending(tx, p.TeamID, p.ForTeamID, invoice_iface.BalanceType_BALANCE_TYPE_PAYABLE, -p.Amount, now); err != nil {
+		return err
+	}
+	return adjustPending(tx, p.ForTeamID, p.TeamID, invoice_iface.BalanceType_BALANCE_TYPE_RECEIVABLE, -p.Amount, now)
 }
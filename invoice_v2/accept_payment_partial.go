@@ -0,0 +1,72 @@
+package invoice_v2
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"connectrpc.com/connect"
+	"github.com/pdcgo/invoice_service/invoice_models"
+	invoice_iface "github.com/pdcgo/schema/services/invoice_iface/v2"
+	"github.com/pdcgo/user_service/access_interceptors"
+	"gorm.io/gorm"
+)
+
+// AcceptPaymentPartial implements [invoice_ifaceconnect.InvoiceServiceHandler].
+//
+// The receiver confirms a pending payment for less than was submitted, e.g. a transfer
+// that arrived short of bank charges. Only accepted_amount is settled (same settle /
+// overpayment split as AcceptPayment), the full submitted amount leaves pending on both
+// sides, and the payment is marked PARTIALLY_ACCEPTED with the requested and accepted
+// amounts and the reason. Confirming the full amount is a plain ACCEPTED. Like
+// AcceptPayment, an accepted_amount above the receiver's approval threshold is held as
+// a PENDING approval and the payment stays PENDING.
+func (s *invoiceServiceImpl) AcceptPaymentPartial(
+	ctx context.Context,
+	req *connect.Request[invoice_iface.AcceptPaymentPartialRequest],
+) (*connect.Response[invoice_iface.AcceptPaymentPartialResponse], error) {
+	pay := req.Msg
+
+	if pay.AcceptedAmount <= 0 {
+		return nil, connect.NewError(connect.CodeInvalidArgument, errors.New("accepted_amount must be greater than zero; reject the payment instead"))
+	}
+
+	caller, err := access_interceptors.GetIdentityFromCtx(ctx)
+	if err != nil {
+		return nil, connect.NewError(connect.CodeUnauthenticated, err)
+	}
+	completedBy := uint64(caller.IdentityId)
+
+	now := time.Now()
+	var p *invoice_models.InvoicePayment
+	var approval *invoice_models.InvoiceApproval
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var err error
+		p, err = loadPendingPayment(tx, pay.PaymentId, pay.TeamId, pay.ForTeamId)
+		if err != nil {
+			return err
+		}
+		if pay.AcceptedAmount > p.Amount {
+			return connect.NewError(connect.CodeInvalidArgument, errors.New("accepted_amount must not exceed the payment amount"))
+		}
+
+		if pay.AcceptedAmount < p.Amount && pay.Reason == "" {
+			return connect.NewError(connect.CodeInvalidArgument, errors.New("reason is required for a partial acceptance"))
+		}
+
+		approval, err = holdPaymentAcceptance(tx, p, pay.AcceptedAmount, pay.Reason, completedBy, now)
+		if err != nil || approval != nil {
+			return err
+		}
+		return acceptPayment(tx, p, pay.AcceptedAmount, pay.Reason, completedBy, now)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &invoice_iface.AcceptPaymentPartialResponse{Payment: toProtoPayment(p)}
+	if approval != nil {
+		resp.Approval = toProtoApproval(approval)
+	}
+	return connect.NewResponse(resp), nil
+}
@@ -0,0 +1,173 @@
+package invoice_v2
+
+import (
+	"context"
+	"errors"
+	"math"
+	"time"
+
+	"connectrpc.com/connect"
+	invoice_iface "github.com/pdcgo/schema/services/invoice_iface/v2"
+	"github.com/pdcgo/shared/db_models"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// defaultAgingBuckets are the bucket upper bounds in days: 0–30, 31–60, 61–90, 90+.
+var defaultAgingBuckets = []int64{30, 60, 90}
+
+// AgingReport implements [invoice_ifaceconnect.InvoiceServiceHandler]. It ages the
+// scoped team's outstanding debt per counterparty as of a date: balance_type PAYABLE
+// is what the team owes, RECEIVABLE what it is owed.
+//
+// The ledger is replayed from balance_change_logs up to as_of. Each debt-increasing
+// leg is a dated debit; each reducing leg (a payment, or a fee cancel) consumes the
+// oldest debits first, so what remains is the unpaid debt by age. A counterparty
+// the team has overpaid ages nothing. bucket_days are the ascending upper bounds of
+// the buckets (default 30/60/90), with a final open-ended bucket.
+func (s *invoiceServiceImpl) AgingReport(
+	ctx context.Context,
+	req *connect.Request[invoice_iface.AgingReportRequest],
+) (*connect.Response[invoice_iface.AgingReportResponse], error) {
+	pay := req.Msg
+	if pay.TeamId == 0 {
+		return nil, connect.NewError(connect.CodeInvalidArgument, errors.New("team_id is required"))
+	}
+	// sign turns a leg's change_amount into a change of the debt.
+	var sign float64
+	switch pay.BalanceType {
+	case btPayable:
+		sign = -1
+	case btReceivable:
+		sign = 1
+	default:
+		return nil, connect.NewError(connect.CodeInvalidArgument, errors.New("balance_type is required"))
+	}
+	bounds := pay.BucketDays
+	if len(bounds) == 0 {
+		bounds = defaultAgingBuckets
+	}
+	for i, b := range bounds {
+		if b <= 0 || (i > 0 && b <= bounds[i-1]) {
+			return nil, connect.NewError(connect.CodeInvalidArgument, errors.New("bucket_days must be positive and ascending"))
+		}
+	}
+	asOf := time.Now()
+	if pay.AsOf != nil {
+		asOf = pay.AsOf.AsTime()
+	}
+
+	query := s.db.WithContext(ctx).
+		Table("balance_change_logs x").
+		Joins("LEFT JOIN teams t ON t.id = x.for_team_id").
+		Select("x.for_team_id, x.change_amount, x.created_at, t.type AS team_type").
+		Where("x.team_id = ? AND x.balance_type = ? AND x.created_at <= ?", pay.TeamId, pay.BalanceType, asOf)
+	if pay.ForTeamId > 0 {
+		query = query.Where("x.for_team_id = ?", pay.ForTeamId)
+	}
+	if typeFilter := dbTeamType(pay.TeamType); typeFilter != "" {
+		query = query.Where("t.type = ?", typeFilter)
+	}
+	var legs []struct {
+		ForTeamID    uint64
+		ChangeAmount float64
+		CreatedAt    time.Time
+		TeamType     db_models.TeamType
+	}
+	if err := query.Order("x.for_team_id, x.created_at, x.id").Scan(&legs).Error; err != nil {
+		return nil, err
+	}
+
+	resp := &invoice_iface.AgingReportResponse{
+		AsOf:    timestamppb.New(asOf),
+		Buckets: make([]*invoice_iface.AgingBucket, 0, len(bounds)+1),
+		Rows:    []*invoice_iface.AgingRow{},
+		Totals:  make([]float64, len(bounds)+1),
+	}
+	from := int64(0)
+	for _, b := range bounds {
+		resp.Buckets = append(resp.Buckets, &invoice_iface.AgingBucket{FromDay: from, ToDay: b})
+		from = b + 1
+	}
+	resp.Buckets = append(resp.Buckets, &invoice_iface.AgingBucket{FromDay: from})
+
+	bucketOf := func(created time.Time) int {
+		age := ageDays(asOf, created)
+		for i, b := range bounds {
+			if age <= b {
+				return i
+			}
+		}
+		return len(bounds)
+	}
+
+	// Replay one counterparty at a time (legs are grouped by for_team_id).
+	for i := 0; i < len(legs); {
+		forTeamID := legs[i].ForTeamID
+		teamType := legs[i].TeamType
+		var open []debit
+		credit := 0.0 // reductions not yet matched by a debit (overpayment)
+		for ; i < len(legs) && legs[i].ForTeamID == forTeamID; i++ {
+			open, credit = replayDebit(open, credit, sign*legs[i].ChangeAmount, legs[i].CreatedAt)
+		}
+
+		row := &invoice_iface.AgingRow{
+			ForTeamId: forTeamID,
+			TeamType:  teamTypeToProto(teamType),
+			Amounts:   make([]float64, len(bounds)+1),
+		}
+		for _, d := range open {
+			b := bucketOf(d.at)
+			row.Amounts[b] += d.amount
+			row.Total += d.amount
+			resp.Totals[b] += d.amount
+		}
+		if row.Total > 0 {
+			resp.Total += row.Total
+			resp.Rows = append(resp.Rows, row)
+		}
+	}
+
+	return connect.NewResponse(resp), nil
+}
+
+// debit is an unpaid part of a debt-increasing leg, dated by the leg.
+type debit struct {
+	amount float64
+	at     time.Time
+}
+
+// replayDebit applies one leg's change of the debt, dated at, to the unpaid debits:
+// an increase first uses up any credit and opens a debit for the rest, a reduction
+// pays off the oldest debits first (FIFO).
+func replayDebit(open []debit, credit, delta float64, at time.Time) ([]debit, float64) {
+	switch {
+	case delta > 0:
+		used := min(delta, credit)
+		credit -= used
+		if delta-used > 0 {
+			open = append(open, debit{amount: delta - used, at: at})
+		}
+	case delta < 0:
+		open, credit = consumeDebits(open, -delta, credit)
+	}
+	return open, credit
+}
+
+// ageDays is how many whole days old something dated at is as of asOf.
+func ageDays(asOf, at time.Time) int64 {
+	return int64(math.Floor(asOf.Sub(at).Hours() / 24))
+}
+
+// consumeDebits pays amount off the oldest debits first; what the debits cannot
+// absorb is added to credit.
+func consumeDebits(open []debit, amount, credit float64) ([]debit, float64) {
+	for len(open) > 0 && amount > 0 {
+		used := min(amount, open[0].amount)
+		open[0].amount -= used
+		amount -= used
+		if open[0].amount <= 0 {
+			open = open[1:]
+		}
+	}
+	return open, credit + amount
+}
@@ -0,0 +1,124 @@
+package invoice_v2_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"connectrpc.com/connect"
+	"github.com/pdcgo/invoice_service/invoice_models"
+	"github.com/pdcgo/invoice_service/invoice_v2"
+	"github.com/pdcgo/schema/services/common/v1"
+	invoice_iface "github.com/pdcgo/schema/services/invoice_iface/v2"
+	"github.com/pdcgo/shared/db_models"
+	"github.com/pdcgo/shared/pkg/moretest"
+	"github.com/pdcgo/shared/pkg/moretest/moretest_mock"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"gorm.io/gorm"
+)
+
+func TestAgingReport(t *testing.T) {
+	var scenario moretest_mock.DbScenario
+	moretest.Suite(t, "aging report",
+		moretest.SetupListFunc{moretest_mock.MockPostgresDatabase(&scenario)},
+		func(t *testing.T) {
+			scenario(t, func(tx *gorm.DB) {
+				assert.NoError(t, tx.AutoMigrate(
+					&invoice_models.BalanceChangeLog{},
+					&invoice_models.OweLimitAlertLevel{},
+					&teamRow{},
+				))
+
+				asOf := time.Date(2026, 6, 30, 12, 0, 0, 0, time.UTC)
+				daysAgo := func(n int) time.Time { return asOf.AddDate(0, 0, -n) }
+
+				assert.NoError(t, tx.Create(&[]teamRow{
+					{ID: 2, Name: "Beta", Type: db_models.SellingTeamType},
+					{ID: 3, Name: "Acme", Type: db_models.WarehouseTeamType},
+				}).Error)
+
+				whFee := invoice_iface.BalanceChangeType_BALANCE_CHANGE_TYPE_WAREHOUSE_FEE
+				payment := invoice_iface.BalanceChangeType_BALANCE_CHANGE_TYPE_PAYMENT
+				leg := func(teamID, forTeamID uint64, bt invoice_iface.BalanceType, ct invoice_iface.BalanceChangeType, amount float64, at time.Time) invoice_models.BalanceChangeLog {
+					return invoice_models.BalanceChangeLog{TeamID: teamID, ForTeamID: forTeamID, BalanceType: bt, ChangeType: ct, ChangeAmount: amount, CreatedAt: at, CreatedByID: 7}
+				}
+				assert.NoError(t, tx.Create(&[]invoice_models.BalanceChangeLog{
+					// team 1 owes warehouse 3: 10 (100d), 20 (45d), 30 (5d); pays 15 (2d).
+					leg(1, 3, payable, whFee, -10, daysAgo(100)),
+					leg(1, 3, payable, whFee, -20, daysAgo(45)),
+					leg(1, 3, payable, whFee, -30, daysAgo(5)),
+					leg(1, 3, payable, payment, 15, daysAgo(2)),
+					leg(1, 3, payable, whFee, -99, asOf.Add(time.Hour)), // after as_of
+					// team 1 owes selling team 2: 40 (70d), overpaid by 50 (60d) -> in credit.
+					leg(1, 2, payable, whFee, -40, daysAgo(70)),
+					leg(1, 2, payable, payment, 50, daysAgo(60)),
+					// team 2 owes team 1: 25 (31d).
+					leg(1, 2, receivable, whFee, 25, daysAgo(31)),
+				}).Error)
+
+				svc := invoice_v2.NewInvoiceService(tx)
+				report := func(req *invoice_iface.AgingReportRequest) (*invoice_iface.AgingReportResponse, error) {
+					req.TeamId = 1
+					req.AsOf = timestamppb.New(asOf)
+					res, err := svc.AgingReport(context.Background(), connect.NewRequest(req))
+					if err != nil {
+						return nil, err
+					}
+					return res.Msg, nil
+				}
+
+				t.Run("payable: payments consume the oldest debt first", func(t *testing.T) {
+					res, err := report(&invoice_iface.AgingReportRequest{BalanceType: payable})
+					assert.NoError(t, err)
+					assert.Len(t, res.Buckets, 4)
+					assert.Equal(t, int64(61), res.Buckets[2].FromDay)
+					assert.Equal(t, int64(90), res.Buckets[2].ToDay)
+
+					// team 2 is in credit and ages nothing.
+					if assert.Len(t, res.Rows, 1) {
+						row := res.Rows[0]
+						assert.Equal(t, uint64(3), row.ForTeamId)
+						assert.Equal(t, common.TeamType_TEAM_TYPE_WAREHOUSE, row.TeamType)
+						assert.Equal(t, []float64{30, 15, 0, 0}, row.Amounts)
+						assert.Equal(t, float64(45), row.Total)
+					}
+					assert.Equal(t, float64(45), res.Total)
+				})
+
+				t.Run("receivable direction", func(t *testing.T) {
+					res, err := report(&invoice_iface.AgingReportRequest{BalanceType: receivable})
+					assert.NoError(t, err)
+					if assert.Len(t, res.Rows, 1) {
+						assert.Equal(t, uint64(2), res.Rows[0].ForTeamId)
+						assert.Equal(t, []float64{0, 25, 0, 0}, res.Rows[0].Amounts)
+					}
+				})
+
+				t.Run("custom buckets and team type filter", func(t *testing.T) {
+					res, err := report(&invoice_iface.AgingReportRequest{
+						BalanceType: payable,
+						BucketDays:  []int64{7, 30},
+						TeamType:    common.TeamType_TEAM_TYPE_WAREHOUSE,
+					})
+					assert.NoError(t, err)
+					if assert.Len(t, res.Rows, 1) {
+						assert.Equal(t, []float64{30, 0, 15}, res.Rows[0].Amounts)
+					}
+
+					res, err = report(&invoice_iface.AgingReportRequest{
+						BalanceType: payable,
+						TeamType:    common.TeamType_TEAM_TYPE_SELLING,
+					})
+					assert.NoError(t, err)
+					assert.Empty(t, res.Rows)
+				})
+
+				t.Run("invalid buckets rejected", func(t *testing.T) {
+					_, err := report(&invoice_iface.AgingReportRequest{BalanceType: payable, BucketDays: []int64{60, 30}})
+					assert.Equal(t, connect.CodeInvalidArgument, connect.CodeOf(err))
+				})
+			})
+		},
+	)
+}
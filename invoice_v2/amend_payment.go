@@ -0,0 +1,103 @@
+package invoice_v2
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"connectrpc.com/connect"
+	"github.com/pdcgo/invoice_service/invoice_models"
+	invoice_iface "github.com/pdcgo/schema/services/invoice_iface/v2"
+	"github.com/pdcgo/user_service/access_interceptors"
+	"gorm.io/gorm"
+)
+
+// AmendPayment implements [invoice_ifaceconnect.InvoiceServiceHandler].
+//
+// The payer corrects its own pending payment — amount, document and note are replaced
+// with the request's values. An amount change moves PendingPaymentAmount on both sides
+// by the difference. Every amendment is kept (PaymentAmendmentList) so the receiver can
+// see what changed before accepting. A payment whose acceptance awaits approval cannot
+// be amended: the approver would otherwise accept an amount the payer no longer sent.
+// Neither can a line of a bulk payment, whose total and document its lines share (and
+// whose lines were checked against the outstanding payable); cancel the line instead.
+func (s *invoiceServiceImpl) AmendPayment(
+	ctx context.Context,
+	req *connect.Request[invoice_iface.AmendPaymentRequest],
+) (*connect.Response[invoice_iface.AmendPaymentResponse], error) {
+	pay := req.Msg
+
+	if pay.Amount <= 0 {
+		return nil, connect.NewError(connect.CodeInvalidArgument, errors.New("amount must be greater than zero"))
+	}
+
+	caller, err := access_interceptors.GetIdentityFromCtx(ctx)
+	if err != nil {
+		return nil, connect.NewError(connect.CodeUnauthenticated, err)
+	}
+
+	now := time.Now()
+	var p *invoice_models.InvoicePayment
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var err error
+		p, err = loadPendingPayment(tx, pay.PaymentId, pay.TeamId, pay.ForTeamId)
+		if err != nil {
+			return err
+		}
+		if p.BulkPaymentID != nil {
+			return connect.NewError(connect.CodeFailedPrecondition, fmt.Errorf("payment is a line of bulk payment #%d; cancel it instead", *p.BulkPaymentID))
+		}
+		if err := requireNoPaymentApproval(tx, p.ID); err != nil {
+			return err
+		}
+		if p.Amount == pay.Amount && p.DocumentID == pay.DocumentId && p.Note == pay.Note {
+			return connect.NewError(connect.CodeInvalidArgument, errors.New("amendment changes nothing"))
+		}
+
+		amendment := invoice_models.InvoicePaymentAmendment{
+			PaymentID:          p.ID,
+			PreviousAmount:     p.Amount,
+			NewAmount:          pay.Amount,
+			PreviousDocumentID: p.DocumentID,
+			NewDocumentID:      pay.DocumentId,
+			PreviousNote:       p.Note,
+			NewNote:            pay.Note,
+			Reason:             pay.Reason,
+			AmendedByID:        uint64(caller.IdentityId),
+			CreatedAt:          now,
+		}
+		if err := tx.Create(&amendment).Error; err != nil {
+			return err
+		}
+
+		if delta := pay.Amount - p.Amount; delta != 0 {
+			if err := adjustPending(tx, p.TeamID, p.ForTeamID, invoice_iface.BalanceType_BALANCE_TYPE_PAYABLE, delta, now); err != nil {
+				return err
+			}
+			if err := adjustPending(tx, p.ForTeamID, p.TeamID, invoice_iface.BalanceType_BALANCE_TYPE_RECEIVABLE, delta, now); err != nil {
+				return err
+			}
+		}
+
+		p.Amount = pay.Amount
+		p.DocumentID = pay.DocumentId
+		p.Note = pay.Note
+		p.UpdatedAt = now
+		return tx.Model(&invoice_models.InvoicePayment{}).
+			Where("id = ?", p.ID).
+			Updates(map[string]interface{}{
+				"amount":      p.Amount,
+				"document_id": p.DocumentID,
+				"note":        p.Note,
+				"updated_at":  now,
+			}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return connect.NewResponse(&invoice_iface.AmendPaymentResponse{
+		Payment: toProtoPayment(p),
+	}), nil
+}
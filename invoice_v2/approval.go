@@ -0,0 +1,189 @@
+package invoice_v2
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"connectrpc.com/connect"
+	"github.com/pdcgo/invoice_service/invoice_models"
+	invoice_iface "github.com/pdcgo/schema/services/invoice_iface/v2"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"gorm.io/gorm"
+)
+
+// approvalThreshold is teamID's maker-checker threshold for kind; 0 means no approval
+// is needed.
+func approvalThreshold(tx *gorm.DB, teamID uint64, kind invoice_iface.ApprovalKind) (float64, error) {
+	var policy invoice_models.InvoiceApprovalPolicy
+	if err := tx.Where("team_id = ?", teamID).Limit(1).Find(&policy).Error; err != nil {
+		return 0, err
+	}
+	switch kind {
+	case invoice_iface.ApprovalKind_APPROVAL_KIND_PAYMENT:
+		return policy.PaymentThreshold, nil
+	case invoice_iface.ApprovalKind_APPROVAL_KIND_ADJUSTMENT:
+		return policy.AdjustmentThreshold, nil
+	}
+	return 0, nil
+}
+
+// holdPaymentAcceptance is the maker-checker gate of AcceptPayment and
+// AcceptPaymentPartial. When accepting p for accepted is above the receiver's
+// payment threshold it records a PENDING approval instead and returns it; the caller
+// then posts nothing. A payment already awaiting approval cannot be accepted again.
+func holdPaymentAcceptance(
+	tx *gorm.DB,
+	p *invoice_models.InvoicePayment,
+	accepted float64,
+	reason string,
+	requestedBy uint64,
+	now time.Time,
+) (*invoice_models.InvoiceApproval, error) {
+	if err := requireNoPaymentApproval(tx, p.ID); err != nil {
+		return nil, err
+	}
+
+	threshold, err := approvalThreshold(tx, p.ForTeamID, invoice_iface.ApprovalKind_APPROVAL_KIND_PAYMENT)
+	if err != nil || threshold <= 0 || accepted <= threshold {
+		return nil, err
+	}
+	paymentID := p.ID
+	approval := invoice_models.InvoiceApproval{
+		TeamID:        p.ForTeamID,
+		ForTeamID:     p.TeamID,
+		Kind:          invoice_iface.ApprovalKind_APPROVAL_KIND_PAYMENT,
+		Status:        invoice_iface.ApprovalStatus_APPROVAL_STATUS_PENDING,
+		Amount:        accepted,
+		PaymentID:     &paymentID,
+		Note:          reason,
+		RequestedByID: requestedBy,
+		RequestedAt:   now,
+		UpdatedAt:     now,
+	}
+	return &approval, tx.Create(&approval).Error
+}
+
+// requireNoPaymentApproval fails with FailedPrecondition while an acceptance of the
+// payment awaits approval: the payment must not be accepted again or amended until
+// that approval is decided.
+func requireNoPaymentApproval(tx *gorm.DB, paymentID uint64) error {
+	var open invoice_models.InvoiceApproval
+	res := tx.
+		Where("payment_id = ? AND status = ?", paymentID, invoice_iface.ApprovalStatus_APPROVAL_STATUS_PENDING).
+		Limit(1).
+		Find(&open)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected > 0 {
+		return connect.NewError(connect.CodeFailedPrecondition, fmt.Errorf("payment is awaiting approval #%d", open.ID))
+	}
+	return nil
+}
+
+// holdAdjustment is the maker-checker gate of a manual posting through
+// CreateBalanceLog, of any change type: above teamID's adjustment threshold the change
+// is stored as a PENDING approval and returned instead of posted.
+func holdAdjustment(
+	tx *gorm.DB,
+	teamID, forTeamID uint64,
+	changeType invoice_iface.BalanceChangeType,
+	balanceType invoice_iface.BalanceType,
+	amount float64,
+	note string,
+	requestedBy uint64,
+	now time.Time,
+) (*invoice_models.InvoiceApproval, error) {
+	threshold, err := approvalThreshold(tx, teamID, invoice_iface.ApprovalKind_APPROVAL_KIND_ADJUSTMENT)
+	if err != nil || threshold <= 0 || amount <= threshold {
+		return nil, err
+	}
+	approval := invoice_models.InvoiceApproval{
+		TeamID:        teamID,
+		ForTeamID:     forTeamID,
+		Kind:          invoice_iface.ApprovalKind_APPROVAL_KIND_ADJUSTMENT,
+		Status:        invoice_iface.ApprovalStatus_APPROVAL_STATUS_PENDING,
+		Amount:        amount,
+		BalanceType:   balanceType,
+		ChangeType:    changeType,
+		Note:          note,
+		RequestedByID: requestedBy,
+		RequestedAt:   now,
+		UpdatedAt:     now,
+	}
+	return &approval, tx.Create(&approval).Error
+}
+
+// loadPendingApproval locks the approval row, verifies it belongs to teamID, and
+// requires it to be PENDING.
+func loadPendingApproval(tx *gorm.DB, approvalID, teamID uint64) (*invoice_models.InvoiceApproval, error) {
+	var a invoice_models.InvoiceApproval
+	err := lockForUpdate(tx).Where("id = ?", approvalID).First(&a).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, connect.NewError(connect.CodeNotFound, errors.New("approval not found"))
+		}
+		return nil, err
+	}
+	if a.TeamID != teamID {
+		return nil, connect.NewError(connect.CodeInvalidArgument, errors.New("approval does not match team_id"))
+	}
+	if a.Status != invoice_iface.ApprovalStatus_APPROVAL_STATUS_PENDING {
+		return nil, connect.NewError(connect.CodeFailedPrecondition, fmt.Errorf("approval already %s", a.Status))
+	}
+	return &a, nil
+}
+
+// cancelPaymentApprovals closes the open approval of a payment that ended another way
+// (rejected, canceled or expired) before it was decided.
+func cancelPaymentApprovals(tx *gorm.DB, paymentID uint64, note string, now time.Time) error {
+	return tx.Model(&invoice_models.InvoiceApproval{}).
+		Where("payment_id = ? AND status = ?", paymentID, invoice_iface.ApprovalStatus_APPROVAL_STATUS_PENDING).
+		Updates(map[string]interface{}{
+			"status":        invoice_iface.ApprovalStatus_APPROVAL_STATUS_CANCELED,
+			"decision_note": note,
+			"decided_at":    now,
+			"updated_at":    now,
+		}).Error
+}
+
+func toProtoApproval(a *invoice_models.InvoiceApproval) *invoice_iface.Approval {
+	out := &invoice_iface.Approval{
+		Id:            a.ID,
+		TeamId:        a.TeamID,
+		ForTeamId:     a.ForTeamID,
+		Kind:          a.Kind,
+		Status:        a.Status,
+		Amount:        a.Amount,
+		BalanceType:   a.BalanceType,
+		ChangeType:    a.ChangeType,
+		Note:          a.Note,
+		RequestedById: a.RequestedByID,
+		RequestedAt:   timestamppb.New(a.RequestedAt),
+		DecisionNote:  a.DecisionNote,
+	}
+	if a.PaymentID != nil {
+		out.PaymentId = *a.PaymentID
+	}
+	if a.DecidedByID != nil {
+		out.DecidedById = *a.DecidedByID
+	}
+	if a.DecidedAt != nil {
+		out.DecidedAt = timestamppb.New(*a.DecidedAt)
+	}
+	return out
+}
+
+func toProtoApprovalPolicy(p *invoice_models.InvoiceApprovalPolicy) *invoice_iface.ApprovalPolicy {
+	out := &invoice_iface.ApprovalPolicy{
+		TeamId:              p.TeamID,
+		PaymentThreshold:    p.PaymentThreshold,
+		AdjustmentThreshold: p.AdjustmentThreshold,
+		UpdatedById:         p.UpdatedByID,
+	}
+	if !p.UpdatedAt.IsZero() {
+		out.UpdatedAt = timestamppb.New(p.UpdatedAt)
+	}
+	return out
+}
@@ -0,0 +1,98 @@
+package invoice_v2
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"connectrpc.com/connect"
+	"github.com/pdcgo/invoice_service/invoice_models"
+	invoice_iface "github.com/pdcgo/schema/services/invoice_iface/v2"
+	"github.com/pdcgo/user_service/access_interceptors"
+	"gorm.io/gorm"
+)
+
+// ApprovalApprove implements [invoice_ifaceconnect.InvoiceServiceHandler].
+//
+// The checker approves a pending approval of the scoped team, which must be held by a
+// different user than the one who requested it. The held action posts now, in the
+// same transaction: a PAYMENT approval accepts the payment (partially, if that was
+// requested), an ADJUSTMENT approval posts the ledger change. The ledger records the
+// requester as the actor; the approver is on the approval. A payment approval is
+// refused if the payment no longer covers the held amount or was amended after the
+// hold; it must then be rejected and the payment accepted again.
+func (s *invoiceServiceImpl) ApprovalApprove(
+	ctx context.Context,
+	req *connect.Request[invoice_iface.ApprovalApproveRequest],
+) (*connect.Response[invoice_iface.ApprovalApproveResponse], error) {
+	pay := req.Msg
+
+	caller, err := access_interceptors.GetIdentityFromCtx(ctx)
+	if err != nil {
+		return nil, connect.NewError(connect.CodeUnauthenticated, err)
+	}
+	decidedBy := uint64(caller.IdentityId)
+
+	now := time.Now()
+	var a *invoice_models.InvoiceApproval
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		a, err = loadPendingApproval(tx, pay.ApprovalId, pay.TeamId)
+		if err != nil {
+			return err
+		}
+		if a.RequestedByID == decidedBy {
+			return connect.NewError(connect.CodePermissionDenied, errors.New("an approval must be decided by a different user than its requester"))
+		}
+
+		switch a.Kind {
+		case invoice_iface.ApprovalKind_APPROVAL_KIND_PAYMENT:
+			p, err := loadPendingPayment(tx, *a.PaymentID, a.ForTeamID, a.TeamID)
+			if err != nil {
+				return err
+			}
+			if a.Amount > p.Amount {
+				return connect.NewError(connect.CodeFailedPrecondition, errors.New("payment amount is below the held amount"))
+			}
+			var amended int64
+			err = tx.Model(&invoice_models.InvoicePaymentAmendment{}).
+				Where("payment_id = ? AND created_at > ?", p.ID, a.RequestedAt).
+				Count(&amended).Error
+			if err != nil {
+				return err
+			}
+			if amended > 0 {
+				return connect.NewError(connect.CodeFailedPrecondition, errors.New("payment was amended after the acceptance was held"))
+			}
+			if err := acceptPayment(tx, p, a.Amount, a.Note, a.RequestedByID, now); err != nil {
+				return err
+			}
+		case invoice_iface.ApprovalKind_APPROVAL_KIND_ADJUSTMENT:
+			err := PostBalanceLog(tx, a.TeamID, a.ForTeamID, a.ChangeType, a.Amount, a.BalanceType, a.Note, a.RequestedByID, now)
+			if err != nil {
+				return err
+			}
+		default:
+			return connect.NewError(connect.CodeInternal, errors.New("unknown approval kind"))
+		}
+
+		a.Status = invoice_iface.ApprovalStatus_APPROVAL_STATUS_APPROVED
+		a.DecidedByID = &decidedBy
+		a.DecidedAt = &now
+		a.DecisionNote = pay.Note
+		a.UpdatedAt = now
+		return tx.Model(&invoice_models.InvoiceApproval{}).
+			Where("id = ?", a.ID).
+			Updates(map[string]interface{}{
+				"status":        a.Status,
+				"decided_by_id": decidedBy,
+				"decided_at":    now,
+				"decision_note": pay.Note,
+				"updated_at":    now,
+			}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return connect.NewResponse(&invoice_iface.ApprovalApproveResponse{Approval: toProtoApproval(a)}), nil
+}
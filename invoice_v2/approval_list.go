@@ -0,0 +1,64 @@
+package invoice_v2
+
+import (
+	"context"
+	"errors"
+
+	"connectrpc.com/connect"
+	"github.com/pdcgo/invoice_service/invoice_models"
+	"github.com/pdcgo/schema/services/common/v1"
+	invoice_iface "github.com/pdcgo/schema/services/invoice_iface/v2"
+	"github.com/pdcgo/shared/db_connect"
+	"gorm.io/gorm"
+)
+
+// ApprovalList implements [invoice_ifaceconnect.InvoiceServiceHandler]. It lists the
+// scoped team's approvals with their trail (requester, decider, decision note),
+// newest first, optionally filtered by kind and status — e.g. status PENDING is the
+// checker's queue.
+func (s *invoiceServiceImpl) ApprovalList(
+	ctx context.Context,
+	req *connect.Request[invoice_iface.ApprovalListRequest],
+) (*connect.Response[invoice_iface.ApprovalListResponse], error) {
+	pay := req.Msg
+	if pay.Page == nil {
+		return nil, connect.NewError(connect.CodeInvalidArgument, errors.New("page is required"))
+	}
+
+	result := &invoice_iface.ApprovalListResponse{
+		Approvals: []*invoice_iface.Approval{},
+		PageInfo:  &common.PageInfo{},
+	}
+	db := s.db.WithContext(ctx)
+
+	var rows []*invoice_models.InvoiceApproval
+	paginated, pageInfo, err := db_connect.SetPaginationQuery(db, func() (*gorm.DB, error) {
+		query := db.
+			Model(&invoice_models.InvoiceApproval{}).
+			Scopes(func(d *gorm.DB) *gorm.DB {
+				d = d.Where("team_id = ?", pay.TeamId)
+				if pay.Kind != invoice_iface.ApprovalKind_APPROVAL_KIND_UNSPECIFIED {
+					d = d.Where("kind = ?", pay.Kind)
+				}
+				if pay.Status != invoice_iface.ApprovalStatus_APPROVAL_STATUS_UNSPECIFIED {
+					d = d.Where("status = ?", pay.Status)
+				}
+				return d
+			})
+		return query, nil
+	}, pay.Page)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := paginated.Order("id DESC").Find(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	result.PageInfo = pageInfo
+	for _, row := range rows {
+		result.Approvals = append(result.Approvals, toProtoApproval(row))
+	}
+
+	return connect.NewResponse(result), nil
+}
@@ -0,0 +1,32 @@
+package invoice_v2
+
+import (
+	"context"
+
+	"connectrpc.com/connect"
+	"github.com/pdcgo/invoice_service/invoice_models"
+	invoice_iface "github.com/pdcgo/schema/services/invoice_iface/v2"
+)
+
+// ApprovalPolicyGet implements [invoice_ifaceconnect.InvoiceServiceHandler]. It
+// returns the team's maker-checker thresholds; a team without a policy gets zero
+// thresholds (no approval needed).
+func (s *invoiceServiceImpl) ApprovalPolicyGet(
+	ctx context.Context,
+	req *connect.Request[invoice_iface.ApprovalPolicyGetRequest],
+) (*connect.Response[invoice_iface.ApprovalPolicyGetResponse], error) {
+	pay := req.Msg
+
+	policy := invoice_models.InvoiceApprovalPolicy{TeamID: pay.TeamId}
+	err := s.db.
+		WithContext(ctx).
+		Where("team_id = ?", pay.TeamId).
+		Limit(1).
+		Find(&policy).
+		Error
+	if err != nil {
+		return nil, err
+	}
+
+	return connect.NewResponse(&invoice_iface.ApprovalPolicyGetResponse{Policy: toProtoApprovalPolicy(&policy)}), nil
+}
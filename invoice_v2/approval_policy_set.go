@@ -0,0 +1,59 @@
+package invoice_v2
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"connectrpc.com/connect"
+	"github.com/pdcgo/invoice_service/invoice_models"
+	invoice_iface "github.com/pdcgo/schema/services/invoice_iface/v2"
+	"github.com/pdcgo/user_service/access_interceptors"
+	"gorm.io/gorm/clause"
+)
+
+// ApprovalPolicySet implements [invoice_ifaceconnect.InvoiceServiceHandler]. It
+// upserts the team's maker-checker thresholds: payment_threshold for accepting
+// payments made to the team and adjustment_threshold for manual ADJUSTMENTs of its
+// balance (0 disables either). Approvals already pending are not affected.
+func (s *invoiceServiceImpl) ApprovalPolicySet(
+	ctx context.Context,
+	req *connect.Request[invoice_iface.ApprovalPolicySetRequest],
+) (*connect.Response[invoice_iface.ApprovalPolicySetResponse], error) {
+	pay := req.Msg
+
+	if pay.TeamId == 0 {
+		return nil, connect.NewError(connect.CodeInvalidArgument, errors.New("team_id is required"))
+	}
+	if pay.PaymentThreshold < 0 || pay.AdjustmentThreshold < 0 {
+		return nil, connect.NewError(connect.CodeInvalidArgument, errors.New("thresholds must not be negative"))
+	}
+
+	caller, err := access_interceptors.GetIdentityFromCtx(ctx)
+	if err != nil {
+		return nil, connect.NewError(connect.CodeUnauthenticated, err)
+	}
+
+	now := time.Now()
+	row := invoice_models.InvoiceApprovalPolicy{
+		TeamID:              pay.TeamId,
+		PaymentThreshold:    pay.PaymentThreshold,
+		AdjustmentThreshold: pay.AdjustmentThreshold,
+		UpdatedByID:         uint64(caller.IdentityId),
+		CreatedAt:           now,
+		UpdatedAt:           now,
+	}
+	err = s.db.
+		WithContext(ctx).
+		Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "team_id"}},
+			DoUpdates: clause.AssignmentColumns([]string{"payment_threshold", "adjustment_threshold", "updated_by_id", "updated_at"}),
+		}).
+		Create(&row).
+		Error
+	if err != nil {
+		return nil, err
+	}
+
+	return connect.NewResponse(&invoice_iface.ApprovalPolicySetResponse{Policy: toProtoApprovalPolicy(&row)}), nil
+}
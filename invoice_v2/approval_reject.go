@@ -0,0 +1,66 @@
+package invoice_v2
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"connectrpc.com/connect"
+	"github.com/pdcgo/invoice_service/invoice_models"
+	invoice_iface "github.com/pdcgo/schema/services/invoice_iface/v2"
+	"github.com/pdcgo/user_service/access_interceptors"
+	"gorm.io/gorm"
+)
+
+// ApprovalReject implements [invoice_ifaceconnect.InvoiceServiceHandler].
+//
+// A pending approval of the scoped team is rejected with a reason and its action is
+// dropped: nothing posts. A held payment acceptance leaves the payment PENDING, to be
+// accepted again or rejected. The requester may reject (withdraw) their own request.
+func (s *invoiceServiceImpl) ApprovalReject(
+	ctx context.Context,
+	req *connect.Request[invoice_iface.ApprovalRejectRequest],
+) (*connect.Response[invoice_iface.ApprovalRejectResponse], error) {
+	pay := req.Msg
+
+	reason := strings.TrimSpace(pay.Reason)
+	if reason == "" {
+		return nil, connect.NewError(connect.CodeInvalidArgument, errors.New("reason is required"))
+	}
+
+	caller, err := access_interceptors.GetIdentityFromCtx(ctx)
+	if err != nil {
+		return nil, connect.NewError(connect.CodeUnauthenticated, err)
+	}
+	decidedBy := uint64(caller.IdentityId)
+
+	now := time.Now()
+	var a *invoice_models.InvoiceApproval
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		a, err = loadPendingApproval(tx, pay.ApprovalId, pay.TeamId)
+		if err != nil {
+			return err
+		}
+
+		a.Status = invoice_iface.ApprovalStatus_APPROVAL_STATUS_REJECTED
+		a.DecidedByID = &decidedBy
+		a.DecidedAt = &now
+		a.DecisionNote = reason
+		a.UpdatedAt = now
+		return tx.Model(&invoice_models.InvoiceApproval{}).
+			Where("id = ?", a.ID).
+			Updates(map[string]interface{}{
+				"status":        a.Status,
+				"decided_by_id": decidedBy,
+				"decided_at":    now,
+				"decision_note": reason,
+				"updated_at":    now,
+			}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return connect.NewResponse(&invoice_iface.ApprovalRejectResponse{Approval: toProtoApproval(a)}), nil
+}
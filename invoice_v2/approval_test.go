@@ -0,0 +1,252 @@
+package invoice_v2_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"connectrpc.com/connect"
+	"github.com/pdcgo/invoice_service/invoice_models"
+	"github.com/pdcgo/invoice_service/invoice_v2"
+	"github.com/pdcgo/schema/services/common/v1"
+	invoice_iface "github.com/pdcgo/schema/services/invoice_iface/v2"
+	role_base "github.com/pdcgo/schema/services/role_base/v1"
+	"github.com/pdcgo/shared/pkg/moretest"
+	"github.com/pdcgo/shared/pkg/moretest/moretest_mock"
+	"github.com/pdcgo/user_service/access_interceptors"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func TestApproval(t *testing.T) {
+	var scenario moretest_mock.DbScenario
+
+	moretest.Suite(t, "maker-checker approval",
+		moretest.SetupListFunc{
+			moretest_mock.MockPostgresDatabase(&scenario),
+		},
+		func(t *testing.T) {
+			scenario(t, func(tx *gorm.DB) {
+				assert.NoError(t, tx.AutoMigrate(
+					&invoice_models.InvoicePayment{},
+					&invoice_models.InvoicePaymentAmendment{},
+					&invoice_models.InvoicePaymentSelection{},
+					&invoice_models.InvoiceApprovalPolicy{},
+					&invoice_models.InvoiceApproval{},
+					&invoice_models.TeamBalance{},
+					&invoice_models.BalanceChangeLog{},
+					&invoice_models.OweLimitAlertLevel{},
+					&invoice_models.BalanceOpenItem{},
+					&invoice_models.BalanceOpenItemAllocation{},
+					&invoice_models.BalanceChangePaymentSource{},
+					&invoice_models.TeamBalanceDailyLog{},
+				))
+
+				svc := invoice_v2.NewInvoiceService(tx)
+				maker := access_interceptors.SetIdentityToCtx(context.Background(), &role_base.Identity{IdentityId: 7})
+				checker := access_interceptors.SetIdentityToCtx(context.Background(), &role_base.Identity{IdentityId: 8})
+
+				balanceOf := func(teamID, forTeamID uint64, bt invoice_iface.BalanceType) float64 {
+					var b invoice_models.TeamBalance
+					assert.NoError(t, tx.Where("team_id = ? AND for_team_id = ? AND balance_type = ?", teamID, forTeamID, bt).Limit(1).Find(&b).Error)
+					return b.Balance
+				}
+				paymentStatus := func(id uint64) invoice_iface.PaymentStatus {
+					var p invoice_models.InvoicePayment
+					assert.NoError(t, tx.First(&p, id).Error)
+					return p.Status
+				}
+				createPayment := func(amount float64) uint64 {
+					res, err := svc.CreatePayment(maker, connect.NewRequest(&invoice_iface.CreatePaymentRequest{
+						TeamId: 1, ForTeamId: 2, Amount: amount,
+					}))
+					assert.NoError(t, err)
+					return res.Msg.Id
+				}
+				accept := func(id uint64) (*invoice_iface.Approval, error) {
+					res, err := svc.AcceptPayment(maker, connect.NewRequest(&invoice_iface.AcceptPaymentRequest{
+						TeamId: 1, ForTeamId: 2, PaymentId: id,
+					}))
+					if err != nil {
+						return nil, err
+					}
+					return res.Msg.GetApproval(), nil
+				}
+				approve := func(ctx context.Context, id uint64) (*invoice_iface.Approval, error) {
+					res, err := svc.ApprovalApprove(ctx, connect.NewRequest(&invoice_iface.ApprovalApproveRequest{
+						TeamId: 2, ApprovalId: id,
+					}))
+					if err != nil {
+						return nil, err
+					}
+					return res.Msg.GetApproval(), nil
+				}
+
+				_, err := svc.ApprovalPolicySet(maker, connect.NewRequest(&invoice_iface.ApprovalPolicySetRequest{
+					TeamId: 2, PaymentThreshold: 100, AdjustmentThreshold: 50,
+				}))
+				assert.NoError(t, err)
+
+				t.Run("large acceptance is held until a second user approves", func(t *testing.T) {
+					id := createPayment(150)
+					held, err := accept(id)
+					assert.NoError(t, err)
+					if !assert.NotNil(t, held) {
+						return
+					}
+					assert.Equal(t, invoice_iface.ApprovalStatus_APPROVAL_STATUS_PENDING, held.Status)
+					assert.Equal(t, pending, paymentStatus(id))
+					assert.Equal(t, float64(0), balanceOf(1, 2, receivable))
+
+					_, err = accept(id)
+					assert.Equal(t, connect.CodeFailedPrecondition, connect.CodeOf(err))
+
+					_, err = approve(maker, held.Id)
+					assert.Equal(t, connect.CodePermissionDenied, connect.CodeOf(err))
+
+					done, err := approve(checker, held.Id)
+					assert.NoError(t, err)
+					assert.Equal(t, invoice_iface.ApprovalStatus_APPROVAL_STATUS_APPROVED, done.Status)
+					assert.Equal(t, uint64(8), done.DecidedById)
+					assert.Equal(t, accepted, paymentStatus(id))
+					assert.Equal(t, float64(150), balanceOf(1, 2, receivable))
+				})
+
+				t.Run("small acceptance posts directly", func(t *testing.T) {
+					id := createPayment(80)
+					held, err := accept(id)
+					assert.NoError(t, err)
+					assert.Nil(t, held)
+					assert.Equal(t, accepted, paymentStatus(id))
+				})
+
+				t.Run("canceling a held payment cancels its approval", func(t *testing.T) {
+					id := createPayment(200)
+					held, err := accept(id)
+					assert.NoError(t, err)
+					_, err = svc.CancelPayment(maker, connect.NewRequest(&invoice_iface.CancelPaymentRequest{
+						TeamId: 1, ForTeamId: 2, PaymentId: id,
+					}))
+					assert.NoError(t, err)
+
+					_, err = approve(checker, held.Id)
+					assert.Equal(t, connect.CodeFailedPrecondition, connect.CodeOf(err))
+				})
+
+				t.Run("large adjustment is held; rejection drops it", func(t *testing.T) {
+					adjust := func(amount float64) *invoice_iface.Approval {
+						res, err := svc.CreateBalanceLog(maker, connect.NewRequest(&invoice_iface.CreateBalanceLogRequest{
+							TeamId:       2,
+							ForTeamId:    1,
+							ChangeType:   invoice_iface.BalanceChangeType_BALANCE_CHANGE_TYPE_ADJUSTMENT,
+							ChangeAmount: amount,
+							BalanceType:  receivable,
+							Note:         "manual",
+						}))
+						assert.NoError(t, err)
+						return res.Msg.GetApproval()
+					}
+					before := balanceOf(2, 1, receivable)
+					assert.Nil(t, adjust(40))
+					assert.Equal(t, before+40, balanceOf(2, 1, receivable))
+
+					held := adjust(60)
+					if !assert.NotNil(t, held) {
+						return
+					}
+					assert.Equal(t, invoice_iface.ApprovalKind_APPROVAL_KIND_ADJUSTMENT, held.Kind)
+					assert.Equal(t, before+40, balanceOf(2, 1, receivable))
+
+					_, err := svc.ApprovalReject(checker, connect.NewRequest(&invoice_iface.ApprovalRejectRequest{
+						TeamId: 2, ApprovalId: held.Id,
+					}))
+					assert.Equal(t, connect.CodeInvalidArgument, connect.CodeOf(err))
+					res, err := svc.ApprovalReject(checker, connect.NewRequest(&invoice_iface.ApprovalRejectRequest{
+						TeamId: 2, ApprovalId: held.Id, Reason: "no backing document",
+					}))
+					assert.NoError(t, err)
+					assert.Equal(t, invoice_iface.ApprovalStatus_APPROVAL_STATUS_REJECTED, res.Msg.GetApproval().Status)
+					assert.Equal(t, before+40, balanceOf(2, 1, receivable))
+				})
+
+				t.Run("trail is queryable", func(t *testing.T) {
+					list := func(status invoice_iface.ApprovalStatus) []*invoice_iface.Approval {
+						res, err := svc.ApprovalList(checker, connect.NewRequest(&invoice_iface.ApprovalListRequest{
+							TeamId: 2,
+							Status: status,
+							Page:   &common.PageFilter{Page: 1, Limit: 10},
+						}))
+						assert.NoError(t, err)
+						return res.Msg.Approvals
+					}
+					assert.Len(t, list(invoice_iface.ApprovalStatus_APPROVAL_STATUS_UNSPECIFIED), 3)
+					assert.Empty(t, list(invoice_iface.ApprovalStatus_APPROVAL_STATUS_PENDING))
+					if canceled := list(invoice_iface.ApprovalStatus_APPROVAL_STATUS_CANCELED); assert.Len(t, canceled, 1) {
+						assert.Equal(t, uint64(7), canceled[0].RequestedById)
+					}
+				})
+
+				t.Run("a held payment is not amended under the approver", func(t *testing.T) {
+					id := createPayment(150)
+					held, err := accept(id)
+					assert.NoError(t, err)
+					if !assert.NotNil(t, held) {
+						return
+					}
+
+					_, err = svc.AmendPayment(maker, connect.NewRequest(&invoice_iface.AmendPaymentRequest{
+						TeamId: 1, ForTeamId: 2, PaymentId: id, Amount: 120,
+					}))
+					assert.Equal(t, connect.CodeFailedPrecondition, connect.CodeOf(err))
+
+					// changes that got past the hold anyway are refused on approval.
+					assert.NoError(t, tx.Model(&invoice_models.InvoicePayment{}).Where("id = ?", id).Update("amount", 120).Error)
+					_, err = approve(checker, held.Id)
+					assert.Equal(t, connect.CodeFailedPrecondition, connect.CodeOf(err))
+
+					assert.NoError(t, tx.Model(&invoice_models.InvoicePayment{}).Where("id = ?", id).Update("amount", 150).Error)
+					assert.NoError(t, tx.Create(&invoice_models.InvoicePaymentAmendment{
+						PaymentID:      id,
+						PreviousAmount: 150,
+						NewAmount:      150,
+						NewNote:        "edited",
+						AmendedByID:    7,
+						CreatedAt:      time.Now(),
+					}).Error)
+					_, err = approve(checker, held.Id)
+					assert.Equal(t, connect.CodeFailedPrecondition, connect.CodeOf(err))
+					assert.Equal(t, pending, paymentStatus(id))
+				})
+
+				t.Run("a large manual posting of another change type is held too", func(t *testing.T) {
+					before := balanceOf(2, 1, receivable)
+					res, err := svc.CreateBalanceLog(maker, connect.NewRequest(&invoice_iface.CreateBalanceLogRequest{
+						TeamId:       2,
+						ForTeamId:    1,
+						ChangeType:   invoice_iface.BalanceChangeType_BALANCE_CHANGE_TYPE_WAREHOUSE_FEE,
+						ChangeAmount: 500,
+						BalanceType:  receivable,
+						Note:         "manual fee",
+					}))
+					assert.NoError(t, err)
+					held := res.Msg.GetApproval()
+					if !assert.NotNil(t, held) {
+						return
+					}
+					assert.Equal(t, invoice_iface.BalanceChangeType_BALANCE_CHANGE_TYPE_WAREHOUSE_FEE, held.ChangeType)
+					assert.Equal(t, before, balanceOf(2, 1, receivable))
+
+					_, err = approve(checker, held.Id)
+					assert.NoError(t, err)
+					assert.Equal(t, before+500, balanceOf(2, 1, receivable))
+
+					var changeTypes []invoice_iface.BalanceChangeType
+					assert.NoError(t, tx.Model(&invoice_models.BalanceChangeLog{}).
+						Where("team_id = ? AND for_team_id = ?", 2, 1).
+						Order("id DESC").Limit(1).Pluck("change_type", &changeTypes).Error)
+					assert.Equal(t, []invoice_iface.BalanceChangeType{invoice_iface.BalanceChangeType_BALANCE_CHANGE_TYPE_WAREHOUSE_FEE}, changeTypes)
+				})
+			})
+		},
+	)
+}
@@ -20,3 +20,35 @@ func toProtoBalanceChangeLog(l *invoice_models.BalanceChangeLog) *invoice_iface.
 		CreatedAt:    timestamppb.New(l.CreatedAt),
 	}
 }
+
+// toProtoTeamBalance maps a stored TeamBalance to its proto representation.
+func toProtoTeamBalance(b *invoice_models.TeamBalance) *invoice_iface.TeamBalance {
+	return &invoice_iface.TeamBalance{
+		Id:                   b.ID,
+		TeamId:               b.TeamID,
+		ForTeamId:            b.ForTeamID,
+		BalanceType:          b.BalanceType,
+		Balance:              b.Balance,
+		PendingPaymentAmount: b.PendingPaymentAmount,
+		CreatedAt:            timestamppb.New(b.CreatedAt),
+		UpdatedAt:            timestamppb.New(b.UpdatedAt),
+	}
+}
+
+// toProtoOrderSource maps a stored BalanceChangeOrderSource to its proto representation.
+func toProtoOrderSource(s *invoice_models.BalanceChangeOrderSource) *invoice_iface.BalanceChangeOrderSource {
+	out := &invoice_iface.BalanceChangeOrderSource{
+		BalanceChangeLogId: s.BalanceChangeLogID,
+		OrderSystem:        s.OrderSystem,
+		OrderId:            s.OrderID,
+		TeamId:             s.TeamID,
+		WarehouseId:        s.WarehouseID,
+		FeeRuleId:          s.FeeRuleID,
+		CreatedAt:          timestamppb.New(s.CreatedAt),
+	}
+	if s.FeeRuleVersion != nil {
+		version := int32(*s.FeeRuleVersion)
+		out.FeeRuleVersion = &version
+	}
+	return out
+}
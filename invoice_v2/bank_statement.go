@@ -0,0 +1,263 @@
+package invoice_v2
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"math"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"connectrpc.com/connect"
+	"github.com/pdcgo/invoice_service/bank_statement"
+	"github.com/pdcgo/invoice_service/invoice_models"
+	invoice_iface "github.com/pdcgo/schema/services/invoice_iface/v2"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"gorm.io/gorm"
+)
+
+// defaultDateToleranceDays is how many calendar days a bank line may be booked before
+// or after the payment was created and still match it.
+const defaultDateToleranceDays = 3
+
+// BankStatementInput is one statement file to import for a receiving team.
+type BankStatementInput struct {
+	TeamID            uint64
+	Format            string
+	FileName          string
+	Content           []byte
+	DateToleranceDays int
+}
+
+// ImportStatement parses a bank statement and matches its credit lines to the PENDING
+// payments made to in.TeamID, storing the import and one BankStatementLine per credit.
+// Nothing is accepted: MATCHED lines only propose their payment for AcceptPayment.
+//
+// A pending payment is a candidate for a line when the amounts are equal to the cent
+// and the line is booked within DateToleranceDays of the payment's (Jakarta) creation
+// day. Lines are matched in file order and each payment is proposed at most once:
+// first every line whose reference or description contains a candidate's document id
+// (REFERENCE, the closest date wins), then the remaining lines with exactly one
+// candidate left (AMOUNT_DATE). A line with several candidates is AMBIGUOUS, one with
+// none UNMATCHED. The same file (by content hash) cannot be imported twice by a team.
+func ImportStatement(
+	tx *gorm.DB,
+	in BankStatementInput,
+	createdBy uint64,
+	now time.Time,
+) (*invoice_models.BankStatementImport, []invoice_models.BankStatementLine, error) {
+	if in.TeamID == 0 {
+		return nil, nil, connect.NewError(connect.CodeInvalidArgument, errors.New("team_id is required"))
+	}
+	if len(in.Content) == 0 {
+		return nil, nil, connect.NewError(connect.CodeInvalidArgument, errors.New("content is required"))
+	}
+	if in.DateToleranceDays < 0 {
+		return nil, nil, connect.NewError(connect.CodeInvalidArgument, errors.New("date_tolerance_days must not be negative"))
+	}
+	tolerance := in.DateToleranceDays
+	if tolerance == 0 {
+		tolerance = defaultDateToleranceDays
+	}
+	format := strings.ToLower(in.Format)
+	if format == "" {
+		format = formatFromFileName(in.FileName)
+	}
+	if format == "" {
+		return nil, nil, connect.NewError(connect.CodeInvalidArgument, errors.New("format is required"))
+	}
+	parsed, err := bank_statement.Parse(format, bytes.NewReader(in.Content))
+	if err != nil {
+		return nil, nil, connect.NewError(connect.CodeInvalidArgument, err)
+	}
+
+	sum := sha256.Sum256(in.Content)
+	hash := hex.EncodeToString(sum[:])
+	var existing int64
+	err = tx.Model(&invoice_models.BankStatementImport{}).
+		Where("team_id = ? AND content_hash = ?", in.TeamID, hash).
+		Count(&existing).Error
+	if err != nil {
+		return nil, nil, err
+	}
+	if existing > 0 {
+		return nil, nil, connect.NewError(connect.CodeAlreadyExists, errors.New("statement already imported"))
+	}
+
+	var pending []invoice_models.InvoicePayment
+	if len(parsed) > 0 {
+		from, to := parsed[0].Date, parsed[0].Date
+		for _, l := range parsed {
+			if l.Date.Before(from) {
+				from = l.Date
+			}
+			if l.Date.After(to) {
+				to = l.Date
+			}
+		}
+		// widen by a day on each side so the Jakarta day comparison below decides.
+		err = tx.
+			Where("for_team_id = ? AND status = ?", in.TeamID, invoice_iface.PaymentStatus_PAYMENT_STATUS_PENDING).
+			Where("created_at >= ? AND created_at < ?",
+				from.AddDate(0, 0, -tolerance-1), to.AddDate(0, 0, tolerance+2)).
+			Order("created_at, id").
+			Find(&pending).Error
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	imp := invoice_models.BankStatementImport{
+		TeamID:      in.TeamID,
+		ContentHash: hash,
+		Format:      format,
+		FileName:    in.FileName,
+		LineCount:   len(parsed),
+		CreatedByID: createdBy,
+		CreatedAt:   now,
+	}
+	lines := matchStatementLines(parsed, pending, tolerance)
+	for _, l := range lines {
+		if l.MatchStatus == invoice_iface.BankLineMatchStatus_BANK_LINE_MATCH_STATUS_MATCHED {
+			imp.MatchedCount++
+		}
+	}
+	if err := tx.Create(&imp).Error; err != nil {
+		return nil, nil, err
+	}
+	for i := range lines {
+		lines[i].ImportID = imp.ID
+		lines[i].TeamID = in.TeamID
+		lines[i].CreatedAt = now
+	}
+	if len(lines) > 0 {
+		if err := tx.Create(&lines).Error; err != nil {
+			return nil, nil, err
+		}
+	}
+	return &imp, lines, nil
+}
+
+// matchStatementLines pairs parsed lines with pending payments as described on
+// ImportStatement. pending is ordered by creation.
+func matchStatementLines(
+	parsed []bank_statement.Line,
+	pending []invoice_models.InvoicePayment,
+	tolerance int,
+) []invoice_models.BankStatementLine {
+	lines := make([]invoice_models.BankStatementLine, len(parsed))
+	used := make([]bool, len(pending))
+
+	candidates := func(l bank_statement.Line) []int {
+		var out []int
+		for i := range pending {
+			if used[i] || toCents(pending[i].Amount) != toCents(l.Amount) {
+				continue
+			}
+			if daysApart(l.Date, pending[i].CreatedAt) <= tolerance {
+				out = append(out, i)
+			}
+		}
+		return out
+	}
+	match := func(i int, p int, kind invoice_iface.BankLineMatchKind) {
+		used[p] = true
+		id := pending[p].ID
+		lines[i].MatchStatus = invoice_iface.BankLineMatchStatus_BANK_LINE_MATCH_STATUS_MATCHED
+		lines[i].MatchKind = kind
+		lines[i].PaymentID = &id
+	}
+
+	for i, l := range parsed {
+		lines[i] = invoice_models.BankStatementLine{
+			LineNo:      l.LineNo,
+			Date:        l.Date,
+			Amount:      l.Amount,
+			Reference:   l.Reference,
+			Description: l.Description,
+			MatchStatus: invoice_iface.BankLineMatchStatus_BANK_LINE_MATCH_STATUS_UNMATCHED,
+		}
+	}
+
+	// Pass 1: document id found in the reference or description.
+	for i, l := range parsed {
+		text := strings.ToLower(l.Reference + " " + l.Description)
+		var byRef []int
+		for _, p := range candidates(l) {
+			doc := strings.ToLower(strings.TrimSpace(pending[p].DocumentID))
+			if doc != "" && strings.Contains(text, doc) {
+				byRef = append(byRef, p)
+			}
+		}
+		if len(byRef) == 0 {
+			continue
+		}
+		sort.SliceStable(byRef, func(a, b int) bool {
+			return daysApart(l.Date, pending[byRef[a]].CreatedAt) < daysApart(l.Date, pending[byRef[b]].CreatedAt)
+		})
+		match(i, byRef[0], invoice_iface.BankLineMatchKind_BANK_LINE_MATCH_KIND_REFERENCE)
+	}
+
+	// Pass 2: amount and date alone, only when unambiguous.
+	for i, l := range parsed {
+		if lines[i].PaymentID != nil {
+			continue
+		}
+		switch c := candidates(l); len(c) {
+		case 0:
+		case 1:
+			match(i, c[0], invoice_iface.BankLineMatchKind_BANK_LINE_MATCH_KIND_AMOUNT_DATE)
+		default:
+			lines[i].MatchStatus = invoice_iface.BankLineMatchStatus_BANK_LINE_MATCH_STATUS_AMBIGUOUS
+		}
+	}
+	return lines
+}
+
+// daysApart is the number of calendar days between a statement booking date and the
+// Jakarta day a payment was created on.
+func daysApart(booked time.Time, created time.Time) int {
+	b := time.Date(booked.Year(), booked.Month(), booked.Day(), 0, 0, 0, 0, time.UTC)
+	c := startOfJakartaDay(created)
+	c = time.Date(c.Year(), c.Month(), c.Day(), 0, 0, 0, 0, time.UTC)
+	d := int(b.Sub(c).Hours() / 24)
+	if d < 0 {
+		d = -d
+	}
+	return d
+}
+
+func toCents(amount float64) int64 {
+	return int64(math.Round(amount * 100))
+}
+
+func toProtoBankStatementLine(l *invoice_models.BankStatementLine) *invoice_iface.BankStatementLine {
+	out := &invoice_iface.BankStatementLine{
+		Id:          l.ID,
+		LineNo:      int64(l.LineNo),
+		Date:        timestamppb.New(l.Date),
+		Amount:      l.Amount,
+		Reference:   l.Reference,
+		Description: l.Description,
+		MatchStatus: l.MatchStatus,
+		MatchKind:   l.MatchKind,
+	}
+	if l.PaymentID != nil {
+		out.PaymentId = *l.PaymentID
+	}
+	return out
+}
+
+// formatFromFileName guesses a statement format from a file extension when the
+// caller does not name one.
+func formatFromFileName(name string) string {
+	switch ext := strings.ToLower(strings.TrimPrefix(filepath.Ext(name), ".")); ext {
+	case "sta", "mt940", "940":
+		return "mt940"
+	default:
+		return ext
+	}
+}
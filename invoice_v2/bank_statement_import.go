@@ -0,0 +1,59 @@
+package invoice_v2
+
+import (
+	"context"
+	"time"
+
+	"connectrpc.com/connect"
+	"github.com/pdcgo/invoice_service/invoice_models"
+	invoice_iface "github.com/pdcgo/schema/services/invoice_iface/v2"
+	"github.com/pdcgo/user_service/access_interceptors"
+	"gorm.io/gorm"
+)
+
+// ImportBankStatement implements [invoice_ifaceconnect.InvoiceServiceHandler].
+//
+// The receiving team (team_id) uploads a bank statement (csv or mt940; guessed from
+// file_name when format is empty) and gets each credit line back with the pending
+// payment it matched, if any. MATCHED lines carry the payment_id to pass to
+// AcceptPayment; UNMATCHED and AMBIGUOUS lines need a manual look. Matching rules are
+// described on [ImportStatement].
+func (s *invoiceServiceImpl) ImportBankStatement(
+	ctx context.Context,
+	req *connect.Request[invoice_iface.ImportBankStatementRequest],
+) (*connect.Response[invoice_iface.ImportBankStatementResponse], error) {
+	pay := req.Msg
+
+	caller, err := access_interceptors.GetIdentityFromCtx(ctx)
+	if err != nil {
+		return nil, connect.NewError(connect.CodeUnauthenticated, err)
+	}
+
+	var imp *invoice_models.BankStatementImport
+	var lines []invoice_models.BankStatementLine
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var err error
+		imp, lines, err = ImportStatement(tx, BankStatementInput{
+			TeamID:            pay.TeamId,
+			Format:            pay.Format,
+			FileName:          pay.FileName,
+			Content:           pay.Content,
+			DateToleranceDays: int(pay.DateToleranceDays),
+		}, uint64(caller.IdentityId), time.Now())
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &invoice_iface.ImportBankStatementResponse{
+		ImportId:     imp.ID,
+		Lines:        make([]*invoice_iface.BankStatementLine, 0, len(lines)),
+		MatchedCount: int64(imp.MatchedCount),
+	}
+	for i := range lines {
+		resp.Lines = append(resp.Lines, toProtoBankStatementLine(&lines[i]))
+	}
+	resp.UnmatchedCount = int64(len(lines)) - resp.MatchedCount
+	return connect.NewResponse(resp), nil
+}
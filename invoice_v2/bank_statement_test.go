@@ -0,0 +1,126 @@
+package invoice_v2_test
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"connectrpc.com/connect"
+	"github.com/pdcgo/invoice_service/invoice_models"
+	"github.com/pdcgo/invoice_service/invoice_v2"
+	invoice_iface "github.com/pdcgo/schema/services/invoice_iface/v2"
+	role_base "github.com/pdcgo/schema/services/role_base/v1"
+	"github.com/pdcgo/shared/pkg/moretest"
+	"github.com/pdcgo/shared/pkg/moretest/moretest_mock"
+	"github.com/pdcgo/user_service/access_interceptors"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func TestImportBankStatement(t *testing.T) {
+	var scenario moretest_mock.DbScenario
+
+	moretest.Suite(t, "import bank statement",
+		moretest.SetupListFunc{
+			moretest_mock.MockPostgresDatabase(&scenario),
+		},
+		func(t *testing.T) {
+			scenario(t, func(tx *gorm.DB) {
+				assert.NoError(t, tx.AutoMigrate(
+					&invoice_models.InvoicePayment{},
+					&invoice_models.BankStatementImport{},
+					&invoice_models.BankStatementLine{},
+				))
+
+				content, err := os.ReadFile("testdata/bank_statement.csv")
+				assert.NoError(t, err)
+
+				// pending payments to team 2, created at noon Jakarta time.
+				day := func(d int) time.Time { return time.Date(2026, 6, d, 5, 0, 0, 0, time.UTC) }
+				payments := []invoice_models.InvoicePayment{
+					{TeamID: 1, Amount: 150000, DocumentID: "INV-001", CreatedAt: day(25)},
+					{TeamID: 3, Amount: 250000, DocumentID: "INV-002", CreatedAt: day(27)},
+					{TeamID: 4, Amount: 75000, CreatedAt: day(26)},
+					{TeamID: 5, Amount: 50000, CreatedAt: day(27)},
+					{TeamID: 6, Amount: 50000, CreatedAt: day(27)},
+					{TeamID: 1, Amount: 150000, CreatedAt: day(10)}, // outside the date tolerance
+				}
+				for i := range payments {
+					payments[i].ForTeamID = 2
+					payments[i].Status = pending
+					payments[i].CreatedByID = callerID
+					payments[i].UpdatedAt = payments[i].CreatedAt
+				}
+				assert.NoError(t, tx.Create(&payments).Error)
+
+				svc := invoice_v2.NewInvoiceService(tx)
+				ctx := access_interceptors.SetIdentityToCtx(
+					context.Background(),
+					&role_base.Identity{IdentityId: 7},
+				)
+				importFile := func() (*invoice_iface.ImportBankStatementResponse, error) {
+					res, err := svc.ImportBankStatement(ctx, connect.NewRequest(&invoice_iface.ImportBankStatementRequest{
+						TeamId:   2,
+						FileName: "statement.csv",
+						Content:  content,
+					}))
+					if err != nil {
+						return nil, err
+					}
+					return res.Msg, nil
+				}
+
+				t.Run("credit lines matched by reference, then amount and date", func(t *testing.T) {
+					res, err := importFile()
+					assert.NoError(t, err)
+					assert.Equal(t, int64(3), res.MatchedCount)
+					assert.Equal(t, int64(2), res.UnmatchedCount)
+					if !assert.Len(t, res.Lines, 5) {
+						return
+					}
+
+					matched := invoice_iface.BankLineMatchStatus_BANK_LINE_MATCH_STATUS_MATCHED
+					byRef := invoice_iface.BankLineMatchKind_BANK_LINE_MATCH_KIND_REFERENCE
+					assert.Equal(t, matched, res.Lines[0].MatchStatus)
+					assert.Equal(t, byRef, res.Lines[0].MatchKind)
+					assert.Equal(t, payments[0].ID, res.Lines[0].PaymentId)
+
+					// document id found in the description, case-insensitive.
+					assert.Equal(t, byRef, res.Lines[1].MatchKind)
+					assert.Equal(t, payments[1].ID, res.Lines[1].PaymentId)
+
+					assert.Equal(t, invoice_iface.BankLineMatchKind_BANK_LINE_MATCH_KIND_AMOUNT_DATE, res.Lines[2].MatchKind)
+					assert.Equal(t, payments[2].ID, res.Lines[2].PaymentId)
+
+					assert.Equal(t, invoice_iface.BankLineMatchStatus_BANK_LINE_MATCH_STATUS_AMBIGUOUS, res.Lines[3].MatchStatus)
+					assert.Zero(t, res.Lines[3].PaymentId)
+					assert.Equal(t, invoice_iface.BankLineMatchStatus_BANK_LINE_MATCH_STATUS_UNMATCHED, res.Lines[4].MatchStatus)
+
+					// proposals only: nothing was accepted.
+					var p invoice_models.InvoicePayment
+					assert.NoError(t, tx.First(&p, payments[0].ID).Error)
+					assert.Equal(t, pending, p.Status)
+
+					var stored int64
+					assert.NoError(t, tx.Model(&invoice_models.BankStatementLine{}).Where("import_id = ?", res.ImportId).Count(&stored).Error)
+					assert.Equal(t, int64(5), stored)
+				})
+
+				t.Run("same file cannot be imported twice", func(t *testing.T) {
+					_, err := importFile()
+					assert.Equal(t, connect.CodeAlreadyExists, connect.CodeOf(err))
+				})
+
+				t.Run("unknown format rejected", func(t *testing.T) {
+					_, err := svc.ImportBankStatement(ctx, connect.NewRequest(&invoice_iface.ImportBankStatementRequest{
+						TeamId:  2,
+						Format:  "ofx",
+						Content: content,
+					}))
+					assert.Equal(t, connect.CodeInvalidArgument, connect.CodeOf(err))
+				})
+			})
+		},
+	)
+}
@@ -0,0 +1,53 @@
+package invoice_v2
+
+import (
+	"github.com/pdcgo/invoice_service/invoice_models"
+	invoice_iface "github.com/pdcgo/schema/services/invoice_iface/v2"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// toProtoBulkPayment maps a batch and its line payments, deriving the batch status:
+// PENDING while no receiver has answered, IN_PROGRESS once some have, COMPLETED when
+// none is left pending. Accepted lines (fully or partially, even if later reversed)
+// count toward AcceptedCount/AcceptedAmount; rejected, canceled and expired lines are
+// closed unpaid.
+func toProtoBulkPayment(b *invoice_models.InvoiceBulkPayment, lines []*invoice_models.InvoicePayment) *invoice_iface.BulkPayment {
+	out := &invoice_iface.BulkPayment{
+		Id:          b.ID,
+		TeamId:      b.TeamID,
+		DocumentId:  b.DocumentID,
+		Note:        b.Note,
+		TotalAmount: b.TotalAmount,
+		Payments:    make([]*invoice_iface.Payment, 0, len(lines)),
+		CreatedById: b.CreatedByID,
+		CreatedAt:   timestamppb.New(b.CreatedAt),
+	}
+	for _, p := range lines {
+		out.Payments = append(out.Payments, toProtoPayment(p))
+		switch p.Status {
+		case invoice_iface.PaymentStatus_PAYMENT_STATUS_PENDING:
+			out.PendingCount++
+		case invoice_iface.PaymentStatus_PAYMENT_STATUS_ACCEPTED,
+			invoice_iface.PaymentStatus_PAYMENT_STATUS_PARTIALLY_ACCEPTED,
+			invoice_iface.PaymentStatus_PAYMENT_STATUS_REVERSED:
+			out.AcceptedCount++
+			if p.AcceptedAmount != nil {
+				out.AcceptedAmount += *p.AcceptedAmount
+			} else {
+				out.AcceptedAmount += p.Amount
+			}
+		default:
+			out.ClosedCount++
+		}
+	}
+
+	switch {
+	case out.PendingCount == int64(len(lines)):
+		out.Status = invoice_iface.BulkPaymentStatus_BULK_PAYMENT_STATUS_PENDING
+	case out.PendingCount == 0:
+		out.Status = invoice_iface.BulkPaymentStatus_BULK_PAYMENT_STATUS_COMPLETED
+	default:
+		out.Status = invoice_iface.BulkPaymentStatus_BULK_PAYMENT_STATUS_IN_PROGRESS
+	}
+	return out
+}
@@ -0,0 +1,153 @@
+package invoice_v2_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"connectrpc.com/connect"
+	"github.com/pdcgo/invoice_service/invoice_models"
+	"github.com/pdcgo/invoice_service/invoice_v2"
+	invoice_iface "github.com/pdcgo/schema/services/invoice_iface/v2"
+	role_base "github.com/pdcgo/schema/services/role_base/v1"
+	"github.com/pdcgo/shared/pkg/moretest"
+	"github.com/pdcgo/shared/pkg/moretest/moretest_mock"
+	"github.com/pdcgo/user_service/access_interceptors"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func TestBulkPayment(t *testing.T) {
+	var scenario moretest_mock.DbScenario
+
+	moretest.Suite(t, "bulk payment",
+		moretest.SetupListFunc{
+			moretest_mock.MockPostgresDatabase(&scenario),
+		},
+		func(t *testing.T) {
+			scenario(t, func(tx *gorm.DB) {
+				assert.NoError(t, tx.AutoMigrate(
+					&invoice_models.InvoiceBulkPayment{},
+					&invoice_models.InvoicePayment{},
+					&invoice_models.InvoicePaymentSelection{},
+					&invoice_models.InvoiceApprovalPolicy{},
+					&invoice_models.InvoiceApproval{},
+					&invoice_models.TeamBalance{},
+					&invoice_models.BalanceChangeLog{},
+					&invoice_models.OweLimitAlertLevel{},
+					&invoice_models.BalanceOpenItem{},
+					&invoice_models.BalanceOpenItemAllocation{},
+					&invoice_models.BalanceChangePaymentSource{},
+					&invoice_models.TeamBalanceDailyLog{},
+				))
+
+				svc := invoice_v2.NewInvoiceService(tx)
+				ctx := access_interceptors.SetIdentityToCtx(
+					context.Background(),
+					&role_base.Identity{IdentityId: 7},
+				)
+
+				// team 1 owes warehouse 2 100 and warehouse 3 50.
+				now := time.Now()
+				fee := invoice_iface.BalanceChangeType_BALANCE_CHANGE_TYPE_WAREHOUSE_FEE
+				assert.NoError(t, invoice_v2.PostBalanceLog(tx, 2, 1, fee, 100, receivable, "fee", callerID, now))
+				assert.NoError(t, invoice_v2.PostBalanceLog(tx, 3, 1, fee, 50, receivable, "fee", callerID, now))
+
+				bulk := func(lines ...*invoice_iface.BulkPaymentLine) (*invoice_iface.BulkPayment, error) {
+					res, err := svc.CreateBulkPayment(ctx, connect.NewRequest(&invoice_iface.CreateBulkPaymentRequest{
+						TeamId:     1,
+						DocumentId: "TRF-2026-06",
+						Note:       "month end",
+						Lines:      lines,
+					}))
+					if err != nil {
+						return nil, err
+					}
+					return res.Msg.GetBulkPayment(), nil
+				}
+				countPayments := func() int64 {
+					var n int64
+					assert.NoError(t, tx.Model(&invoice_models.InvoicePayment{}).Count(&n).Error)
+					return n
+				}
+
+				t.Run("lines validated against outstanding payable, all or nothing", func(t *testing.T) {
+					_, err := bulk(
+						&invoice_iface.BulkPaymentLine{ForTeamId: 2, Amount: 100},
+						&invoice_iface.BulkPaymentLine{ForTeamId: 3, Amount: 60},
+					)
+					assert.Equal(t, connect.CodeFailedPrecondition, connect.CodeOf(err))
+					assert.Zero(t, countPayments())
+
+					_, err = bulk(
+						&invoice_iface.BulkPaymentLine{ForTeamId: 2, Amount: 10},
+						&invoice_iface.BulkPaymentLine{ForTeamId: 2, Amount: 10},
+					)
+					assert.Equal(t, connect.CodeInvalidArgument, connect.CodeOf(err))
+				})
+
+				var batch *invoice_iface.BulkPayment
+				t.Run("one pending payment per creditor under one document", func(t *testing.T) {
+					var err error
+					batch, err = bulk(
+						&invoice_iface.BulkPaymentLine{ForTeamId: 2, Amount: 100},
+						&invoice_iface.BulkPaymentLine{ForTeamId: 3, Amount: 30, Note: "part"},
+					)
+					assert.NoError(t, err)
+					assert.Equal(t, invoice_iface.BulkPaymentStatus_BULK_PAYMENT_STATUS_PENDING, batch.Status)
+					assert.Equal(t, float64(130), batch.TotalAmount)
+					if assert.Len(t, batch.Payments, 2) {
+						for _, p := range batch.Payments {
+							assert.Equal(t, "TRF-2026-06", p.DocumentId)
+							assert.Equal(t, batch.Id, p.BulkPaymentId)
+						}
+						assert.Equal(t, "month end", batch.Payments[0].Note)
+						assert.Equal(t, "part", batch.Payments[1].Note)
+					}
+
+					// 20 left to warehouse 3 once the pending 30 is counted.
+					_, err = bulk(&invoice_iface.BulkPaymentLine{ForTeamId: 3, Amount: 30})
+					assert.Equal(t, connect.CodeFailedPrecondition, connect.CodeOf(err))
+
+					// a line is not amended on its own: that would stale the total and skip the payable check.
+					_, err = svc.AmendPayment(ctx, connect.NewRequest(&invoice_iface.AmendPaymentRequest{
+						TeamId: 1, ForTeamId: 3, PaymentId: batch.Payments[1].Id, Amount: 500, DocumentId: "TRF-2026-06",
+					}))
+					assert.Equal(t, connect.CodeFailedPrecondition, connect.CodeOf(err))
+				})
+
+				t.Run("each receiver answers its own line", func(t *testing.T) {
+					get := func() *invoice_iface.BulkPayment {
+						res, err := svc.GetBulkPayment(ctx, connect.NewRequest(&invoice_iface.GetBulkPaymentRequest{
+							TeamId: 1, BulkPaymentId: batch.Id,
+						}))
+						assert.NoError(t, err)
+						return res.Msg.GetBulkPayment()
+					}
+
+					_, err := svc.AcceptPayment(ctx, connect.NewRequest(&invoice_iface.AcceptPaymentRequest{
+						TeamId: 1, ForTeamId: 2, PaymentId: batch.Payments[0].Id,
+					}))
+					assert.NoError(t, err)
+					got := get()
+					assert.Equal(t, invoice_iface.BulkPaymentStatus_BULK_PAYMENT_STATUS_IN_PROGRESS, got.Status)
+					assert.Equal(t, float64(100), got.AcceptedAmount)
+
+					_, err = svc.RejectPayment(ctx, connect.NewRequest(&invoice_iface.RejectPaymentRequest{
+						TeamId: 1, ForTeamId: 3, PaymentId: batch.Payments[1].Id,
+					}))
+					assert.NoError(t, err)
+					got = get()
+					assert.Equal(t, invoice_iface.BulkPaymentStatus_BULK_PAYMENT_STATUS_COMPLETED, got.Status)
+					assert.Equal(t, int64(1), got.AcceptedCount)
+					assert.Equal(t, int64(1), got.ClosedCount)
+
+					_, err = svc.GetBulkPayment(ctx, connect.NewRequest(&invoice_iface.GetBulkPaymentRequest{
+						TeamId: 2, BulkPaymentId: batch.Id,
+					}))
+					assert.Equal(t, connect.CodeNotFound, connect.CodeOf(err))
+				})
+			})
+		},
+	)
+}
@@ -0,0 +1,57 @@
+package invoice_v2
+
+import (
+	"context"
+	"time"
+
+	"connectrpc.com/connect"
+	"github.com/pdcgo/invoice_service/invoice_models"
+	invoice_iface "github.com/pdcgo/schema/services/invoice_iface/v2"
+	"github.com/pdcgo/user_service/access_interceptors"
+	"gorm.io/gorm"
+)
+
+// CancelPayment implements [invoice_ifaceconnect.InvoiceServiceHandler].
+//
+// The payer withdraws its own pending payment (e.g. submitted in error): like a
+// rejection it clears the in-flight PendingPaymentAmount on both sides without
+// settling anything, and marks the payment CANCELED.
+func (s *invoiceServiceImpl) CancelPayment(
+	ctx context.Context,
+	req *connect.Request[invoice_iface.CancelPaymentRequest],
+) (*connect.Response[invoice_iface.CancelPaymentResponse], error) {
+	pay := req.Msg
+
+	caller, err := access_interceptors.GetIdentityFromCtx(ctx)
+	if err != nil {
+		return nil, connect.NewError(connect.CodeUnauthenticated, err)
+	}
+	completedBy := uint64(caller.IdentityId)
+
+	now := time.Now()
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		p, err := loadPendingPayment(tx, pay.PaymentId, pay.TeamId, pay.ForTeamId)
+		if err != nil {
+			return err
+		}
+
+		// Release the in-flight amount; balances are untouched.
+		if err := releasePending(tx, p, now); err != nil {
+			return err
+		}
+
+		return tx.Model(&invoice_models.InvoicePayment{}).
+			Where("id = ?", p.ID).
+			Updates(map[string]interface{}{
+				"status":          invoice_iface.PaymentStatus_PAYMENT_STATUS_CANCELED,
+				"canceled_at":     now,
+				"completed_by_id": completedBy,
+				"updated_at":      now,
+			}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return connect.NewResponse(&invoice_iface.CancelPaymentResponse{}), nil
+}
@@ -2,48 +2,142 @@ package invoice_v2
 
 import (
 	"context"
+	"time"
 
 	"connectrpc.com/connect"
 	"github.com/pdcgo/invoice_service/invoice_models"
 	invoice_iface "github.com/pdcgo/schema/services/invoice_iface/v2"
 	"github.com/pdcgo/shared/db_models"
+	"google.golang.org/protobuf/types/known/timestamppb"
 	"gorm.io/gorm"
 )
 
 // CheckOweLimit implements [invoice_ifaceconnect.InvoiceServiceHandler]. It reports,
 // per creditor in cfg_team_ids, whether the debtor team (team_id) may still owe them —
-// i.e. its current debt is below the creditor's configured threshold.
+// i.e. its projected debt stays within the creditor's configured threshold.
+// prospective_amounts (per creditor) is the amount about to be added, e.g. the order
+// being placed; pending_policy overrides whether pending payments count (see
+// [OweLimitQuery]). Served from the OweLimitCache when the service has one.
 func (s *invoiceServiceImpl) CheckOweLimit(
 	ctx context.Context,
 	req *connect.Request[invoice_iface.CheckOweLimitRequest],
 ) (*connect.Response[invoice_iface.CheckOweLimitResponse], error) {
 	pay := req.Msg
-	canOwe, err := EvaluateOweLimits(s.db.WithContext(ctx), pay.TeamId, pay.CfgTeamIds)
+	canOwe, err := s.oweLimitCache.Evaluate(ctx, s.db, OweLimitQuery{
+		DebtorTeamID:       pay.TeamId,
+		CreditorTeamIDs:    pay.CfgTeamIds,
+		ProspectiveAmounts: pay.ProspectiveAmounts,
+		PendingPolicy:      pay.PendingPolicy,
+	})
 	if err != nil {
 		return nil, err
 	}
 	return connect.NewResponse(&invoice_iface.CheckOweLimitResponse{CanOwe: canOwe}), nil
 }
 
-// EvaluateOweLimits is the reusable core of the CheckOweLimit RPC: a read-only owe-limit
-// evaluation for a debtor against a set of creditors, composable in-process (e.g. the v3
-// OrderCreate gate). For each creditor it resolves the owe threshold
-// (owe_limit_configurations: custom for this debtor beats the creditor's default; no config
-// = allow; threshold 0 = unlimited) and compares it to the debtor's CURRENT debt to that
-// creditor read from the invoice v2 ledger (team_balances PAYABLE, stored negative). It is
-// purely advisory — the ledger write path enforces nothing; only the caller gates on the
-// returned map.
+// OweLimitQuery is one owe-limit evaluation: a debtor against a set of creditors.
+// ProspectiveAmounts adds, per creditor, debt about to be incurred. PendingPolicy
+// decides whether the debtor's pending payments (PendingPaymentAmount) already reduce
+// its debt: UNSPECIFIED follows each creditor's OweLimitPolicy opt-in, INCLUDE and
+// EXCLUDE force it for every creditor. At is the instant owe-limit overrides are
+// matched against; zero means now. SkipAge leaves the age rules out — no ledger
+// replay and no AGE condition — for callers that only use the amount.
+type OweLimitQuery struct {
+	DebtorTeamID       uint64
+	CreditorTeamIDs    []uint64
+	ProspectiveAmounts map[uint64]float64
+	PendingPolicy      invoice_iface.OweLimitPendingPolicy
+	At                 time.Time
+	SkipAge            bool
+}
+
+// EvaluateOweLimits evaluates the debtor's current debt against the creditors' limits,
+// with pending payments counted where the creditor opted in. See EvaluateOweLimitsQuery.
 func EvaluateOweLimits(
 	db *gorm.DB,
 	debtorTeamID uint64,
 	creditorTeamIDs []uint64,
 ) (map[uint64]*invoice_iface.OweLimitAllow, error) {
-	result := make(map[uint64]*invoice_iface.OweLimitAllow, len(creditorTeamIDs))
+	return EvaluateOweLimitsQuery(db, OweLimitQuery{DebtorTeamID: debtorTeamID, CreditorTeamIDs: creditorTeamIDs})
+}
+
+// EvaluateOweLimitsQuery is the reusable core of the CheckOweLimit RPC: a read-only
+// owe-limit evaluation for a debtor against a set of creditors, composable in-process
+// (e.g. the v3 OrderCreate gate). For each creditor it resolves the owe threshold
+// (an override active at q.At beats the custom row for this debtor, which beats the
+// creditor's rule for the debtor's teams.type (OweLimitTeamTypeRule), which beats the
+// creditor's default in owe_limit_configurations; no config = allow; threshold 0 =
+// unlimited) and reports which rule decided. An expired or revoked override simply
+// stops matching, so evaluation falls back without any cleanup. The debt
+// is read from the invoice v2 ledger (team_balances PAYABLE, stored negative); the
+// projected debt is that debt, less pending payments when they count, plus the
+// prospective amount. Without a prospective amount the debtor is allowed while the
+// projected debt is below the threshold (there is room left); with one, while the
+// projected debt does not exceed it (the new debt fits). Headroom is the threshold
+// less the projected debt. A config with an age rule (OweLimitAgeRule, kept under an
+// override too) also blocks once the debtor's oldest unsettled debt, aged from the
+// ledger as in AgingReport, is more than max_age_days old; failed_conditions names
+// the condition(s) that blocked. State is BLOCKED when not allowed, WARN when allowed
+// but over the rule's soft threshold (OweLimitSoftThreshold, kept under an override
+// like the age rule), OK otherwise. It is purely advisory — the ledger write path
+// enforces nothing; only the caller gates on the returned map.
+func EvaluateOweLimitsQuery(
+	db *gorm.DB,
+	q OweLimitQuery,
+) (map[uint64]*invoice_iface.OweLimitAllow, error) {
+	at := q.At
+	if at.IsZero() {
+		at = time.Now()
+	}
+	inputs, err := loadOweLimitInputs(db, q.DebtorTeamID, q.CreditorTeamIDs, at, !q.SkipAge)
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[uint64]*invoice_iface.OweLimitAllow, len(q.CreditorTeamIDs))
+	for _, c := range q.CreditorTeamIDs {
+		result[c] = evaluateOweLimit(inputs[c], q, c, at)
+	}
+	return result, nil
+}
+
+// oweLimitInputs is everything the evaluation of one (debtor, creditor) pair reads
+// from the database, independent of the request (prospective amount, pending policy)
+// and of the clock (ages). It is what OweLimitCache keeps per pair.
+type oweLimitInputs struct {
+	HasCfg         bool                       `json:"has_cfg"`
+	Threshold      float64                    `json:"threshold"`
+	SoftThreshold  float64                    `json:"soft_threshold"`
+	Rule           invoice_iface.OweLimitRule `json:"rule"`
+	TeamType       string                     `json:"team_type"`
+	OverrideID     uint64                     `json:"override_id"`
+	OverrideEndsAt time.Time                  `json:"override_ends_at"`
+	MaxAgeDays     int64                      `json:"max_age_days"`
+	Debt           float64                    `json:"debt"`
+	Pending        float64                    `json:"pending"`
+	CountPending   bool                       `json:"count_pending"`
+	OldestDebtAt   time.Time                  `json:"oldest_debt_at"`
+	// ValidUntil is when an override of the pair starts or ends, changing the rule
+	// without any write; zero when none is due.
+	ValidUntil time.Time `json:"valid_until"`
+}
+
+// loadOweLimitInputs reads the owe-limit inputs of the debtor against each creditor
+// as of at. Every creditor gets an entry. Without withAge the oldest unsettled debt
+// is not looked up.
+func loadOweLimitInputs(
+	db *gorm.DB,
+	debtorTeamID uint64,
+	creditorTeamIDs []uint64,
+	at time.Time,
+	withAge bool,
+) (map[uint64]*oweLimitInputs, error) {
+	inputs := make(map[uint64]*oweLimitInputs, len(creditorTeamIDs))
 	for _, c := range creditorTeamIDs {
-		result[c] = &invoice_iface.OweLimitAllow{Allow: true} // no config => allow (default)
+		// no config => allow (default)
+		inputs[c] = &oweLimitInputs{Rule: invoice_iface.OweLimitRule_OWE_LIMIT_RULE_NONE}
 	}
 	if len(creditorTeamIDs) == 0 {
-		return result, nil
+		return inputs, nil
 	}
 
 	// 1. Config per creditor: the debtor-specific custom row beats the creditor's default.
@@ -58,27 +152,103 @@ func EvaluateOweLimits(
 		return nil, err
 	}
 
-	type limit struct {
-		threshold float64
-		hasCustom bool
-		hasCfg    bool
-	}
-	limits := map[uint64]*limit{}
+	configOf := map[uint64]uint64{}
 	for i := range cfgs {
 		cfg := cfgs[i]
-		l := limits[cfg.TeamID]
-		if l == nil {
-			l = &limit{}
-			limits[cfg.TeamID] = l
-		}
+		in := inputs[cfg.TeamID]
 		isCustom := !cfg.IsDefault && cfg.ForTeamID != nil && *cfg.ForTeamID == debtorTeamID
 		if isCustom {
-			l.threshold = cfg.Threshold
-			l.hasCustom = true
-			l.hasCfg = true
-		} else if cfg.IsDefault && !l.hasCustom {
-			l.threshold = cfg.Threshold
-			l.hasCfg = true
+			in.Threshold = cfg.Threshold
+			in.Rule = invoice_iface.OweLimitRule_OWE_LIMIT_RULE_CUSTOM
+			in.HasCfg = true
+			configOf[cfg.TeamID] = cfg.ID
+		} else if cfg.IsDefault && in.Rule != invoice_iface.OweLimitRule_OWE_LIMIT_RULE_CUSTOM {
+			in.Threshold = cfg.Threshold
+			in.Rule = invoice_iface.OweLimitRule_OWE_LIMIT_RULE_DEFAULT
+			in.HasCfg = true
+			configOf[cfg.TeamID] = cfg.ID
+		}
+	}
+
+	// 1a. Between the two, the creditor's rule for the debtor's team type. The type is
+	// only looked up once some creditor has such rules.
+	var typeRules []invoice_models.OweLimitTeamTypeRule
+	err = db.Where("team_id IN ?", creditorTeamIDs).Find(&typeRules).Error
+	if err != nil {
+		return nil, err
+	}
+	var debtorType string
+	if len(typeRules) > 0 {
+		err = db.Table("teams").Select("type").Where("id = ?", debtorTeamID).Limit(1).Scan(&debtorType).Error
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, r := range typeRules {
+		in := inputs[r.TeamID]
+		if r.TeamType != debtorType || in.Rule == invoice_iface.OweLimitRule_OWE_LIMIT_RULE_CUSTOM {
+			continue
+		}
+		in.Threshold = r.Threshold
+		in.SoftThreshold = r.SoftThreshold
+		in.Rule = invoice_iface.OweLimitRule_OWE_LIMIT_RULE_TEAM_TYPE
+		in.HasCfg = true
+		in.TeamType = r.TeamType
+		in.MaxAgeDays = r.MaxAgeDays
+		delete(configOf, r.TeamID)
+	}
+
+	// 1b. The deciding config's soft threshold and age rule, if any.
+	configIDs := make([]uint64, 0, len(configOf))
+	for _, id := range configOf {
+		configIDs = append(configIDs, id)
+	}
+	ages, err := ageRulesOf(db, configIDs)
+	if err != nil {
+		return nil, err
+	}
+	softs, err := softThresholdsOf(db, configIDs)
+	if err != nil {
+		return nil, err
+	}
+	for c, id := range configOf {
+		inputs[c].MaxAgeDays = ages[id]
+		inputs[c].SoftThreshold = softs[id]
+	}
+	var aged []uint64
+	for c, in := range inputs {
+		if withAge && in.MaxAgeDays > 0 {
+			aged = append(aged, c)
+		}
+	}
+
+	// 1c. An override active at `at` beats both; it replaces the threshold only. Later
+	// ones bound how long the inputs hold.
+	var overrides []invoice_models.OweLimitOverride
+	err = db.
+		Where("team_id IN ? AND for_team_id = ?", creditorTeamIDs, debtorTeamID).
+		Where("ends_at > ? AND revoked_at IS NULL", at).
+		Order("starts_at, id").
+		Find(&overrides).
+		Error
+	if err != nil {
+		return nil, err
+	}
+	for i := range overrides {
+		o := &overrides[i]
+		in := inputs[o.TeamID]
+		boundary := o.StartsAt
+		if !o.StartsAt.After(at) {
+			// windows of one pair never overlap; the latest start wins should they.
+			in.Threshold = o.Threshold
+			in.Rule = invoice_iface.OweLimitRule_OWE_LIMIT_RULE_OVERRIDE
+			in.HasCfg = true
+			in.OverrideID = o.ID
+			in.OverrideEndsAt = o.EndsAt
+			boundary = o.EndsAt
+		}
+		if in.ValidUntil.IsZero() || boundary.Before(in.ValidUntil) {
+			in.ValidUntil = boundary
 		}
 	}
 
@@ -94,26 +264,92 @@ func EvaluateOweLimits(
 	if err != nil {
 		return nil, err
 	}
-	debtOf := map[uint64]float64{}
 	for _, b := range balances {
-		debtOf[b.ForTeamID] = -b.Balance
+		inputs[b.ForTeamID].Debt = -b.Balance
+		inputs[b.ForTeamID].Pending = b.PendingPaymentAmount
 	}
 
-	// 3. Evaluate.
-	for _, c := range creditorTeamIDs {
-		allow := result[c]
-		l := limits[c]
-		if l == nil || !l.hasCfg {
-			continue // no config => allow (already set)
+	// 2a. Oldest unsettled debt where an age rule applies.
+	oldest, err := oldestUnsettledDebt(db, debtorTeamID, aged, at)
+	if err != nil {
+		return nil, err
+	}
+	for c, since := range oldest {
+		inputs[c].OldestDebtAt = since
+	}
+
+	// 3. The creditors' opt-in to count pending payments.
+	var optedIn []uint64
+	err = db.
+		Model(&invoice_models.OweLimitPolicy{}).
+		Where("team_id IN ? AND count_pending_payments = ?", creditorTeamIDs, true).
+		Pluck("team_id", &optedIn).
+		Error
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range optedIn {
+		inputs[c].CountPending = true
+	}
+
+	return inputs, nil
+}
+
+// evaluateOweLimit decides one creditor's limit from its inputs, the request q and
+// the clock at; see EvaluateOweLimitsQuery.
+func evaluateOweLimit(in *oweLimitInputs, q OweLimitQuery, creditorTeamID uint64, at time.Time) *invoice_iface.OweLimitAllow {
+	allow := &invoice_iface.OweLimitAllow{
+		Allow:             true,
+		Rule:              in.Rule,
+		ActiveAmount:      in.Debt,
+		PendingAmount:     in.Pending,
+		ProspectiveAmount: q.ProspectiveAmounts[creditorTeamID],
+	}
+	switch q.PendingPolicy {
+	case invoice_iface.OweLimitPendingPolicy_OWE_LIMIT_PENDING_POLICY_INCLUDE:
+		allow.PendingCounted = true
+	case invoice_iface.OweLimitPendingPolicy_OWE_LIMIT_PENDING_POLICY_EXCLUDE:
+	default:
+		allow.PendingCounted = in.CountPending
+	}
+	allow.ProjectedDebt = in.Debt + allow.ProspectiveAmount
+	if allow.PendingCounted {
+		allow.ProjectedDebt -= in.Pending
+	}
+	if !in.HasCfg {
+		allow.State = invoice_iface.OweLimitState_OWE_LIMIT_STATE_OK
+		return allow // no config => allow
+	}
+
+	if in.Rule == invoice_iface.OweLimitRule_OWE_LIMIT_RULE_TEAM_TYPE {
+		allow.TeamType = teamTypeToProto(db_models.TeamType(in.TeamType))
+	}
+	if in.OverrideID != 0 {
+		allow.OverrideId = in.OverrideID
+		allow.OverrideEndsAt = timestamppb.New(in.OverrideEndsAt)
+	}
+	allow.Threshold = in.Threshold
+	// threshold 0 => unlimited (the amount condition holds)
+	if in.Threshold > 0 {
+		allow.Headroom = in.Threshold - allow.ProjectedDebt
+		fits := allow.ProjectedDebt < in.Threshold // room left below threshold
+		if allow.ProspectiveAmount > 0 {
+			fits = allow.ProjectedDebt <= in.Threshold // the new debt fits
 		}
-		debt := debtOf[c]
-		allow.Threshold = l.threshold
-		allow.ActiveAmount = debt
-		if l.threshold == 0 {
-			continue // threshold 0 => unlimited (allow already set)
+		if !fits {
+			allow.FailedConditions = append(allow.FailedConditions, invoice_iface.OweLimitCondition_OWE_LIMIT_CONDITION_AMOUNT)
 		}
-		allow.Allow = debt < l.threshold // current debt below threshold
 	}
-
-	return result, nil
+	allow.MaxAgeDays = in.MaxAgeDays
+	if in.MaxAgeDays > 0 && !q.SkipAge && !in.OldestDebtAt.IsZero() {
+		allow.OldestDebtAt = timestamppb.New(in.OldestDebtAt)
+		allow.OldestDebtAgeDays = ageDays(at, in.OldestDebtAt)
+		if allow.OldestDebtAgeDays > in.MaxAgeDays {
+			allow.FailedConditions = append(allow.FailedConditions, invoice_iface.OweLimitCondition_OWE_LIMIT_CONDITION_AGE)
+		}
+	}
+	allow.Allow = len(allow.FailedConditions) == 0
+	allow.SoftThreshold = in.SoftThreshold
+	allow.State = oweLimitState(allow)
+	return allow
 }
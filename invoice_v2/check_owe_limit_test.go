@@ -2,10 +2,11 @@ package invoice_v2_test
 
 import (
 	"testing"
+	"time"
 
-	invoice_iface "github.com/pdcgo/schema/services/invoice_iface/v2"
 	"github.com/pdcgo/invoice_service/invoice_models"
 	"github.com/pdcgo/invoice_service/invoice_v2"
+	invoice_iface "github.com/pdcgo/schema/services/invoice_iface/v2"
 	"github.com/pdcgo/shared/db_models"
 	"github.com/pdcgo/shared/pkg/moretest"
 	"github.com/pdcgo/shared/pkg/moretest/moretest_mock"
@@ -25,6 +26,11 @@ func TestEvaluateOweLimits(t *testing.T) {
 				assert.NoError(t, tx.AutoMigrate(
 					&invoice_models.TeamBalance{},
 					&db_models.OweLimitConfiguration{},
+					&invoice_models.OweLimitPolicy{},
+					&invoice_models.OweLimitOverride{},
+					&invoice_models.OweLimitAgeRule{},
+					&invoice_models.OweLimitSoftThreshold{},
+					&invoice_models.OweLimitTeamTypeRule{},
 				))
 
 				debtor := uint64(1)
@@ -75,3 +81,303 @@ func TestEvaluateOweLimits(t *testing.T) {
 		},
 	)
 }
+
+func TestCheckOweLimitProjected(t *testing.T) {
+	var scenario moretest_mock.DbScenario
+
+	moretest.Suite(t, "check owe limit projected",
+		moretest.SetupListFunc{
+			moretest_mock.MockPostgresDatabase(&scenario),
+		},
+		func(t *testing.T) {
+			scenario(t, func(tx *gorm.DB) {
+				assert.NoError(t, tx.AutoMigrate(
+					&invoice_models.TeamBalance{},
+					&db_models.OweLimitConfiguration{},
+					&invoice_models.OweLimitPolicy{},
+					&invoice_models.OweLimitOverride{},
+					&invoice_models.OweLimitAgeRule{},
+					&invoice_models.OweLimitSoftThreshold{},
+					&invoice_models.OweLimitTeamTypeRule{},
+				))
+
+				debtor := uint64(1)
+				assert.NoError(t, tx.Create(&[]*db_models.OweLimitConfiguration{
+					{TeamID: 8, IsDefault: true, Threshold: 100},
+					{TeamID: 9, IsDefault: true, Threshold: 999},
+					{TeamID: 9, IsDefault: false, ForTeamID: &debtor, Threshold: 100},
+				}).Error)
+				pay := invoice_iface.BalanceType_BALANCE_TYPE_PAYABLE
+				assert.NoError(t, tx.Create(&[]*invoice_models.TeamBalance{
+					{TeamID: 1, ForTeamID: 8, BalanceType: pay, Balance: -120, PendingPaymentAmount: 50},
+					{TeamID: 1, ForTeamID: 9, BalanceType: pay, Balance: -120, PendingPaymentAmount: 50},
+				}).Error)
+				// only creditor 8 lets pending payments count.
+				assert.NoError(t, tx.Create(&invoice_models.OweLimitPolicy{TeamID: 8, CountPendingPayments: true}).Error)
+
+				eval := func(q invoice_v2.OweLimitQuery) map[uint64]*invoice_iface.OweLimitAllow {
+					q.DebtorTeamID = debtor
+					q.CreditorTeamIDs = []uint64{8, 9, 10}
+					res, err := invoice_v2.EvaluateOweLimitsQuery(tx, q)
+					assert.NoError(t, err)
+					return res
+				}
+
+				t.Run("pending payments count where the creditor opted in", func(t *testing.T) {
+					res := eval(invoice_v2.OweLimitQuery{})
+					assert.True(t, res[8].PendingCounted)
+					assert.Equal(t, float64(70), res[8].GetProjectedDebt())
+					assert.Equal(t, float64(30), res[8].GetHeadroom())
+					assert.True(t, res[8].GetAllow())
+					assert.Equal(t, invoice_iface.OweLimitRule_OWE_LIMIT_RULE_DEFAULT, res[8].GetRule())
+
+					assert.False(t, res[9].PendingCounted)
+					assert.Equal(t, float64(120), res[9].GetProjectedDebt())
+					assert.Equal(t, float64(-20), res[9].GetHeadroom())
+					assert.False(t, res[9].GetAllow())
+					assert.Equal(t, invoice_iface.OweLimitRule_OWE_LIMIT_RULE_CUSTOM, res[9].GetRule())
+
+					assert.True(t, res[10].GetAllow())
+					assert.Equal(t, invoice_iface.OweLimitRule_OWE_LIMIT_RULE_NONE, res[10].GetRule())
+				})
+
+				t.Run("policy flag overrides the opt-in", func(t *testing.T) {
+					res := eval(invoice_v2.OweLimitQuery{PendingPolicy: invoice_iface.OweLimitPendingPolicy_OWE_LIMIT_PENDING_POLICY_INCLUDE})
+					assert.True(t, res[9].GetAllow())
+					res = eval(invoice_v2.OweLimitQuery{PendingPolicy: invoice_iface.OweLimitPendingPolicy_OWE_LIMIT_PENDING_POLICY_EXCLUDE})
+					assert.False(t, res[8].GetAllow())
+				})
+
+				t.Run("prospective amount must fit under the threshold", func(t *testing.T) {
+					res := eval(invoice_v2.OweLimitQuery{ProspectiveAmounts: map[uint64]float64{8: 30}})
+					assert.Equal(t, float64(100), res[8].GetProjectedDebt())
+					assert.Zero(t, res[8].GetHeadroom())
+					assert.True(t, res[8].GetAllow())
+
+					res = eval(invoice_v2.OweLimitQuery{ProspectiveAmounts: map[uint64]float64{8: 30.5}})
+					assert.False(t, res[8].GetAllow())
+				})
+			})
+		},
+	)
+}
+
+func TestEvaluateOweLimitsOverride(t *testing.T) {
+	var scenario moretest_mock.DbScenario
+
+	moretest.Suite(t, "evaluate owe limits with overrides",
+		moretest.SetupListFunc{
+			moretest_mock.MockPostgresDatabase(&scenario),
+		},
+		func(t *testing.T) {
+			scenario(t, func(tx *gorm.DB) {
+				assert.NoError(t, tx.AutoMigrate(
+					&invoice_models.TeamBalance{},
+					&db_models.OweLimitConfiguration{},
+					&invoice_models.OweLimitPolicy{},
+					&invoice_models.OweLimitOverride{},
+					&invoice_models.OweLimitAgeRule{},
+					&invoice_models.OweLimitSoftThreshold{},
+					&invoice_models.OweLimitTeamTypeRule{},
+				))
+
+				debtor := uint64(1)
+				assert.NoError(t, tx.Create(&[]*db_models.OweLimitConfiguration{
+					{TeamID: 8, IsDefault: true, Threshold: 100},
+					{TeamID: 8, IsDefault: false, ForTeamID: &debtor, Threshold: 50},
+					{TeamID: 9, IsDefault: true, Threshold: 100},
+				}).Error)
+				pay := invoice_iface.BalanceType_BALANCE_TYPE_PAYABLE
+				assert.NoError(t, tx.Create(&[]*invoice_models.TeamBalance{
+					{TeamID: 1, ForTeamID: 8, BalanceType: pay, Balance: -150},
+					{TeamID: 1, ForTeamID: 9, BalanceType: pay, Balance: -150},
+				}).Error)
+
+				// campaign week: creditor 8 lifts debtor 1 to 300; creditor 9's window
+				// was revoked before it could apply.
+				start := time.Date(2025, 3, 3, 0, 0, 0, 0, time.UTC)
+				end := start.AddDate(0, 0, 7)
+				revokedAt := start.Add(-time.Hour)
+				assert.NoError(t, tx.Create(&[]*invoice_models.OweLimitOverride{
+					{TeamID: 8, ForTeamID: debtor, Threshold: 300, StartsAt: start, EndsAt: end, CreatedByID: callerID, CreatedAt: start},
+					{TeamID: 9, ForTeamID: debtor, Threshold: 300, StartsAt: start, EndsAt: end, CreatedByID: callerID, CreatedAt: start, RevokedAt: &revokedAt},
+				}).Error)
+
+				eval := func(at time.Time) map[uint64]*invoice_iface.OweLimitAllow {
+					res, err := invoice_v2.EvaluateOweLimitsQuery(tx, invoice_v2.OweLimitQuery{
+						DebtorTeamID:    debtor,
+						CreditorTeamIDs: []uint64{8, 9},
+						At:              at,
+					})
+					assert.NoError(t, err)
+					return res
+				}
+
+				t.Run("active override beats custom", func(t *testing.T) {
+					res := eval(start.Add(24 * time.Hour))
+					assert.True(t, res[8].GetAllow())
+					assert.Equal(t, float64(300), res[8].GetThreshold())
+					assert.Equal(t, invoice_iface.OweLimitRule_OWE_LIMIT_RULE_OVERRIDE, res[8].GetRule())
+					assert.NotZero(t, res[8].OverrideId)
+					assert.True(t, res[8].OverrideEndsAt.AsTime().Equal(end))
+
+					assert.False(t, res[9].GetAllow())
+					assert.Equal(t, invoice_iface.OweLimitRule_OWE_LIMIT_RULE_DEFAULT, res[9].GetRule())
+				})
+
+				t.Run("expired override falls back", func(t *testing.T) {
+					res := eval(end)
+					assert.False(t, res[8].GetAllow())
+					assert.Equal(t, float64(50), res[8].GetThreshold())
+					assert.Equal(t, invoice_iface.OweLimitRule_OWE_LIMIT_RULE_CUSTOM, res[8].GetRule())
+					assert.Zero(t, res[8].OverrideId)
+				})
+			})
+		},
+	)
+}
+
+func TestEvaluateOweLimitsAge(t *testing.T) {
+	var scenario moretest_mock.DbScenario
+
+	moretest.Suite(t, "evaluate owe limits by age",
+		moretest.SetupListFunc{
+			moretest_mock.MockPostgresDatabase(&scenario),
+		},
+		func(t *testing.T) {
+			scenario(t, func(tx *gorm.DB) {
+				assert.NoError(t, tx.AutoMigrate(
+					&invoice_models.BalanceChangeLog{},
+					&invoice_models.TeamBalance{},
+					&db_models.OweLimitConfiguration{},
+					&invoice_models.OweLimitPolicy{},
+					&invoice_models.OweLimitOverride{},
+					&invoice_models.OweLimitAgeRule{},
+					&invoice_models.OweLimitSoftThreshold{},
+					&invoice_models.OweLimitTeamTypeRule{},
+				))
+
+				debtor := uint64(1)
+				// creditor 8: any amount, but nothing older than 30 days; creditor 9:
+				// custom 100 and 30 days.
+				ageOnly := db_models.OweLimitConfiguration{TeamID: 8, IsDefault: true, Threshold: 0}
+				both := db_models.OweLimitConfiguration{TeamID: 9, ForTeamID: &debtor, Threshold: 100}
+				assert.NoError(t, tx.Create(&ageOnly).Error)
+				assert.NoError(t, tx.Create(&both).Error)
+				assert.NoError(t, tx.Create(&[]invoice_models.OweLimitAgeRule{
+					{ConfigurationID: ageOnly.ID, MaxAgeDays: 30},
+					{ConfigurationID: both.ID, MaxAgeDays: 30},
+				}).Error)
+
+				day0 := time.Date(2025, 1, 1, 9, 0, 0, 0, time.UTC)
+				day := func(n int) time.Time { return day0.AddDate(0, 0, n) }
+				leg := func(creditor uint64, amount, balance float64, at time.Time) *invoice_models.BalanceChangeLog {
+					return &invoice_models.BalanceChangeLog{
+						TeamID: debtor, ForTeamID: creditor, BalanceType: payable,
+						ChangeType:   invoice_iface.BalanceChangeType_BALANCE_CHANGE_TYPE_ADJUSTMENT,
+						ChangeAmount: amount, Balance: balance, CreatedAt: at,
+					}
+				}
+				// creditor 8: 50 on day 0 and 30 on day 20; paying 60 on day 40 settles
+				// the first in full (FIFO), so the oldest unsettled debt is day 20's.
+				assert.NoError(t, tx.Create(&[]*invoice_models.BalanceChangeLog{
+					leg(8, -50, -50, day(0)),
+					leg(8, -30, -80, day(20)),
+					leg(8, 60, -20, day(40)),
+					leg(9, -120, -120, day(0)),
+				}).Error)
+				assert.NoError(t, tx.Create(&[]*invoice_models.TeamBalance{
+					{TeamID: debtor, ForTeamID: 8, BalanceType: payable, Balance: -20},
+					{TeamID: debtor, ForTeamID: 9, BalanceType: payable, Balance: -120},
+				}).Error)
+
+				eval := func(at time.Time) map[uint64]*invoice_iface.OweLimitAllow {
+					res, err := invoice_v2.EvaluateOweLimitsQuery(tx, invoice_v2.OweLimitQuery{
+						DebtorTeamID:    debtor,
+						CreditorTeamIDs: []uint64{8, 9},
+						At:              at,
+					})
+					assert.NoError(t, err)
+					return res
+				}
+
+				t.Run("age is counted from the oldest unsettled debit", func(t *testing.T) {
+					res := eval(day(45))
+					assert.True(t, res[8].GetAllow())
+					assert.Equal(t, int64(30), res[8].MaxAgeDays)
+					assert.Equal(t, int64(25), res[8].OldestDebtAgeDays)
+					assert.True(t, res[8].OldestDebtAt.AsTime().Equal(day(20)))
+					assert.Empty(t, res[8].GetFailedConditions())
+				})
+
+				t.Run("too old blocks whatever the amount", func(t *testing.T) {
+					res := eval(day(51))
+					assert.False(t, res[8].GetAllow())
+					assert.Equal(t, []invoice_iface.OweLimitCondition{
+						invoice_iface.OweLimitCondition_OWE_LIMIT_CONDITION_AGE,
+					}, res[8].GetFailedConditions())
+				})
+
+				t.Run("both conditions are reported", func(t *testing.T) {
+					res := eval(day(45))
+					assert.False(t, res[9].GetAllow())
+					assert.Equal(t, []invoice_iface.OweLimitCondition{
+						invoice_iface.OweLimitCondition_OWE_LIMIT_CONDITION_AMOUNT,
+						invoice_iface.OweLimitCondition_OWE_LIMIT_CONDITION_AGE,
+					}, res[9].GetFailedConditions())
+				})
+
+				t.Run("an amount-only query skips the age rule", func(t *testing.T) {
+					res, err := invoice_v2.EvaluateOweLimitsQuery(tx, invoice_v2.OweLimitQuery{
+						DebtorTeamID:    debtor,
+						CreditorTeamIDs: []uint64{8},
+						At:              day(51),
+						SkipAge:         true,
+					})
+					assert.NoError(t, err)
+					assert.True(t, res[8].GetAllow())
+					assert.Nil(t, res[8].OldestDebtAt)
+				})
+
+				t.Run("debt from before the account was last settled is not aged", func(t *testing.T) {
+					// paying 30 on day 52 leaves a credit of 10; 25 on day 55 uses it up
+					// and leaves 15 owed since day 55.
+					assert.NoError(t, tx.Create(&[]*invoice_models.BalanceChangeLog{
+						leg(8, 30, 10, day(52)),
+						leg(8, -25, -15, day(55)),
+					}).Error)
+					res := eval(day(60))
+					assert.True(t, res[8].GetAllow())
+					assert.True(t, res[8].OldestDebtAt.AsTime().Equal(day(55)))
+					assert.Equal(t, int64(5), res[8].OldestDebtAgeDays)
+				})
+
+				t.Run("a backdated leg is aged in created_at order, as AgingReport does", func(t *testing.T) {
+					// debtor 2 owes 50 from day 70 and pays it on day 71; a 40 dated day 60
+					// arrives last. In created_at order the payment settles day 60's 40
+					// first, so 40 of day 70's debit is what is still unpaid.
+					other := uint64(2)
+					legs := []*invoice_models.BalanceChangeLog{
+						leg(8, -50, -50, day(70)),
+						leg(8, 50, 0, day(71)),
+						leg(8, -40, -40, day(60)),
+					}
+					for _, l := range legs {
+						l.TeamID = other
+					}
+					assert.NoError(t, tx.Create(&legs).Error)
+					assert.NoError(t, tx.Create(&invoice_models.TeamBalance{TeamID: other, ForTeamID: 8, BalanceType: payable, Balance: -40}).Error)
+
+					res, err := invoice_v2.EvaluateOweLimitsQuery(tx, invoice_v2.OweLimitQuery{
+						DebtorTeamID:    other,
+						CreditorTeamIDs: []uint64{8},
+						At:              day(75),
+					})
+					assert.NoError(t, err)
+					assert.True(t, res[8].OldestDebtAt.AsTime().Equal(day(70)))
+					assert.Equal(t, int64(5), res[8].OldestDebtAgeDays)
+				})
+			})
+		},
+	)
+}
@@ -0,0 +1,213 @@
+package invoice_v2
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"connectrpc.com/connect"
+	"github.com/pdcgo/invoice_service/invoice_models"
+	invoice_iface "github.com/pdcgo/schema/services/invoice_iface/v2"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// CompensationProposal is a warehouse's claim that it owes the product team for Count
+// units of a sku. Cost is the line's cost when the caller knows it (the problem tx item's
+// total); 0 makes cost valuation look up the sku's last inbound price. InvTxItemID links
+// an event-proposed compensation to its problem item.
+type CompensationProposal struct {
+	WarehouseID      uint64
+	TeamID           uint64
+	Type             invoice_iface.CompensationType
+	InvTransactionID *uint64
+	InvTxItemID      *uint64
+	SkuID            string
+	ProductName      string
+	Count            int
+	Cost             float64
+	Note             string
+	ProposedByID     uint64
+}
+
+// ProposeCompensation values a proposal with the warehouse's policy for its type and
+// stores it as PROPOSED, awaiting the product team's review; nothing is posted yet. A
+// proposal for a problem item that already has one of the same type is a no-op and
+// returns nil.
+func ProposeCompensation(tx *gorm.DB, p *CompensationProposal, now time.Time) (*invoice_models.StockCompensation, error) {
+	if p.WarehouseID == 0 || p.TeamID == 0 {
+		return nil, connect.NewError(connect.CodeInvalidArgument, errors.New("warehouse_id and team_id are required"))
+	}
+	if p.WarehouseID == p.TeamID {
+		return nil, connect.NewError(connect.CodeInvalidArgument, errors.New("warehouse_id and team_id must differ"))
+	}
+	if p.Type == invoice_iface.CompensationType_COMPENSATION_TYPE_UNSPECIFIED {
+		return nil, connect.NewError(connect.CodeInvalidArgument, errors.New("type is required"))
+	}
+	if p.Count <= 0 {
+		return nil, connect.NewError(connect.CodeInvalidArgument, errors.New("count must be greater than zero"))
+	}
+
+	policy, err := loadCompensationPolicy(tx, p.WarehouseID, p.Type)
+	if err != nil {
+		return nil, err
+	}
+	amount, err := valueCompensation(tx, policy, p)
+	if err != nil {
+		return nil, err
+	}
+
+	row := invoice_models.StockCompensation{
+		WarehouseID:      p.WarehouseID,
+		TeamID:           p.TeamID,
+		Type:             p.Type,
+		Status:           invoice_iface.CompensationStatus_COMPENSATION_STATUS_PROPOSED,
+		Valuation:        policy.Valuation,
+		InvTransactionID: p.InvTransactionID,
+		InvTxItemID:      p.InvTxItemID,
+		SkuID:            p.SkuID,
+		ProductName:      p.ProductName,
+		Count:            p.Count,
+		Amount:           amount,
+		Note:             p.Note,
+		ProposedByID:     p.ProposedByID,
+		CreatedAt:        now,
+		UpdatedAt:        now,
+	}
+	res := tx.
+		Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "type"}, {Name: "inv_tx_item_id"}},
+			DoNothing: true,
+		}).
+		Create(&row)
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	if res.RowsAffected == 0 {
+		return nil, nil
+	}
+	return &row, nil
+}
+
+// loadCompensationPolicy returns the warehouse's policy for the type, else its default
+// (type UNSPECIFIED) row, else cost valuation.
+func loadCompensationPolicy(
+	tx *gorm.DB,
+	warehouseID uint64,
+	ct invoice_iface.CompensationType,
+) (*invoice_models.WarehouseCompensationPolicy, error) {
+	var policy invoice_models.WarehouseCompensationPolicy
+	res := tx.
+		Where("warehouse_id = ? AND type IN ?", warehouseID, []invoice_iface.CompensationType{
+			ct, invoice_iface.CompensationType_COMPENSATION_TYPE_UNSPECIFIED,
+		}).
+		Order("type DESC").
+		Limit(1).
+		Find(&policy)
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	if res.RowsAffected == 0 {
+		policy.Valuation = invoice_iface.CompensationValuation_COMPENSATION_VALUATION_COST
+	}
+	return &policy, nil
+}
+
+// valueCompensation prices a proposal. Sale price is the last price the sku's variant
+// sold for; a sku that never sold is valued at cost instead.
+func valueCompensation(
+	tx *gorm.DB,
+	policy *invoice_models.WarehouseCompensationPolicy,
+	p *CompensationProposal,
+) (float64, error) {
+	switch policy.Valuation {
+	case invoice_iface.CompensationValuation_COMPENSATION_VALUATION_FIXED_RATE:
+		return policy.FixedRate * float64(p.Count), nil
+
+	case invoice_iface.CompensationValuation_COMPENSATION_VALUATION_SALE_PRICE:
+		var prices []float64
+		err := tx.
+			Table("order_items oi").
+			Joins("join skus s on s.variant_id = oi.variation_id").
+			Where("s.id = ?", p.SkuID).
+			Order("oi.id DESC").
+			Limit(1).
+			Pluck("oi.price", &prices).
+			Error
+		if err != nil {
+			return 0, err
+		}
+		if len(prices) > 0 && prices[0] > 0 {
+			return prices[0] * float64(p.Count), nil
+		}
+	}
+
+	if p.Cost > 0 {
+		return p.Cost, nil
+	}
+	var prices []float64
+	err := tx.
+		Table("inv_tx_items").
+		Where("sku_id = ?", p.SkuID).
+		Order("id DESC").
+		Limit(1).
+		Pluck("price", &prices).
+		Error
+	if err != nil {
+		return 0, err
+	}
+	if len(prices) == 0 {
+		return 0, nil
+	}
+	return prices[0] * float64(p.Count), nil
+}
+
+// lockCompensation loads a compensation FOR UPDATE, scoped to the team reviewing or
+// revising it (column is "team_id" or "warehouse_id"); another team's row is NotFound.
+func lockCompensation(tx *gorm.DB, id uint64, column string, teamID uint64) (*invoice_models.StockCompensation, error) {
+	var row invoice_models.StockCompensation
+	res := lockForUpdate(tx).
+		Where(fmt.Sprintf("id = ? AND %s = ?", column), id, teamID).
+		Limit(1).
+		Find(&row)
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	if res.RowsAffected == 0 {
+		return nil, connect.NewError(connect.CodeNotFound, errors.New("compensation not found"))
+	}
+	return &row, nil
+}
+
+func toProtoCompensation(c *invoice_models.StockCompensation) *invoice_iface.Compensation {
+	out := &invoice_iface.Compensation{
+		Id:            c.ID,
+		WarehouseId:   c.WarehouseID,
+		TeamId:        c.TeamID,
+		Type:          c.Type,
+		Status:        c.Status,
+		Valuation:     c.Valuation,
+		SkuId:         c.SkuID,
+		ProductName:   c.ProductName,
+		Count:         int32(c.Count),
+		Amount:        c.Amount,
+		Note:          c.Note,
+		DisputeReason: c.DisputeReason,
+		ProposedById:  c.ProposedByID,
+		CreatedAt:     timestamppb.New(c.CreatedAt),
+	}
+	if c.InvTransactionID != nil {
+		out.InvTransactionId = *c.InvTransactionID
+	}
+	if c.InvTxItemID != nil {
+		out.InvTxItemId = *c.InvTxItemID
+	}
+	if c.ReviewedByID != nil {
+		out.ReviewedById = *c.ReviewedByID
+	}
+	if c.ReviewedAt != nil {
+		out.ReviewedAt = timestamppb.New(*c.ReviewedAt)
+	}
+	return out
+}
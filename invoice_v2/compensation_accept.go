@@ -0,0 +1,80 @@
+package invoice_v2
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"connectrpc.com/connect"
+	"github.com/pdcgo/invoice_service/invoice_models"
+	invoice_iface "github.com/pdcgo/schema/services/invoice_iface/v2"
+	"github.com/pdcgo/user_service/access_interceptors"
+	"gorm.io/gorm"
+)
+
+// CompensationAccept implements [invoice_ifaceconnect.InvoiceServiceHandler]. The product
+// team (team_id) accepts a PROPOSED compensation, which posts it as a STOCK_PROBLEM double
+// entry: the warehouse owes the product team the amount (a RECEIVABLE on the product-team
+// side, mirrored to a PAYABLE on the warehouse side).
+func (s *invoiceServiceImpl) CompensationAccept(
+	ctx context.Context,
+	req *connect.Request[invoice_iface.CompensationAcceptRequest],
+) (*connect.Response[invoice_iface.CompensationAcceptResponse], error) {
+	pay := req.Msg
+
+	caller, err := access_interceptors.GetIdentityFromCtx(ctx)
+	if err != nil {
+		return nil, connect.NewError(connect.CodeUnauthenticated, err)
+	}
+	reviewerID := uint64(caller.IdentityId)
+
+	var row *invoice_models.StockCompensation
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var err error
+		row, err = lockCompensation(tx, pay.CompensationId, "team_id", pay.TeamId)
+		if err != nil {
+			return err
+		}
+		if row.Status != invoice_iface.CompensationStatus_COMPENSATION_STATUS_PROPOSED {
+			return connect.NewError(connect.CodeFailedPrecondition, errors.New("compensation is not awaiting review"))
+		}
+		if row.Amount <= 0 {
+			return connect.NewError(connect.CodeFailedPrecondition, errors.New("compensation has no amount; ask the warehouse to revise it"))
+		}
+
+		now := time.Now()
+		note := fmt.Sprintf("compensation %d %s", row.ID, row.ProductName)
+		err = PostBalanceLog(
+			tx, row.TeamID, row.WarehouseID,
+			invoice_iface.BalanceChangeType_BALANCE_CHANGE_TYPE_STOCK_PROBLEM,
+			row.Amount, invoice_iface.BalanceType_BALANCE_TYPE_RECEIVABLE,
+			note, reviewerID, now,
+		)
+		if err != nil {
+			return err
+		}
+
+		row.Status = invoice_iface.CompensationStatus_COMPENSATION_STATUS_ACCEPTED
+		row.ReviewedByID = &reviewerID
+		row.ReviewedAt = &now
+		row.UpdatedAt = now
+		return tx.
+			Model(&invoice_models.StockCompensation{}).
+			Where("id = ?", row.ID).
+			Updates(map[string]interface{}{
+				"status":         row.Status,
+				"reviewed_by_id": reviewerID,
+				"reviewed_at":    now,
+				"updated_at":     now,
+			}).
+			Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return connect.NewResponse(&invoice_iface.CompensationAcceptResponse{
+		Compensation: toProtoCompensation(row),
+	}), nil
+}
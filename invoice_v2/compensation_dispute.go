@@ -0,0 +1,70 @@
+package invoice_v2
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"connectrpc.com/connect"
+	"github.com/pdcgo/invoice_service/invoice_models"
+	invoice_iface "github.com/pdcgo/schema/services/invoice_iface/v2"
+	"github.com/pdcgo/user_service/access_interceptors"
+	"gorm.io/gorm"
+)
+
+// CompensationDispute implements [invoice_ifaceconnect.InvoiceServiceHandler]. The product
+// team (team_id) rejects a PROPOSED compensation with a reason. Nothing posts; the
+// warehouse answers with CompensationRevise.
+func (s *invoiceServiceImpl) CompensationDispute(
+	ctx context.Context,
+	req *connect.Request[invoice_iface.CompensationDisputeRequest],
+) (*connect.Response[invoice_iface.CompensationDisputeResponse], error) {
+	pay := req.Msg
+
+	if pay.Reason == "" {
+		return nil, connect.NewError(connect.CodeInvalidArgument, errors.New("reason is required"))
+	}
+
+	caller, err := access_interceptors.GetIdentityFromCtx(ctx)
+	if err != nil {
+		return nil, connect.NewError(connect.CodeUnauthenticated, err)
+	}
+	reviewerID := uint64(caller.IdentityId)
+
+	var row *invoice_models.StockCompensation
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var err error
+		row, err = lockCompensation(tx, pay.CompensationId, "team_id", pay.TeamId)
+		if err != nil {
+			return err
+		}
+		if row.Status != invoice_iface.CompensationStatus_COMPENSATION_STATUS_PROPOSED {
+			return connect.NewError(connect.CodeFailedPrecondition, errors.New("compensation is not awaiting review"))
+		}
+
+		now := time.Now()
+		row.Status = invoice_iface.CompensationStatus_COMPENSATION_STATUS_DISPUTED
+		row.DisputeReason = pay.Reason
+		row.ReviewedByID = &reviewerID
+		row.ReviewedAt = &now
+		row.UpdatedAt = now
+		return tx.
+			Model(&invoice_models.StockCompensation{}).
+			Where("id = ?", row.ID).
+			Updates(map[string]interface{}{
+				"status":         row.Status,
+				"dispute_reason": row.DisputeReason,
+				"reviewed_by_id": reviewerID,
+				"reviewed_at":    now,
+				"updated_at":     now,
+			}).
+			Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return connect.NewResponse(&invoice_iface.CompensationDisputeResponse{
+		Compensation: toProtoCompensation(row),
+	}), nil
+}
@@ -0,0 +1,65 @@
+package invoice_v2
+
+import (
+	"context"
+	"errors"
+
+	"connectrpc.com/connect"
+	"github.com/pdcgo/invoice_service/invoice_models"
+	"github.com/pdcgo/schema/services/common/v1"
+	invoice_iface "github.com/pdcgo/schema/services/invoice_iface/v2"
+	"github.com/pdcgo/shared/db_connect"
+	"gorm.io/gorm"
+)
+
+// CompensationList implements [invoice_ifaceconnect.InvoiceServiceHandler]. It lists
+// compensations owed by a warehouse (warehouse_id) and/or owed to a product team
+// (team_id), optionally by status, newest first, paginated — e.g. a product team's
+// review queue is team_id + PROPOSED.
+func (s *invoiceServiceImpl) CompensationList(
+	ctx context.Context,
+	req *connect.Request[invoice_iface.CompensationListRequest],
+) (*connect.Response[invoice_iface.CompensationListResponse], error) {
+	pay := req.Msg
+	if pay.Page == nil {
+		return nil, connect.NewError(connect.CodeInvalidArgument, errors.New("page is required"))
+	}
+	if pay.WarehouseId == 0 && pay.TeamId == 0 {
+		return nil, connect.NewError(connect.CodeInvalidArgument, errors.New("warehouse_id or team_id is required"))
+	}
+
+	result := &invoice_iface.CompensationListResponse{
+		Items:    []*invoice_iface.Compensation{},
+		PageInfo: &common.PageInfo{},
+	}
+	db := s.db.WithContext(ctx)
+
+	var rows []*invoice_models.StockCompensation
+	paginated, pageInfo, err := db_connect.SetPaginationQuery(db, func() (*gorm.DB, error) {
+		query := db.Model(&invoice_models.StockCompensation{})
+		if pay.WarehouseId != 0 {
+			query = query.Where("warehouse_id = ?", pay.WarehouseId)
+		}
+		if pay.TeamId != 0 {
+			query = query.Where("team_id = ?", pay.TeamId)
+		}
+		if pay.Status != invoice_iface.CompensationStatus_COMPENSATION_STATUS_UNSPECIFIED {
+			query = query.Where("status = ?", pay.Status)
+		}
+		return query, nil
+	}, pay.Page)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := paginated.Order("id DESC").Find(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	result.PageInfo = pageInfo
+	for _, row := range rows {
+		result.Items = append(result.Items, toProtoCompensation(row))
+	}
+
+	return connect.NewResponse(result), nil
+}
@@ -0,0 +1,41 @@
+package invoice_v2
+
+import (
+	"context"
+
+	"connectrpc.com/connect"
+	"github.com/pdcgo/invoice_service/invoice_models"
+	invoice_iface "github.com/pdcgo/schema/services/invoice_iface/v2"
+)
+
+// CompensationPolicyList implements [invoice_ifaceconnect.InvoiceServiceHandler]. It
+// returns the warehouse team's valuation policies, the default (type UNSPECIFIED) first.
+// Types without a row fall back to the default, and without a default to cost.
+func (s *invoiceServiceImpl) CompensationPolicyList(
+	ctx context.Context,
+	req *connect.Request[invoice_iface.CompensationPolicyListRequest],
+) (*connect.Response[invoice_iface.CompensationPolicyListResponse], error) {
+	var rows []*invoice_models.WarehouseCompensationPolicy
+	err := s.db.
+		WithContext(ctx).
+		Where("warehouse_id = ?", req.Msg.WarehouseId).
+		Order("type").
+		Find(&rows).
+		Error
+	if err != nil {
+		return nil, err
+	}
+
+	result := &invoice_iface.CompensationPolicyListResponse{
+		Items: make([]*invoice_iface.CompensationPolicy, 0, len(rows)),
+	}
+	for _, row := range rows {
+		result.Items = append(result.Items, &invoice_iface.CompensationPolicy{
+			Type:      row.Type,
+			Valuation: row.Valuation,
+			FixedRate: row.FixedRate,
+		})
+	}
+
+	return connect.NewResponse(result), nil
+}
@@ -0,0 +1,67 @@
+package invoice_v2
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"connectrpc.com/connect"
+	"github.com/pdcgo/invoice_service/invoice_models"
+	invoice_iface "github.com/pdcgo/schema/services/invoice_iface/v2"
+	"github.com/pdcgo/user_service/access_interceptors"
+	"gorm.io/gorm/clause"
+)
+
+// CompensationPolicySet implements [invoice_ifaceconnect.InvoiceServiceHandler]. It
+// upserts how the warehouse team values one compensation type (type UNSPECIFIED sets the
+// warehouse default). It only affects compensations proposed afterwards.
+func (s *invoiceServiceImpl) CompensationPolicySet(
+	ctx context.Context,
+	req *connect.Request[invoice_iface.CompensationPolicySetRequest],
+) (*connect.Response[invoice_iface.CompensationPolicySetResponse], error) {
+	pay := req.Msg
+	policy := pay.Policy
+
+	if pay.WarehouseId == 0 || policy == nil {
+		return nil, connect.NewError(connect.CodeInvalidArgument, errors.New("warehouse_id and policy are required"))
+	}
+	switch policy.Valuation {
+	case invoice_iface.CompensationValuation_COMPENSATION_VALUATION_COST,
+		invoice_iface.CompensationValuation_COMPENSATION_VALUATION_SALE_PRICE:
+	case invoice_iface.CompensationValuation_COMPENSATION_VALUATION_FIXED_RATE:
+		if policy.FixedRate <= 0 {
+			return nil, connect.NewError(connect.CodeInvalidArgument, errors.New("fixed_rate must be greater than zero"))
+		}
+	default:
+		return nil, connect.NewError(connect.CodeInvalidArgument, errors.New("valuation must be cost, sale price or fixed rate"))
+	}
+
+	caller, err := access_interceptors.GetIdentityFromCtx(ctx)
+	if err != nil {
+		return nil, connect.NewError(connect.CodeUnauthenticated, err)
+	}
+
+	now := time.Now()
+	row := invoice_models.WarehouseCompensationPolicy{
+		WarehouseID: pay.WarehouseId,
+		Type:        policy.Type,
+		Valuation:   policy.Valuation,
+		FixedRate:   policy.FixedRate,
+		UpdatedByID: uint64(caller.IdentityId),
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	err = s.db.
+		WithContext(ctx).
+		Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "warehouse_id"}, {Name: "type"}},
+			DoUpdates: clause.AssignmentColumns([]string{"valuation", "fixed_rate", "updated_by_id", "updated_at"}),
+		}).
+		Create(&row).
+		Error
+	if err != nil {
+		return nil, err
+	}
+
+	return connect.NewResponse(&invoice_iface.CompensationPolicySetResponse{}), nil
+}
@@ -0,0 +1,72 @@
+package invoice_v2
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"connectrpc.com/connect"
+	"github.com/pdcgo/invoice_service/invoice_models"
+	invoice_iface "github.com/pdcgo/schema/services/invoice_iface/v2"
+	"github.com/pdcgo/user_service/access_interceptors"
+	"gorm.io/gorm"
+)
+
+// CompensationPropose implements [invoice_ifaceconnect.InvoiceServiceHandler]. The
+// warehouse team proposes compensating the product team (team_id) for count units of a
+// sku, e.g. expired stock or shrinkage found at a stock count. Lost and damaged stock is
+// normally proposed from the StockProblem event instead. The amount comes from the
+// warehouse's policy; the product team then accepts or disputes it.
+func (s *invoiceServiceImpl) CompensationPropose(
+	ctx context.Context,
+	req *connect.Request[invoice_iface.CompensationProposeRequest],
+) (*connect.Response[invoice_iface.CompensationProposeResponse], error) {
+	pay := req.Msg
+
+	if pay.SkuId == "" {
+		return nil, connect.NewError(connect.CodeInvalidArgument, errors.New("sku_id is required"))
+	}
+
+	caller, err := access_interceptors.GetIdentityFromCtx(ctx)
+	if err != nil {
+		return nil, connect.NewError(connect.CodeUnauthenticated, err)
+	}
+
+	var row *invoice_models.StockCompensation
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// the sku must be the product team's; its product name labels the entry.
+		var names []string
+		err := tx.
+			Table("skus s").
+			Joins("left join products p on p.id = s.product_id").
+			Where("s.id = ? AND s.team_id = ?", pay.SkuId, pay.TeamId).
+			Limit(1).
+			Pluck("coalesce(p.name, '')", &names).
+			Error
+		if err != nil {
+			return err
+		}
+		if len(names) == 0 {
+			return connect.NewError(connect.CodeInvalidArgument, errors.New("sku does not belong to team_id"))
+		}
+
+		row, err = ProposeCompensation(tx, &CompensationProposal{
+			WarehouseID:  pay.WarehouseId,
+			TeamID:       pay.TeamId,
+			Type:         pay.Type,
+			SkuID:        pay.SkuId,
+			ProductName:  names[0],
+			Count:        int(pay.Count),
+			Note:         pay.Note,
+			ProposedByID: uint64(caller.IdentityId),
+		}, time.Now())
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return connect.NewResponse(&invoice_iface.CompensationProposeResponse{
+		Compensation: toProtoCompensation(row),
+	}), nil
+}
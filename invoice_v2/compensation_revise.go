@@ -0,0 +1,66 @@
+package invoice_v2
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"connectrpc.com/connect"
+	"github.com/pdcgo/invoice_service/invoice_models"
+	invoice_iface "github.com/pdcgo/schema/services/invoice_iface/v2"
+	"gorm.io/gorm"
+)
+
+// CompensationRevise implements [invoice_ifaceconnect.InvoiceServiceHandler]. The
+// warehouse team overrides the amount of a compensation it proposed — typically answering
+// a dispute — and sends it back to the product team as PROPOSED with MANUAL valuation.
+// Accepted compensations are final.
+func (s *invoiceServiceImpl) CompensationRevise(
+	ctx context.Context,
+	req *connect.Request[invoice_iface.CompensationReviseRequest],
+) (*connect.Response[invoice_iface.CompensationReviseResponse], error) {
+	pay := req.Msg
+
+	if pay.Amount <= 0 {
+		return nil, connect.NewError(connect.CodeInvalidArgument, errors.New("amount must be greater than zero"))
+	}
+
+	var row *invoice_models.StockCompensation
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var err error
+		row, err = lockCompensation(tx, pay.CompensationId, "warehouse_id", pay.WarehouseId)
+		if err != nil {
+			return err
+		}
+		if row.Status == invoice_iface.CompensationStatus_COMPENSATION_STATUS_ACCEPTED {
+			return connect.NewError(connect.CodeFailedPrecondition, errors.New("compensation is already accepted"))
+		}
+
+		row.Status = invoice_iface.CompensationStatus_COMPENSATION_STATUS_PROPOSED
+		row.Valuation = invoice_iface.CompensationValuation_COMPENSATION_VALUATION_MANUAL
+		row.Amount = pay.Amount
+		if pay.Note != "" {
+			row.Note = pay.Note
+		}
+		row.UpdatedAt = time.Now()
+
+		return tx.
+			Model(&invoice_models.StockCompensation{}).
+			Where("id = ?", row.ID).
+			Updates(map[string]interface{}{
+				"status":     row.Status,
+				"valuation":  row.Valuation,
+				"amount":     row.Amount,
+				"note":       row.Note,
+				"updated_at": row.UpdatedAt,
+			}).
+			Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return connect.NewResponse(&invoice_iface.CompensationReviseResponse{
+		Compensation: toProtoCompensation(row),
+	}), nil
+}
@@ -0,0 +1,161 @@
+package invoice_v2_test
+
+import (
+	"context"
+	"testing"
+
+	"connectrpc.com/connect"
+	"github.com/pdcgo/invoice_service/invoice_models"
+	"github.com/pdcgo/invoice_service/invoice_v2"
+	"github.com/pdcgo/schema/services/common/v1"
+	invoice_iface "github.com/pdcgo/schema/services/invoice_iface/v2"
+	role_base "github.com/pdcgo/schema/services/role_base/v1"
+	"github.com/pdcgo/shared/db_models"
+	"github.com/pdcgo/shared/pkg/moretest"
+	"github.com/pdcgo/shared/pkg/moretest/moretest_mock"
+	"github.com/pdcgo/user_service/access_interceptors"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func TestCompensationReview(t *testing.T) {
+	var scenario moretest_mock.DbScenario
+
+	moretest.Suite(t, "compensation review",
+		moretest.SetupListFunc{
+			moretest_mock.MockPostgresDatabase(&scenario),
+		},
+		func(t *testing.T) {
+			scenario(t, func(tx *gorm.DB) {
+				assert.NoError(t, tx.AutoMigrate(
+					&db_models.Product{},
+					&db_models.Sku{},
+					&db_models.InvTxItem{},
+					&db_models.OrderItem{},
+					&invoice_models.TeamBalance{},
+					&invoice_models.BalanceChangeLog{},
+					&invoice_models.OweLimitAlertLevel{},
+					&invoice_models.BalanceOpenItem{},
+					&invoice_models.BalanceOpenItemAllocation{},
+					&invoice_models.TeamBalanceDailyLog{},
+					&invoice_models.StockCompensation{},
+					&invoice_models.WarehouseCompensationPolicy{},
+				))
+
+				const warehouse = uint64(9)
+				const productTeam = uint64(2)
+
+				// sku1 (variant 3) of team 2: last inbound at 4/unit, last sold at 10/unit.
+				assert.NoError(t, tx.Create(&db_models.Product{ID: 5, Name: "X"}).Error)
+				assert.NoError(t, tx.Create(&db_models.Sku{ID: "sku1", TeamID: 2, ProductID: 5, VariantID: 3}).Error)
+				assert.NoError(t, tx.Create(&db_models.InvTxItem{ID: 50, SkuID: "sku1", Price: 4, Count: 10, Total: 40}).Error)
+				assert.NoError(t, tx.Create(&db_models.OrderItem{OrderID: 1, ProductID: 5, VariationID: 3, Price: 10, Count: 1}).Error)
+
+				svc := invoice_v2.NewInvoiceService(tx)
+				ctx := access_interceptors.SetIdentityToCtx(
+					context.Background(),
+					&role_base.Identity{IdentityId: 7},
+				)
+
+				propose := func(ct invoice_iface.CompensationType, count int32) *invoice_iface.Compensation {
+					res, err := svc.CompensationPropose(ctx, connect.NewRequest(&invoice_iface.CompensationProposeRequest{
+						WarehouseId: warehouse, TeamId: productTeam, Type: ct, SkuId: "sku1", Count: count,
+					}))
+					assert.NoError(t, err)
+					return res.Msg.GetCompensation()
+				}
+				setPolicy := func(ct invoice_iface.CompensationType, v invoice_iface.CompensationValuation, rate float64) {
+					_, err := svc.CompensationPolicySet(ctx, connect.NewRequest(&invoice_iface.CompensationPolicySetRequest{
+						WarehouseId: warehouse,
+						Policy:      &invoice_iface.CompensationPolicy{Type: ct, Valuation: v, FixedRate: rate},
+					}))
+					assert.NoError(t, err)
+				}
+				owed := func() float64 {
+					var b invoice_models.TeamBalance
+					assert.NoError(t, tx.
+						Where("team_id = ? AND for_team_id = ? AND balance_type = ?", productTeam, warehouse, receivable).
+						Limit(1).Find(&b).Error)
+					return b.Balance
+				}
+
+				t.Run("policies value proposals", func(t *testing.T) {
+					// no policy: cost (last inbound price).
+					assert.Equal(t, float64(12), propose(invoice_iface.CompensationType_COMPENSATION_TYPE_EXPIRED, 3).Amount)
+
+					// warehouse default sale price, shrinkage at a fixed rate.
+					setPolicy(invoice_iface.CompensationType_COMPENSATION_TYPE_UNSPECIFIED,
+						invoice_iface.CompensationValuation_COMPENSATION_VALUATION_SALE_PRICE, 0)
+					setPolicy(invoice_iface.CompensationType_COMPENSATION_TYPE_SHRINKAGE,
+						invoice_iface.CompensationValuation_COMPENSATION_VALUATION_FIXED_RATE, 2.5)
+					assert.Equal(t, float64(30), propose(invoice_iface.CompensationType_COMPENSATION_TYPE_DAMAGED_IN_TRANSIT, 3).Amount)
+					assert.Equal(t, float64(5), propose(invoice_iface.CompensationType_COMPENSATION_TYPE_SHRINKAGE, 2).Amount)
+
+					res, err := svc.CompensationPolicyList(ctx, connect.NewRequest(&invoice_iface.CompensationPolicyListRequest{
+						WarehouseId: warehouse,
+					}))
+					assert.NoError(t, err)
+					assert.Len(t, res.Msg.GetItems(), 2)
+
+					// another team's sku is rejected.
+					_, err = svc.CompensationPropose(ctx, connect.NewRequest(&invoice_iface.CompensationProposeRequest{
+						WarehouseId: warehouse, TeamId: 3, Type: invoice_iface.CompensationType_COMPENSATION_TYPE_EXPIRED,
+						SkuId: "sku1", Count: 1,
+					}))
+					assert.Equal(t, connect.CodeInvalidArgument, connect.CodeOf(err))
+				})
+
+				t.Run("dispute, revise, then accept posts once", func(t *testing.T) {
+					comp := propose(invoice_iface.CompensationType_COMPENSATION_TYPE_SHRINKAGE, 4) // 10
+
+					disputed, err := svc.CompensationDispute(ctx, connect.NewRequest(&invoice_iface.CompensationDisputeRequest{
+						TeamId: productTeam, CompensationId: comp.Id, Reason: "count was 6",
+					}))
+					assert.NoError(t, err)
+					assert.Equal(t, invoice_iface.CompensationStatus_COMPENSATION_STATUS_DISPUTED, disputed.Msg.GetCompensation().Status)
+
+					// disputed compensations cannot be accepted until revised.
+					_, err = svc.CompensationAccept(ctx, connect.NewRequest(&invoice_iface.CompensationAcceptRequest{
+						TeamId: productTeam, CompensationId: comp.Id,
+					}))
+					assert.Equal(t, connect.CodeFailedPrecondition, connect.CodeOf(err))
+
+					revised, err := svc.CompensationRevise(ctx, connect.NewRequest(&invoice_iface.CompensationReviseRequest{
+						WarehouseId: warehouse, CompensationId: comp.Id, Amount: 15,
+					}))
+					assert.NoError(t, err)
+					assert.Equal(t, invoice_iface.CompensationValuation_COMPENSATION_VALUATION_MANUAL, revised.Msg.GetCompensation().Valuation)
+
+					// only the owed team reviews.
+					_, err = svc.CompensationAccept(ctx, connect.NewRequest(&invoice_iface.CompensationAcceptRequest{
+						TeamId: warehouse, CompensationId: comp.Id,
+					}))
+					assert.Equal(t, connect.CodeNotFound, connect.CodeOf(err))
+
+					accepted, err := svc.CompensationAccept(ctx, connect.NewRequest(&invoice_iface.CompensationAcceptRequest{
+						TeamId: productTeam, CompensationId: comp.Id,
+					}))
+					assert.NoError(t, err)
+					assert.Equal(t, invoice_iface.CompensationStatus_COMPENSATION_STATUS_ACCEPTED, accepted.Msg.GetCompensation().Status)
+					assert.Equal(t, float64(15), owed())
+
+					_, err = svc.CompensationAccept(ctx, connect.NewRequest(&invoice_iface.CompensationAcceptRequest{
+						TeamId: productTeam, CompensationId: comp.Id,
+					}))
+					assert.Equal(t, connect.CodeFailedPrecondition, connect.CodeOf(err))
+					assert.Equal(t, float64(15), owed())
+				})
+
+				t.Run("review queue lists proposed only", func(t *testing.T) {
+					res, err := svc.CompensationList(ctx, connect.NewRequest(&invoice_iface.CompensationListRequest{
+						TeamId: productTeam,
+						Status: invoice_iface.CompensationStatus_COMPENSATION_STATUS_PROPOSED,
+						Page:   &common.PageFilter{Page: 1, Limit: 20},
+					}))
+					assert.NoError(t, err)
+					assert.Len(t, res.Msg.GetItems(), 3)
+				})
+			})
+		},
+	)
+}
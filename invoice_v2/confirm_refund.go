@@ -0,0 +1,77 @@
+package invoice_v2
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"connectrpc.com/connect"
+	"github.com/pdcgo/invoice_service/invoice_models"
+	invoice_iface "github.com/pdcgo/schema/services/invoice_iface/v2"
+	"github.com/pdcgo/user_service/access_interceptors"
+	"gorm.io/gorm"
+)
+
+// ConfirmRefund implements [invoice_ifaceconnect.InvoiceServiceHandler].
+//
+// The original payer (for_team_id) confirms it received the refund. That clears the
+// credit by a double entry of type REFUND: RECEIVABLE(for_team_id, team_id) drops by
+// the amount, mirrored on the refunding team's PAYABLE. The refund becomes CONFIRMED.
+func (s *invoiceServiceImpl) ConfirmRefund(
+	ctx context.Context,
+	req *connect.Request[invoice_iface.ConfirmRefundRequest],
+) (*connect.Response[invoice_iface.ConfirmRefundResponse], error) {
+	pay := req.Msg
+
+	caller, err := access_interceptors.GetIdentityFromCtx(ctx)
+	if err != nil {
+		return nil, connect.NewError(connect.CodeUnauthenticated, err)
+	}
+	completedBy := uint64(caller.IdentityId)
+
+	now := time.Now()
+	var r *invoice_models.InvoiceRefund
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		r, err = loadPendingRefund(tx, pay.RefundId, pay.TeamId, pay.ForTeamId)
+		if err != nil {
+			return err
+		}
+
+		// The credit may have shrunk since the refund was made (e.g. by a reversal).
+		credit, _, err := refundableCredit(tx, r.TeamID, r.ForTeamID)
+		if err != nil {
+			return err
+		}
+		if r.Amount > credit {
+			return connect.NewError(connect.CodeFailedPrecondition, errors.New("refund exceeds the remaining credit"))
+		}
+
+		note := fmt.Sprintf("refund #%d", r.ID)
+		if err := postDoubleEntry(tx, r.ForTeamID, r.TeamID, invoice_iface.BalanceType_BALANCE_TYPE_RECEIVABLE, invoice_iface.BalanceChangeType_BALANCE_CHANGE_TYPE_REFUND, -r.Amount, note, completedBy, now, nil); err != nil {
+			return err
+		}
+		// The refunding team's PAYABLE to the payer shrank; its alert level may drop back.
+		if err := checkOweLimitAlert(tx, r.TeamID, r.ForTeamID, now); err != nil {
+			return err
+		}
+
+		r.Status = invoice_iface.RefundStatus_REFUND_STATUS_CONFIRMED
+		r.CompletedByID = &completedBy
+		r.ConfirmedAt = &now
+		r.UpdatedAt = now
+		return tx.Model(&invoice_models.InvoiceRefund{}).
+			Where("id = ?", r.ID).
+			Updates(map[string]interface{}{
+				"status":          r.Status,
+				"confirmed_at":    now,
+				"completed_by_id": completedBy,
+				"updated_at":      now,
+			}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return connect.NewResponse(&invoice_iface.ConfirmRefundResponse{Refund: toProtoRefund(r)}), nil
+}
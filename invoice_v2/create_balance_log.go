@@ -20,6 +20,9 @@ import (
 // the opposite balance_type (with swapped teams) by -amount. Both legs update
 // the running TeamBalance, append an immutable BalanceChangeLog, and accumulate
 // a per-day TeamBalanceDailyLog. The whole thing runs in one transaction.
+//
+// A posting above team_id's adjustment threshold, whatever its change_type, is not
+// posted: it is returned as a PENDING approval and posts once a second user approves it.
 func (s *invoiceServiceImpl) CreateBalanceLog(
 	ctx context.Context,
 	req *connect.Request[invoice_iface.CreateBalanceLogRequest],
@@ -34,26 +37,81 @@ func (s *invoiceServiceImpl) CreateBalanceLog(
 	createdByID := uint64(caller.IdentityId)
 
 	now := time.Now()
+	var approval *invoice_models.InvoiceApproval
 	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := validateBalanceLog(pay.TeamId, pay.ForTeamId, pay.ChangeType, pay.ChangeAmount, pay.BalanceType); err != nil {
+			return err
+		}
+		var err error
+		approval, err = holdAdjustment(tx, pay.TeamId, pay.ForTeamId, pay.ChangeType, pay.BalanceType, pay.ChangeAmount, pay.Note, createdByID, now)
+		if err != nil || approval != nil {
+			return err
+		}
 		return PostBalanceLog(tx, pay.TeamId, pay.ForTeamId, pay.ChangeType, pay.ChangeAmount, pay.BalanceType, pay.Note, createdByID, now)
 	})
 	if err != nil {
 		return nil, err
 	}
 
-	return connect.NewResponse(&invoice_iface.CreateBalanceLogResponse{}), nil
+	resp := &invoice_iface.CreateBalanceLogResponse{}
+	if approval != nil {
+		resp.Approval = toProtoApproval(approval)
+	}
+	return connect.NewResponse(resp), nil
 }
 
 // OrderSource attributes the posted ledger legs to the order that caused them
 // (order-driven fees). When passed, both the primary and mirror legs get a
 // BalanceChangeOrderSource row keyed by their balance_change_log id. OrderSystem
 // disambiguates the legacy vs v3 order id-space. TeamID is the canonical ordering
-// team (constant across legs and create/cancel), not the leg's own team.
+// team (constant across legs and create/cancel), not the leg's own team. FeeRuleID and
+// FeeRuleVersion name the warehouse fee rule version that priced the leg, if any.
 type OrderSource struct {
-	OrderSystem invoice_iface.OrderSystem
-	OrderID     uint64
-	TeamID      uint64
-	WarehouseID uint64
+	OrderSystem    invoice_iface.OrderSystem
+	OrderID        uint64
+	TeamID         uint64
+	WarehouseID    uint64
+	FeeRuleID      *uint64
+	FeeRuleVersion *int
+}
+
+// legSource attributes a posted ledger leg to what caused it: attach writes the
+// source row for the leg's balance_change_log id.
+type legSource interface {
+	attach(tx *gorm.DB, logID uint64, now time.Time) error
+}
+
+func (src *OrderSource) attach(tx *gorm.DB, logID uint64, now time.Time) error {
+	return tx.Create(&invoice_models.BalanceChangeOrderSource{
+		BalanceChangeLogID: logID,
+		OrderSystem:        src.OrderSystem,
+		OrderID:            src.OrderID,
+		TeamID:             src.TeamID,
+		WarehouseID:        src.WarehouseID,
+		FeeRuleID:          src.FeeRuleID,
+		FeeRuleVersion:     src.FeeRuleVersion,
+		CreatedAt:          now,
+	}).Error
+}
+
+// PaymentSource links the ledger legs of an accepted payment (settlement and
+// overpayment credit) to the InvoicePayment, and marks the legs of its reversal.
+type PaymentSource struct {
+	PaymentID uint64
+	Reversal  bool
+
+	// selected are the open items the payer chose in CreatePayment; the
+	// settlement pays them first.
+	selected []invoice_models.InvoicePaymentSelection
+}
+
+func (src *PaymentSource) attach(tx *gorm.DB, logID uint64, now time.Time) error {
+	return tx.Create(&invoice_models.BalanceChangePaymentSource{
+		BalanceChangeLogID: logID,
+		PaymentID:          src.PaymentID,
+		Reversal:           src.Reversal,
+		CreatedAt:          now,
+	}).Error
 }
 
 // PostBalanceLog validates and posts a double-entry balance change within the
@@ -61,7 +119,8 @@ type OrderSource struct {
 // it can be composed into any db.Transaction scope (e.g. event/push handlers).
 // It takes createdByID/now as params (no ctx identity lookup) so non-RPC callers
 // can supply a system id and their own clock. An optional OrderSource attaches
-// order attribution to both ledger legs.
+// order attribution to both ledger legs. The debtor's owe-limit alert levels are
+// re-checked afterwards (see checkOweLimitAlert).
 func PostBalanceLog(
 	tx *gorm.DB,
 	teamID, forTeamID uint64,
@@ -72,6 +131,33 @@ func PostBalanceLog(
 	createdByID uint64,
 	now time.Time,
 	src ...*OrderSource,
+) error {
+	if err := validateBalanceLog(teamID, forTeamID, changeType, changeAmount, balanceType); err != nil {
+		return err
+	}
+	var source legSource
+	if len(src) > 0 && src[0] != nil {
+		source = src[0]
+	}
+	if err := postDoubleEntry(tx, teamID, forTeamID, balanceType, changeType, changeAmount, note, createdByID, now, source); err != nil {
+		return err
+	}
+
+	// One leg is always the debtor's PAYABLE; see whether it crossed an alert level.
+	debtor, creditor := teamID, forTeamID
+	if balanceType != invoice_iface.BalanceType_BALANCE_TYPE_PAYABLE {
+		debtor, creditor = forTeamID, teamID
+	}
+	return checkOweLimitAlert(tx, debtor, creditor, now)
+}
+
+// validateBalanceLog checks a requested balance change before it is posted or held
+// for approval.
+func validateBalanceLog(
+	teamID, forTeamID uint64,
+	changeType invoice_iface.BalanceChangeType,
+	changeAmount float64,
+	balanceType invoice_iface.BalanceType,
 ) error {
 	if teamID == 0 || forTeamID == 0 {
 		return connect.NewError(connect.CodeInvalidArgument, errors.New("team_id and for_team_id are required"))
@@ -88,16 +174,13 @@ func PostBalanceLog(
 	if _, err := oppositeBalance(balanceType); err != nil {
 		return connect.NewError(connect.CodeInvalidArgument, err)
 	}
-	var orderSource *OrderSource
-	if len(src) > 0 {
-		orderSource = src[0]
-	}
-	return postDoubleEntry(tx, teamID, forTeamID, balanceType, changeType, changeAmount, note, createdByID, now, orderSource)
+	return nil
 }
 
 // postDoubleEntry posts a signed-mirror double entry for the (teamID, forTeamID)
 // pair: +amount on balance type bt, and -amount on the opposite type with the
-// teams swapped.
+// teams swapped. Callers re-check the debtor's owe-limit alert levels once their
+// postings are done (checkOweLimitAlert), as PostBalanceLog does.
 func postDoubleEntry(
 	tx *gorm.DB,
 	teamID, forTeamID uint64,
@@ -107,7 +190,7 @@ func postDoubleEntry(
 	note string,
 	createdByID uint64,
 	now time.Time,
-	src *OrderSource,
+	src legSource,
 ) error {
 	counterType, err := oppositeBalance(bt)
 	if err != nil {
@@ -121,7 +204,8 @@ func postDoubleEntry(
 
 // postEntry applies a single signed delta to one (team, for_team, balance_type)
 // account: it locks/loads (or creates) the TeamBalance, writes a BalanceChangeLog
-// with the resulting balance, and accumulates the day's TeamBalanceDailyLog.
+// with the resulting balance, and accumulates the day's TeamBalanceDailyLog. The
+// pair's cached owe-limit inputs are invalidated (see OweLimitCache).
 func postEntry(
 	tx *gorm.DB,
 	teamID, forTeamID uint64,
@@ -131,12 +215,13 @@ func postEntry(
 	note string,
 	createdByID uint64,
 	now time.Time,
-	src *OrderSource,
+	src legSource,
 ) error {
 	bal, err := lockOrCreateBalance(tx, teamID, forTeamID, bt, now)
 	if err != nil {
 		return err
 	}
+	touchOweLimit(tx, teamID, forTeamID, bt)
 
 	prev := bal.Balance
 	newBal := prev + delta
@@ -165,18 +250,17 @@ func postEntry(
 		return err
 	}
 
-	// Attach order attribution to this leg (both legs of a double entry carry the
-	// same OrderSource, so the order's full create+reverse fee history is queryable).
+	// Attach attribution to this leg (both legs of a double entry carry the same
+	// source, so e.g. the order's full create+reverse fee history is queryable).
 	if src != nil {
-		source := invoice_models.BalanceChangeOrderSource{
-			BalanceChangeLogID: logEntry.ID,
-			OrderSystem:        src.OrderSystem,
-			OrderID:            src.OrderID,
-			TeamID:             src.TeamID,
-			WarehouseID:        src.WarehouseID,
-			CreatedAt:          now,
+		if err := src.attach(tx, logEntry.ID, now); err != nil {
+			return err
 		}
-		if err := tx.Create(&source).Error; err != nil {
+	}
+
+	// Debits and credits on a PAYABLE account open and pay off open items.
+	if bt == invoice_iface.BalanceType_BALANCE_TYPE_PAYABLE {
+		if err := trackOpenItems(tx, &logEntry, newBal, src, now); err != nil {
 			return err
 		}
 	}
@@ -262,7 +346,8 @@ func lockOrCreateBalance(
 }
 
 // adjustPending moves the PendingPaymentAmount of one (team, for_team,
-// balance_type) account by delta (locking/creating the row as needed).
+// balance_type) account by delta (locking/creating the row as needed), invalidating
+// the pair's cached owe-limit inputs.
 func adjustPending(
 	tx *gorm.DB,
 	teamID, forTeamID uint64,
@@ -274,6 +359,7 @@ func adjustPending(
 	if err != nil {
 		return err
 	}
+	touchOweLimit(tx, teamID, forTeamID, bt)
 	return tx.Model(&invoice_models.TeamBalance{}).
 		Where("id = ?", bal.ID).
 		Updates(map[string]interface{}{
@@ -309,3 +395,9 @@ func startOfJakartaDay(t time.Time) time.Time {
 func lockForUpdate(tx *gorm.DB) *gorm.DB {
 	return tx.Clauses(clause.Locking{Strength: "UPDATE"})
 }
+
+// claimForUpdate applies SELECT ... FOR UPDATE SKIP LOCKED: rows another transaction
+// holds are left to it rather than waited for.
+func claimForUpdate(tx *gorm.DB) *gorm.DB {
+	return tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"})
+}
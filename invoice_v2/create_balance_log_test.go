@@ -29,8 +29,13 @@ func TestCreateBalanceLog(t *testing.T) {
 			scenario(t, func(tx *gorm.DB) {
 				assert.NoError(t, tx.AutoMigrate(
 					&invoice_models.BalanceChangeLog{},
+					&invoice_models.OweLimitAlertLevel{},
+					&invoice_models.BalanceOpenItem{},
+					&invoice_models.BalanceOpenItemAllocation{},
 					&invoice_models.TeamBalance{},
 					&invoice_models.TeamBalanceDailyLog{},
+					&invoice_models.InvoiceApprovalPolicy{},
+					&invoice_models.InvoiceApproval{},
 				))
 
 				svc := invoice_v2.NewInvoiceService(tx)
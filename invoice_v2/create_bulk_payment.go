@@ -0,0 +1,118 @@
+package invoice_v2
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"connectrpc.com/connect"
+	"github.com/pdcgo/invoice_service/invoice_models"
+	invoice_iface "github.com/pdcgo/schema/services/invoice_iface/v2"
+	"github.com/pdcgo/user_service/access_interceptors"
+	"gorm.io/gorm"
+)
+
+// CreateBulkPayment implements [invoice_ifaceconnect.InvoiceServiceHandler].
+//
+// The payer (team_id) settles several creditors with one document: every line becomes
+// a PENDING InvoicePayment to its for_team_id, carrying the batch's document_id and
+// linked to the batch, exactly as if CreatePayment had been called for it. A line may
+// not exceed what the payer still owes that creditor — its outstanding PAYABLE less
+// the payments already pending — and each creditor appears once. All lines are created
+// or none. Receivers then accept or reject their own line; see GetBulkPayment for the
+// batch status.
+func (s *invoiceServiceImpl) CreateBulkPayment(
+	ctx context.Context,
+	req *connect.Request[invoice_iface.CreateBulkPaymentRequest],
+) (*connect.Response[invoice_iface.CreateBulkPaymentResponse], error) {
+	pay := req.Msg
+
+	if pay.TeamId == 0 {
+		return nil, connect.NewError(connect.CodeInvalidArgument, errors.New("team_id is required"))
+	}
+	if strings.TrimSpace(pay.DocumentId) == "" {
+		return nil, connect.NewError(connect.CodeInvalidArgument, errors.New("document_id is required"))
+	}
+	if len(pay.Lines) == 0 {
+		return nil, connect.NewError(connect.CodeInvalidArgument, errors.New("lines are required"))
+	}
+	total := 0.0
+	seen := map[uint64]bool{}
+	for i, line := range pay.Lines {
+		switch {
+		case line.ForTeamId == 0:
+			return nil, connect.NewError(connect.CodeInvalidArgument, fmt.Errorf("line %d: for_team_id is required", i+1))
+		case line.ForTeamId == pay.TeamId:
+			return nil, connect.NewError(connect.CodeInvalidArgument, fmt.Errorf("line %d: team_id and for_team_id must differ", i+1))
+		case seen[line.ForTeamId]:
+			return nil, connect.NewError(connect.CodeInvalidArgument, fmt.Errorf("line %d: for_team_id %d appears twice", i+1, line.ForTeamId))
+		case line.Amount <= 0:
+			return nil, connect.NewError(connect.CodeInvalidArgument, fmt.Errorf("line %d: amount must be greater than zero", i+1))
+		}
+		seen[line.ForTeamId] = true
+		total += line.Amount
+	}
+
+	caller, err := access_interceptors.GetIdentityFromCtx(ctx)
+	if err != nil {
+		return nil, connect.NewError(connect.CodeUnauthenticated, err)
+	}
+	createdBy := uint64(caller.IdentityId)
+
+	now := time.Now()
+	batch := invoice_models.InvoiceBulkPayment{
+		TeamID:      pay.TeamId,
+		DocumentID:  pay.DocumentId,
+		Note:        pay.Note,
+		TotalAmount: total,
+		LineCount:   len(pay.Lines),
+		CreatedByID: createdBy,
+		CreatedAt:   now,
+	}
+	lines := make([]*invoice_models.InvoicePayment, 0, len(pay.Lines))
+
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&batch).Error; err != nil {
+			return err
+		}
+		for i, line := range pay.Lines {
+			bal, err := lockOrCreateBalance(tx, pay.TeamId, line.ForTeamId, invoice_iface.BalanceType_BALANCE_TYPE_PAYABLE, now)
+			if err != nil {
+				return err
+			}
+			payable := max(-bal.Balance, 0) - bal.PendingPaymentAmount
+			if toCents(line.Amount) > toCents(payable) {
+				return connect.NewError(connect.CodeFailedPrecondition, fmt.Errorf("line %d: amount exceeds the outstanding payable %.2f to team %d", i+1, max(payable, 0), line.ForTeamId))
+			}
+
+			note := line.Note
+			if note == "" {
+				note = pay.Note
+			}
+			p := &invoice_models.InvoicePayment{
+				TeamID:        pay.TeamId,
+				ForTeamID:     line.ForTeamId,
+				Amount:        line.Amount,
+				Note:          note,
+				DocumentID:    pay.DocumentId,
+				Status:        invoice_iface.PaymentStatus_PAYMENT_STATUS_PENDING,
+				BulkPaymentID: &batch.ID,
+				CreatedByID:   createdBy,
+				CreatedAt:     now,
+				UpdatedAt:     now,
+			}
+			if err := createPendingPayment(tx, p, nil, now); err != nil {
+				return err
+			}
+			lines = append(lines, p)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return connect.NewResponse(&invoice_iface.CreateBulkPaymentResponse{BulkPayment: toProtoBulkPayment(&batch, lines)}), nil
+}
@@ -3,6 +3,7 @@ package invoice_v2
 import (
 	"context"
 	"errors"
+	"fmt"
 	"time"
 
 	"connectrpc.com/connect"
@@ -17,6 +18,9 @@ import (
 // It records a PENDING payment from team_id to for_team_id and bumps the
 // PendingPaymentAmount on both the payer's PAYABLE and the receiver's RECEIVABLE
 // balances. The actual balance settlement happens on AcceptPayment.
+//
+// Allocations optionally name the payer's open items (see ListOpenItems) the payment
+// is meant for; acceptance pays them first and allocates the rest FIFO.
 func (s *invoiceServiceImpl) CreatePayment(
 	ctx context.Context,
 	req *connect.Request[invoice_iface.CreatePaymentRequest],
@@ -46,14 +50,7 @@ func (s *invoiceServiceImpl) CreatePayment(
 	}
 
 	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
-		if err := tx.Create(&payment).Error; err != nil {
-			return err
-		}
-		// Track the in-flight amount on both sides of the pair.
-		if err := adjustPending(tx, pay.TeamId, pay.ForTeamId, invoice_iface.BalanceType_BALANCE_TYPE_PAYABLE, pay.Amount, now); err != nil {
-			return err
-		}
-		return adjustPending(tx, pay.ForTeamId, pay.TeamId, invoice_iface.BalanceType_BALANCE_TYPE_RECEIVABLE, pay.Amount, now)
+		return createPendingPayment(tx, &payment, pay.Allocations, now)
 	})
 	if err != nil {
 		return nil, err
@@ -61,3 +58,65 @@ func (s *invoiceServiceImpl) CreatePayment(
 
 	return connect.NewResponse(&invoice_iface.CreatePaymentResponse{Id: payment.ID}), nil
 }
+
+// createPendingPayment stores a new PENDING payment with its selected open items and
+// tracks its in-flight amount on both sides of the pair.
+func createPendingPayment(tx *gorm.DB, p *invoice_models.InvoicePayment, allocs []*invoice_iface.PaymentAllocation, now time.Time) error {
+	if err := tx.Create(p).Error; err != nil {
+		return err
+	}
+	if err := saveSelections(tx, p, allocs, now); err != nil {
+		return err
+	}
+	if err := adjustPending(tx, p.TeamID, p.ForTeamID, invoice_iface.BalanceType_BALANCE_TYPE_PAYABLE, p.Amount, now); err != nil {
+		return err
+	}
+	return adjustPending(tx, p.ForTeamID, p.TeamID, invoice_iface.BalanceType_BALANCE_TYPE_RECEIVABLE, p.Amount, now)
+}
+
+// saveSelections validates the payer's explicit allocations against its open items
+// to the receiver and stores them, in order, for settlePayment.
+func saveSelections(tx *gorm.DB, p *invoice_models.InvoicePayment, allocs []*invoice_iface.PaymentAllocation, now time.Time) error {
+	total := 0.0
+	seen := map[uint64]bool{}
+	for i, a := range allocs {
+		if a.Amount <= 0 {
+			return connect.NewError(connect.CodeInvalidArgument, errors.New("allocation amount must be greater than zero"))
+		}
+		if seen[a.BalanceChangeLogId] {
+			return connect.NewError(connect.CodeInvalidArgument, fmt.Errorf("open item %d allocated twice", a.BalanceChangeLogId))
+		}
+		seen[a.BalanceChangeLogId] = true
+
+		var item invoice_models.BalanceOpenItem
+		res := tx.
+			Where("balance_change_log_id = ? AND team_id = ? AND for_team_id = ?", a.BalanceChangeLogId, p.TeamID, p.ForTeamID).
+			Limit(1).
+			Find(&item)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return connect.NewError(connect.CodeInvalidArgument, fmt.Errorf("open item %d not found for team_id/for_team_id", a.BalanceChangeLogId))
+		}
+		if a.Amount > item.Remaining {
+			return connect.NewError(connect.CodeInvalidArgument, fmt.Errorf("allocation to open item %d exceeds its remaining %.2f", a.BalanceChangeLogId, item.Remaining))
+		}
+		total += a.Amount
+
+		sel := invoice_models.InvoicePaymentSelection{
+			PaymentID:          p.ID,
+			BalanceChangeLogID: a.BalanceChangeLogId,
+			Seq:                i,
+			Amount:             a.Amount,
+			CreatedAt:          now,
+		}
+		if err := tx.Create(&sel).Error; err != nil {
+			return err
+		}
+	}
+	if total > p.Amount {
+		return connect.NewError(connect.CodeInvalidArgument, errors.New("allocations exceed the payment amount"))
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+package invoice_v2
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"connectrpc.com/connect"
+	"github.com/pdcgo/invoice_service/invoice_models"
+	invoice_iface "github.com/pdcgo/schema/services/invoice_iface/v2"
+	"github.com/pdcgo/user_service/access_interceptors"
+	"gorm.io/gorm"
+)
+
+// CreateRefund implements [invoice_ifaceconnect.InvoiceServiceHandler].
+//
+// The refunding team (team_id) records that it paid back part of the credit the
+// original payer (for_team_id) holds on it, e.g. an overpayment. The refund is
+// PENDING and moves no balance until the original payer confirms receipt. The amount
+// may not exceed the credit less the refunds already pending.
+func (s *invoiceServiceImpl) CreateRefund(
+	ctx context.Context,
+	req *connect.Request[invoice_iface.CreateRefundRequest],
+) (*connect.Response[invoice_iface.CreateRefundResponse], error) {
+	pay := req.Msg
+
+	if pay.TeamId == 0 || pay.ForTeamId == 0 {
+		return nil, connect.NewError(connect.CodeInvalidArgument, errors.New("team_id and for_team_id are required"))
+	}
+	if pay.TeamId == pay.ForTeamId {
+		return nil, connect.NewError(connect.CodeInvalidArgument, errors.New("team_id and for_team_id must differ"))
+	}
+	if pay.Amount <= 0 {
+		return nil, connect.NewError(connect.CodeInvalidArgument, errors.New("amount must be greater than zero"))
+	}
+
+	caller, err := access_interceptors.GetIdentityFromCtx(ctx)
+	if err != nil {
+		return nil, connect.NewError(connect.CodeUnauthenticated, err)
+	}
+
+	now := time.Now()
+	refund := invoice_models.InvoiceRefund{
+		TeamID:      pay.TeamId,
+		ForTeamID:   pay.ForTeamId,
+		Amount:      pay.Amount,
+		Note:        pay.Note,
+		DocumentID:  pay.DocumentId,
+		Status:      invoice_iface.RefundStatus_REFUND_STATUS_PENDING,
+		CreatedByID: uint64(caller.IdentityId),
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		credit, pending, err := refundableCredit(tx, pay.TeamId, pay.ForTeamId)
+		if err != nil {
+			return err
+		}
+		if refundable := credit - pending; pay.Amount > refundable {
+			return connect.NewError(connect.CodeFailedPrecondition, fmt.Errorf("amount exceeds the refundable credit %.2f", max(refundable, 0)))
+		}
+		return tx.Create(&refund).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return connect.NewResponse(&invoice_iface.CreateRefundResponse{Refund: toProtoRefund(&refund)}), nil
+}
@@ -0,0 +1,37 @@
+package invoice_v2
+
+import (
+	"context"
+	"errors"
+
+	"connectrpc.com/connect"
+	"github.com/pdcgo/invoice_service/invoice_models"
+	invoice_iface "github.com/pdcgo/schema/services/invoice_iface/v2"
+)
+
+// GetBulkPayment implements [invoice_ifaceconnect.InvoiceServiceHandler]. It returns
+// one of the payer's (team_id) batches with every line payment as it stands now and
+// the batch status derived from them.
+func (s *invoiceServiceImpl) GetBulkPayment(
+	ctx context.Context,
+	req *connect.Request[invoice_iface.GetBulkPaymentRequest],
+) (*connect.Response[invoice_iface.GetBulkPaymentResponse], error) {
+	pay := req.Msg
+	db := s.db.WithContext(ctx)
+
+	var batch invoice_models.InvoiceBulkPayment
+	res := db.Where("id = ? AND team_id = ?", pay.BulkPaymentId, pay.TeamId).Limit(1).Find(&batch)
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	if res.RowsAffected == 0 {
+		return nil, connect.NewError(connect.CodeNotFound, errors.New("bulk payment not found"))
+	}
+
+	var lines []*invoice_models.InvoicePayment
+	if err := db.Where("bulk_payment_id = ?", batch.ID).Order("id").Find(&lines).Error; err != nil {
+		return nil, err
+	}
+
+	return connect.NewResponse(&invoice_iface.GetBulkPaymentResponse{BulkPayment: toProtoBulkPayment(&batch, lines)}), nil
+}
@@ -0,0 +1,69 @@
+package invoice_v2
+
+import (
+	"context"
+	"errors"
+
+	"connectrpc.com/connect"
+	"github.com/pdcgo/invoice_service/invoice_models"
+	"github.com/pdcgo/schema/services/common/v1"
+	invoice_iface "github.com/pdcgo/schema/services/invoice_iface/v2"
+	"github.com/pdcgo/shared/db_connect"
+	"gorm.io/gorm"
+)
+
+// ListIncomingRefund implements [invoice_ifaceconnect.InvoiceServiceHandler]. It
+// lists the INCOMING refunds of the scoped team (for_team_id = original payer),
+// optionally filtered by refunding team and status.
+func (s *invoiceServiceImpl) ListIncomingRefund(
+	ctx context.Context,
+	req *connect.Request[invoice_iface.ListIncomingRefundRequest],
+) (*connect.Response[invoice_iface.ListIncomingRefundResponse], error) {
+	pay := req.Msg
+	if pay.Page == nil {
+		return nil, connect.NewError(connect.CodeInvalidArgument, errors.New("page is required"))
+	}
+
+	result := &invoice_iface.ListIncomingRefundResponse{
+		Refunds:  []*invoice_iface.Refund{},
+		PageInfo: &common.PageInfo{},
+	}
+	db := s.db.WithContext(ctx)
+
+	var rows []*invoice_models.InvoiceRefund
+	paginated, pageInfo, err := db_connect.SetPaginationQuery(db, func() (*gorm.DB, error) {
+		query := db.
+			Model(&invoice_models.InvoiceRefund{}).
+			Scopes(func(d *gorm.DB) *gorm.DB {
+				d = d.Where("for_team_id = ?", pay.ForTeamId)
+				if pay.TeamId > 0 {
+					d = d.Where("team_id = ?", pay.TeamId)
+				}
+				if pay.Status != invoice_iface.RefundStatus_REFUND_STATUS_UNSPECIFIED {
+					d = d.Where("status = ?", pay.Status)
+				}
+				if pay.FromTime != nil {
+					d = d.Where("created_at >= ?", pay.FromTime.AsTime())
+				}
+				if pay.ToTime != nil {
+					d = d.Where("created_at <= ?", pay.ToTime.AsTime())
+				}
+				return d
+			})
+		return query, nil
+	}, pay.Page)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := paginated.Order("id DESC").Find(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	result.PageInfo = pageInfo
+	for _, row := range rows {
+		result.Refunds = append(result.Refunds, toProtoRefund(row))
+	}
+
+	return connect.NewResponse(result), nil
+}
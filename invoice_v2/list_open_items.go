@@ -0,0 +1,143 @@
+package invoice_v2
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"connectrpc.com/connect"
+	"github.com/pdcgo/schema/services/common/v1"
+	invoice_iface "github.com/pdcgo/schema/services/invoice_iface/v2"
+	"github.com/pdcgo/shared/db_connect"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"gorm.io/gorm"
+)
+
+// ListOpenItems implements [invoice_ifaceconnect.InvoiceServiceHandler]. It lists
+// what the scoped team (team_id) still owes, one row per debit on its PAYABLE that
+// is not yet paid off, oldest first, with the debit's order attribution (through
+// balance_change_order_sources). It can be narrowed to a counterparty or an order,
+// and include_closed also returns fully paid items. Counterparties totals the
+// remaining amount per counterparty under the same filters. Results are paginated.
+func (s *invoiceServiceImpl) ListOpenItems(
+	ctx context.Context,
+	req *connect.Request[invoice_iface.ListOpenItemsRequest],
+) (*connect.Response[invoice_iface.ListOpenItemsResponse], error) {
+	pay := req.Msg
+	if pay.Page == nil {
+		return nil, connect.NewError(connect.CodeInvalidArgument, errors.New("page is required"))
+	}
+	if pay.TeamId == 0 {
+		return nil, connect.NewError(connect.CodeInvalidArgument, errors.New("team_id is required"))
+	}
+
+	result := &invoice_iface.ListOpenItemsResponse{
+		Items:          []*invoice_iface.OpenItem{},
+		Counterparties: []*invoice_iface.OpenItemCounterparty{},
+		PageInfo:       &common.PageInfo{},
+	}
+	db := s.db.WithContext(ctx)
+
+	filter := func(d *gorm.DB) *gorm.DB {
+		d = d.
+			Joins("JOIN balance_change_logs bcl ON bcl.id = oi.balance_change_log_id").
+			Joins("LEFT JOIN balance_change_order_sources s ON s.balance_change_log_id = oi.balance_change_log_id").
+			Where("oi.team_id = ?", pay.TeamId)
+		if pay.ForTeamId > 0 {
+			d = d.Where("oi.for_team_id = ?", pay.ForTeamId)
+		}
+		if pay.OrderId > 0 {
+			d = d.Where("s.order_id = ?", pay.OrderId)
+		}
+		if pay.OrderSystem != invoice_iface.OrderSystem_ORDER_SYSTEM_UNSPECIFIED {
+			d = d.Where("s.order_system = ?", pay.OrderSystem)
+		}
+		if !pay.IncludeClosed {
+			d = d.Where("oi.remaining > 0")
+		}
+		return d
+	}
+
+	var rows []openItemRow
+	paginated, pageInfo, err := db_connect.SetPaginationQuery(db, func() (*gorm.DB, error) {
+		query := db.
+			Table("balance_open_items oi").
+			Select("oi.*, bcl.note, COALESCE(s.order_id, 0) as order_id, COALESCE(s.warehouse_id, 0) as warehouse_id, COALESCE(s.order_system, 0) as order_system").
+			Scopes(filter)
+		return query, nil
+	}, pay.Page)
+	if err != nil {
+		return nil, err
+	}
+	if err := paginated.Order("oi.balance_change_log_id").Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	var totals []struct {
+		ForTeamID uint64
+		Remaining float64
+		ItemCount int64
+	}
+	err = db.
+		Table("balance_open_items oi").
+		Select("oi.for_team_id, SUM(oi.remaining) as remaining, COUNT(*) as item_count").
+		Scopes(filter).
+		Where("oi.remaining > 0").
+		Group("oi.for_team_id").
+		Order("oi.for_team_id").
+		Scan(&totals).Error
+	if err != nil {
+		return nil, err
+	}
+
+	result.PageInfo = pageInfo
+	for i := range rows {
+		result.Items = append(result.Items, toProtoOpenItem(&rows[i]))
+	}
+	for _, t := range totals {
+		result.Counterparties = append(result.Counterparties, &invoice_iface.OpenItemCounterparty{
+			ForTeamId: t.ForTeamID,
+			Remaining: t.Remaining,
+			ItemCount: t.ItemCount,
+		})
+	}
+
+	return connect.NewResponse(result), nil
+}
+
+// openItemRow scans a BalanceOpenItem with its debit leg's note and (LEFT-joined)
+// order-source columns.
+type openItemRow struct {
+	BalanceChangeLogID uint64
+	TeamID             uint64
+	ForTeamID          uint64
+	ChangeType         invoice_iface.BalanceChangeType
+	Note               string
+	Amount             float64
+	Remaining          float64
+	CreatedAt          time.Time
+	ClosedAt           *time.Time
+	OrderID            uint64
+	WarehouseID        uint64
+	OrderSystem        invoice_iface.OrderSystem
+}
+
+func toProtoOpenItem(r *openItemRow) *invoice_iface.OpenItem {
+	out := &invoice_iface.OpenItem{
+		BalanceChangeLogId: r.BalanceChangeLogID,
+		TeamId:             r.TeamID,
+		ForTeamId:          r.ForTeamID,
+		ChangeType:         r.ChangeType,
+		Note:               r.Note,
+		Amount:             r.Amount,
+		Remaining:          r.Remaining,
+		CreatedAt:          timestamppb.New(r.CreatedAt),
+		OrderSystem:        r.OrderSystem,
+		OrderId:            r.OrderID,
+		WarehouseId:        r.WarehouseID,
+	}
+	if r.ClosedAt != nil {
+		out.ClosedAt = timestamppb.New(*r.ClosedAt)
+	}
+	return out
+}
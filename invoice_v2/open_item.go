@@ -0,0 +1,206 @@
+package invoice_v2
+
+import (
+	"time"
+
+	"github.com/pdcgo/invoice_service/invoice_models"
+	"gorm.io/gorm"
+)
+
+// trackOpenItems keeps open-item accounting in step with one posted PAYABLE leg.
+// A debit (delta < 0) opens an item for the part of it that is actually owed (a
+// prior credit balance on the account absorbs the rest); the debit of a payment
+// reversal instead reopens what that payment had paid off. A credit (delta > 0)
+// pays off open items: the payment's selections first, then items from the same
+// source (order, or the payment being reversed), then oldest first.
+func trackOpenItems(tx *gorm.DB, leg *invoice_models.BalanceChangeLog, newBal float64, src legSource, now time.Time) error {
+	if leg.ChangeAmount < 0 {
+		owed := -leg.ChangeAmount
+		if debt := -newBal; debt < owed {
+			owed = max(debt, 0)
+		}
+		if ps, ok := src.(*PaymentSource); ok && ps.Reversal {
+			reopened, err := reopenPaymentAllocations(tx, leg, ps.PaymentID, owed, now)
+			if err != nil {
+				return err
+			}
+			if owed -= reopened; owed <= 0 {
+				return nil
+			}
+		}
+		item := invoice_models.BalanceOpenItem{
+			BalanceChangeLogID: leg.ID,
+			TeamID:             leg.TeamID,
+			ForTeamID:          leg.ForTeamID,
+			ChangeType:         leg.ChangeType,
+			Amount:             -leg.ChangeAmount,
+			Remaining:          owed,
+			CreatedAt:          now,
+			UpdatedAt:          now,
+		}
+		if owed <= 0 {
+			item.ClosedAt = &now
+		}
+		return tx.Create(&item).Error
+	}
+	if leg.ChangeAmount > 0 {
+		return allocateCredit(tx, leg, src, now)
+	}
+	return nil
+}
+
+// allocateCredit pays off open items on the leg's account with the credit leg.
+// Whatever exceeds the open items is left unallocated (the account is in credit).
+func allocateCredit(tx *gorm.DB, leg *invoice_models.BalanceChangeLog, src legSource, now time.Time) error {
+	var items []invoice_models.BalanceOpenItem
+	err := lockForUpdate(tx).
+		Where("team_id = ? AND for_team_id = ? AND remaining > 0", leg.TeamID, leg.ForTeamID).
+		Order("balance_change_log_id").
+		Find(&items).Error
+	if err != nil || len(items) == 0 {
+		return err
+	}
+
+	// Explicit amounts per item come first, in selection order; then preferred items
+	// in full; then everything else FIFO.
+	var explicit []invoice_models.InvoicePaymentSelection
+	var preferred []uint64
+	var paymentID *uint64
+	switch s := src.(type) {
+	case *PaymentSource:
+		if s.Reversal {
+			err = tx.Model(&invoice_models.BalanceChangePaymentSource{}).
+				Where("payment_id = ? AND NOT reversal", s.PaymentID).
+				Pluck("balance_change_log_id", &preferred).Error
+		} else {
+			explicit = s.selected
+			paymentID = &s.PaymentID
+		}
+	case *OrderSource:
+		err = tx.Model(&invoice_models.BalanceChangeOrderSource{}).
+			Where("order_system = ? AND order_id = ?", s.OrderSystem, s.OrderID).
+			Pluck("balance_change_log_id", &preferred).Error
+	}
+	if err != nil {
+		return err
+	}
+
+	byID := make(map[uint64]*invoice_models.BalanceOpenItem, len(items))
+	for i := range items {
+		byID[items[i].BalanceChangeLogID] = &items[i]
+	}
+	left := leg.ChangeAmount
+	pay := func(item *invoice_models.BalanceOpenItem, amount float64) error {
+		amount = min(amount, item.Remaining, left)
+		if amount <= 0 {
+			return nil
+		}
+		item.Remaining -= amount
+		left -= amount
+		updates := map[string]interface{}{
+			"remaining":  item.Remaining,
+			"updated_at": now,
+		}
+		if item.Remaining <= 0 {
+			updates["closed_at"] = now
+		}
+		if err := tx.Model(&invoice_models.BalanceOpenItem{}).
+			Where("balance_change_log_id = ?", item.BalanceChangeLogID).
+			Updates(updates).Error; err != nil {
+			return err
+		}
+		return tx.Create(&invoice_models.BalanceOpenItemAllocation{
+			OpenItemID:  item.BalanceChangeLogID,
+			CreditLogID: leg.ID,
+			PaymentID:   paymentID,
+			Amount:      amount,
+			CreatedAt:   now,
+		}).Error
+	}
+
+	for _, sel := range explicit {
+		if item := byID[sel.BalanceChangeLogID]; item != nil {
+			if err := pay(item, sel.Amount); err != nil {
+				return err
+			}
+		}
+	}
+	for _, id := range preferred {
+		if item := byID[id]; item != nil {
+			if err := pay(item, item.Remaining); err != nil {
+				return err
+			}
+		}
+	}
+	for i := range items {
+		if left <= 0 {
+			break
+		}
+		if err := pay(&items[i], items[i].Remaining); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// reopenPaymentAllocations puts back, newest first, up to amount of what paymentID
+// paid off on the leg's account, releasing those allocations. An allocation reopened
+// only in part is split: it keeps the unreleased rest and a released row records the
+// part put back. It returns the amount reopened.
+func reopenPaymentAllocations(tx *gorm.DB, leg *invoice_models.BalanceChangeLog, paymentID uint64, amount float64, now time.Time) (float64, error) {
+	var allocs []invoice_models.BalanceOpenItemAllocation
+	err := tx.Model(&invoice_models.BalanceOpenItemAllocation{}).
+		Joins("JOIN balance_open_items i ON i.balance_change_log_id = balance_open_item_allocations.open_item_id").
+		Where("balance_open_item_allocations.payment_id = ? AND balance_open_item_allocations.released_at IS NULL", paymentID).
+		Where("i.team_id = ? AND i.for_team_id = ?", leg.TeamID, leg.ForTeamID).
+		Order("balance_open_item_allocations.id DESC").
+		Find(&allocs).Error
+	if err != nil {
+		return 0, err
+	}
+
+	reopened := 0.0
+	for _, a := range allocs {
+		r := min(a.Amount, amount-reopened)
+		if r <= 0 {
+			break
+		}
+		if err := tx.Model(&invoice_models.BalanceOpenItem{}).
+			Where("balance_change_log_id = ?", a.OpenItemID).
+			Updates(map[string]interface{}{
+				"remaining":  gorm.Expr("remaining + ?", r),
+				"closed_at":  nil,
+				"updated_at": now,
+			}).Error; err != nil {
+			return 0, err
+		}
+		if err := releaseAllocation(tx, &a, r, now); err != nil {
+			return 0, err
+		}
+		reopened += r
+	}
+	return reopened, nil
+}
+
+// releaseAllocation marks amount of allocation a as released, splitting a when that
+// is less than all of it.
+func releaseAllocation(tx *gorm.DB, a *invoice_models.BalanceOpenItemAllocation, amount float64, now time.Time) error {
+	if amount >= a.Amount {
+		return tx.Model(&invoice_models.BalanceOpenItemAllocation{}).
+			Where("id = ?", a.ID).
+			Update("released_at", now).Error
+	}
+	if err := tx.Model(&invoice_models.BalanceOpenItemAllocation{}).
+		Where("id = ?", a.ID).
+		Update("amount", gorm.Expr("amount - ?", amount)).Error; err != nil {
+		return err
+	}
+	return tx.Create(&invoice_models.BalanceOpenItemAllocation{
+		OpenItemID:  a.OpenItemID,
+		CreditLogID: a.CreditLogID,
+		PaymentID:   a.PaymentID,
+		Amount:      amount,
+		CreatedAt:   a.CreatedAt,
+		ReleasedAt:  &now,
+	}).Error
+}
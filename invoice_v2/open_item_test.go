@@ -0,0 +1,208 @@
+package invoice_v2_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"connectrpc.com/connect"
+	"github.com/pdcgo/invoice_service/invoice_models"
+	"github.com/pdcgo/invoice_service/invoice_v2"
+	"github.com/pdcgo/schema/services/common/v1"
+	invoice_iface "github.com/pdcgo/schema/services/invoice_iface/v2"
+	role_base "github.com/pdcgo/schema/services/role_base/v1"
+	"github.com/pdcgo/shared/pkg/moretest"
+	"github.com/pdcgo/shared/pkg/moretest/moretest_mock"
+	"github.com/pdcgo/user_service/access_interceptors"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func TestOpenItems(t *testing.T) {
+	var scenario moretest_mock.DbScenario
+
+	moretest.Suite(t, "open items",
+		moretest.SetupListFunc{
+			moretest_mock.MockPostgresDatabase(&scenario),
+		},
+		func(t *testing.T) {
+			scenario(t, func(tx *gorm.DB) {
+				assert.NoError(t, tx.AutoMigrate(
+					&invoice_models.InvoicePayment{},
+					&invoice_models.InvoicePaymentSelection{},
+					&invoice_models.TeamBalance{},
+					&invoice_models.BalanceChangeLog{},
+					&invoice_models.OweLimitAlertLevel{},
+					&invoice_models.BalanceOpenItem{},
+					&invoice_models.BalanceOpenItemAllocation{},
+					&invoice_models.BalanceChangeOrderSource{},
+					&invoice_models.BalanceChangePaymentSource{},
+					&invoice_models.TeamBalanceDailyLog{},
+					&invoice_models.InvoiceApprovalPolicy{},
+					&invoice_models.InvoiceApproval{},
+				))
+
+				svc := invoice_v2.NewInvoiceService(tx)
+				ctx := access_interceptors.SetIdentityToCtx(
+					context.Background(),
+					&role_base.Identity{IdentityId: 7},
+				)
+				now := time.Now()
+
+				// Team 60 owes team 61: order 1 fee 10, order 2 fee 20, then an adjustment of 5.
+				debit := func(changeType invoice_iface.BalanceChangeType, amount float64, orderID uint64) {
+					var src []*invoice_v2.OrderSource
+					if orderID > 0 {
+						src = append(src, &invoice_v2.OrderSource{
+							OrderSystem: invoice_iface.OrderSystem_ORDER_SYSTEM_V3,
+							OrderID:     orderID,
+							TeamID:      60,
+							WarehouseID: 61,
+						})
+					}
+					assert.NoError(t, invoice_v2.PostBalanceLog(tx, 61, 60, changeType, amount, receivable, "debit", callerID, now, src...))
+				}
+				debit(invoice_iface.BalanceChangeType_BALANCE_CHANGE_TYPE_WAREHOUSE_FEE, 10, 1)
+				debit(invoice_iface.BalanceChangeType_BALANCE_CHANGE_TYPE_WAREHOUSE_FEE, 20, 2)
+				debit(invoice_iface.BalanceChangeType_BALANCE_CHANGE_TYPE_ADJUSTMENT, 5, 0)
+
+				list := func(req *invoice_iface.ListOpenItemsRequest) *invoice_iface.ListOpenItemsResponse {
+					req.TeamId = 60
+					req.Page = &common.PageFilter{Page: 1, Limit: 10}
+					res, err := svc.ListOpenItems(ctx, connect.NewRequest(req))
+					assert.NoError(t, err)
+					return res.Msg
+				}
+				remaining := func() map[uint64]float64 {
+					out := map[uint64]float64{}
+					for _, item := range list(&invoice_iface.ListOpenItemsRequest{IncludeClosed: true}).Items {
+						out[item.OrderId] = item.Remaining
+					}
+					return out
+				}
+
+				t.Run("debits are open items", func(t *testing.T) {
+					res := list(&invoice_iface.ListOpenItemsRequest{})
+					assert.Len(t, res.Items, 3)
+					assert.Equal(t, uint64(1), res.Items[0].OrderId)
+					assert.Equal(t, float64(10), res.Items[0].Remaining)
+					if assert.Len(t, res.Counterparties, 1) {
+						assert.Equal(t, uint64(61), res.Counterparties[0].ForTeamId)
+						assert.Equal(t, float64(35), res.Counterparties[0].Remaining)
+						assert.Equal(t, int64(3), res.Counterparties[0].ItemCount)
+					}
+
+					byOrder := list(&invoice_iface.ListOpenItemsRequest{OrderId: 2})
+					if assert.Len(t, byOrder.Items, 1) {
+						assert.Equal(t, float64(20), byOrder.Items[0].Remaining)
+					}
+
+					// the receiver's side has nothing open.
+					other, err := svc.ListOpenItems(ctx, connect.NewRequest(&invoice_iface.ListOpenItemsRequest{
+						TeamId: 61,
+						Page:   &common.PageFilter{Page: 1, Limit: 10},
+					}))
+					assert.NoError(t, err)
+					assert.Empty(t, other.Msg.Items)
+				})
+
+				var paymentID uint64
+				t.Run("selected items are paid first, the rest FIFO", func(t *testing.T) {
+					items := list(&invoice_iface.ListOpenItemsRequest{OrderId: 2}).Items
+					res, err := svc.CreatePayment(ctx, connect.NewRequest(&invoice_iface.CreatePaymentRequest{
+						TeamId:    60,
+						ForTeamId: 61,
+						Amount:    25,
+						Allocations: []*invoice_iface.PaymentAllocation{
+							{BalanceChangeLogId: items[0].BalanceChangeLogId, Amount: 20},
+						},
+					}))
+					assert.NoError(t, err)
+					paymentID = res.Msg.Id
+
+					_, err = svc.AcceptPayment(ctx, connect.NewRequest(&invoice_iface.AcceptPaymentRequest{
+						TeamId: 60, ForTeamId: 61, PaymentId: paymentID,
+					}))
+					assert.NoError(t, err)
+
+					// order 2 paid off by selection; the other 5 went to the oldest item (order 1).
+					assert.Equal(t, map[uint64]float64{1: 5, 2: 0, 0: 5}, remaining())
+					open := list(&invoice_iface.ListOpenItemsRequest{})
+					assert.Len(t, open.Items, 2)
+					assert.Equal(t, float64(10), open.Counterparties[0].Remaining)
+				})
+
+				t.Run("allocation beyond an item's remaining rejected", func(t *testing.T) {
+					items := list(&invoice_iface.ListOpenItemsRequest{OrderId: 1}).Items
+					_, err := svc.CreatePayment(ctx, connect.NewRequest(&invoice_iface.CreatePaymentRequest{
+						TeamId:    60,
+						ForTeamId: 61,
+						Amount:    50,
+						Allocations: []*invoice_iface.PaymentAllocation{
+							{BalanceChangeLogId: items[0].BalanceChangeLogId, Amount: 6},
+						},
+					}))
+					assert.Equal(t, connect.CodeInvalidArgument, connect.CodeOf(err))
+				})
+
+				t.Run("reversal reopens what the payment paid", func(t *testing.T) {
+					_, err := svc.ReversePayment(ctx, connect.NewRequest(&invoice_iface.ReversePaymentRequest{
+						TeamId: 60, ForTeamId: 61, PaymentId: paymentID, Reason: "bounced",
+					}))
+					assert.NoError(t, err)
+					assert.Equal(t, map[uint64]float64{1: 10, 2: 20, 0: 5}, remaining())
+				})
+
+				t.Run("order credit pays off that order's item", func(t *testing.T) {
+					// cancel order 2's fee: credit PAYABLE(60,61) attributed to order 2.
+					assert.NoError(t, invoice_v2.PostBalanceLog(tx, 60, 61,
+						invoice_iface.BalanceChangeType_BALANCE_CHANGE_TYPE_WAREHOUSE_FEE,
+						20, payable, "cancel", callerID, now,
+						&invoice_v2.OrderSource{
+							OrderSystem: invoice_iface.OrderSystem_ORDER_SYSTEM_V3,
+							OrderID:     2,
+							TeamID:      60,
+							WarehouseID: 61,
+						}))
+					assert.Equal(t, map[uint64]float64{1: 10, 2: 0, 0: 5}, remaining())
+				})
+
+				t.Run("a reversal owed only in part splits the allocation", func(t *testing.T) {
+					res, err := svc.CreatePayment(ctx, connect.NewRequest(&invoice_iface.CreatePaymentRequest{
+						TeamId: 60, ForTeamId: 61, Amount: 15,
+					}))
+					assert.NoError(t, err)
+					_, err = svc.AcceptPayment(ctx, connect.NewRequest(&invoice_iface.AcceptPaymentRequest{
+						TeamId: 60, ForTeamId: 61, PaymentId: res.Msg.Id,
+					}))
+					assert.NoError(t, err)
+					assert.Equal(t, map[uint64]float64{1: 0, 2: 0, 0: 0}, remaining())
+
+					// a credit of 6 leaves the account in credit, so the reversal owes only 9.
+					assert.NoError(t, invoice_v2.PostBalanceLog(tx, 60, 61,
+						invoice_iface.BalanceChangeType_BALANCE_CHANGE_TYPE_ADJUSTMENT,
+						6, payable, "credit", callerID, now))
+					_, err = svc.ReversePayment(ctx, connect.NewRequest(&invoice_iface.ReversePaymentRequest{
+						TeamId: 60, ForTeamId: 61, PaymentId: res.Msg.Id, Reason: "bounced",
+					}))
+					assert.NoError(t, err)
+					// newest allocation first: the adjustment's 5 in full, then 4 of order 1's 10.
+					assert.Equal(t, map[uint64]float64{1: 4, 2: 0, 0: 5}, remaining())
+
+					var allocs []invoice_models.BalanceOpenItemAllocation
+					assert.NoError(t, tx.Where("payment_id = ?", res.Msg.Id).Order("id").Find(&allocs).Error)
+					var held, released float64
+					for _, a := range allocs {
+						if a.ReleasedAt == nil {
+							held += a.Amount
+						} else {
+							released += a.Amount
+						}
+					}
+					assert.Equal(t, float64(6), held)
+					assert.Equal(t, float64(9), released)
+				})
+			})
+		},
+	)
+}
@@ -105,8 +105,8 @@ func (s *invoiceServiceImpl) Overview(
 				return nil, err
 			}
 			v, err := sumCol(scope(db.Model(&invoice_models.InvoicePayment{}).
-				Where("status = ?", invoice_iface.PaymentStatus_PAYMENT_STATUS_ACCEPTED).
-				Where("accepted_at BETWEEN ? AND ?", start, end)), "amount")
+				Where("status IN ?", psSettled).
+				Where("accepted_at BETWEEN ? AND ?", start, end)), sqlAcceptedAmount)
 			if err != nil {
 				return nil, err
 			}
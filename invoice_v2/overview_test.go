@@ -25,6 +25,9 @@ func TestOverview(t *testing.T) {
 				assert.NoError(t, tx.AutoMigrate(
 					&invoice_models.TeamBalance{},
 					&invoice_models.BalanceChangeLog{},
+					&invoice_models.OweLimitAlertLevel{},
+					&invoice_models.BalanceOpenItem{},
+					&invoice_models.BalanceOpenItemAllocation{},
 					&invoice_models.InvoicePayment{},
 				))
 
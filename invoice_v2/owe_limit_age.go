@@ -0,0 +1,269 @@
+package invoice_v2
+
+import (
+	"errors"
+	"time"
+
+	"connectrpc.com/connect"
+	"github.com/pdcgo/invoice_service/invoice_models"
+	invoice_iface "github.com/pdcgo/schema/services/invoice_iface/v2"
+	"github.com/pdcgo/shared/db_models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ageRulesOf maps each configuration id to its max age in days; configurations without
+// an age rule are absent.
+func ageRulesOf(db *gorm.DB, configIDs []uint64) (map[uint64]int64, error) {
+	out := map[uint64]int64{}
+	if len(configIDs) == 0 {
+		return out, nil
+	}
+	var rules []invoice_models.OweLimitAgeRule
+	if err := db.Where("configuration_id IN ?", configIDs).Find(&rules).Error; err != nil {
+		return nil, err
+	}
+	for _, r := range rules {
+		out[r.ConfigurationID] = r.MaxAgeDays
+	}
+	return out, nil
+}
+
+// oldestUnsettledDebt is, per creditor, when the debtor's oldest debt still unpaid as
+// of asOf was incurred (see unsettledDebits). Creditors owed nothing are absent.
+func oldestUnsettledDebt(db *gorm.DB, debtorTeamID uint64, creditorTeamIDs []uint64, asOf time.Time) (map[uint64]time.Time, error) {
+	open, err := unsettledDebits(db, debtorTeamID, creditorTeamIDs, asOf)
+	if err != nil {
+		return nil, err
+	}
+	out := make(map[uint64]time.Time, len(open))
+	for c, debits := range open {
+		out[c] = debits[0].at
+	}
+	return out, nil
+}
+
+// unsettledDebits is, per creditor, the debtor's debits still unpaid as of asOf, oldest
+// first. It replays the debtor's PAYABLE legs from balance_change_logs with payments
+// consuming the oldest debits first, exactly as AgingReport does, so the age a limit
+// blocks on is the age the report shows. Creditors owed nothing are absent.
+//
+// The replay starts after the last leg that left the account settled, in the replay's
+// own created_at order: nothing before it is still unpaid, and the balance there is the
+// credit carried forward. That balance is summed in created_at order rather than read
+// from the stored balance column, which follows id order and disagrees with it once a
+// leg is backdated (a late delivery or a replayed event).
+func unsettledDebits(db *gorm.DB, debtorTeamID uint64, creditorTeamIDs []uint64, asOf time.Time) (map[uint64][]debit, error) {
+	out := map[uint64][]debit{}
+	if len(creditorTeamIDs) == 0 {
+		return out, nil
+	}
+	running := db.
+		Table("balance_change_logs").
+		Select("id, for_team_id, created_at, SUM(change_amount) OVER (PARTITION BY for_team_id ORDER BY created_at, id) AS balance").
+		Where("team_id = ? AND balance_type = ? AND created_at <= ?", debtorTeamID, btPayable, asOf).
+		Where("for_team_id IN ?", creditorTeamIDs)
+	settledAt := db.
+		Table("(?) r", running).
+		Select("DISTINCT ON (for_team_id) for_team_id, id, created_at, balance").
+		Where("balance >= 0").
+		Order("for_team_id, created_at DESC, id DESC")
+
+	var starts []struct {
+		ForTeamID uint64
+		Balance   float64
+	}
+	if err := db.Table("(?) s", settledAt).Select("for_team_id, balance").Scan(&starts).Error; err != nil {
+		return nil, err
+	}
+	credit := map[uint64]float64{}
+	for _, s := range starts {
+		credit[s.ForTeamID] = s.Balance
+	}
+
+	var legs []struct {
+		ForTeamID    uint64
+		ChangeAmount float64
+		CreatedAt    time.Time
+	}
+	err := db.
+		Table("balance_change_logs l").
+		Joins("LEFT JOIN (?) s ON s.for_team_id = l.for_team_id", settledAt).
+		Select("l.for_team_id, l.change_amount, l.created_at").
+		Where("l.team_id = ? AND l.balance_type = ? AND l.created_at <= ?", debtorTeamID, btPayable, asOf).
+		Where("l.for_team_id IN ?", creditorTeamIDs).
+		Where("s.id IS NULL OR (l.created_at, l.id) > (s.created_at, s.id)").
+		Order("l.for_team_id, l.created_at, l.id").
+		Scan(&legs).Error
+	if err != nil {
+		return nil, err
+	}
+
+	for i := 0; i < len(legs); {
+		forTeamID := legs[i].ForTeamID
+		var open []debit
+		c := credit[forTeamID]
+		for ; i < len(legs) && legs[i].ForTeamID == forTeamID; i++ {
+			// PAYABLE is stored negative: a debit grows the debt.
+			open, c = replayDebit(open, c, -legs[i].ChangeAmount, legs[i].CreatedAt)
+		}
+		if len(open) > 0 {
+			out[forTeamID] = open
+		}
+	}
+	return out, nil
+}
+
+// oweLimitValues is what a creditor configures per owe-limit rule: the hard threshold
+// (0 = unlimited), the soft threshold above which debtors are flagged WARN (0 =
+// none) and the max age of unsettled debt in days (0 = none).
+type oweLimitValues struct {
+	Threshold     float64
+	SoftThreshold float64
+	MaxAgeDays    int64
+}
+
+// validate checks v as given to a set RPC or an import row. A soft threshold must
+// not exceed a hard one.
+func (v oweLimitValues) validate() error {
+	switch {
+	case v.MaxAgeDays < 0:
+		return errors.New("max_age_days must not be negative")
+	case v.SoftThreshold < 0:
+		return errors.New("soft_threshold must not be negative")
+	case v.Threshold > 0 && v.SoftThreshold > v.Threshold:
+		return errors.New("soft_threshold must not exceed threshold")
+	}
+	return nil
+}
+
+// oweLimitValuesOf reads the values of configurations: the threshold from the row, the
+// soft threshold and max age from their side tables.
+func oweLimitValuesOf(db *gorm.DB, cfgs []db_models.OweLimitConfiguration) (map[uint64]oweLimitValues, error) {
+	ids := make([]uint64, len(cfgs))
+	for i := range cfgs {
+		ids[i] = cfgs[i].ID
+	}
+	ages, err := ageRulesOf(db, ids)
+	if err != nil {
+		return nil, err
+	}
+	softs, err := softThresholdsOf(db, ids)
+	if err != nil {
+		return nil, err
+	}
+	out := make(map[uint64]oweLimitValues, len(cfgs))
+	for _, cfg := range cfgs {
+		out[cfg.ID] = oweLimitValues{Threshold: cfg.Threshold, SoftThreshold: softs[cfg.ID], MaxAgeDays: ages[cfg.ID]}
+	}
+	return out, nil
+}
+
+// setOweLimitConfiguration writes a creditor's values to cfg (created when exists is
+// false) and records the change in the owe-limit history, with the values it
+// replaced. A call that changes nothing records nothing.
+func setOweLimitConfiguration(
+	tx *gorm.DB,
+	cfg *db_models.OweLimitConfiguration,
+	exists bool,
+	v oweLimitValues,
+	changedBy uint64,
+	now time.Time,
+) error {
+	if err := v.validate(); err != nil {
+		return connect.NewError(connect.CodeInvalidArgument, err)
+	}
+
+	h := newOweLimitChange(cfg, invoice_iface.OweLimitHistoryAction_OWE_LIMIT_HISTORY_ACTION_CREATE, changedBy, now)
+	if exists {
+		values, err := oweLimitValuesOf(tx, []db_models.OweLimitConfiguration{*cfg})
+		if err != nil {
+			return err
+		}
+		old := values[cfg.ID]
+		if old == v {
+			return nil
+		}
+		err = tx.
+			Model(&db_models.OweLimitConfiguration{}).
+			Where("id = ?", cfg.ID).
+			Update("threshold", v.Threshold).
+			Error
+		if err != nil {
+			return err
+		}
+		h.Action = invoice_iface.OweLimitHistoryAction_OWE_LIMIT_HISTORY_ACTION_UPDATE
+		h.OldThreshold = &old.Threshold
+		h.OldSoftThreshold = &old.SoftThreshold
+		h.OldMaxAgeDays = &old.MaxAgeDays
+	} else {
+		cfg.Threshold = v.Threshold
+		if err := tx.Create(cfg).Error; err != nil {
+			return err
+		}
+		h.ConfigurationID = cfg.ID
+	}
+
+	if v.MaxAgeDays > 0 {
+		err := tx.
+			Clauses(clause.OnConflict{
+				Columns:   []clause.Column{{Name: "configuration_id"}},
+				DoUpdates: clause.AssignmentColumns([]string{"max_age_days", "updated_at"}),
+			}).
+			Create(&invoice_models.OweLimitAgeRule{ConfigurationID: cfg.ID, MaxAgeDays: v.MaxAgeDays, UpdatedAt: now}).
+			Error
+		if err != nil {
+			return err
+		}
+	} else if exists {
+		if err := tx.Where("configuration_id = ?", cfg.ID).Delete(&invoice_models.OweLimitAgeRule{}).Error; err != nil {
+			return err
+		}
+	}
+	if err := setSoftThreshold(tx, cfg.ID, exists, v.SoftThreshold, now); err != nil {
+		return err
+	}
+
+	h.NewThreshold = &v.Threshold
+	h.NewSoftThreshold = &v.SoftThreshold
+	h.NewMaxAgeDays = &v.MaxAgeDays
+	return tx.Create(h).Error
+}
+
+// deleteOweLimitConfigurations hard-deletes cfgs with their soft thresholds and age
+// rules and records each removed rule's values in the owe-limit history.
+func deleteOweLimitConfigurations(
+	tx *gorm.DB,
+	cfgs []db_models.OweLimitConfiguration,
+	changedBy uint64,
+	now time.Time,
+) error {
+	if len(cfgs) == 0 {
+		return nil
+	}
+	values, err := oweLimitValuesOf(tx, cfgs)
+	if err != nil {
+		return err
+	}
+
+	ids := make([]uint64, len(cfgs))
+	for i := range cfgs {
+		cfg := &cfgs[i]
+		ids[i] = cfg.ID
+		if err := tx.Where("id = ?", cfg.ID).Delete(&db_models.OweLimitConfiguration{}).Error; err != nil {
+			return err
+		}
+		h := newOweLimitChange(cfg, invoice_iface.OweLimitHistoryAction_OWE_LIMIT_HISTORY_ACTION_DELETE, changedBy, now)
+		old := values[cfg.ID]
+		h.OldThreshold = &old.Threshold
+		h.OldSoftThreshold = &old.SoftThreshold
+		h.OldMaxAgeDays = &old.MaxAgeDays
+		if err := tx.Create(h).Error; err != nil {
+			return err
+		}
+	}
+	if err := tx.Where("configuration_id IN ?", ids).Delete(&invoice_models.OweLimitSoftThreshold{}).Error; err != nil {
+		return err
+	}
+	return tx.Where("configuration_id IN ?", ids).Delete(&invoice_models.OweLimitAgeRule{}).Error
+}
@@ -0,0 +1,196 @@
+package invoice_v2
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/pdcgo/invoice_service/invoice_models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// maxOweLimitAlertAttempts is how often DispatchOweLimitAlerts offers an alert to the
+// notifier before leaving it undelivered for good.
+const maxOweLimitAlertAttempts = 10
+
+// OweLimitNotifier delivers an owe-limit alert, e.g. to the creditor's and debtor's
+// members.
+type OweLimitNotifier interface {
+	NotifyOweLimit(ctx context.Context, alert *invoice_models.OweLimitAlert) error
+}
+
+// OweLimitAlertResult reports what a dispatch did. Failed alerts are retried by the
+// next dispatch.
+type OweLimitAlertResult struct {
+	Notified int
+	Failed   int
+}
+
+// checkOweLimitAlert re-evaluates the debtor's limit at the creditor after its debt
+// moved and records an OweLimitAlert when the projected debt crossed an alert level
+// (OweLimitAlertLevel, in percent of the threshold) above the one last alerted. The
+// level drops back silently when the debt falls, so each crossing is alerted once
+// however many orders follow. A creditor without levels costs a single query.
+func checkOweLimitAlert(tx *gorm.DB, debtorTeamID, creditorTeamID uint64, now time.Time) error {
+	var levels []uint32
+	err := tx.
+		Model(&invoice_models.OweLimitAlertLevel{}).
+		Where("team_id = ?", creditorTeamID).
+		Order("percent").
+		Pluck("percent", &levels).
+		Error
+	if err != nil || len(levels) == 0 {
+		return err
+	}
+
+	// Levels are a percent of the threshold, so the age rules are not needed; skipping
+	// them keeps the ledger replay out of every posting.
+	res, err := EvaluateOweLimitsQuery(tx, OweLimitQuery{
+		DebtorTeamID:    debtorTeamID,
+		CreditorTeamIDs: []uint64{creditorTeamID},
+		At:              now,
+		SkipAge:         true,
+	})
+	if err != nil {
+		return err
+	}
+	allow := res[creditorTeamID]
+	var crossed uint32
+	if allow.Threshold > 0 {
+		for _, level := range levels {
+			if allow.ProjectedDebt*100 >= float64(level)*allow.Threshold {
+				crossed = level
+			}
+		}
+	}
+
+	// The debtor's PAYABLE row is already locked by the posting, so concurrent
+	// postings for the pair are serialized before they get here.
+	err = tx.
+		Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&invoice_models.OweLimitAlertState{TeamID: creditorTeamID, ForTeamID: debtorTeamID, UpdatedAt: now}).
+		Error
+	if err != nil {
+		return err
+	}
+	var state invoice_models.OweLimitAlertState
+	err = lockForUpdate(tx).
+		Where("team_id = ? AND for_team_id = ?", creditorTeamID, debtorTeamID).
+		First(&state).
+		Error
+	if err != nil || state.Level == crossed {
+		return err
+	}
+
+	if crossed > state.Level {
+		err = tx.Create(&invoice_models.OweLimitAlert{
+			TeamID:        creditorTeamID,
+			ForTeamID:     debtorTeamID,
+			Level:         crossed,
+			Threshold:     allow.Threshold,
+			ProjectedDebt: allow.ProjectedDebt,
+			Rule:          allow.Rule,
+			CreatedAt:     now,
+		}).Error
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Model(&invoice_models.OweLimitAlertState{}).
+		Where("team_id = ? AND for_team_id = ?", creditorTeamID, debtorTeamID).
+		Updates(map[string]interface{}{
+			"level":      crossed,
+			"updated_at": now,
+		}).Error
+}
+
+// DispatchOweLimitAlerts hands every undelivered owe-limit alert to notifier, oldest
+// first, and marks the delivered ones. An alert the notifier fails is retried by the
+// next dispatch, up to maxOweLimitAlertAttempts. Meant to run on a short schedule.
+//
+// Each alert is claimed with FOR UPDATE SKIP LOCKED in its own transaction and held
+// until it is marked, so overlapping dispatches (a slow run, or several replicas) never
+// send the same alert twice.
+func DispatchOweLimitAlerts(
+	ctx context.Context,
+	db *gorm.DB,
+	notifier OweLimitNotifier,
+	now time.Time,
+) (*OweLimitAlertResult, error) {
+	result := &OweLimitAlertResult{}
+	db = db.WithContext(ctx)
+
+	var firstErr error
+	lastID := uint64(0) // alerts are taken in id order, each once per dispatch
+	for {
+		var a invoice_models.OweLimitAlert
+		var notifyErr error
+		claimed := false
+		err := db.Transaction(func(tx *gorm.DB) error {
+			res := claimForUpdate(tx).
+				Where("notified_at IS NULL AND attempts < ? AND id > ?", maxOweLimitAlertAttempts, lastID).
+				Order("id").
+				Limit(1).
+				Find(&a)
+			if res.Error != nil || res.RowsAffected == 0 {
+				return res.Error
+			}
+			claimed = true
+
+			update := map[string]interface{}{"attempts": gorm.Expr("attempts + 1")}
+			notifyErr = notifier.NotifyOweLimit(ctx, &a)
+			if notifyErr != nil {
+				update["last_error"] = notifyErr.Error()
+			} else {
+				update["notified_at"] = now
+			}
+			return tx.Model(&invoice_models.OweLimitAlert{}).Where("id = ?", a.ID).Updates(update).Error
+		})
+		if err != nil {
+			return result, err
+		}
+		if !claimed {
+			break
+		}
+		lastID = a.ID
+
+		if notifyErr != nil {
+			result.Failed++
+			if firstErr == nil {
+				firstErr = notifyErr
+			}
+			continue
+		}
+		result.Notified++
+	}
+
+	if firstErr != nil {
+		return result, fmt.Errorf("%d alert(s) failed: %w", result.Failed, firstErr)
+	}
+	return result, nil
+}
+
+// validateAlertLevels checks the alert levels of an OweLimitPolicySet: each a percent
+// of the threshold, at most 1000, without duplicates.
+func validateAlertLevels(levels []uint32) error {
+	seen := map[uint32]bool{}
+	for _, l := range levels {
+		if l == 0 || l > 1000 {
+			return fmt.Errorf("alert level %d must be between 1 and 1000 percent", l)
+		}
+		if seen[l] {
+			return fmt.Errorf("alert level %d given twice", l)
+		}
+		seen[l] = true
+	}
+	return nil
+}
+
+// sortedAlertLevels is levels in ascending order, as OweLimitPolicyGet returns them.
+func sortedAlertLevels(levels []uint32) []uint32 {
+	out := slices.Clone(levels)
+	slices.Sort(out)
+	return out
+}
@@ -0,0 +1,159 @@
+package invoice_v2_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"connectrpc.com/connect"
+	"github.com/pdcgo/invoice_service/invoice_models"
+	"github.com/pdcgo/invoice_service/invoice_v2"
+	invoice_iface "github.com/pdcgo/schema/services/invoice_iface/v2"
+	role_base "github.com/pdcgo/schema/services/role_base/v1"
+	"github.com/pdcgo/shared/db_models"
+	"github.com/pdcgo/shared/pkg/moretest"
+	"github.com/pdcgo/shared/pkg/moretest/moretest_mock"
+	"github.com/pdcgo/user_service/access_interceptors"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+type recordingNotifier struct {
+	failFirst bool
+	got       []uint32
+}
+
+func (n *recordingNotifier) NotifyOweLimit(ctx context.Context, a *invoice_models.OweLimitAlert) error {
+	if n.failFirst {
+		n.failFirst = false
+		return errors.New("webhook down")
+	}
+	n.got = append(n.got, a.Level)
+	return nil
+}
+
+func TestOweLimitAlerts(t *testing.T) {
+	var scenario moretest_mock.DbScenario
+
+	moretest.Suite(t, "owe limit alerts",
+		moretest.SetupListFunc{
+			moretest_mock.MockPostgresDatabase(&scenario),
+		},
+		func(t *testing.T) {
+			scenario(t, func(tx *gorm.DB) {
+				assert.NoError(t, tx.AutoMigrate(
+					&invoice_models.InvoicePayment{},
+					&invoice_models.InvoicePaymentSelection{},
+					&invoice_models.InvoiceApprovalPolicy{},
+					&invoice_models.InvoiceApproval{},
+					&invoice_models.BalanceChangePaymentSource{},
+					&invoice_models.BalanceChangeLog{},
+					&invoice_models.BalanceOpenItem{},
+					&invoice_models.BalanceOpenItemAllocation{},
+					&invoice_models.TeamBalance{},
+					&invoice_models.TeamBalanceDailyLog{},
+					&db_models.OweLimitConfiguration{},
+					&invoice_models.OweLimitPolicy{},
+					&invoice_models.OweLimitOverride{},
+					&invoice_models.OweLimitAgeRule{},
+					&invoice_models.OweLimitSoftThreshold{},
+					&invoice_models.OweLimitTeamTypeRule{},
+					&invoice_models.OweLimitAlertLevel{},
+					&invoice_models.OweLimitAlertState{},
+					&invoice_models.OweLimitAlert{},
+				))
+
+				// creditor 1 lets everyone owe it 100 and wants to hear at 80% and 100%.
+				assert.NoError(t, tx.Create(&db_models.OweLimitConfiguration{TeamID: 1, IsDefault: true, Threshold: 100}).Error)
+				assert.NoError(t, tx.Create(&[]invoice_models.OweLimitAlertLevel{
+					{TeamID: 1, Percent: 80},
+					{TeamID: 1, Percent: 100},
+				}).Error)
+
+				now := time.Date(2025, 3, 3, 10, 0, 0, 0, time.UTC)
+				adjustment := invoice_iface.BalanceChangeType_BALANCE_CHANGE_TYPE_ADJUSTMENT
+				// debt raises team 2's debt to creditor 1; repay lowers it.
+				debt := func(amount float64) {
+					assert.NoError(t, invoice_v2.PostBalanceLog(tx, 1, 2, adjustment, amount, receivable, "order", callerID, now))
+				}
+				repay := func(amount float64) {
+					assert.NoError(t, invoice_v2.PostBalanceLog(tx, 2, 1, adjustment, amount, payable, "repay", callerID, now))
+				}
+				levels := func() []uint32 {
+					var out []uint32
+					assert.NoError(t, tx.Model(&invoice_models.OweLimitAlert{}).Order("id").Pluck("level", &out).Error)
+					return out
+				}
+
+				t.Run("each crossing is alerted once", func(t *testing.T) {
+					debt(50)
+					assert.Empty(t, levels())
+
+					debt(40) // 90
+					debt(5)  // 95, still past 80 only
+					assert.Equal(t, []uint32{80}, levels())
+
+					debt(10) // 105
+					debt(10) // 115
+					assert.Equal(t, []uint32{80, 100}, levels())
+
+					var alert invoice_models.OweLimitAlert
+					assert.NoError(t, tx.Order("id DESC").First(&alert).Error)
+					assert.Equal(t, uint64(1), alert.TeamID)
+					assert.Equal(t, uint64(2), alert.ForTeamID)
+					assert.Equal(t, float64(105), alert.ProjectedDebt)
+					assert.Equal(t, invoice_iface.OweLimitRule_OWE_LIMIT_RULE_DEFAULT, alert.Rule)
+				})
+
+				t.Run("falling below a level re-arms it", func(t *testing.T) {
+					repay(60) // 55
+					assert.Len(t, levels(), 2)
+
+					debt(30) // 85
+					assert.Equal(t, []uint32{80, 100, 80}, levels())
+				})
+
+				t.Run("dispatch retries failed alerts", func(t *testing.T) {
+					n := &recordingNotifier{failFirst: true}
+					res, err := invoice_v2.DispatchOweLimitAlerts(context.Background(), tx, n, now)
+					assert.Error(t, err)
+					assert.Equal(t, 2, res.Notified)
+					assert.Equal(t, 1, res.Failed)
+
+					res, err = invoice_v2.DispatchOweLimitAlerts(context.Background(), tx, n, now)
+					assert.NoError(t, err)
+					assert.Equal(t, 1, res.Notified)
+					assert.Equal(t, []uint32{100, 80, 80}, n.got)
+
+					var pending int64
+					assert.NoError(t, tx.Model(&invoice_models.OweLimitAlert{}).Where("notified_at IS NULL").Count(&pending).Error)
+					assert.Zero(t, pending)
+				})
+
+				t.Run("a reversed payment alerts like new debt", func(t *testing.T) {
+					svc := invoice_v2.NewInvoiceService(tx)
+					ctx := access_interceptors.SetIdentityToCtx(
+						context.Background(),
+						&role_base.Identity{IdentityId: uint32(callerID)},
+					)
+					res, err := svc.CreatePayment(ctx, connect.NewRequest(&invoice_iface.CreatePaymentRequest{
+						TeamId: 2, ForTeamId: 1, Amount: 30,
+					}))
+					assert.NoError(t, err)
+					_, err = svc.AcceptPayment(ctx, connect.NewRequest(&invoice_iface.AcceptPaymentRequest{
+						TeamId: 2, ForTeamId: 1, PaymentId: res.Msg.Id,
+					}))
+					assert.NoError(t, err) // 55, re-arms 80
+					assert.Len(t, levels(), 3)
+
+					_, err = svc.ReversePayment(ctx, connect.NewRequest(&invoice_iface.ReversePaymentRequest{
+						TeamId: 2, ForTeamId: 1, PaymentId: res.Msg.Id, Reason: "bounced",
+					}))
+					assert.NoError(t, err) // 85 again
+					assert.Equal(t, []uint32{80, 100, 80, 80}, levels())
+				})
+			})
+		},
+	)
+}
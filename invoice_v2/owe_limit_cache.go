@@ -0,0 +1,283 @@
+package invoice_v2
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"connectrpc.com/connect"
+	"github.com/pdcgo/san_collection/san_caches"
+	invoice_iface "github.com/pdcgo/schema/services/invoice_iface/v2"
+	"gorm.io/gorm"
+)
+
+// oweLimitCacheTTL bounds how long cached owe-limit inputs live even without an
+// invalidation, like the legacy GetLimitInvoice cache.
+const oweLimitCacheTTL = time.Minute
+
+// oweLimitGenerationTTL keeps a creditor's generation well past any load that read it.
+const oweLimitGenerationTTL = time.Hour
+
+// OweLimitCache caches the owe-limit inputs of each (debtor, creditor) pair for the
+// order hot path. Entries are dropped precisely: every write that touches a pair —
+// postEntry, adjustPending, the owe-limit set/delete RPCs — records it on the context
+// of its transaction, and the scope opened with Track drops those entries once the
+// write is done. Only the database-derived inputs are cached; the prospective amount,
+// pending policy and debt ages are applied per call, and an entry never outlives the
+// start or end of an override. A load that races a write is not left behind: each
+// creditor has a generation that a drop replaces before deleting entries, and an
+// entry whose creditor's generation moved while it was loaded is deleted again right
+// after it is set. A nil *OweLimitCache caches nothing.
+type OweLimitCache struct {
+	cache san_caches.CacheManager
+}
+
+func NewOweLimitCache(cache san_caches.CacheManager) *OweLimitCache {
+	return &OweLimitCache{cache: cache}
+}
+
+// oweLimitCacheKey is one pair's entry. Keys are laid out creditor first, so a change
+// to a creditor's default or policy drops all its debtors by namespace.
+type oweLimitCacheKey struct {
+	creditorTeamID uint64
+	debtorTeamID   uint64
+}
+
+func (k oweLimitCacheKey) GetKey() (string, error) {
+	return fmt.Sprintf("%s%d", oweLimitCreditorNamespace(k.creditorTeamID), k.debtorTeamID), nil
+}
+
+func oweLimitCreditorNamespace(creditorTeamID uint64) string {
+	return fmt.Sprintf("invoice_v2:owe_limit:%d:", creditorTeamID)
+}
+
+// oweLimitGenerationKey is a creditor's generation. It lives outside the creditor's
+// namespace so dropping the namespace leaves it alone.
+type oweLimitGenerationKey struct {
+	creditorTeamID uint64
+}
+
+func (k oweLimitGenerationKey) GetKey() (string, error) {
+	return fmt.Sprintf("invoice_v2:owe_limit_generation:%d", k.creditorTeamID), nil
+}
+
+// oweLimitGeneration is a random token; only whether it changed matters.
+type oweLimitGeneration string
+
+func (g *oweLimitGeneration) MarshalBinary() ([]byte, error) {
+	return []byte(*g), nil
+}
+
+func (g *oweLimitGeneration) UnmarshalBinary(data []byte) error {
+	*g = oweLimitGeneration(data)
+	return nil
+}
+
+// generation reads the creditor's generation; "" when it has none (or the read failed).
+func (c *OweLimitCache) generation(ctx context.Context, creditorTeamID uint64) oweLimitGeneration {
+	var g oweLimitGeneration
+	if err := c.cache.Get(ctx, oweLimitGenerationKey{creditorTeamID: creditorTeamID}, &g); err != nil {
+		return ""
+	}
+	return g
+}
+
+// bump replaces the creditor's generation.
+func (c *OweLimitCache) bump(ctx context.Context, creditorTeamID uint64) error {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return err
+	}
+	g := oweLimitGeneration(hex.EncodeToString(b[:]))
+	return c.cache.Set(ctx, oweLimitGenerationKey{creditorTeamID: creditorTeamID}, &g, oweLimitGenerationTTL)
+}
+
+func (in *oweLimitInputs) MarshalBinary() ([]byte, error) {
+	return json.Marshal(in)
+}
+
+func (in *oweLimitInputs) UnmarshalBinary(data []byte) error {
+	return json.Unmarshal(data, in)
+}
+
+// Evaluate is EvaluateOweLimitsQuery served from the cache where it can: pairs with
+// a cached entry are evaluated without touching the database, the rest are loaded
+// in one go and cached. A query for another time than now (q.At) bypasses the cache.
+func (c *OweLimitCache) Evaluate(
+	ctx context.Context,
+	db *gorm.DB,
+	q OweLimitQuery,
+) (map[uint64]*invoice_iface.OweLimitAllow, error) {
+	db = db.WithContext(ctx)
+	if c == nil || !q.At.IsZero() {
+		return EvaluateOweLimitsQuery(db, q)
+	}
+
+	now := time.Now()
+	inputs := make(map[uint64]*oweLimitInputs, len(q.CreditorTeamIDs))
+	var missing []uint64
+	for _, creditor := range q.CreditorTeamIDs {
+		var in oweLimitInputs
+		key := oweLimitCacheKey{creditorTeamID: creditor, debtorTeamID: q.DebtorTeamID}
+		if err := c.cache.Get(ctx, key, &in); err != nil {
+			missing = append(missing, creditor)
+			continue
+		}
+		inputs[creditor] = &in
+	}
+
+	if len(missing) > 0 {
+		gens := make(map[uint64]oweLimitGeneration, len(missing))
+		for _, creditor := range missing {
+			gens[creditor] = c.generation(ctx, creditor)
+		}
+		loaded, err := loadOweLimitInputs(db, q.DebtorTeamID, missing, now, true)
+		if err != nil {
+			return nil, err
+		}
+		for creditor, in := range loaded {
+			inputs[creditor] = in
+			ttl := oweLimitCacheTTL
+			if !in.ValidUntil.IsZero() {
+				ttl = min(ttl, in.ValidUntil.Sub(now))
+			}
+			if ttl <= 0 {
+				continue
+			}
+			key := oweLimitCacheKey{creditorTeamID: creditor, debtorTeamID: q.DebtorTeamID}
+			if err := c.cache.Set(ctx, key, in, ttl); err != nil {
+				slog.Warn("owe limit cache set failed", slog.String("err", err.Error()))
+				continue
+			}
+			// A write that committed during the load may have dropped the pair before
+			// the Set; its generation bump gives it away.
+			if c.generation(ctx, creditor) != gens[creditor] {
+				if err := c.cache.Del(ctx, key); err != nil {
+					slog.Error("owe limit cache invalidation failed",
+						slog.Uint64("creditor", creditor), slog.Uint64("debtor", q.DebtorTeamID), slog.String("err", err.Error()))
+				}
+			}
+		}
+	}
+
+	result := make(map[uint64]*invoice_iface.OweLimitAllow, len(q.CreditorTeamIDs))
+	for _, creditor := range q.CreditorTeamIDs {
+		result[creditor] = evaluateOweLimit(inputs[creditor], q, creditor, now)
+	}
+	return result, nil
+}
+
+// Track opens an invalidation scope: writes made through a transaction on the
+// returned context record the pairs they touch, and done drops their entries. Call
+// done after the transaction has committed (or failed; dropping is always safe).
+func (c *OweLimitCache) Track(ctx context.Context) (context.Context, func()) {
+	if c == nil {
+		return ctx, func() {}
+	}
+	touched := &oweLimitTouched{
+		pairs:     map[oweLimitCacheKey]bool{},
+		creditors: map[uint64]bool{},
+	}
+	return context.WithValue(ctx, oweLimitTouchedKey{}, touched), func() {
+		c.drop(context.WithoutCancel(ctx), touched)
+	}
+}
+
+// Interceptor opens a Track scope around every RPC, so the writes of any handler
+// that runs its transaction on the request context invalidate what they touched.
+func (c *OweLimitCache) Interceptor() connect.Interceptor {
+	return connect.UnaryInterceptorFunc(func(next connect.UnaryFunc) connect.UnaryFunc {
+		return func(ctx context.Context, req connect.AnyRequest) (connect.AnyResponse, error) {
+			ctx, done := c.Track(ctx)
+			defer done()
+			return next(ctx, req)
+		}
+	})
+}
+
+// drop bumps the generation of every creditor touched, then deletes the entries.
+func (c *OweLimitCache) drop(ctx context.Context, touched *oweLimitTouched) {
+	touched.mu.Lock()
+	defer touched.mu.Unlock()
+	bumped := map[uint64]bool{}
+	bump := func(creditor uint64) {
+		if bumped[creditor] {
+			return
+		}
+		bumped[creditor] = true
+		if err := c.bump(ctx, creditor); err != nil {
+			slog.Error("owe limit cache generation bump failed", slog.Uint64("creditor", creditor), slog.String("err", err.Error()))
+		}
+	}
+	for creditor := range touched.creditors {
+		bump(creditor)
+	}
+	for key := range touched.pairs {
+		bump(key.creditorTeamID)
+	}
+	for creditor := range touched.creditors {
+		if err := c.cache.DelNamespace(ctx, oweLimitCreditorNamespace(creditor)); err != nil {
+			slog.Error("owe limit cache invalidation failed", slog.Uint64("creditor", creditor), slog.String("err", err.Error()))
+		}
+	}
+	for key := range touched.pairs {
+		if touched.creditors[key.creditorTeamID] {
+			continue
+		}
+		if err := c.cache.Del(ctx, key); err != nil {
+			slog.Error("owe limit cache invalidation failed",
+				slog.Uint64("creditor", key.creditorTeamID), slog.Uint64("debtor", key.debtorTeamID), slog.String("err", err.Error()))
+		}
+	}
+}
+
+type oweLimitTouchedKey struct{}
+
+// oweLimitTouched collects the pairs, and whole creditors, a Track scope has to drop.
+type oweLimitTouched struct {
+	mu        sync.Mutex
+	pairs     map[oweLimitCacheKey]bool
+	creditors map[uint64]bool
+}
+
+func touchedFrom(tx *gorm.DB) *oweLimitTouched {
+	if tx.Statement == nil || tx.Statement.Context == nil {
+		return nil
+	}
+	touched, _ := tx.Statement.Context.Value(oweLimitTouchedKey{}).(*oweLimitTouched)
+	return touched
+}
+
+// touchOweLimit records that the account (teamID, forTeamID, bt) changed, which is
+// the debtor's PAYABLE side (or its RECEIVABLE mirror) of one pair.
+func touchOweLimit(tx *gorm.DB, teamID, forTeamID uint64, bt invoice_iface.BalanceType) {
+	debtor, creditor := teamID, forTeamID
+	if bt != invoice_iface.BalanceType_BALANCE_TYPE_PAYABLE {
+		debtor, creditor = forTeamID, teamID
+	}
+	touchOweLimitPair(tx, debtor, creditor)
+}
+
+// touchOweLimitPair records that the limit creditorTeamID applies to debtorTeamID
+// changed.
+func touchOweLimitPair(tx *gorm.DB, debtorTeamID, creditorTeamID uint64) {
+	if touched := touchedFrom(tx); touched != nil {
+		touched.mu.Lock()
+		touched.pairs[oweLimitCacheKey{creditorTeamID: creditorTeamID, debtorTeamID: debtorTeamID}] = true
+		touched.mu.Unlock()
+	}
+}
+
+// touchOweLimitCreditor records that every limit of creditorTeamID changed.
+func touchOweLimitCreditor(tx *gorm.DB, creditorTeamID uint64) {
+	if touched := touchedFrom(tx); touched != nil {
+		touched.mu.Lock()
+		touched.creditors[creditorTeamID] = true
+		touched.mu.Unlock()
+	}
+}
@@ -0,0 +1,236 @@
+package invoice_v2_test
+
+import (
+	"context"
+	"encoding"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"connectrpc.com/connect"
+	"github.com/pdcgo/invoice_service/invoice_models"
+	"github.com/pdcgo/invoice_service/invoice_v2"
+	"github.com/pdcgo/san_collection/san_caches"
+	invoice_iface "github.com/pdcgo/schema/services/invoice_iface/v2"
+	role_base "github.com/pdcgo/schema/services/role_base/v1"
+	"github.com/pdcgo/shared/db_models"
+	"github.com/pdcgo/shared/pkg/moretest"
+	"github.com/pdcgo/shared/pkg/moretest/moretest_mock"
+	"github.com/pdcgo/user_service/access_interceptors"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+// memoryCache is an in-process san_caches.CacheManager; ttl is ignored. beforeSet,
+// when set, runs once ahead of the next Set of a key it matches.
+type memoryCache struct {
+	mu        sync.Mutex
+	data      map[string][]byte
+	beforeSet func(key string) bool
+}
+
+func (m *memoryCache) Set(ctx context.Context, key san_caches.CacheKey, value any, ttl time.Duration) error {
+	k, err := key.GetKey()
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	hook := m.beforeSet
+	m.mu.Unlock()
+	if hook != nil && hook(k) {
+		m.mu.Lock()
+		m.beforeSet = nil
+		m.mu.Unlock()
+	}
+	raw, err := value.(encoding.BinaryMarshaler).MarshalBinary()
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.data[k] = raw
+	return nil
+}
+
+func (m *memoryCache) Get(ctx context.Context, key san_caches.CacheKey, value any) error {
+	k, err := key.GetKey()
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	raw, ok := m.data[k]
+	m.mu.Unlock()
+	if !ok {
+		return errors.New("cache miss")
+	}
+	return value.(encoding.BinaryUnmarshaler).UnmarshalBinary(raw)
+}
+
+func (m *memoryCache) Del(ctx context.Context, key san_caches.CacheKey) error {
+	k, err := key.GetKey()
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.data, k)
+	return nil
+}
+
+func (m *memoryCache) DelNamespace(ctx context.Context, namespace string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for k := range m.data {
+		if strings.HasPrefix(k, namespace) {
+			delete(m.data, k)
+		}
+	}
+	return nil
+}
+
+// entries counts the cached owe-limit entries, leaving out creditor generations.
+func (m *memoryCache) entries() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	n := 0
+	for k := range m.data {
+		if strings.HasPrefix(k, "invoice_v2:owe_limit:") {
+			n++
+		}
+	}
+	return n
+}
+
+func (m *memoryCache) has(key string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, ok := m.data[key]
+	return ok
+}
+
+func TestOweLimitCache(t *testing.T) {
+	var scenario moretest_mock.DbScenario
+
+	moretest.Suite(t, "owe limit cache",
+		moretest.SetupListFunc{
+			moretest_mock.MockPostgresDatabase(&scenario),
+		},
+		func(t *testing.T) {
+			scenario(t, func(tx *gorm.DB) {
+				assert.NoError(t, tx.AutoMigrate(
+					&invoice_models.BalanceChangeLog{},
+					&invoice_models.BalanceOpenItem{},
+					&invoice_models.BalanceOpenItemAllocation{},
+					&invoice_models.TeamBalance{},
+					&invoice_models.TeamBalanceDailyLog{},
+					&db_models.OweLimitConfiguration{},
+					&invoice_models.OweLimitPolicy{},
+					&invoice_models.OweLimitOverride{},
+					&invoice_models.OweLimitAgeRule{},
+					&invoice_models.OweLimitSoftThreshold{},
+					&invoice_models.OweLimitTeamTypeRule{},
+					&invoice_models.OweLimitAlertLevel{},
+					&invoice_models.OweLimitConfigurationHistory{},
+				))
+				assert.NoError(t, tx.Create(&db_models.OweLimitConfiguration{TeamID: 1, IsDefault: true, Threshold: 100}).Error)
+
+				mem := &memoryCache{data: map[string][]byte{}}
+				cache := invoice_v2.NewOweLimitCache(mem)
+				now := time.Now()
+				adjustment := invoice_iface.BalanceChangeType_BALANCE_CHANGE_TYPE_ADJUSTMENT
+				// debt raises the debtor's debt to creditor 1 on ctx's transaction.
+				debt := func(ctx context.Context, debtor uint64, amount float64) {
+					assert.NoError(t, invoice_v2.PostBalanceLog(tx.WithContext(ctx), 1, debtor, adjustment, amount, receivable, "order", callerID, now))
+				}
+				active := func(debtor uint64) float64 {
+					res, err := cache.Evaluate(context.Background(), tx, invoice_v2.OweLimitQuery{
+						DebtorTeamID:    debtor,
+						CreditorTeamIDs: []uint64{1},
+					})
+					assert.NoError(t, err)
+					return res[1].ActiveAmount
+				}
+
+				t.Run("evaluations are cached per pair", func(t *testing.T) {
+					assert.Equal(t, float64(0), active(2))
+					assert.Equal(t, float64(0), active(3))
+					assert.Equal(t, 2, mem.entries())
+
+					// a write outside a Track scope leaves the entry alone.
+					debt(context.Background(), 2, 30)
+					assert.Equal(t, float64(0), active(2))
+				})
+
+				t.Run("a tracked posting drops only its pair", func(t *testing.T) {
+					ctx, done := cache.Track(context.Background())
+					debt(ctx, 2, 10)
+					assert.Equal(t, 2, mem.entries())
+					done()
+
+					assert.Equal(t, 1, mem.entries())
+					assert.Equal(t, float64(40), active(2))
+				})
+
+				t.Run("a creditor-wide change drops all its debtors", func(t *testing.T) {
+					assert.Equal(t, float64(40), active(2))
+					assert.Equal(t, 2, mem.entries())
+
+					svc := invoice_v2.NewInvoiceService(tx, invoice_v2.WithOweLimitCache(cache))
+					ctx, done := cache.Track(access_interceptors.SetIdentityToCtx(
+						context.Background(),
+						&role_base.Identity{IdentityId: uint32(callerID)},
+					))
+					_, err := svc.OweLimitDefaultSet(ctx, connect.NewRequest(&invoice_iface.OweLimitDefaultSetRequest{
+						TeamId:    1,
+						Threshold: 200,
+					}))
+					assert.NoError(t, err)
+					done()
+					assert.Zero(t, mem.entries())
+
+					res, err := svc.CheckOweLimit(context.Background(), connect.NewRequest(&invoice_iface.CheckOweLimitRequest{
+						TeamId:     2,
+						CfgTeamIds: []uint64{1},
+					}))
+					assert.NoError(t, err)
+					assert.Equal(t, float64(200), res.Msg.CanOwe[1].Threshold)
+					assert.Equal(t, 1, mem.entries())
+				})
+
+				t.Run("a write between the load and the set leaves no stale entry", func(t *testing.T) {
+					mem.mu.Lock()
+					mem.beforeSet = func(key string) bool {
+						if key != "invoice_v2:owe_limit:1:5" {
+							return false
+						}
+						// the load has already read no debt; the write commits and drops now.
+						ctx, done := cache.Track(context.Background())
+						debt(ctx, 5, 25)
+						done()
+						return true
+					}
+					mem.mu.Unlock()
+
+					assert.Equal(t, float64(0), active(5))
+					assert.False(t, mem.has("invoice_v2:owe_limit:1:5"))
+					assert.Equal(t, float64(25), active(5))
+					assert.True(t, mem.has("invoice_v2:owe_limit:1:5"))
+				})
+
+				t.Run("a query for another time bypasses the cache", func(t *testing.T) {
+					before := mem.entries()
+					res, err := cache.Evaluate(context.Background(), tx, invoice_v2.OweLimitQuery{
+						DebtorTeamID:    4,
+						CreditorTeamIDs: []uint64{1},
+						At:              now,
+					})
+					assert.NoError(t, err)
+					assert.True(t, res[1].Allow)
+					assert.Equal(t, before, mem.entries())
+				})
+			})
+		},
+	)
+}
@@ -7,11 +7,13 @@ import (
 	"connectrpc.com/connect"
 	"github.com/pdcgo/schema/services/common/v1"
 	invoice_iface "github.com/pdcgo/schema/services/invoice_iface/v2"
+	role_base "github.com/pdcgo/schema/services/role_base/v1"
 	"github.com/pdcgo/invoice_service/invoice_models"
 	"github.com/pdcgo/invoice_service/invoice_v2"
 	"github.com/pdcgo/shared/db_models"
 	"github.com/pdcgo/shared/pkg/moretest"
 	"github.com/pdcgo/shared/pkg/moretest/moretest_mock"
+	"github.com/pdcgo/user_service/access_interceptors"
 	"github.com/stretchr/testify/assert"
 	"gorm.io/gorm"
 )
@@ -27,11 +29,20 @@ func TestOweLimitConfigCRUD(t *testing.T) {
 			scenario(t, func(tx *gorm.DB) {
 				assert.NoError(t, tx.AutoMigrate(
 					&db_models.OweLimitConfiguration{},
+					&invoice_models.OweLimitPolicy{},
+					&invoice_models.OweLimitOverride{},
+					&invoice_models.OweLimitAgeRule{},
+					&invoice_models.OweLimitSoftThreshold{},
+					&invoice_models.OweLimitTeamTypeRule{},
+					&invoice_models.OweLimitConfigurationHistory{},
 					&invoice_models.TeamBalance{},
 				))
 
 				svc := invoice_v2.NewInvoiceService(tx)
-				ctx := context.Background()
+				ctx := access_interceptors.SetIdentityToCtx(
+					context.Background(),
+					&role_base.Identity{IdentityId: uint32(callerID)},
+				)
 
 				const creditor = uint64(8) // the limit owner
 				const debtor = uint64(1)
@@ -129,6 +140,38 @@ func TestOweLimitConfigCRUD(t *testing.T) {
 					assert.Equal(t, float64(250), res[creditor].GetThreshold())
 				})
 
+				t.Run("history records every change with the caller", func(t *testing.T) {
+					res, err := svc.OweLimitHistory(ctx, connect.NewRequest(&invoice_iface.OweLimitHistoryRequest{
+						TeamId: creditor,
+						Page:   &common.PageFilter{Page: 1, Limit: 20},
+					}))
+					assert.NoError(t, err)
+					entries := res.Msg.GetEntries()
+					// newest first: custom delete, custom update, custom create, default
+					// update, default create.
+					assert.Len(t, entries, 5)
+					for _, e := range entries {
+						assert.Equal(t, callerID, e.ChangedById)
+					}
+					assert.Equal(t, invoice_iface.OweLimitHistoryAction_OWE_LIMIT_HISTORY_ACTION_DELETE, entries[0].Action)
+					assert.Equal(t, float64(45), *entries[0].OldThreshold)
+					assert.Nil(t, entries[0].NewThreshold)
+					assert.Equal(t, invoice_iface.OweLimitHistoryAction_OWE_LIMIT_HISTORY_ACTION_UPDATE, entries[1].Action)
+					assert.Equal(t, float64(30), *entries[1].OldThreshold)
+					assert.Equal(t, float64(45), *entries[1].NewThreshold)
+					assert.True(t, entries[3].IsDefault)
+					assert.Equal(t, float64(100), *entries[3].OldThreshold)
+					assert.Nil(t, entries[4].OldThreshold)
+
+					res, err = svc.OweLimitHistory(ctx, connect.NewRequest(&invoice_iface.OweLimitHistoryRequest{
+						TeamId:    creditor,
+						ForTeamId: debtor,
+						Page:      &common.PageFilter{Page: 1, Limit: 20},
+					}))
+					assert.NoError(t, err)
+					assert.Len(t, res.Msg.GetEntries(), 3)
+				})
+
 				t.Run("custom for self is rejected", func(t *testing.T) {
 					_, err := svc.OweLimitCustomSet(ctx, connect.NewRequest(&invoice_iface.OweLimitCustomSetRequest{
 						TeamId: creditor, ForTeamId: creditor, Threshold: 10,
@@ -0,0 +1,511 @@
+package invoice_v2
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"connectrpc.com/connect"
+	invoice_iface "github.com/pdcgo/schema/services/invoice_iface/v2"
+	"github.com/pdcgo/shared/db_models"
+	"gorm.io/gorm"
+)
+
+// oweLimitCSVHeader is the header ExportOweLimits writes. ImportOweLimits finds its
+// columns by name (case-insensitive) and needs threshold plus for_team_id or
+// team_name; soft_threshold and max_age_days are optional.
+var oweLimitCSVHeader = []string{"for_team_id", "team_name", "threshold", "soft_threshold", "max_age_days"}
+
+// ExportOweLimits writes the creditor's custom owe limits to w as CSV, one debtor per
+// row ordered by for_team_id, in the layout ImportOweLimits reads back. The
+// creditor's default rule is not part of the file. It returns the number of rows.
+func ExportOweLimits(db *gorm.DB, creditorTeamID uint64, w io.Writer) (int, error) {
+	var rows []struct {
+		db_models.OweLimitConfiguration
+		TeamName string
+	}
+	err := db.
+		Table("owe_limit_configurations c").
+		Select("c.*, COALESCE(t.name, '') AS team_name").
+		Joins("LEFT JOIN teams t ON t.id = c.for_team_id").
+		Where("c.team_id = ? AND c.is_default IS NOT TRUE AND c.for_team_id IS NOT NULL", creditorTeamID).
+		Order("c.for_team_id").
+		Scan(&rows).Error
+	if err != nil {
+		return 0, err
+	}
+	cfgs := make([]db_models.OweLimitConfiguration, len(rows))
+	for i := range rows {
+		cfgs[i] = rows[i].OweLimitConfiguration
+	}
+	values, err := oweLimitValuesOf(db, cfgs)
+	if err != nil {
+		return 0, err
+	}
+
+	cw := csv.NewWriter(w)
+	if err := cw.Write(oweLimitCSVHeader); err != nil {
+		return 0, err
+	}
+	for _, r := range rows {
+		v := values[r.ID]
+		err := cw.Write([]string{
+			strconv.FormatUint(*r.ForTeamID, 10),
+			r.TeamName,
+			strconv.FormatFloat(v.Threshold, 'f', -1, 64),
+			strconv.FormatFloat(v.SoftThreshold, 'f', -1, 64),
+			strconv.FormatInt(v.MaxAgeDays, 10),
+		})
+		if err != nil {
+			return 0, err
+		}
+	}
+	cw.Flush()
+	return len(rows), cw.Error()
+}
+
+// OweLimitImportInput is one CSV of custom owe limits to import for a creditor.
+type OweLimitImportInput struct {
+	TeamID  uint64
+	Content []byte
+	// DeleteMissing deletes the creditor's custom limits for debtors absent from the
+	// file, making the file the complete set.
+	DeleteMissing bool
+	// DryRun only plans the import.
+	DryRun bool
+}
+
+// OweLimitImportChange is what an import does to one debtor's custom limit. Line is
+// the CSV line, 0 for deletes of debtors absent from the file.
+type OweLimitImportChange struct {
+	Line             int
+	ForTeamID        uint64
+	TeamName         string
+	Action           invoice_iface.OweLimitImportAction
+	OldThreshold     float64
+	NewThreshold     float64
+	OldSoftThreshold float64
+	NewSoftThreshold float64
+	OldMaxAgeDays    int64
+	NewMaxAgeDays    int64
+
+	cfg *db_models.OweLimitConfiguration
+}
+
+// OweLimitImportError is a CSV row that cannot be imported.
+type OweLimitImportError struct {
+	Line    int
+	Message string
+}
+
+// OweLimitImportResult is the plan of an import and whether it was applied.
+type OweLimitImportResult struct {
+	Changes []OweLimitImportChange
+	Errors  []OweLimitImportError
+	Applied bool
+}
+
+// ImportOweLimits plans the creditor's custom owe limits from a CSV (see
+// oweLimitCSVHeader) against the current ones and, unless in.DryRun or a row failed
+// validation, applies the plan on tx. Rows name the debtor by for_team_id or by
+// team_name (unique, not deleted); both given must agree. A debtor may appear once.
+// Applying writes the same history as OweLimitCustomSet / OweLimitCustomDelete,
+// deleting before creating so the uniq_owe_limit_custom index holds throughout.
+// Rows that change nothing record nothing. Call it inside a transaction: the
+// creditor's custom rows stay locked from planning to applying.
+func ImportOweLimits(
+	tx *gorm.DB,
+	in OweLimitImportInput,
+	changedBy uint64,
+	now time.Time,
+) (*OweLimitImportResult, error) {
+	if in.TeamID == 0 {
+		return nil, connect.NewError(connect.CodeInvalidArgument, errors.New("team_id is required"))
+	}
+	if len(in.Content) == 0 {
+		return nil, connect.NewError(connect.CodeInvalidArgument, errors.New("content is required"))
+	}
+	rows, rowErrs, err := parseOweLimitCSV(in.Content)
+	if err != nil {
+		return nil, connect.NewError(connect.CodeInvalidArgument, err)
+	}
+
+	result := &OweLimitImportResult{Errors: rowErrs}
+	rows, resolveErrs, err := resolveOweLimitTeams(tx, in.TeamID, rows)
+	if err != nil {
+		return nil, err
+	}
+	result.Errors = append(result.Errors, resolveErrs...)
+
+	var current []db_models.OweLimitConfiguration
+	err = lockForUpdate(tx).
+		Where("team_id = ? AND is_default IS NOT TRUE", in.TeamID).
+		Order("for_team_id, id").
+		Find(&current).
+		Error
+	if err != nil {
+		return nil, err
+	}
+	values, err := oweLimitValuesOf(tx, current)
+	if err != nil {
+		return nil, err
+	}
+	byDebtor := map[uint64]*db_models.OweLimitConfiguration{}
+	for i := range current {
+		if current[i].ForTeamID != nil {
+			byDebtor[*current[i].ForTeamID] = &current[i]
+		}
+	}
+
+	seen := map[uint64]bool{}
+	for _, r := range rows {
+		ch := OweLimitImportChange{
+			Line:             r.line,
+			ForTeamID:        r.forTeamID,
+			TeamName:         r.teamName,
+			Action:           invoice_iface.OweLimitImportAction_OWE_LIMIT_IMPORT_ACTION_CREATE,
+			NewThreshold:     r.values.Threshold,
+			NewSoftThreshold: r.values.SoftThreshold,
+			NewMaxAgeDays:    r.values.MaxAgeDays,
+		}
+		if cfg, ok := byDebtor[r.forTeamID]; ok {
+			old := values[cfg.ID]
+			ch.cfg = cfg
+			ch.OldThreshold, ch.OldSoftThreshold, ch.OldMaxAgeDays = old.Threshold, old.SoftThreshold, old.MaxAgeDays
+			ch.Action = invoice_iface.OweLimitImportAction_OWE_LIMIT_IMPORT_ACTION_UPDATE
+			if old == r.values {
+				ch.Action = invoice_iface.OweLimitImportAction_OWE_LIMIT_IMPORT_ACTION_UNCHANGED
+			}
+		} else if r.deleted {
+			result.Errors = append(result.Errors, OweLimitImportError{
+				Line:    r.line,
+				Message: fmt.Sprintf("team #%d is deleted", r.forTeamID),
+			})
+			continue
+		}
+		seen[r.forTeamID] = true
+		result.Changes = append(result.Changes, ch)
+	}
+	if in.DeleteMissing {
+		for i := range current {
+			cfg := &current[i]
+			if cfg.ForTeamID == nil || seen[*cfg.ForTeamID] {
+				continue
+			}
+			old := values[cfg.ID]
+			result.Changes = append(result.Changes, OweLimitImportChange{
+				ForTeamID:        *cfg.ForTeamID,
+				Action:           invoice_iface.OweLimitImportAction_OWE_LIMIT_IMPORT_ACTION_DELETE,
+				OldThreshold:     old.Threshold,
+				OldSoftThreshold: old.SoftThreshold,
+				OldMaxAgeDays:    old.MaxAgeDays,
+				cfg:              cfg,
+			})
+		}
+	}
+	sort.SliceStable(result.Errors, func(i, j int) bool { return result.Errors[i].Line < result.Errors[j].Line })
+
+	if in.DryRun || len(result.Errors) > 0 {
+		return result, nil
+	}
+	if err := applyOweLimitImport(tx, in.TeamID, result.Changes, changedBy, now); err != nil {
+		return nil, err
+	}
+	result.Applied = true
+	return result, nil
+}
+
+func applyOweLimitImport(
+	tx *gorm.DB,
+	creditorTeamID uint64,
+	changes []OweLimitImportChange,
+	changedBy uint64,
+	now time.Time,
+) error {
+	var deletes []db_models.OweLimitConfiguration
+	for _, ch := range changes {
+		if ch.Action == invoice_iface.OweLimitImportAction_OWE_LIMIT_IMPORT_ACTION_DELETE {
+			touchOweLimitPair(tx, ch.ForTeamID, creditorTeamID)
+			deletes = append(deletes, *ch.cfg)
+		}
+	}
+	if err := deleteOweLimitConfigurations(tx, deletes, changedBy, now); err != nil {
+		return err
+	}
+
+	for _, ch := range changes {
+		var cfg *db_models.OweLimitConfiguration
+		switch ch.Action {
+		case invoice_iface.OweLimitImportAction_OWE_LIMIT_IMPORT_ACTION_CREATE:
+			forTeamID := ch.ForTeamID
+			cfg = &db_models.OweLimitConfiguration{
+				TeamID:    creditorTeamID,
+				ForTeamID: &forTeamID,
+				IsDefault: false,
+			}
+		case invoice_iface.OweLimitImportAction_OWE_LIMIT_IMPORT_ACTION_UPDATE:
+			cfg = ch.cfg
+		default:
+			continue
+		}
+		touchOweLimitPair(tx, ch.ForTeamID, creditorTeamID)
+		exists := ch.cfg != nil
+		if err := setOweLimitConfiguration(tx, cfg, exists, oweLimitValues{
+			Threshold:     ch.NewThreshold,
+			SoftThreshold: ch.NewSoftThreshold,
+			MaxAgeDays:    ch.NewMaxAgeDays,
+		}, changedBy, now); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// oweLimitCSVRow is a parsed CSV row; forTeamID is 0 until resolved from teamName.
+type oweLimitCSVRow struct {
+	line      int
+	forTeamID uint64
+	teamName  string
+	values    oweLimitValues
+	deleted   bool
+}
+
+// parseOweLimitCSV reads the rows of an owe-limit CSV. Malformed rows are reported as
+// row errors; only an unreadable file or a missing column fails the whole parse.
+func parseOweLimitCSV(content []byte) ([]oweLimitCSVRow, []OweLimitImportError, error) {
+	cr := csv.NewReader(bytes.NewReader(content))
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+
+	header, err := cr.Read()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, nil, errors.New("csv: empty file")
+		}
+		return nil, nil, err
+	}
+	col := map[string]int{}
+	for i, name := range header {
+		col[strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))] = i
+	}
+	if _, ok := col["threshold"]; !ok {
+		return nil, nil, errors.New("csv: no threshold column")
+	}
+	_, hasID := col["for_team_id"]
+	_, hasName := col["team_name"]
+	if !hasID && !hasName {
+		return nil, nil, errors.New("csv: no for_team_id or team_name column")
+	}
+	field := func(rec []string, name string) string {
+		i, ok := col[name]
+		if !ok || i >= len(rec) {
+			return ""
+		}
+		return strings.TrimSpace(rec[i])
+	}
+
+	var rows []oweLimitCSVRow
+	var rowErrs []OweLimitImportError
+	for {
+		rec, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		line, _ := cr.FieldPos(0)
+		fail := func(format string, args ...any) {
+			rowErrs = append(rowErrs, OweLimitImportError{Line: line, Message: fmt.Sprintf(format, args...)})
+		}
+
+		r := oweLimitCSVRow{line: line, teamName: field(rec, "team_name")}
+		if raw := field(rec, "for_team_id"); raw != "" {
+			r.forTeamID, err = strconv.ParseUint(raw, 10, 64)
+			if err != nil || r.forTeamID == 0 {
+				fail("invalid for_team_id %q", raw)
+				continue
+			}
+		}
+		if r.forTeamID == 0 && r.teamName == "" {
+			fail("for_team_id or team_name is required")
+			continue
+		}
+		raw := field(rec, "threshold")
+		r.values.Threshold, err = parseCSVAmount(raw)
+		if err != nil {
+			fail("invalid threshold %q", raw)
+			continue
+		}
+		if raw := field(rec, "soft_threshold"); raw != "" {
+			r.values.SoftThreshold, err = parseCSVAmount(raw)
+			if err != nil {
+				fail("invalid soft_threshold %q", raw)
+				continue
+			}
+		}
+		if raw := field(rec, "max_age_days"); raw != "" {
+			r.values.MaxAgeDays, err = strconv.ParseInt(raw, 10, 64)
+			if err != nil {
+				fail("invalid max_age_days %q", raw)
+				continue
+			}
+		}
+		if err := r.values.validate(); err != nil {
+			fail("%s", err)
+			continue
+		}
+		rows = append(rows, r)
+	}
+	return rows, rowErrs, nil
+}
+
+// parseCSVAmount reads a threshold cell: a finite, non-negative number.
+func parseCSVAmount(raw string) (float64, error) {
+	v, err := strconv.ParseFloat(raw, 64)
+	if err != nil {
+		return 0, err
+	}
+	if v < 0 || math.IsInf(v, 0) || math.IsNaN(v) {
+		return 0, errors.New("out of range")
+	}
+	return v, nil
+}
+
+// resolveOweLimitTeams checks every row's debtor against the teams table, fills in
+// forTeamID for rows named by team_name, and drops the rows it reports: unknown or
+// ambiguous teams, the creditor itself and debtors listed twice.
+func resolveOweLimitTeams(
+	db *gorm.DB,
+	creditorTeamID uint64,
+	rows []oweLimitCSVRow,
+) ([]oweLimitCSVRow, []OweLimitImportError, error) {
+	type team struct {
+		ID      uint64
+		Name    string
+		Deleted bool
+	}
+	var ids []uint64
+	var names []string
+	for _, r := range rows {
+		if r.forTeamID != 0 {
+			ids = append(ids, r.forTeamID)
+		} else {
+			names = append(names, strings.ToLower(r.teamName))
+		}
+	}
+	byID := map[uint64]team{}
+	if len(ids) > 0 {
+		var teams []team
+		if err := db.Table("teams").Select("id, name, deleted").Where("id IN ?", ids).Scan(&teams).Error; err != nil {
+			return nil, nil, err
+		}
+		for _, t := range teams {
+			byID[t.ID] = t
+		}
+	}
+	byName := map[string][]team{}
+	if len(names) > 0 {
+		var teams []team
+		err := db.
+			Table("teams").
+			Select("id, name, deleted").
+			Where("LOWER(name) IN ? AND deleted IS NOT TRUE", names).
+			Scan(&teams).Error
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, t := range teams {
+			key := strings.ToLower(t.Name)
+			byName[key] = append(byName[key], t)
+		}
+	}
+
+	var out []oweLimitCSVRow
+	var rowErrs []OweLimitImportError
+	firstLine := map[uint64]int{}
+	for _, r := range rows {
+		fail := func(format string, args ...any) {
+			rowErrs = append(rowErrs, OweLimitImportError{Line: r.line, Message: fmt.Sprintf(format, args...)})
+		}
+		var t team
+		if r.forTeamID != 0 {
+			found, ok := byID[r.forTeamID]
+			if !ok {
+				fail("team #%d not found", r.forTeamID)
+				continue
+			}
+			if r.teamName != "" && !strings.EqualFold(r.teamName, found.Name) {
+				fail("team #%d is named %q, not %q", r.forTeamID, found.Name, r.teamName)
+				continue
+			}
+			t = found
+		} else {
+			switch found := byName[strings.ToLower(r.teamName)]; len(found) {
+			case 0:
+				fail("team %q not found", r.teamName)
+				continue
+			case 1:
+				t = found[0]
+			default:
+				fail("team name %q matches %d teams, use for_team_id", r.teamName, len(found))
+				continue
+			}
+		}
+		if t.ID == creditorTeamID {
+			fail("a team cannot set an owe limit for itself")
+			continue
+		}
+		if line, ok := firstLine[t.ID]; ok {
+			fail("team #%d already listed on line %d", t.ID, line)
+			continue
+		}
+		firstLine[t.ID] = r.line
+		r.forTeamID, r.teamName, r.deleted = t.ID, t.Name, t.Deleted
+		out = append(out, r)
+	}
+	return out, rowErrs, nil
+}
+
+func toProtoOweLimitImportResult(r *OweLimitImportResult) *invoice_iface.ImportOweLimitsResponse {
+	out := &invoice_iface.ImportOweLimitsResponse{
+		Changes: make([]*invoice_iface.OweLimitImportChange, 0, len(r.Changes)),
+		Errors:  make([]*invoice_iface.OweLimitImportError, 0, len(r.Errors)),
+		Applied: r.Applied,
+	}
+	for _, ch := range r.Changes {
+		switch ch.Action {
+		case invoice_iface.OweLimitImportAction_OWE_LIMIT_IMPORT_ACTION_CREATE:
+			out.Created++
+		case invoice_iface.OweLimitImportAction_OWE_LIMIT_IMPORT_ACTION_UPDATE:
+			out.Updated++
+		case invoice_iface.OweLimitImportAction_OWE_LIMIT_IMPORT_ACTION_DELETE:
+			out.Deleted++
+		case invoice_iface.OweLimitImportAction_OWE_LIMIT_IMPORT_ACTION_UNCHANGED:
+			out.Unchanged++
+		}
+		out.Changes = append(out.Changes, &invoice_iface.OweLimitImportChange{
+			Line:             int64(ch.Line),
+			ForTeamId:        ch.ForTeamID,
+			TeamName:         ch.TeamName,
+			Action:           ch.Action,
+			OldThreshold:     ch.OldThreshold,
+			NewThreshold:     ch.NewThreshold,
+			OldSoftThreshold: ch.OldSoftThreshold,
+			NewSoftThreshold: ch.NewSoftThreshold,
+			OldMaxAgeDays:    ch.OldMaxAgeDays,
+			NewMaxAgeDays:    ch.NewMaxAgeDays,
+		})
+	}
+	for _, e := range r.Errors {
+		out.Errors = append(out.Errors, &invoice_iface.OweLimitImportError{Line: int64(e.Line), Message: e.Message})
+	}
+	return out
+}
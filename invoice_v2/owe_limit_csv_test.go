@@ -0,0 +1,189 @@
+package invoice_v2_test
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/pdcgo/invoice_service/invoice_models"
+	"github.com/pdcgo/invoice_service/invoice_v2"
+	invoice_iface "github.com/pdcgo/schema/services/invoice_iface/v2"
+	"github.com/pdcgo/shared/db_models"
+	"github.com/pdcgo/shared/pkg/moretest"
+	"github.com/pdcgo/shared/pkg/moretest/moretest_mock"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+// deletableTeamRow is teamRow with the deleted flag team lookups filter on.
+type deletableTeamRow struct {
+	ID      uint64 `gorm:"primarykey"`
+	Name    string
+	Deleted bool
+}
+
+func (deletableTeamRow) TableName() string { return "teams" }
+
+func TestOweLimitCSV(t *testing.T) {
+	var scenario moretest_mock.DbScenario
+
+	moretest.Suite(t, "owe limit csv",
+		moretest.SetupListFunc{
+			moretest_mock.MockPostgresDatabase(&scenario),
+		},
+		func(t *testing.T) {
+			scenario(t, func(tx *gorm.DB) {
+				assert.NoError(t, tx.AutoMigrate(
+					&db_models.OweLimitConfiguration{},
+					&invoice_models.OweLimitAgeRule{},
+					&invoice_models.OweLimitSoftThreshold{},
+					&invoice_models.OweLimitConfigurationHistory{},
+					&deletableTeamRow{},
+				))
+				assert.NoError(t, tx.Create(&[]deletableTeamRow{
+					{ID: 1, Name: "Creditor"},
+					{ID: 2, Name: "Beta"},
+					{ID: 3, Name: "Acme"},
+					{ID: 4, Name: "Delta"},
+					{ID: 5, Name: "Twin"},
+					{ID: 6, Name: "twin"},
+					{ID: 7, Name: "Gone", Deleted: true},
+				}).Error)
+
+				const creditor = uint64(1)
+				now := time.Date(2025, 5, 1, 9, 0, 0, 0, time.UTC)
+				beta, acme := uint64(2), uint64(3)
+				assert.NoError(t, tx.Create(&[]db_models.OweLimitConfiguration{
+					{TeamID: creditor, IsDefault: true, Threshold: 10},
+					{TeamID: creditor, ForTeamID: &beta, Threshold: 100},
+					{TeamID: creditor, ForTeamID: &acme, Threshold: 50},
+				}).Error)
+
+				importCSV := func(content string, deleteMissing, dryRun bool) *invoice_v2.OweLimitImportResult {
+					res, err := invoice_v2.ImportOweLimits(tx, invoice_v2.OweLimitImportInput{
+						TeamID:        creditor,
+						Content:       []byte(content),
+						DeleteMissing: deleteMissing,
+						DryRun:        dryRun,
+					}, callerID, now)
+					assert.NoError(t, err)
+					return res
+				}
+				actions := func(res *invoice_v2.OweLimitImportResult) map[uint64]invoice_iface.OweLimitImportAction {
+					out := map[uint64]invoice_iface.OweLimitImportAction{}
+					for _, ch := range res.Changes {
+						out[ch.ForTeamID] = ch.Action
+					}
+					return out
+				}
+				limits := func() map[uint64]float64 {
+					var cfgs []db_models.OweLimitConfiguration
+					assert.NoError(t, tx.Where("team_id = ? AND is_default IS NOT TRUE", creditor).Find(&cfgs).Error)
+					out := map[uint64]float64{}
+					for _, c := range cfgs {
+						out[*c.ForTeamID] = c.Threshold
+					}
+					return out
+				}
+
+				t.Run("export lists custom limits only", func(t *testing.T) {
+					var buf bytes.Buffer
+					n, err := invoice_v2.ExportOweLimits(tx, creditor, &buf)
+					assert.NoError(t, err)
+					assert.Equal(t, 2, n)
+					assert.Equal(t, "for_team_id,team_name,threshold,soft_threshold,max_age_days\n2,Beta,100,0,0\n3,Acme,50,0,0\n", buf.String())
+				})
+
+				t.Run("the export imports back unchanged", func(t *testing.T) {
+					var buf bytes.Buffer
+					_, err := invoice_v2.ExportOweLimits(tx, creditor, &buf)
+					assert.NoError(t, err)
+					res := importCSV(buf.String(), true, false)
+					assert.Empty(t, res.Errors)
+					assert.True(t, res.Applied)
+					assert.Equal(t, map[uint64]invoice_iface.OweLimitImportAction{
+						2: invoice_iface.OweLimitImportAction_OWE_LIMIT_IMPORT_ACTION_UNCHANGED,
+						3: invoice_iface.OweLimitImportAction_OWE_LIMIT_IMPORT_ACTION_UNCHANGED,
+					}, actions(res))
+
+					var history int64
+					assert.NoError(t, tx.Model(&invoice_models.OweLimitConfigurationHistory{}).Count(&history).Error)
+					assert.Equal(t, int64(0), history)
+				})
+
+				csv := "team_name,threshold,max_age_days\nbeta,120,30\nDelta,75,\n"
+
+				t.Run("dry run previews creates, updates and deletes", func(t *testing.T) {
+					res := importCSV(csv, true, true)
+					assert.Empty(t, res.Errors)
+					assert.False(t, res.Applied)
+					assert.Equal(t, map[uint64]invoice_iface.OweLimitImportAction{
+						2: invoice_iface.OweLimitImportAction_OWE_LIMIT_IMPORT_ACTION_UPDATE,
+						3: invoice_iface.OweLimitImportAction_OWE_LIMIT_IMPORT_ACTION_DELETE,
+						4: invoice_iface.OweLimitImportAction_OWE_LIMIT_IMPORT_ACTION_CREATE,
+					}, actions(res))
+					assert.Equal(t, map[uint64]float64{2: 100, 3: 50}, limits())
+				})
+
+				t.Run("apply writes everything with history", func(t *testing.T) {
+					res := importCSV(csv, true, false)
+					assert.True(t, res.Applied)
+					assert.Equal(t, map[uint64]float64{2: 120, 4: 75}, limits())
+
+					var ages []int64
+					assert.NoError(t, tx.Model(&invoice_models.OweLimitAgeRule{}).Pluck("max_age_days", &ages).Error)
+					assert.Equal(t, []int64{30}, ages)
+
+					var history []invoice_models.OweLimitConfigurationHistory
+					assert.NoError(t, tx.Order("id").Find(&history).Error)
+					got := map[uint64]invoice_iface.OweLimitHistoryAction{}
+					for _, h := range history {
+						assert.Equal(t, uint64(callerID), h.ChangedByID)
+						got[*h.ForTeamID] = h.Action
+					}
+					assert.Equal(t, map[uint64]invoice_iface.OweLimitHistoryAction{
+						2: invoice_iface.OweLimitHistoryAction_OWE_LIMIT_HISTORY_ACTION_UPDATE,
+						3: invoice_iface.OweLimitHistoryAction_OWE_LIMIT_HISTORY_ACTION_DELETE,
+						4: invoice_iface.OweLimitHistoryAction_OWE_LIMIT_HISTORY_ACTION_CREATE,
+					}, got)
+				})
+
+				t.Run("without delete_missing absent debtors are kept", func(t *testing.T) {
+					res := importCSV("for_team_id,threshold\n3,40\n", false, false)
+					assert.True(t, res.Applied)
+					assert.Equal(t, map[uint64]float64{2: 120, 3: 40, 4: 75}, limits())
+				})
+
+				t.Run("invalid rows are reported and nothing is applied", func(t *testing.T) {
+					res := importCSV(
+						"for_team_id,team_name,threshold\n"+
+							"2,Beta,500\n"+ // valid, but not applied
+							"99,,10\n"+
+							",Twin,10\n"+
+							",Nobody,10\n"+
+							"4,Beta,10\n"+
+							"1,,10\n"+
+							"2,,10\n"+
+							"7,,10\n"+
+							"3,,-5\n",
+						false, false)
+					assert.False(t, res.Applied)
+					lines := map[int]bool{}
+					for _, e := range res.Errors {
+						lines[e.Line] = true
+					}
+					assert.Equal(t, map[int]bool{3: true, 4: true, 5: true, 6: true, 7: true, 8: true, 9: true, 10: true}, lines)
+					assert.Equal(t, map[uint64]float64{2: 120, 3: 40, 4: 75}, limits())
+				})
+
+				t.Run("a file without the needed columns is rejected", func(t *testing.T) {
+					_, err := invoice_v2.ImportOweLimits(tx, invoice_v2.OweLimitImportInput{
+						TeamID:  creditor,
+						Content: []byte("team,limit\nBeta,10\n"),
+					}, callerID, now)
+					assert.Error(t, err)
+				})
+			})
+		},
+	)
+}
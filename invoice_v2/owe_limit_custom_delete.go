@@ -2,27 +2,45 @@ package invoice_v2
 
 import (
 	"context"
+	"time"
 
 	"connectrpc.com/connect"
 	invoice_iface "github.com/pdcgo/schema/services/invoice_iface/v2"
 	"github.com/pdcgo/shared/db_models"
+	"github.com/pdcgo/user_service/access_interceptors"
+	"gorm.io/gorm"
 )
 
 // OweLimitCustomDelete implements [invoice_ifaceconnect.InvoiceServiceHandler]. It removes
 // the CREDITOR team's per-debtor threshold for for_team_id; that debtor then falls back to
 // the creditor's default rule (or, with no default, is allowed). Hard delete — the model
-// has no soft-delete field. Deleting a row that does not exist is a no-op.
+// has no soft-delete field — so the removed threshold lives on only in the owe-limit
+// history. Deleting a row that does not exist is a no-op.
 func (s *invoiceServiceImpl) OweLimitCustomDelete(
 	ctx context.Context,
 	req *connect.Request[invoice_iface.OweLimitCustomDeleteRequest],
 ) (*connect.Response[invoice_iface.OweLimitCustomDeleteResponse], error) {
 	pay := req.Msg
 
-	err := s.db.
-		WithContext(ctx).
-		Where("team_id = ? AND for_team_id = ? AND is_default IS NOT TRUE", pay.TeamId, pay.ForTeamId).
-		Delete(&db_models.OweLimitConfiguration{}).
-		Error
+	caller, err := access_interceptors.GetIdentityFromCtx(ctx)
+	if err != nil {
+		return nil, connect.NewError(connect.CodeUnauthenticated, err)
+	}
+	changedBy := uint64(caller.IdentityId)
+	now := time.Now()
+
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		touchOweLimitPair(tx, pay.ForTeamId, pay.TeamId)
+		var cfgs []db_models.OweLimitConfiguration
+		err := lockForUpdate(tx).
+			Where("team_id = ? AND for_team_id = ? AND is_default IS NOT TRUE", pay.TeamId, pay.ForTeamId).
+			Find(&cfgs).
+			Error
+		if err != nil {
+			return err
+		}
+		return deleteOweLimitConfigurations(tx, cfgs, changedBy, now)
+	})
 	if err != nil {
 		return nil, err
 	}
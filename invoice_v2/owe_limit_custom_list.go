@@ -3,8 +3,10 @@ package invoice_v2
 import (
 	"context"
 	"errors"
+	"time"
 
 	"connectrpc.com/connect"
+	"github.com/pdcgo/invoice_service/invoice_models"
 	"github.com/pdcgo/schema/services/common/v1"
 	invoice_iface "github.com/pdcgo/schema/services/invoice_iface/v2"
 	"github.com/pdcgo/shared/db_connect"
@@ -14,7 +16,10 @@ import (
 
 // OweLimitCustomList implements [invoice_ifaceconnect.InvoiceServiceHandler]. It lists the
 // CREDITOR team's per-debtor owe thresholds (the custom rows only — the default rule is
-// fetched with OweLimitDefaultGet), newest first, paginated.
+// fetched with OweLimitDefaultGet), newest first, paginated. for_team_id narrows it to
+// one debtor. With include_overrides it also returns the audit of the team's
+// time-boxed overrides — scheduled, active, expired and revoked — newest first and
+// not paginated.
 func (s *invoiceServiceImpl) OweLimitCustomList(
 	ctx context.Context,
 	req *connect.Request[invoice_iface.OweLimitCustomListRequest],
@@ -37,10 +42,14 @@ func (s *invoiceServiceImpl) OweLimitCustomList(
 			Scopes(func(d *gorm.DB) *gorm.DB {
 				// is_default IS NOT TRUE: the column is nullable in the live schema and
 				// gorm scans NULL to false, so a NULL row counts as custom.
-				return d.
+				d = d.
 					Where("team_id = ?", pay.TeamId).
 					Where("is_default IS NOT TRUE").
 					Where("for_team_id IS NOT NULL")
+				if pay.ForTeamId != 0 {
+					d = d.Where("for_team_id = ?", pay.ForTeamId)
+				}
+				return d
 			})
 		return query, nil
 	}, pay.Page)
@@ -52,11 +61,18 @@ func (s *invoiceServiceImpl) OweLimitCustomList(
 		return nil, err
 	}
 
+	values, err := oweLimitValuesOf(db, rows)
+	if err != nil {
+		return nil, err
+	}
+
 	result.PageInfo = pageInfo
 	for _, row := range rows {
 		item := &invoice_iface.OweLimitCustomItem{
-			Id:        row.ID,
-			Threshold: row.Threshold,
+			Id:            row.ID,
+			Threshold:     row.Threshold,
+			SoftThreshold: values[row.ID].SoftThreshold,
+			MaxAgeDays:    values[row.ID].MaxAgeDays,
 		}
 		if row.ForTeamID != nil {
 			item.ForTeamId = *row.ForTeamID
@@ -64,5 +80,21 @@ func (s *invoiceServiceImpl) OweLimitCustomList(
 		result.Items = append(result.Items, item)
 	}
 
+	if pay.IncludeOverrides {
+		var overrides []invoice_models.OweLimitOverride
+		query := db.Where("team_id = ?", pay.TeamId)
+		if pay.ForTeamId != 0 {
+			query = query.Where("for_team_id = ?", pay.ForTeamId)
+		}
+		if err := query.Order("starts_at DESC, id DESC").Find(&overrides).Error; err != nil {
+			return nil, err
+		}
+		now := time.Now()
+		result.Overrides = make([]*invoice_iface.OweLimitOverride, 0, len(overrides))
+		for i := range overrides {
+			result.Overrides = append(result.Overrides, toProtoOweLimitOverride(&overrides[i], now))
+		}
+	}
+
 	return connect.NewResponse(result), nil
 }
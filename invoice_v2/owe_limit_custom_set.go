@@ -3,16 +3,21 @@ package invoice_v2
 import (
 	"context"
 	"errors"
+	"time"
 
 	"connectrpc.com/connect"
 	invoice_iface "github.com/pdcgo/schema/services/invoice_iface/v2"
 	"github.com/pdcgo/shared/db_models"
+	"github.com/pdcgo/user_service/access_interceptors"
 	"gorm.io/gorm"
 )
 
 // OweLimitCustomSet implements [invoice_ifaceconnect.InvoiceServiceHandler]. It upserts a
 // per-debtor owe threshold for the CREDITOR team (team_id): "for_team_id may owe me up to
-// threshold" (0 = unlimited). A custom row beats the creditor's default row.
+// threshold" (0 = unlimited), and with max_age_days > 0 "as long as nothing it owes me
+// is older than that". Above soft_threshold (0 = none) the debtor is flagged WARN but
+// still allowed. A custom row beats the creditor's default row. Each change
+// is recorded, with the caller, in the owe-limit history (see OweLimitHistory).
 func (s *invoiceServiceImpl) OweLimitCustomSet(
 	ctx context.Context,
 	req *connect.Request[invoice_iface.OweLimitCustomSetRequest],
@@ -23,7 +28,15 @@ func (s *invoiceServiceImpl) OweLimitCustomSet(
 		return nil, connect.NewError(connect.CodeInvalidArgument, errors.New("team_id and for_team_id must differ"))
 	}
 
-	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+	caller, err := access_interceptors.GetIdentityFromCtx(ctx)
+	if err != nil {
+		return nil, connect.NewError(connect.CodeUnauthenticated, err)
+	}
+	changedBy := uint64(caller.IdentityId)
+	now := time.Now()
+
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		touchOweLimitPair(tx, pay.ForTeamId, pay.TeamId)
 		// is_default IS NOT TRUE (not `= false`): the column is nullable in the live
 		// schema, and gorm scans NULL to false — i.e. a NULL row is a custom row.
 		var cfg db_models.OweLimitConfiguration
@@ -35,22 +48,20 @@ func (s *invoiceServiceImpl) OweLimitCustomSet(
 			return res.Error
 		}
 
-		if res.RowsAffected == 0 {
+		exists := res.RowsAffected > 0
+		if !exists {
 			forTeamID := pay.ForTeamId
 			cfg = db_models.OweLimitConfiguration{
 				TeamID:    pay.TeamId,
 				ForTeamID: &forTeamID,
 				IsDefault: false,
-				Threshold: pay.Threshold,
 			}
-			return tx.Create(&cfg).Error
 		}
-
-		return tx.
-			Model(&db_models.OweLimitConfiguration{}).
-			Where("id = ?", cfg.ID).
-			Update("threshold", pay.Threshold).
-			Error
+		return setOweLimitConfiguration(tx, &cfg, exists, oweLimitValues{
+			Threshold:     pay.Threshold,
+			SoftThreshold: pay.SoftThreshold,
+			MaxAgeDays:    pay.MaxAgeDays,
+		}, changedBy, now)
 	})
 	if err != nil {
 		return nil, err
@@ -11,7 +11,8 @@ import (
 // OweLimitDefaultGet implements [invoice_ifaceconnect.InvoiceServiceHandler]. It returns
 // the CREDITOR team's default owe threshold — the rule applied to any debtor that has no
 // custom row. configured=false means there is no default rule (the creditor allows any
-// debt); threshold 0 means unlimited.
+// debt); threshold 0 means unlimited, soft_threshold 0 no soft limit and max_age_days 0
+// no age limit.
 func (s *invoiceServiceImpl) OweLimitDefaultGet(
 	ctx context.Context,
 	req *connect.Request[invoice_iface.OweLimitDefaultGetRequest],
@@ -28,8 +29,15 @@ func (s *invoiceServiceImpl) OweLimitDefaultGet(
 		return nil, res.Error
 	}
 
+	values, err := oweLimitValuesOf(s.db.WithContext(ctx), []db_models.OweLimitConfiguration{cfg})
+	if err != nil {
+		return nil, err
+	}
+
 	return connect.NewResponse(&invoice_iface.OweLimitDefaultGetResponse{
-		Configured: res.RowsAffected > 0,
-		Threshold:  cfg.Threshold,
+		Configured:    res.RowsAffected > 0,
+		Threshold:     cfg.Threshold,
+		SoftThreshold: values[cfg.ID].SoftThreshold,
+		MaxAgeDays:    values[cfg.ID].MaxAgeDays,
 	}), nil
 }
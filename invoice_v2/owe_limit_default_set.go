@@ -2,24 +2,37 @@ package invoice_v2
 
 import (
 	"context"
+	"time"
 
 	"connectrpc.com/connect"
 	invoice_iface "github.com/pdcgo/schema/services/invoice_iface/v2"
 	"github.com/pdcgo/shared/db_models"
+	"github.com/pdcgo/user_service/access_interceptors"
 	"gorm.io/gorm"
 )
 
 // OweLimitDefaultSet implements [invoice_ifaceconnect.InvoiceServiceHandler]. It upserts
-// the CREDITOR team's default owe threshold (0 = unlimited) — the rule applied to any
-// debtor with no custom row. The row is locked for update so concurrent sets don't
-// duplicate it (the partial unique index is the DB-level guard).
+// the CREDITOR team's default owe threshold (0 = unlimited), soft threshold above which
+// debtors are flagged WARN (0 = none, at most the threshold) and max age of unsettled
+// debt in days (0 = none) — the rule applied to any debtor with no custom row. The row
+// is locked for update so concurrent sets don't duplicate it (the partial unique index
+// is the DB-level guard). Each change is recorded, with the caller, in the owe-limit
+// history (see OweLimitHistory).
 func (s *invoiceServiceImpl) OweLimitDefaultSet(
 	ctx context.Context,
 	req *connect.Request[invoice_iface.OweLimitDefaultSetRequest],
 ) (*connect.Response[invoice_iface.OweLimitDefaultSetResponse], error) {
 	pay := req.Msg
 
-	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+	caller, err := access_interceptors.GetIdentityFromCtx(ctx)
+	if err != nil {
+		return nil, connect.NewError(connect.CodeUnauthenticated, err)
+	}
+	changedBy := uint64(caller.IdentityId)
+	now := time.Now()
+
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		touchOweLimitCreditor(tx, pay.TeamId)
 		var cfg db_models.OweLimitConfiguration
 		res := lockForUpdate(tx).
 			Where("team_id = ? AND is_default = ?", pay.TeamId, true).
@@ -29,20 +42,18 @@ func (s *invoiceServiceImpl) OweLimitDefaultSet(
 			return res.Error
 		}
 
-		if res.RowsAffected == 0 {
+		exists := res.RowsAffected > 0
+		if !exists {
 			cfg = db_models.OweLimitConfiguration{
 				TeamID:    pay.TeamId,
 				IsDefault: true,
-				Threshold: pay.Threshold,
 			}
-			return tx.Create(&cfg).Error
 		}
-
-		return tx.
-			Model(&db_models.OweLimitConfiguration{}).
-			Where("id = ?", cfg.ID).
-			Update("threshold", pay.Threshold).
-			Error
+		return setOweLimitConfiguration(tx, &cfg, exists, oweLimitValues{
+			Threshold:     pay.Threshold,
+			SoftThreshold: pay.SoftThreshold,
+			MaxAgeDays:    pay.MaxAgeDays,
+		}, changedBy, now)
 	})
 	if err != nil {
 		return nil, err
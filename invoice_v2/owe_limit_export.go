@@ -0,0 +1,34 @@
+package invoice_v2
+
+import (
+	"bytes"
+	"context"
+	"errors"
+
+	"connectrpc.com/connect"
+	invoice_iface "github.com/pdcgo/schema/services/invoice_iface/v2"
+)
+
+// ExportOweLimits implements [invoice_ifaceconnect.InvoiceServiceHandler]. It returns
+// the CREDITOR team's custom owe limits as CSV (for_team_id, team_name, threshold,
+// max_age_days), ready to edit and feed back to ImportOweLimits.
+func (s *invoiceServiceImpl) ExportOweLimits(
+	ctx context.Context,
+	req *connect.Request[invoice_iface.ExportOweLimitsRequest],
+) (*connect.Response[invoice_iface.ExportOweLimitsResponse], error) {
+	pay := req.Msg
+	if pay.TeamId == 0 {
+		return nil, connect.NewError(connect.CodeInvalidArgument, errors.New("team_id is required"))
+	}
+
+	var buf bytes.Buffer
+	n, err := ExportOweLimits(s.db.WithContext(ctx), pay.TeamId, &buf)
+	if err != nil {
+		return nil, err
+	}
+
+	return connect.NewResponse(&invoice_iface.ExportOweLimitsResponse{
+		Content:  buf.Bytes(),
+		RowCount: int64(n),
+	}), nil
+}
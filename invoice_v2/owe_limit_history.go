@@ -0,0 +1,108 @@
+package invoice_v2
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"connectrpc.com/connect"
+	"github.com/pdcgo/invoice_service/invoice_models"
+	"github.com/pdcgo/schema/services/common/v1"
+	invoice_iface "github.com/pdcgo/schema/services/invoice_iface/v2"
+	"github.com/pdcgo/shared/db_connect"
+	"github.com/pdcgo/shared/db_models"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"gorm.io/gorm"
+)
+
+// OweLimitHistory implements [invoice_ifaceconnect.InvoiceServiceHandler]. It lists
+// the changes to the CREDITOR team's owe limits — who created, changed or deleted
+// which threshold or max age and what it was before — newest first, paginated. for_team_id
+// narrows it to the custom thresholds of one debtor.
+func (s *invoiceServiceImpl) OweLimitHistory(
+	ctx context.Context,
+	req *connect.Request[invoice_iface.OweLimitHistoryRequest],
+) (*connect.Response[invoice_iface.OweLimitHistoryResponse], error) {
+	pay := req.Msg
+	if pay.Page == nil {
+		return nil, connect.NewError(connect.CodeInvalidArgument, errors.New("page is required"))
+	}
+
+	result := &invoice_iface.OweLimitHistoryResponse{
+		Entries:  []*invoice_iface.OweLimitHistoryEntry{},
+		PageInfo: &common.PageInfo{},
+	}
+	db := s.db.WithContext(ctx)
+
+	var rows []*invoice_models.OweLimitConfigurationHistory
+	paginated, pageInfo, err := db_connect.SetPaginationQuery(db, func() (*gorm.DB, error) {
+		query := db.
+			Model(&invoice_models.OweLimitConfigurationHistory{}).
+			Scopes(func(d *gorm.DB) *gorm.DB {
+				d = d.Where("team_id = ?", pay.TeamId)
+				if pay.ForTeamId != 0 {
+					d = d.Where("for_team_id = ?", pay.ForTeamId)
+				}
+				return d
+			})
+		return query, nil
+	}, pay.Page)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := paginated.Order("id DESC").Find(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	result.PageInfo = pageInfo
+	for _, row := range rows {
+		result.Entries = append(result.Entries, toProtoOweLimitHistoryEntry(row))
+	}
+
+	return connect.NewResponse(result), nil
+}
+
+// newOweLimitChange starts the owe_limit_configuration_history row of a change to
+// cfg; the caller fills in the values before and after.
+func newOweLimitChange(
+	cfg *db_models.OweLimitConfiguration,
+	action invoice_iface.OweLimitHistoryAction,
+	changedBy uint64,
+	now time.Time,
+) *invoice_models.OweLimitConfigurationHistory {
+	return &invoice_models.OweLimitConfigurationHistory{
+		ConfigurationID: cfg.ID,
+		TeamID:          cfg.TeamID,
+		ForTeamID:       cfg.ForTeamID,
+		IsDefault:       cfg.IsDefault,
+		Action:          action,
+		ChangedByID:     changedBy,
+		ChangedAt:       now,
+	}
+}
+
+func toProtoOweLimitHistoryEntry(h *invoice_models.OweLimitConfigurationHistory) *invoice_iface.OweLimitHistoryEntry {
+	out := &invoice_iface.OweLimitHistoryEntry{
+		Id:               h.ID,
+		ConfigurationId:  h.ConfigurationID,
+		TeamId:           h.TeamID,
+		IsDefault:        h.IsDefault,
+		Action:           h.Action,
+		OldThreshold:     h.OldThreshold,
+		NewThreshold:     h.NewThreshold,
+		OldMaxAgeDays:    h.OldMaxAgeDays,
+		NewMaxAgeDays:    h.NewMaxAgeDays,
+		OldSoftThreshold: h.OldSoftThreshold,
+		NewSoftThreshold: h.NewSoftThreshold,
+		ChangedById:      h.ChangedByID,
+		ChangedAt:        timestamppb.New(h.ChangedAt),
+	}
+	if h.ForTeamID != nil {
+		out.ForTeamId = *h.ForTeamID
+	}
+	if h.TeamType != "" {
+		out.TeamType = teamTypeToProto(db_models.TeamType(h.TeamType))
+	}
+	return out
+}
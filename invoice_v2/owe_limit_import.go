@@ -0,0 +1,49 @@
+package invoice_v2
+
+import (
+	"context"
+	"time"
+
+	"connectrpc.com/connect"
+	invoice_iface "github.com/pdcgo/schema/services/invoice_iface/v2"
+	"github.com/pdcgo/user_service/access_interceptors"
+	"gorm.io/gorm"
+)
+
+// ImportOweLimits implements [invoice_ifaceconnect.InvoiceServiceHandler].
+//
+// The CREDITOR team (team_id) uploads a CSV of custom owe limits, as written by
+// ExportOweLimits, and gets back what each row does: CREATE, UPDATE or UNCHANGED, and
+// with delete_missing a DELETE for every debtor left out of the file. Rows that do not
+// validate come back in errors and nothing is applied; with dry_run nothing is applied
+// either, so the same call previews the import. Otherwise every change is applied in
+// one transaction and recorded in the owe-limit history. Rules are described on
+// [ImportOweLimits].
+func (s *invoiceServiceImpl) ImportOweLimits(
+	ctx context.Context,
+	req *connect.Request[invoice_iface.ImportOweLimitsRequest],
+) (*connect.Response[invoice_iface.ImportOweLimitsResponse], error) {
+	pay := req.Msg
+
+	caller, err := access_interceptors.GetIdentityFromCtx(ctx)
+	if err != nil {
+		return nil, connect.NewError(connect.CodeUnauthenticated, err)
+	}
+
+	var result *OweLimitImportResult
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var err error
+		result, err = ImportOweLimits(tx, OweLimitImportInput{
+			TeamID:        pay.TeamId,
+			Content:       pay.Content,
+			DeleteMissing: pay.DeleteMissing,
+			DryRun:        pay.DryRun,
+		}, uint64(caller.IdentityId), time.Now())
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return connect.NewResponse(toProtoOweLimitImportResult(result)), nil
+}
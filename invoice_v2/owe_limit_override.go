@@ -0,0 +1,45 @@
+package invoice_v2
+
+import (
+	"time"
+
+	"github.com/pdcgo/invoice_service/invoice_models"
+	invoice_iface "github.com/pdcgo/schema/services/invoice_iface/v2"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// overrideState is where o stands at now: revoked wins, then its window decides.
+func overrideState(o *invoice_models.OweLimitOverride, now time.Time) invoice_iface.OweLimitOverrideState {
+	switch {
+	case o.RevokedAt != nil:
+		return invoice_iface.OweLimitOverrideState_OWE_LIMIT_OVERRIDE_STATE_REVOKED
+	case now.Before(o.StartsAt):
+		return invoice_iface.OweLimitOverrideState_OWE_LIMIT_OVERRIDE_STATE_SCHEDULED
+	case now.Before(o.EndsAt):
+		return invoice_iface.OweLimitOverrideState_OWE_LIMIT_OVERRIDE_STATE_ACTIVE
+	default:
+		return invoice_iface.OweLimitOverrideState_OWE_LIMIT_OVERRIDE_STATE_EXPIRED
+	}
+}
+
+func toProtoOweLimitOverride(o *invoice_models.OweLimitOverride, now time.Time) *invoice_iface.OweLimitOverride {
+	out := &invoice_iface.OweLimitOverride{
+		Id:          o.ID,
+		TeamId:      o.TeamID,
+		ForTeamId:   o.ForTeamID,
+		Threshold:   o.Threshold,
+		StartsAt:    timestamppb.New(o.StartsAt),
+		EndsAt:      timestamppb.New(o.EndsAt),
+		Reason:      o.Reason,
+		State:       overrideState(o, now),
+		CreatedById: o.CreatedByID,
+		CreatedAt:   timestamppb.New(o.CreatedAt),
+	}
+	if o.RevokedByID != nil {
+		out.RevokedById = *o.RevokedByID
+	}
+	if o.RevokedAt != nil {
+		out.RevokedAt = timestamppb.New(*o.RevokedAt)
+	}
+	return out
+}
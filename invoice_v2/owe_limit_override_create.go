@@ -0,0 +1,88 @@
+package invoice_v2
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"connectrpc.com/connect"
+	"github.com/pdcgo/invoice_service/invoice_models"
+	invoice_iface "github.com/pdcgo/schema/services/invoice_iface/v2"
+	"github.com/pdcgo/user_service/access_interceptors"
+	"gorm.io/gorm"
+)
+
+// OweLimitOverrideCreate implements [invoice_ifaceconnect.InvoiceServiceHandler]. It
+// schedules a time-boxed owe threshold the CREDITOR team (team_id) grants for_team_id
+// between starts_at and ends_at (0 = unlimited), e.g. extra room for a campaign week.
+// While active it beats the custom and default rules; afterwards CheckOweLimit falls
+// back to them on its own. Windows of one pair may not overlap unless revoked.
+func (s *invoiceServiceImpl) OweLimitOverrideCreate(
+	ctx context.Context,
+	req *connect.Request[invoice_iface.OweLimitOverrideCreateRequest],
+) (*connect.Response[invoice_iface.OweLimitOverrideCreateResponse], error) {
+	pay := req.Msg
+
+	if pay.TeamId == 0 || pay.ForTeamId == 0 {
+		return nil, connect.NewError(connect.CodeInvalidArgument, errors.New("team_id and for_team_id are required"))
+	}
+	if pay.TeamId == pay.ForTeamId {
+		return nil, connect.NewError(connect.CodeInvalidArgument, errors.New("team_id and for_team_id must differ"))
+	}
+	if pay.Threshold < 0 {
+		return nil, connect.NewError(connect.CodeInvalidArgument, errors.New("threshold must not be negative"))
+	}
+	if pay.StartsAt == nil || pay.EndsAt == nil {
+		return nil, connect.NewError(connect.CodeInvalidArgument, errors.New("starts_at and ends_at are required"))
+	}
+	startsAt, endsAt := pay.StartsAt.AsTime(), pay.EndsAt.AsTime()
+	if !endsAt.After(startsAt) {
+		return nil, connect.NewError(connect.CodeInvalidArgument, errors.New("ends_at must be after starts_at"))
+	}
+
+	caller, err := access_interceptors.GetIdentityFromCtx(ctx)
+	if err != nil {
+		return nil, connect.NewError(connect.CodeUnauthenticated, err)
+	}
+
+	now := time.Now()
+	if !endsAt.After(now) {
+		return nil, connect.NewError(connect.CodeInvalidArgument, errors.New("ends_at must be in the future"))
+	}
+
+	var row invoice_models.OweLimitOverride
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		touchOweLimitPair(tx, pay.ForTeamId, pay.TeamId)
+		var clash []invoice_models.OweLimitOverride
+		err := lockForUpdate(tx).
+			Where("team_id = ? AND for_team_id = ? AND revoked_at IS NULL", pay.TeamId, pay.ForTeamId).
+			Where("starts_at < ? AND ends_at > ?", endsAt, startsAt).
+			Limit(1).
+			Find(&clash).
+			Error
+		if err != nil {
+			return err
+		}
+		if len(clash) > 0 {
+			return connect.NewError(connect.CodeFailedPrecondition, fmt.Errorf("overlaps owe limit override #%d", clash[0].ID))
+		}
+
+		row = invoice_models.OweLimitOverride{
+			TeamID:      pay.TeamId,
+			ForTeamID:   pay.ForTeamId,
+			Threshold:   pay.Threshold,
+			StartsAt:    startsAt,
+			EndsAt:      endsAt,
+			Reason:      pay.Reason,
+			CreatedByID: uint64(caller.IdentityId),
+			CreatedAt:   now,
+		}
+		return tx.Create(&row).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return connect.NewResponse(&invoice_iface.OweLimitOverrideCreateResponse{Override: toProtoOweLimitOverride(&row, now)}), nil
+}
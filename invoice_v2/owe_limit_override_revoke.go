@@ -0,0 +1,67 @@
+package invoice_v2
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"connectrpc.com/connect"
+	"github.com/pdcgo/invoice_service/invoice_models"
+	invoice_iface "github.com/pdcgo/schema/services/invoice_iface/v2"
+	"github.com/pdcgo/user_service/access_interceptors"
+	"gorm.io/gorm"
+)
+
+// OweLimitOverrideRevoke implements [invoice_ifaceconnect.InvoiceServiceHandler]. It
+// ends a scheduled or active override of the CREDITOR team (team_id) immediately; the
+// row stays for the audit in OweLimitCustomList. Expired overrides cannot be revoked.
+func (s *invoiceServiceImpl) OweLimitOverrideRevoke(
+	ctx context.Context,
+	req *connect.Request[invoice_iface.OweLimitOverrideRevokeRequest],
+) (*connect.Response[invoice_iface.OweLimitOverrideRevokeResponse], error) {
+	pay := req.Msg
+
+	caller, err := access_interceptors.GetIdentityFromCtx(ctx)
+	if err != nil {
+		return nil, connect.NewError(connect.CodeUnauthenticated, err)
+	}
+	callerID := uint64(caller.IdentityId)
+
+	now := time.Now()
+	var row invoice_models.OweLimitOverride
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := lockForUpdate(tx).Where("id = ?", pay.OverrideId).First(&row).Error
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return connect.NewError(connect.CodeNotFound, errors.New("owe limit override not found"))
+			}
+			return err
+		}
+		if row.TeamID != pay.TeamId {
+			return connect.NewError(connect.CodeInvalidArgument, errors.New("override does not match team_id"))
+		}
+		touchOweLimitPair(tx, row.ForTeamID, row.TeamID)
+		switch overrideState(&row, now) {
+		case invoice_iface.OweLimitOverrideState_OWE_LIMIT_OVERRIDE_STATE_REVOKED:
+			return connect.NewError(connect.CodeFailedPrecondition, errors.New("override already revoked"))
+		case invoice_iface.OweLimitOverrideState_OWE_LIMIT_OVERRIDE_STATE_EXPIRED:
+			return connect.NewError(connect.CodeFailedPrecondition, errors.New("override already expired"))
+		}
+
+		row.RevokedAt = &now
+		row.RevokedByID = &callerID
+		return tx.
+			Model(&invoice_models.OweLimitOverride{}).
+			Where("id = ?", row.ID).
+			Updates(map[string]interface{}{
+				"revoked_at":    now,
+				"revoked_by_id": callerID,
+			}).
+			Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return connect.NewResponse(&invoice_iface.OweLimitOverrideRevokeResponse{Override: toProtoOweLimitOverride(&row, now)}), nil
+}
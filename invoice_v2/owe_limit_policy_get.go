@@ -0,0 +1,56 @@
+package invoice_v2
+
+import (
+	"context"
+
+	"connectrpc.com/connect"
+	"github.com/pdcgo/invoice_service/invoice_models"
+	invoice_iface "github.com/pdcgo/schema/services/invoice_iface/v2"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// OweLimitPolicyGet implements [invoice_ifaceconnect.InvoiceServiceHandler]. It returns
+// the CREDITOR team's owe-limit evaluation opt-ins and alert levels; a team without a
+// policy has opted in to nothing.
+func (s *invoiceServiceImpl) OweLimitPolicyGet(
+	ctx context.Context,
+	req *connect.Request[invoice_iface.OweLimitPolicyGetRequest],
+) (*connect.Response[invoice_iface.OweLimitPolicyGetResponse], error) {
+	pay := req.Msg
+
+	policy := invoice_models.OweLimitPolicy{TeamID: pay.TeamId}
+	err := s.db.
+		WithContext(ctx).
+		Where("team_id = ?", pay.TeamId).
+		Limit(1).
+		Find(&policy).
+		Error
+	if err != nil {
+		return nil, err
+	}
+	out := toProtoOweLimitPolicy(&policy)
+	err = s.db.
+		WithContext(ctx).
+		Model(&invoice_models.OweLimitAlertLevel{}).
+		Where("team_id = ?", pay.TeamId).
+		Order("percent").
+		Pluck("percent", &out.AlertLevels).
+		Error
+	if err != nil {
+		return nil, err
+	}
+
+	return connect.NewResponse(&invoice_iface.OweLimitPolicyGetResponse{Policy: out}), nil
+}
+
+func toProtoOweLimitPolicy(p *invoice_models.OweLimitPolicy) *invoice_iface.OweLimitPolicy {
+	out := &invoice_iface.OweLimitPolicy{
+		TeamId:               p.TeamID,
+		CountPendingPayments: p.CountPendingPayments,
+		UpdatedById:          p.UpdatedByID,
+	}
+	if !p.UpdatedAt.IsZero() {
+		out.UpdatedAt = timestamppb.New(p.UpdatedAt)
+	}
+	return out
+}
@@ -0,0 +1,78 @@
+package invoice_v2
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"connectrpc.com/connect"
+	"github.com/pdcgo/invoice_service/invoice_models"
+	invoice_iface "github.com/pdcgo/schema/services/invoice_iface/v2"
+	"github.com/pdcgo/user_service/access_interceptors"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// OweLimitPolicySet implements [invoice_ifaceconnect.InvoiceServiceHandler]. It
+// upserts the CREDITOR team's owe-limit evaluation opt-ins: with
+// count_pending_payments, its debtors' pending payments already reduce their debt when
+// CheckOweLimit evaluates its limits (default and custom alike). alert_levels replaces
+// the warning levels, in percent of the threshold, at which its debtors' crossings are
+// alerted (see DispatchOweLimitAlerts); empty turns alerts off.
+func (s *invoiceServiceImpl) OweLimitPolicySet(
+	ctx context.Context,
+	req *connect.Request[invoice_iface.OweLimitPolicySetRequest],
+) (*connect.Response[invoice_iface.OweLimitPolicySetResponse], error) {
+	pay := req.Msg
+
+	if pay.TeamId == 0 {
+		return nil, connect.NewError(connect.CodeInvalidArgument, errors.New("team_id is required"))
+	}
+	if err := validateAlertLevels(pay.AlertLevels); err != nil {
+		return nil, connect.NewError(connect.CodeInvalidArgument, err)
+	}
+
+	caller, err := access_interceptors.GetIdentityFromCtx(ctx)
+	if err != nil {
+		return nil, connect.NewError(connect.CodeUnauthenticated, err)
+	}
+
+	now := time.Now()
+	row := invoice_models.OweLimitPolicy{
+		TeamID:               pay.TeamId,
+		CountPendingPayments: pay.CountPendingPayments,
+		UpdatedByID:          uint64(caller.IdentityId),
+		CreatedAt:            now,
+		UpdatedAt:            now,
+	}
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		touchOweLimitCreditor(tx, pay.TeamId)
+		err := tx.
+			Clauses(clause.OnConflict{
+				Columns:   []clause.Column{{Name: "team_id"}},
+				DoUpdates: clause.AssignmentColumns([]string{"count_pending_payments", "updated_by_id", "updated_at"}),
+			}).
+			Create(&row).
+			Error
+		if err != nil {
+			return err
+		}
+
+		err = tx.Where("team_id = ?", pay.TeamId).Delete(&invoice_models.OweLimitAlertLevel{}).Error
+		if err != nil || len(pay.AlertLevels) == 0 {
+			return err
+		}
+		levels := make([]invoice_models.OweLimitAlertLevel, len(pay.AlertLevels))
+		for i, l := range pay.AlertLevels {
+			levels[i] = invoice_models.OweLimitAlertLevel{TeamID: pay.TeamId, Percent: l}
+		}
+		return tx.Create(&levels).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	policy := toProtoOweLimitPolicy(&row)
+	policy.AlertLevels = sortedAlertLevels(pay.AlertLevels)
+	return connect.NewResponse(&invoice_iface.OweLimitPolicySetResponse{Policy: policy}), nil
+}
@@ -0,0 +1,64 @@
+package invoice_v2
+
+import (
+	"time"
+
+	"github.com/pdcgo/invoice_service/invoice_models"
+	invoice_iface "github.com/pdcgo/schema/services/invoice_iface/v2"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// softThresholdsOf maps each configuration id to its soft threshold; configurations
+// without one are absent.
+func softThresholdsOf(db *gorm.DB, configIDs []uint64) (map[uint64]float64, error) {
+	out := map[uint64]float64{}
+	if len(configIDs) == 0 {
+		return out, nil
+	}
+	var rows []invoice_models.OweLimitSoftThreshold
+	if err := db.Where("configuration_id IN ?", configIDs).Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	for _, r := range rows {
+		out[r.ConfigurationID] = r.SoftThreshold
+	}
+	return out, nil
+}
+
+// setSoftThreshold stores the soft threshold of a configuration, removing it when
+// soft is 0. exists says whether the configuration was there before.
+func setSoftThreshold(tx *gorm.DB, configID uint64, exists bool, soft float64, now time.Time) error {
+	if soft > 0 {
+		return tx.
+			Clauses(clause.OnConflict{
+				Columns:   []clause.Column{{Name: "configuration_id"}},
+				DoUpdates: clause.AssignmentColumns([]string{"soft_threshold", "updated_at"}),
+			}).
+			Create(&invoice_models.OweLimitSoftThreshold{ConfigurationID: configID, SoftThreshold: soft, UpdatedAt: now}).
+			Error
+	}
+	if !exists {
+		return nil
+	}
+	return tx.Where("configuration_id = ?", configID).Delete(&invoice_models.OweLimitSoftThreshold{}).Error
+}
+
+// oweLimitState is the state of an evaluated limit: BLOCKED when a condition failed,
+// WARN when the projected debt is over the soft threshold (by the same measure the
+// hard threshold uses), OK otherwise.
+func oweLimitState(allow *invoice_iface.OweLimitAllow) invoice_iface.OweLimitState {
+	if !allow.Allow {
+		return invoice_iface.OweLimitState_OWE_LIMIT_STATE_BLOCKED
+	}
+	if allow.SoftThreshold > 0 {
+		over := allow.ProjectedDebt >= allow.SoftThreshold
+		if allow.ProspectiveAmount > 0 {
+			over = allow.ProjectedDebt > allow.SoftThreshold
+		}
+		if over {
+			return invoice_iface.OweLimitState_OWE_LIMIT_STATE_WARN
+		}
+	}
+	return invoice_iface.OweLimitState_OWE_LIMIT_STATE_OK
+}
@@ -0,0 +1,132 @@
+package invoice_v2_test
+
+import (
+	"context"
+	"testing"
+
+	"connectrpc.com/connect"
+	"github.com/pdcgo/invoice_service/invoice_models"
+	"github.com/pdcgo/invoice_service/invoice_v2"
+	invoice_iface "github.com/pdcgo/schema/services/invoice_iface/v2"
+	role_base "github.com/pdcgo/schema/services/role_base/v1"
+	"github.com/pdcgo/shared/db_models"
+	"github.com/pdcgo/shared/pkg/moretest"
+	"github.com/pdcgo/shared/pkg/moretest/moretest_mock"
+	"github.com/pdcgo/user_service/access_interceptors"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func TestOweLimitSoftThreshold(t *testing.T) {
+	var scenario moretest_mock.DbScenario
+
+	moretest.Suite(t, "soft and hard owe limits",
+		moretest.SetupListFunc{
+			moretest_mock.MockPostgresDatabase(&scenario),
+		},
+		func(t *testing.T) {
+			scenario(t, func(tx *gorm.DB) {
+				assert.NoError(t, tx.AutoMigrate(
+					&invoice_models.TeamBalance{},
+					&db_models.OweLimitConfiguration{},
+					&invoice_models.OweLimitPolicy{},
+					&invoice_models.OweLimitOverride{},
+					&invoice_models.OweLimitAgeRule{},
+					&invoice_models.OweLimitSoftThreshold{},
+					&invoice_models.OweLimitTeamTypeRule{},
+					&invoice_models.OweLimitConfigurationHistory{},
+				))
+
+				const creditor, debtor = uint64(8), uint64(1)
+				pay := invoice_iface.BalanceType_BALANCE_TYPE_PAYABLE
+				assert.NoError(t, tx.Create(&invoice_models.TeamBalance{TeamID: debtor, ForTeamID: creditor, BalanceType: pay, Balance: -50}).Error)
+
+				svc := invoice_v2.NewInvoiceService(tx)
+				ctx := access_interceptors.SetIdentityToCtx(
+					context.Background(),
+					&role_base.Identity{IdentityId: uint32(callerID)},
+				)
+				setDefault := func(threshold, soft float64) error {
+					_, err := svc.OweLimitDefaultSet(ctx, connect.NewRequest(&invoice_iface.OweLimitDefaultSetRequest{
+						TeamId:        creditor,
+						Threshold:     threshold,
+						SoftThreshold: soft,
+					}))
+					return err
+				}
+				owe := func(debt float64) {
+					err := tx.Model(&invoice_models.TeamBalance{}).
+						Where("team_id = ? AND for_team_id = ?", debtor, creditor).
+						Update("balance", -debt).Error
+					assert.NoError(t, err)
+				}
+				check := func(prospective float64) *invoice_iface.OweLimitAllow {
+					res, err := invoice_v2.EvaluateOweLimitsQuery(tx, invoice_v2.OweLimitQuery{
+						DebtorTeamID:       debtor,
+						CreditorTeamIDs:    []uint64{creditor},
+						ProspectiveAmounts: map[uint64]float64{creditor: prospective},
+					})
+					assert.NoError(t, err)
+					return res[creditor]
+				}
+
+				t.Run("soft threshold must not exceed the hard one", func(t *testing.T) {
+					assert.Equal(t, connect.CodeInvalidArgument, connect.CodeOf(setDefault(100, 120)))
+					assert.Equal(t, connect.CodeInvalidArgument, connect.CodeOf(setDefault(100, -1)))
+				})
+
+				t.Run("ok, warn, blocked", func(t *testing.T) {
+					assert.NoError(t, setDefault(100, 80))
+					got, err := svc.OweLimitDefaultGet(ctx, connect.NewRequest(&invoice_iface.OweLimitDefaultGetRequest{TeamId: creditor}))
+					assert.NoError(t, err)
+					assert.Equal(t, float64(80), got.Msg.SoftThreshold)
+
+					res := check(0)
+					assert.Equal(t, invoice_iface.OweLimitState_OWE_LIMIT_STATE_OK, res.GetState())
+					assert.Equal(t, float64(80), res.SoftThreshold)
+
+					// the order lands exactly on the soft limit: still ok; one more is a warning.
+					assert.Equal(t, invoice_iface.OweLimitState_OWE_LIMIT_STATE_OK, check(30).GetState())
+					res = check(31)
+					assert.True(t, res.GetAllow())
+					assert.Equal(t, invoice_iface.OweLimitState_OWE_LIMIT_STATE_WARN, res.GetState())
+
+					owe(85)
+					res = check(0)
+					assert.True(t, res.GetAllow())
+					assert.Equal(t, invoice_iface.OweLimitState_OWE_LIMIT_STATE_WARN, res.GetState())
+
+					owe(100)
+					res = check(0)
+					assert.False(t, res.GetAllow())
+					assert.Equal(t, invoice_iface.OweLimitState_OWE_LIMIT_STATE_BLOCKED, res.GetState())
+				})
+
+				t.Run("a custom soft limit without a hard one only warns", func(t *testing.T) {
+					_, err := svc.OweLimitCustomSet(ctx, connect.NewRequest(&invoice_iface.OweLimitCustomSetRequest{
+						TeamId:        creditor,
+						ForTeamId:     debtor,
+						SoftThreshold: 80,
+					}))
+					assert.NoError(t, err)
+
+					owe(500)
+					res := check(0)
+					assert.Equal(t, invoice_iface.OweLimitRule_OWE_LIMIT_RULE_CUSTOM, res.GetRule())
+					assert.True(t, res.GetAllow())
+					assert.Equal(t, invoice_iface.OweLimitState_OWE_LIMIT_STATE_WARN, res.GetState())
+				})
+
+				t.Run("changes to the soft limit are recorded", func(t *testing.T) {
+					assert.NoError(t, setDefault(100, 90))
+
+					var h invoice_models.OweLimitConfigurationHistory
+					assert.NoError(t, tx.Where("is_default = ?", true).Order("id DESC").First(&h).Error)
+					assert.Equal(t, invoice_iface.OweLimitHistoryAction_OWE_LIMIT_HISTORY_ACTION_UPDATE, h.Action)
+					assert.Equal(t, float64(80), *h.OldSoftThreshold)
+					assert.Equal(t, float64(90), *h.NewSoftThreshold)
+				})
+			})
+		},
+	)
+}
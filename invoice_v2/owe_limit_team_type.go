@@ -0,0 +1,33 @@
+package invoice_v2
+
+import (
+	"errors"
+
+	"connectrpc.com/connect"
+	"github.com/pdcgo/invoice_service/invoice_models"
+	common "github.com/pdcgo/schema/services/common/v1"
+	invoice_iface "github.com/pdcgo/schema/services/invoice_iface/v2"
+	"github.com/pdcgo/shared/db_models"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// ruleTeamType is the teams.type a team-type rule is stored under. Only the types
+// TeamBalanceList filters by can carry a rule.
+func ruleTeamType(t common.TeamType) (string, error) {
+	typ := dbTeamType(t)
+	if typ == "" {
+		return "", connect.NewError(connect.CodeInvalidArgument, errors.New("team_type must be warehouse, selling or admin"))
+	}
+	return typ, nil
+}
+
+func toProtoOweLimitTeamTypeRule(r *invoice_models.OweLimitTeamTypeRule) *invoice_iface.OweLimitTeamTypeRule {
+	return &invoice_iface.OweLimitTeamTypeRule{
+		TeamType:      teamTypeToProto(db_models.TeamType(r.TeamType)),
+		Threshold:     r.Threshold,
+		SoftThreshold: r.SoftThreshold,
+		MaxAgeDays:    r.MaxAgeDays,
+		UpdatedById:   r.UpdatedByID,
+		UpdatedAt:     timestamppb.New(r.UpdatedAt),
+	}
+}
@@ -0,0 +1,69 @@
+package invoice_v2
+
+import (
+	"context"
+	"time"
+
+	"connectrpc.com/connect"
+	"github.com/pdcgo/invoice_service/invoice_models"
+	invoice_iface "github.com/pdcgo/schema/services/invoice_iface/v2"
+	"github.com/pdcgo/user_service/access_interceptors"
+	"gorm.io/gorm"
+)
+
+// OweLimitTeamTypeDelete implements [invoice_ifaceconnect.InvoiceServiceHandler]. It
+// removes the CREDITOR team's rule for debtors of team_type; they then fall back to the
+// creditor's default rule. The removed rule is recorded in the owe-limit history.
+// Deleting a rule that does not exist is a no-op.
+func (s *invoiceServiceImpl) OweLimitTeamTypeDelete(
+	ctx context.Context,
+	req *connect.Request[invoice_iface.OweLimitTeamTypeDeleteRequest],
+) (*connect.Response[invoice_iface.OweLimitTeamTypeDeleteResponse], error) {
+	pay := req.Msg
+	teamType, err := ruleTeamType(pay.TeamType)
+	if err != nil {
+		return nil, err
+	}
+
+	caller, err := access_interceptors.GetIdentityFromCtx(ctx)
+	if err != nil {
+		return nil, connect.NewError(connect.CodeUnauthenticated, err)
+	}
+	changedBy := uint64(caller.IdentityId)
+	now := time.Now()
+
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		touchOweLimitCreditor(tx, pay.TeamId)
+		var rule invoice_models.OweLimitTeamTypeRule
+		res := lockForUpdate(tx).
+			Where("team_id = ? AND team_type = ?", pay.TeamId, teamType).
+			Limit(1).
+			Find(&rule)
+		if res.Error != nil || res.RowsAffected == 0 {
+			return res.Error
+		}
+
+		err := tx.
+			Where("team_id = ? AND team_type = ?", pay.TeamId, teamType).
+			Delete(&invoice_models.OweLimitTeamTypeRule{}).
+			Error
+		if err != nil {
+			return err
+		}
+		return tx.Create(&invoice_models.OweLimitConfigurationHistory{
+			TeamID:           pay.TeamId,
+			TeamType:         teamType,
+			Action:           invoice_iface.OweLimitHistoryAction_OWE_LIMIT_HISTORY_ACTION_DELETE,
+			OldThreshold:     &rule.Threshold,
+			OldSoftThreshold: &rule.SoftThreshold,
+			OldMaxAgeDays:    &rule.MaxAgeDays,
+			ChangedByID:      changedBy,
+			ChangedAt:        now,
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return connect.NewResponse(&invoice_iface.OweLimitTeamTypeDeleteResponse{}), nil
+}
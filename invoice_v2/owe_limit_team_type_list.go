@@ -0,0 +1,37 @@
+package invoice_v2
+
+import (
+	"context"
+
+	"connectrpc.com/connect"
+	"github.com/pdcgo/invoice_service/invoice_models"
+	invoice_iface "github.com/pdcgo/schema/services/invoice_iface/v2"
+)
+
+// OweLimitTeamTypeList implements [invoice_ifaceconnect.InvoiceServiceHandler]. It
+// returns the CREDITOR team's team-type rules, ordered by team type.
+func (s *invoiceServiceImpl) OweLimitTeamTypeList(
+	ctx context.Context,
+	req *connect.Request[invoice_iface.OweLimitTeamTypeListRequest],
+) (*connect.Response[invoice_iface.OweLimitTeamTypeListResponse], error) {
+	pay := req.Msg
+
+	var rules []invoice_models.OweLimitTeamTypeRule
+	err := s.db.
+		WithContext(ctx).
+		Where("team_id = ?", pay.TeamId).
+		Order("team_type").
+		Find(&rules).
+		Error
+	if err != nil {
+		return nil, err
+	}
+
+	result := &invoice_iface.OweLimitTeamTypeListResponse{
+		Rules: make([]*invoice_iface.OweLimitTeamTypeRule, 0, len(rules)),
+	}
+	for i := range rules {
+		result.Rules = append(result.Rules, toProtoOweLimitTeamTypeRule(&rules[i]))
+	}
+	return connect.NewResponse(result), nil
+}
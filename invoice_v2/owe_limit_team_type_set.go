@@ -0,0 +1,94 @@
+package invoice_v2
+
+import (
+	"context"
+	"time"
+
+	"connectrpc.com/connect"
+	"github.com/pdcgo/invoice_service/invoice_models"
+	invoice_iface "github.com/pdcgo/schema/services/invoice_iface/v2"
+	"github.com/pdcgo/user_service/access_interceptors"
+	"gorm.io/gorm"
+)
+
+// OweLimitTeamTypeSet implements [invoice_ifaceconnect.InvoiceServiceHandler]. It upserts
+// the CREDITOR team's owe threshold (0 = unlimited), soft threshold (0 = none) and max
+// age of unsettled debt in days (0 = none) for every debtor of team_type — e.g. one
+// limit for selling teams and another for warehouses. The rule applies to debtors
+// without a custom row and beats the creditor's default. Each change is recorded, with
+// the caller, in the owe-limit history (see OweLimitHistory).
+func (s *invoiceServiceImpl) OweLimitTeamTypeSet(
+	ctx context.Context,
+	req *connect.Request[invoice_iface.OweLimitTeamTypeSetRequest],
+) (*connect.Response[invoice_iface.OweLimitTeamTypeSetResponse], error) {
+	pay := req.Msg
+	teamType, err := ruleTeamType(pay.TeamType)
+	if err != nil {
+		return nil, err
+	}
+	values := oweLimitValues{Threshold: pay.Threshold, SoftThreshold: pay.SoftThreshold, MaxAgeDays: pay.MaxAgeDays}
+	if err := values.validate(); err != nil {
+		return nil, connect.NewError(connect.CodeInvalidArgument, err)
+	}
+
+	caller, err := access_interceptors.GetIdentityFromCtx(ctx)
+	if err != nil {
+		return nil, connect.NewError(connect.CodeUnauthenticated, err)
+	}
+	changedBy := uint64(caller.IdentityId)
+	now := time.Now()
+
+	var rule invoice_models.OweLimitTeamTypeRule
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		touchOweLimitCreditor(tx, pay.TeamId)
+		res := lockForUpdate(tx).
+			Where("team_id = ? AND team_type = ?", pay.TeamId, teamType).
+			Limit(1).
+			Find(&rule)
+		if res.Error != nil {
+			return res.Error
+		}
+
+		h := &invoice_models.OweLimitConfigurationHistory{
+			TeamID:      pay.TeamId,
+			TeamType:    teamType,
+			Action:      invoice_iface.OweLimitHistoryAction_OWE_LIMIT_HISTORY_ACTION_CREATE,
+			ChangedByID: changedBy,
+			ChangedAt:   now,
+		}
+		if res.RowsAffected > 0 {
+			old := oweLimitValues{Threshold: rule.Threshold, SoftThreshold: rule.SoftThreshold, MaxAgeDays: rule.MaxAgeDays}
+			if old == values {
+				return nil
+			}
+			h.Action = invoice_iface.OweLimitHistoryAction_OWE_LIMIT_HISTORY_ACTION_UPDATE
+			h.OldThreshold = &old.Threshold
+			h.OldSoftThreshold = &old.SoftThreshold
+			h.OldMaxAgeDays = &old.MaxAgeDays
+		}
+
+		rule = invoice_models.OweLimitTeamTypeRule{
+			TeamID:        pay.TeamId,
+			TeamType:      teamType,
+			Threshold:     values.Threshold,
+			SoftThreshold: values.SoftThreshold,
+			MaxAgeDays:    values.MaxAgeDays,
+			UpdatedByID:   changedBy,
+			UpdatedAt:     now,
+		}
+		if err := tx.Save(&rule).Error; err != nil {
+			return err
+		}
+		h.NewThreshold = &rule.Threshold
+		h.NewSoftThreshold = &rule.SoftThreshold
+		h.NewMaxAgeDays = &rule.MaxAgeDays
+		return tx.Create(h).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return connect.NewResponse(&invoice_iface.OweLimitTeamTypeSetResponse{
+		Rule: toProtoOweLimitTeamTypeRule(&rule),
+	}), nil
+}
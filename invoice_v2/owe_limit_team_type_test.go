@@ -0,0 +1,137 @@
+package invoice_v2_test
+
+import (
+	"context"
+	"testing"
+
+	"connectrpc.com/connect"
+	"github.com/pdcgo/invoice_service/invoice_models"
+	"github.com/pdcgo/invoice_service/invoice_v2"
+	common "github.com/pdcgo/schema/services/common/v1"
+	invoice_iface "github.com/pdcgo/schema/services/invoice_iface/v2"
+	role_base "github.com/pdcgo/schema/services/role_base/v1"
+	"github.com/pdcgo/shared/db_models"
+	"github.com/pdcgo/shared/pkg/moretest"
+	"github.com/pdcgo/shared/pkg/moretest/moretest_mock"
+	"github.com/pdcgo/user_service/access_interceptors"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func TestOweLimitTeamType(t *testing.T) {
+	var scenario moretest_mock.DbScenario
+
+	moretest.Suite(t, "owe limits by team type",
+		moretest.SetupListFunc{
+			moretest_mock.MockPostgresDatabase(&scenario),
+		},
+		func(t *testing.T) {
+			scenario(t, func(tx *gorm.DB) {
+				assert.NoError(t, tx.AutoMigrate(
+					&invoice_models.TeamBalance{},
+					&db_models.OweLimitConfiguration{},
+					&invoice_models.OweLimitPolicy{},
+					&invoice_models.OweLimitOverride{},
+					&invoice_models.OweLimitAgeRule{},
+					&invoice_models.OweLimitSoftThreshold{},
+					&invoice_models.OweLimitTeamTypeRule{},
+					&invoice_models.OweLimitConfigurationHistory{},
+					&teamRow{},
+				))
+
+				const creditor = uint64(8) // a warehouse
+				assert.NoError(t, tx.Create(&[]teamRow{
+					{ID: 1, Name: "Seller", Type: db_models.SellingTeamType},
+					{ID: 2, Name: "Other warehouse", Type: db_models.WarehouseTeamType},
+					{ID: 3, Name: "Admin", Type: db_models.AdminTeamType},
+					{ID: 4, Name: "Trusted seller", Type: db_models.SellingTeamType},
+					{ID: 8, Name: "Warehouse", Type: db_models.WarehouseTeamType},
+				}).Error)
+				trusted := uint64(4)
+				assert.NoError(t, tx.Create(&[]*db_models.OweLimitConfiguration{
+					{TeamID: creditor, IsDefault: true, Threshold: 100},
+					{TeamID: creditor, ForTeamID: &trusted, Threshold: 20},
+					{TeamID: 9, IsDefault: true, Threshold: 100},
+				}).Error)
+
+				svc := invoice_v2.NewInvoiceService(tx)
+				ctx := access_interceptors.SetIdentityToCtx(
+					context.Background(),
+					&role_base.Identity{IdentityId: uint32(callerID)},
+				)
+				set := func(teamType common.TeamType, threshold float64) error {
+					_, err := svc.OweLimitTeamTypeSet(ctx, connect.NewRequest(&invoice_iface.OweLimitTeamTypeSetRequest{
+						TeamId:    creditor,
+						TeamType:  teamType,
+						Threshold: threshold,
+					}))
+					return err
+				}
+				eval := func(debtor uint64) map[uint64]*invoice_iface.OweLimitAllow {
+					res, err := invoice_v2.EvaluateOweLimits(tx, debtor, []uint64{creditor, 9})
+					assert.NoError(t, err)
+					return res
+				}
+
+				t.Run("set validates the team type", func(t *testing.T) {
+					err := set(common.TeamType(0), 300)
+					assert.Equal(t, connect.CodeInvalidArgument, connect.CodeOf(err))
+				})
+
+				t.Run("custom beats team type beats default", func(t *testing.T) {
+					assert.NoError(t, set(common.TeamType_TEAM_TYPE_SELLING, 300))
+					assert.NoError(t, set(common.TeamType_TEAM_TYPE_WAREHOUSE, 50))
+
+					res := eval(1)
+					assert.Equal(t, invoice_iface.OweLimitRule_OWE_LIMIT_RULE_TEAM_TYPE, res[creditor].GetRule())
+					assert.Equal(t, float64(300), res[creditor].GetThreshold())
+					assert.Equal(t, common.TeamType_TEAM_TYPE_SELLING, res[creditor].TeamType)
+					assert.Equal(t, invoice_iface.OweLimitRule_OWE_LIMIT_RULE_DEFAULT, res[9].GetRule())
+
+					res = eval(2)
+					assert.Equal(t, invoice_iface.OweLimitRule_OWE_LIMIT_RULE_TEAM_TYPE, res[creditor].GetRule())
+					assert.Equal(t, float64(50), res[creditor].GetThreshold())
+
+					res = eval(3)
+					assert.Equal(t, invoice_iface.OweLimitRule_OWE_LIMIT_RULE_DEFAULT, res[creditor].GetRule())
+					assert.Equal(t, float64(100), res[creditor].GetThreshold())
+
+					res = eval(trusted)
+					assert.Equal(t, invoice_iface.OweLimitRule_OWE_LIMIT_RULE_CUSTOM, res[creditor].GetRule())
+					assert.Equal(t, float64(20), res[creditor].GetThreshold())
+				})
+
+				t.Run("list and delete", func(t *testing.T) {
+					list, err := svc.OweLimitTeamTypeList(ctx, connect.NewRequest(&invoice_iface.OweLimitTeamTypeListRequest{TeamId: creditor}))
+					assert.NoError(t, err)
+					assert.Len(t, list.Msg.Rules, 2)
+
+					_, err = svc.OweLimitTeamTypeDelete(ctx, connect.NewRequest(&invoice_iface.OweLimitTeamTypeDeleteRequest{
+						TeamId:   creditor,
+						TeamType: common.TeamType_TEAM_TYPE_SELLING,
+					}))
+					assert.NoError(t, err)
+					assert.Equal(t, invoice_iface.OweLimitRule_OWE_LIMIT_RULE_DEFAULT, eval(1)[creditor].GetRule())
+				})
+
+				t.Run("changes are recorded in the history", func(t *testing.T) {
+					// setting the same values again records nothing
+					assert.NoError(t, set(common.TeamType_TEAM_TYPE_WAREHOUSE, 50))
+
+					var history []invoice_models.OweLimitConfigurationHistory
+					assert.NoError(t, tx.Order("id").Find(&history).Error)
+					var got []invoice_iface.OweLimitHistoryAction
+					for _, h := range history {
+						assert.NotEmpty(t, h.TeamType)
+						got = append(got, h.Action)
+					}
+					assert.Equal(t, []invoice_iface.OweLimitHistoryAction{
+						invoice_iface.OweLimitHistoryAction_OWE_LIMIT_HISTORY_ACTION_CREATE,
+						invoice_iface.OweLimitHistoryAction_OWE_LIMIT_HISTORY_ACTION_CREATE,
+						invoice_iface.OweLimitHistoryAction_OWE_LIMIT_HISTORY_ACTION_DELETE,
+					}, got)
+				})
+			})
+		},
+	)
+}
@@ -3,6 +3,7 @@ package invoice_v2
 import (
 	"errors"
 	"fmt"
+	"time"
 
 	"connectrpc.com/connect"
 	invoice_iface "github.com/pdcgo/schema/services/invoice_iface/v2"
@@ -12,7 +13,8 @@ import (
 )
 
 // loadPendingPayment locks the payment row, verifies it belongs to the
-// (teamID, forTeamID) pair, and requires it to be PENDING. Used by accept/reject.
+// (teamID, forTeamID) pair, and requires it to be PENDING. Used by accept/reject and
+// the payer's cancel/amend.
 func loadPendingPayment(tx *gorm.DB, paymentID, teamID, forTeamID uint64) (*invoice_models.InvoicePayment, error) {
 	var p invoice_models.InvoicePayment
 	err := lockForUpdate(tx).Where("id = ?", paymentID).First(&p).Error
@@ -31,6 +33,20 @@ func loadPendingPayment(tx *gorm.DB, paymentID, teamID, forTeamID uint64) (*invo
 	return &p, nil
 }
 
+// releasePending clears a pending payment's in-flight amount on both sides (the
+// payer's PAYABLE and the receiver's RECEIVABLE) without settling anything, for every
+// way a payment ends unpaid: rejected, canceled or expired. An acceptance still
+// awaiting approval is canceled with it.
+func releasePending(tx *gorm.DB, p *invoice_models.InvoicePayment, now time.Time) error {
+	if err := cancelPaymentApprovals(tx, p.ID, "payment no longer pending", now); err != nil {
+		return err
+	}
+	if err := adjustPending(tx, p.TeamID, p.ForTeamID, invoice_iface.BalanceType_BALANCE_TYPE_PAYABLE, -p.Amount, now); err != nil {
+		return err
+	}
+	return adjustPending(tx, p.ForTeamID, p.TeamID, invoice_iface.BalanceType_BALANCE_TYPE_RECEIVABLE, -p.Amount, now)
+}
+
 // toProtoPayment maps a stored Payment to its proto representation.
 func toProtoPayment(p *invoice_models.InvoicePayment) *invoice_iface.Payment {
 	out := &invoice_iface.Payment{
@@ -47,11 +63,31 @@ func toProtoPayment(p *invoice_models.InvoicePayment) *invoice_iface.Payment {
 	if p.CompletedByID != nil {
 		out.CompletedById = *p.CompletedByID
 	}
+	if p.AcceptedAmount != nil {
+		out.AcceptedAmount = *p.AcceptedAmount
+		out.PartialReason = p.PartialReason
+	}
 	if p.AcceptedAt != nil {
 		out.AcceptedAt = timestamppb.New(*p.AcceptedAt)
 	}
 	if p.RejectedAt != nil {
 		out.RejectedAt = timestamppb.New(*p.RejectedAt)
 	}
+	if p.CanceledAt != nil {
+		out.CanceledAt = timestamppb.New(*p.CanceledAt)
+	}
+	if p.ReversedAt != nil {
+		out.ReversedAt = timestamppb.New(*p.ReversedAt)
+		out.ReversalReason = p.ReversalReason
+	}
+	if p.ExpiredAt != nil {
+		out.ExpiredAt = timestamppb.New(*p.ExpiredAt)
+	}
+	if p.ReversedByID != nil {
+		out.ReversedById = *p.ReversedByID
+	}
+	if p.BulkPaymentID != nil {
+		out.BulkPaymentId = *p.BulkPaymentID
+	}
 	return out
 }
@@ -0,0 +1,61 @@
+package invoice_v2
+
+import (
+	"context"
+	"errors"
+
+	"connectrpc.com/connect"
+	"github.com/pdcgo/invoice_service/invoice_models"
+	invoice_iface "github.com/pdcgo/schema/services/invoice_iface/v2"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// PaymentAmendmentList implements [invoice_ifaceconnect.InvoiceServiceHandler]. It
+// returns the payer's amendments of a payment, oldest first, for either side of the
+// (team_id, for_team_id) pair to review.
+func (s *invoiceServiceImpl) PaymentAmendmentList(
+	ctx context.Context,
+	req *connect.Request[invoice_iface.PaymentAmendmentListRequest],
+) (*connect.Response[invoice_iface.PaymentAmendmentListResponse], error) {
+	pay := req.Msg
+	db := s.db.WithContext(ctx)
+
+	var owner int64
+	err := db.
+		Model(&invoice_models.InvoicePayment{}).
+		Where("id = ? AND team_id = ? AND for_team_id = ?", pay.PaymentId, pay.TeamId, pay.ForTeamId).
+		Count(&owner).
+		Error
+	if err != nil {
+		return nil, err
+	}
+	if owner == 0 {
+		return nil, connect.NewError(connect.CodeNotFound, errors.New("payment not found"))
+	}
+
+	var rows []*invoice_models.InvoicePaymentAmendment
+	if err := db.Where("payment_id = ?", pay.PaymentId).Order("id").Find(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	result := &invoice_iface.PaymentAmendmentListResponse{
+		Items: make([]*invoice_iface.PaymentAmendment, 0, len(rows)),
+	}
+	for _, row := range rows {
+		result.Items = append(result.Items, &invoice_iface.PaymentAmendment{
+			Id:                 row.ID,
+			PaymentId:          row.PaymentID,
+			PreviousAmount:     row.PreviousAmount,
+			NewAmount:          row.NewAmount,
+			PreviousDocumentId: row.PreviousDocumentID,
+			NewDocumentId:      row.NewDocumentID,
+			PreviousNote:       row.PreviousNote,
+			NewNote:            row.NewNote,
+			Reason:             row.Reason,
+			AmendedById:        row.AmendedByID,
+			CreatedAt:          timestamppb.New(row.CreatedAt),
+		})
+	}
+
+	return connect.NewResponse(result), nil
+}
@@ -0,0 +1,154 @@
+package invoice_v2
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/pdcgo/invoice_service/invoice_models"
+	invoice_iface "github.com/pdcgo/schema/services/invoice_iface/v2"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"gorm.io/gorm"
+)
+
+// SystemActorID is the identity recorded as completer of changes made by background
+// jobs (e.g. payment expiry) rather than by a user.
+const SystemActorID uint64 = 0
+
+// PaymentReminder tells a creditor team that a payment made to it is about to expire
+// unanswered.
+type PaymentReminder interface {
+	RemindPayment(ctx context.Context, p *invoice_models.InvoicePayment, expiresAt time.Time) error
+}
+
+// PaymentExpiryResult reports what a sweep did. Failed counts payments whose expiry or
+// reminder failed; they are retried by the next sweep.
+type PaymentExpiryResult struct {
+	Expired  int
+	Reminded int
+	Failed   int
+}
+
+// ExpirePendingPayments is the payment expiry sweeper. Every PENDING payment older than
+// its creditor's expire_after_days (InvoicePaymentExpiryConfig of for_team_id) is moved
+// to EXPIRED with its in-flight amount released like a rejection, completed by
+// SystemActorID. Payments within remind_before_days of expiry are reminded once through
+// reminder (nil sends none). Each payment is handled in its own short transaction, so
+// the sweep is safe to run on a schedule next to live traffic.
+func ExpirePendingPayments(
+	ctx context.Context,
+	db *gorm.DB,
+	reminder PaymentReminder,
+	now time.Time,
+) (*PaymentExpiryResult, error) {
+	result := &PaymentExpiryResult{}
+	db = db.WithContext(ctx)
+	var firstErr error
+	fail := func(err error) {
+		result.Failed++
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	var overdue []uint64
+	err := db.
+		Table("invoice_payments p").
+		Joins("JOIN invoice_payment_expiry_configs c ON c.team_id = p.for_team_id").
+		Where("p.status = ? AND c.expire_after_days > 0", invoice_iface.PaymentStatus_PAYMENT_STATUS_PENDING).
+		Where("p.created_at + c.expire_after_days * INTERVAL '1 day' <= ?", now).
+		Order("p.id").
+		Pluck("p.id", &overdue).Error
+	if err != nil {
+		return result, err
+	}
+	for _, id := range overdue {
+		expired, err := expirePayment(db, id, now)
+		if err != nil {
+			fail(err)
+			continue
+		}
+		if expired {
+			result.Expired++
+		}
+	}
+
+	if reminder != nil {
+		var due []struct {
+			invoice_models.InvoicePayment
+			ExpireAfterDays int
+		}
+		err = db.
+			Table("invoice_payments p").
+			Joins("JOIN invoice_payment_expiry_configs c ON c.team_id = p.for_team_id").
+			Select("p.*, c.expire_after_days").
+			Where("p.status = ? AND p.reminded_at IS NULL", invoice_iface.PaymentStatus_PAYMENT_STATUS_PENDING).
+			Where("c.expire_after_days > 0 AND c.remind_before_days > 0").
+			Where("p.created_at + (c.expire_after_days - c.remind_before_days) * INTERVAL '1 day' <= ?", now).
+			Order("p.id").
+			Scan(&due).Error
+		if err != nil {
+			return result, err
+		}
+		for i := range due {
+			p := &due[i].InvoicePayment
+			if err := reminder.RemindPayment(ctx, p, p.CreatedAt.AddDate(0, 0, due[i].ExpireAfterDays)); err != nil {
+				fail(err)
+				continue
+			}
+			err := db.Model(&invoice_models.InvoicePayment{}).
+				Where("id = ? AND reminded_at IS NULL", p.ID).
+				Update("reminded_at", now).Error
+			if err != nil {
+				fail(err)
+				continue
+			}
+			result.Reminded++
+		}
+	}
+
+	if firstErr != nil {
+		return result, fmt.Errorf("%d payment(s) failed: %w", result.Failed, firstErr)
+	}
+	return result, nil
+}
+
+// expirePayment expires one payment if it is still PENDING (it may have been answered
+// since the sweep listed it).
+func expirePayment(db *gorm.DB, paymentID uint64, now time.Time) (bool, error) {
+	expired := false
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var p invoice_models.InvoicePayment
+		res := lockForUpdate(tx).
+			Where("id = ? AND status = ?", paymentID, invoice_iface.PaymentStatus_PAYMENT_STATUS_PENDING).
+			Limit(1).
+			Find(&p)
+		if res.Error != nil || res.RowsAffected == 0 {
+			return res.Error
+		}
+
+		if err := releasePending(tx, &p, now); err != nil {
+			return err
+		}
+		expired = true
+		return tx.Model(&invoice_models.InvoicePayment{}).
+			Where("id = ?", p.ID).
+			Updates(map[string]interface{}{
+				"status":          invoice_iface.PaymentStatus_PAYMENT_STATUS_EXPIRED,
+				"expired_at":      now,
+				"completed_by_id": SystemActorID,
+				"updated_at":      now,
+			}).Error
+	})
+	return expired, err
+}
+
+func toProtoPaymentExpiryConfig(c *invoice_models.InvoicePaymentExpiryConfig) *invoice_iface.PaymentExpiryConfig {
+	return &invoice_iface.PaymentExpiryConfig{
+		TeamId:           c.TeamID,
+		ExpireAfterDays:  int64(c.ExpireAfterDays),
+		RemindBeforeDays: int64(c.RemindBeforeDays),
+		UpdatedById:      c.UpdatedByID,
+		UpdatedAt:        timestamppb.New(c.UpdatedAt),
+	}
+}
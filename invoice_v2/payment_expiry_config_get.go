@@ -0,0 +1,35 @@
+package invoice_v2
+
+import (
+	"context"
+
+	"connectrpc.com/connect"
+	"github.com/pdcgo/invoice_service/invoice_models"
+	invoice_iface "github.com/pdcgo/schema/services/invoice_iface/v2"
+)
+
+// PaymentExpiryConfigGet implements [invoice_ifaceconnect.InvoiceServiceHandler]. It
+// returns the CREDITOR team's payment expiry policy; config is empty when the team has
+// none (its pending payments never expire).
+func (s *invoiceServiceImpl) PaymentExpiryConfigGet(
+	ctx context.Context,
+	req *connect.Request[invoice_iface.PaymentExpiryConfigGetRequest],
+) (*connect.Response[invoice_iface.PaymentExpiryConfigGetResponse], error) {
+	pay := req.Msg
+
+	var cfg invoice_models.InvoicePaymentExpiryConfig
+	res := s.db.
+		WithContext(ctx).
+		Where("team_id = ?", pay.TeamId).
+		Limit(1).
+		Find(&cfg)
+	if res.Error != nil {
+		return nil, res.Error
+	}
+
+	resp := &invoice_iface.PaymentExpiryConfigGetResponse{}
+	if res.RowsAffected > 0 {
+		resp.Config = toProtoPaymentExpiryConfig(&cfg)
+	}
+	return connect.NewResponse(resp), nil
+}
@@ -0,0 +1,62 @@
+package invoice_v2
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"connectrpc.com/connect"
+	"github.com/pdcgo/invoice_service/invoice_models"
+	invoice_iface "github.com/pdcgo/schema/services/invoice_iface/v2"
+	"github.com/pdcgo/user_service/access_interceptors"
+	"gorm.io/gorm/clause"
+)
+
+// PaymentExpiryConfigSet implements [invoice_ifaceconnect.InvoiceServiceHandler]. It
+// upserts the CREDITOR team's expiry policy for payments made to it: expire_after_days
+// (0 disables expiry) and remind_before_days (0 sends no reminder). The sweeper applies
+// it to payments already pending as well.
+func (s *invoiceServiceImpl) PaymentExpiryConfigSet(
+	ctx context.Context,
+	req *connect.Request[invoice_iface.PaymentExpiryConfigSetRequest],
+) (*connect.Response[invoice_iface.PaymentExpiryConfigSetResponse], error) {
+	pay := req.Msg
+
+	if pay.TeamId == 0 {
+		return nil, connect.NewError(connect.CodeInvalidArgument, errors.New("team_id is required"))
+	}
+	if pay.ExpireAfterDays < 0 || pay.RemindBeforeDays < 0 {
+		return nil, connect.NewError(connect.CodeInvalidArgument, errors.New("expire_after_days and remind_before_days must not be negative"))
+	}
+	if pay.RemindBeforeDays > 0 && pay.RemindBeforeDays >= pay.ExpireAfterDays {
+		return nil, connect.NewError(connect.CodeInvalidArgument, errors.New("remind_before_days must be less than expire_after_days"))
+	}
+
+	caller, err := access_interceptors.GetIdentityFromCtx(ctx)
+	if err != nil {
+		return nil, connect.NewError(connect.CodeUnauthenticated, err)
+	}
+
+	now := time.Now()
+	row := invoice_models.InvoicePaymentExpiryConfig{
+		TeamID:           pay.TeamId,
+		ExpireAfterDays:  int(pay.ExpireAfterDays),
+		RemindBeforeDays: int(pay.RemindBeforeDays),
+		UpdatedByID:      uint64(caller.IdentityId),
+		CreatedAt:        now,
+		UpdatedAt:        now,
+	}
+	err = s.db.
+		WithContext(ctx).
+		Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "team_id"}},
+			DoUpdates: clause.AssignmentColumns([]string{"expire_after_days", "remind_before_days", "updated_by_id", "updated_at"}),
+		}).
+		Create(&row).
+		Error
+	if err != nil {
+		return nil, err
+	}
+
+	return connect.NewResponse(&invoice_iface.PaymentExpiryConfigSetResponse{Config: toProtoPaymentExpiryConfig(&row)}), nil
+}
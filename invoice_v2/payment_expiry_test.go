@@ -0,0 +1,136 @@
+package invoice_v2_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"connectrpc.com/connect"
+	"github.com/pdcgo/invoice_service/invoice_models"
+	"github.com/pdcgo/invoice_service/invoice_v2"
+	invoice_iface "github.com/pdcgo/schema/services/invoice_iface/v2"
+	role_base "github.com/pdcgo/schema/services/role_base/v1"
+	"github.com/pdcgo/shared/pkg/moretest"
+	"github.com/pdcgo/shared/pkg/moretest/moretest_mock"
+	"github.com/pdcgo/user_service/access_interceptors"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+type recordingReminder struct {
+	reminded []uint64
+}
+
+func (r *recordingReminder) RemindPayment(ctx context.Context, p *invoice_models.InvoicePayment, expiresAt time.Time) error {
+	r.reminded = append(r.reminded, p.ID)
+	return nil
+}
+
+func TestExpirePendingPayments(t *testing.T) {
+	var scenario moretest_mock.DbScenario
+
+	moretest.Suite(t, "expire pending payments",
+		moretest.SetupListFunc{
+			moretest_mock.MockPostgresDatabase(&scenario),
+		},
+		func(t *testing.T) {
+			scenario(t, func(tx *gorm.DB) {
+				assert.NoError(t, tx.AutoMigrate(
+					&invoice_models.InvoicePayment{},
+					&invoice_models.InvoicePaymentSelection{},
+					&invoice_models.InvoicePaymentExpiryConfig{},
+					&invoice_models.TeamBalance{},
+					&invoice_models.InvoiceApprovalPolicy{},
+					&invoice_models.InvoiceApproval{},
+				))
+
+				svc := invoice_v2.NewInvoiceService(tx)
+				ctx := access_interceptors.SetIdentityToCtx(
+					context.Background(),
+					&role_base.Identity{IdentityId: 7},
+				)
+				now := time.Now()
+
+				// team 2 expires payments after 10 days and reminds 3 days before; team 3 never.
+				_, err := svc.PaymentExpiryConfigSet(ctx, connect.NewRequest(&invoice_iface.PaymentExpiryConfigSetRequest{
+					TeamId: 2, ExpireAfterDays: 10, RemindBeforeDays: 3,
+				}))
+				assert.NoError(t, err)
+
+				create := func(receiver uint64, age time.Duration) uint64 {
+					res, err := svc.CreatePayment(ctx, connect.NewRequest(&invoice_iface.CreatePaymentRequest{
+						TeamId: 1, ForTeamId: receiver, Amount: 30,
+					}))
+					assert.NoError(t, err)
+					assert.NoError(t, tx.Model(&invoice_models.InvoicePayment{}).
+						Where("id = ?", res.Msg.Id).
+						Update("created_at", now.Add(-age)).Error)
+					return res.Msg.Id
+				}
+				day := 24 * time.Hour
+				stale := create(2, 11*day)
+				soon := create(2, 8*day)
+				fresh := create(2, day)
+				noPolicy := create(3, 100*day)
+
+				statusOf := func(id uint64) invoice_models.InvoicePayment {
+					var p invoice_models.InvoicePayment
+					assert.NoError(t, tx.First(&p, id).Error)
+					return p
+				}
+
+				t.Run("invalid config rejected", func(t *testing.T) {
+					_, err := svc.PaymentExpiryConfigSet(ctx, connect.NewRequest(&invoice_iface.PaymentExpiryConfigSetRequest{
+						TeamId: 2, ExpireAfterDays: 5, RemindBeforeDays: 5,
+					}))
+					assert.Equal(t, connect.CodeInvalidArgument, connect.CodeOf(err))
+
+					got, err := svc.PaymentExpiryConfigGet(ctx, connect.NewRequest(&invoice_iface.PaymentExpiryConfigGetRequest{TeamId: 2}))
+					assert.NoError(t, err)
+					assert.Equal(t, int64(10), got.Msg.GetConfig().ExpireAfterDays)
+				})
+
+				reminder := &recordingReminder{}
+				t.Run("sweep expires overdue and reminds the ones about to expire", func(t *testing.T) {
+					res, err := invoice_v2.ExpirePendingPayments(context.Background(), tx, reminder, now)
+					assert.NoError(t, err)
+					assert.Equal(t, 1, res.Expired)
+					assert.Equal(t, 1, res.Reminded)
+					assert.Equal(t, []uint64{soon}, reminder.reminded)
+
+					p := statusOf(stale)
+					assert.Equal(t, invoice_iface.PaymentStatus_PAYMENT_STATUS_EXPIRED, p.Status)
+					assert.NotNil(t, p.ExpiredAt)
+					if assert.NotNil(t, p.CompletedByID) {
+						assert.Equal(t, invoice_v2.SystemActorID, *p.CompletedByID)
+					}
+					assert.Equal(t, pending, statusOf(fresh).Status)
+					assert.Equal(t, pending, statusOf(noPolicy).Status)
+
+					// only the three remaining pending payments are still in flight.
+					var pyb invoice_models.TeamBalance
+					assert.NoError(t, tx.Where("team_id = 1 AND for_team_id = 2 AND balance_type = ?", payable).First(&pyb).Error)
+					assert.Equal(t, float64(60), pyb.PendingPaymentAmount)
+					var rcv invoice_models.TeamBalance
+					assert.NoError(t, tx.Where("team_id = 2 AND for_team_id = 1 AND balance_type = ?", receivable).First(&rcv).Error)
+					assert.Equal(t, float64(60), rcv.PendingPaymentAmount)
+				})
+
+				t.Run("second sweep does not remind again", func(t *testing.T) {
+					res, err := invoice_v2.ExpirePendingPayments(context.Background(), tx, reminder, now)
+					assert.NoError(t, err)
+					assert.Equal(t, 0, res.Expired)
+					assert.Equal(t, 0, res.Reminded)
+					assert.Len(t, reminder.reminded, 1)
+				})
+
+				t.Run("expired payment can no longer be accepted", func(t *testing.T) {
+					_, err := svc.AcceptPayment(ctx, connect.NewRequest(&invoice_iface.AcceptPaymentRequest{
+						TeamId: 1, ForTeamId: 2, PaymentId: stale,
+					}))
+					assert.Equal(t, connect.CodeFailedPrecondition, connect.CodeOf(err))
+				})
+			})
+		},
+	)
+}
@@ -38,9 +38,17 @@ func TestPayment(t *testing.T) {
 			scenario(t, func(tx *gorm.DB) {
 				assert.NoError(t, tx.AutoMigrate(
 					&invoice_models.InvoicePayment{},
+					&invoice_models.InvoicePaymentAmendment{},
+					&invoice_models.InvoicePaymentSelection{},
 					&invoice_models.TeamBalance{},
 					&invoice_models.BalanceChangeLog{},
+					&invoice_models.OweLimitAlertLevel{},
+					&invoice_models.BalanceOpenItem{},
+					&invoice_models.BalanceOpenItemAllocation{},
+					&invoice_models.BalanceChangePaymentSource{},
 					&invoice_models.TeamBalanceDailyLog{},
+					&invoice_models.InvoiceApprovalPolicy{},
+					&invoice_models.InvoiceApproval{},
 				))
 
 				svc := invoice_v2.NewInvoiceService(tx)
@@ -305,6 +313,199 @@ func TestPayment(t *testing.T) {
 					assert.NoError(t, err)
 					assert.Len(t, inc.Msg.Payments, 2)
 				})
+
+				t.Run("partial accept: settles the confirmed amount, releases the full pending", func(t *testing.T) {
+					// seed: payer 30 owes receiver 31 by 50 -> PAYABLE(30,31) = -50.
+					_, err := svc.CreateBalanceLog(ctx, connect.NewRequest(&invoice_iface.CreateBalanceLogRequest{
+						TeamId:       31,
+						ForTeamId:    30,
+						ChangeType:   invoice_iface.BalanceChangeType_BALANCE_CHANGE_TYPE_ADJUSTMENT,
+						ChangeAmount: 50,
+						BalanceType:  receivable,
+					}))
+					assert.NoError(t, err)
+
+					id := create(30, 31) // 30 submitted
+
+					for _, bad := range []*invoice_iface.AcceptPaymentPartialRequest{
+						{TeamId: 30, ForTeamId: 31, PaymentId: id, AcceptedAmount: 31, Reason: "r"}, // above requested
+						{TeamId: 30, ForTeamId: 31, PaymentId: id, AcceptedAmount: 25},              // short without reason
+						{TeamId: 30, ForTeamId: 31, PaymentId: id, AcceptedAmount: 0, Reason: "r"},  // nothing accepted
+					} {
+						_, err := svc.AcceptPaymentPartial(ctx, connect.NewRequest(bad))
+						assert.Equal(t, connect.CodeInvalidArgument, connect.CodeOf(err))
+					}
+
+					res, err := svc.AcceptPaymentPartial(ctx, connect.NewRequest(&invoice_iface.AcceptPaymentPartialRequest{
+						TeamId: 30, ForTeamId: 31, PaymentId: id, AcceptedAmount: 25, Reason: "bank charges",
+					}))
+					assert.NoError(t, err)
+					out := res.Msg.GetPayment()
+					assert.Equal(t, invoice_iface.PaymentStatus_PAYMENT_STATUS_PARTIALLY_ACCEPTED, out.Status)
+					assert.Equal(t, float64(30), out.Amount)
+					assert.Equal(t, float64(25), out.AcceptedAmount)
+					assert.Equal(t, "bank charges", out.PartialReason)
+
+					// 25 of the 50 debt settled; nothing left pending.
+					pyb, _ := balanceOf(30, 31, payable)
+					assert.Equal(t, float64(-25), pyb.Balance)
+					assert.Equal(t, float64(0), pyb.PendingPaymentAmount)
+					rcv, _ := balanceOf(31, 30, receivable)
+					assert.Equal(t, float64(25), rcv.Balance)
+					assert.Equal(t, float64(0), rcv.PendingPaymentAmount)
+
+					_, err = svc.AcceptPayment(ctx, connect.NewRequest(&invoice_iface.AcceptPaymentRequest{
+						TeamId: 30, ForTeamId: 31, PaymentId: id,
+					}))
+					assert.Equal(t, connect.CodeFailedPrecondition, connect.CodeOf(err))
+				})
+
+				t.Run("amend: pending follows the amount, history kept", func(t *testing.T) {
+					id := create(40, 41) // 30
+
+					res, err := svc.AmendPayment(ctx, connect.NewRequest(&invoice_iface.AmendPaymentRequest{
+						TeamId: 40, ForTeamId: 41, PaymentId: id, Amount: 45, DocumentId: "doc-2", Note: "n", Reason: "typo",
+					}))
+					assert.NoError(t, err)
+					assert.Equal(t, float64(45), res.Msg.GetPayment().Amount)
+
+					pyb, _ := balanceOf(40, 41, payable)
+					assert.Equal(t, float64(45), pyb.PendingPaymentAmount)
+					rcv, _ := balanceOf(41, 40, receivable)
+					assert.Equal(t, float64(45), rcv.PendingPaymentAmount)
+
+					// unchanged amendment rejected; the receiver cannot amend.
+					_, err = svc.AmendPayment(ctx, connect.NewRequest(&invoice_iface.AmendPaymentRequest{
+						TeamId: 40, ForTeamId: 41, PaymentId: id, Amount: 45, DocumentId: "doc-2", Note: "n",
+					}))
+					assert.Equal(t, connect.CodeInvalidArgument, connect.CodeOf(err))
+					_, err = svc.AmendPayment(ctx, connect.NewRequest(&invoice_iface.AmendPaymentRequest{
+						TeamId: 41, ForTeamId: 40, PaymentId: id, Amount: 1,
+					}))
+					assert.Equal(t, connect.CodeInvalidArgument, connect.CodeOf(err))
+
+					hist, err := svc.PaymentAmendmentList(ctx, connect.NewRequest(&invoice_iface.PaymentAmendmentListRequest{
+						TeamId: 40, ForTeamId: 41, PaymentId: id,
+					}))
+					assert.NoError(t, err)
+					if assert.Len(t, hist.Msg.GetItems(), 1) {
+						h := hist.Msg.GetItems()[0]
+						assert.Equal(t, float64(30), h.PreviousAmount)
+						assert.Equal(t, float64(45), h.NewAmount)
+						assert.Equal(t, "doc", h.PreviousDocumentId)
+						assert.Equal(t, "doc-2", h.NewDocumentId)
+						assert.Equal(t, "typo", h.Reason)
+					}
+
+					t.Run("cancel: releases pending, no settlement", func(t *testing.T) {
+						_, err := svc.CancelPayment(ctx, connect.NewRequest(&invoice_iface.CancelPaymentRequest{
+							TeamId: 40, ForTeamId: 41, PaymentId: id,
+						}))
+						assert.NoError(t, err)
+
+						pyb, _ := balanceOf(40, 41, payable)
+						assert.Equal(t, float64(0), pyb.PendingPaymentAmount)
+						assert.Equal(t, float64(0), pyb.Balance)
+						rcv, _ := balanceOf(41, 40, receivable)
+						assert.Equal(t, float64(0), rcv.PendingPaymentAmount)
+
+						var p invoice_models.InvoicePayment
+						assert.NoError(t, tx.First(&p, id).Error)
+						assert.Equal(t, invoice_iface.PaymentStatus_PAYMENT_STATUS_CANCELED, p.Status)
+						assert.NotNil(t, p.CanceledAt)
+
+						_, err = svc.AcceptPayment(ctx, connect.NewRequest(&invoice_iface.AcceptPaymentRequest{
+							TeamId: 40, ForTeamId: 41, PaymentId: id,
+						}))
+						assert.Equal(t, connect.CodeFailedPrecondition, connect.CodeOf(err))
+					})
+				})
+
+				t.Run("partial accept of the full amount is a plain accept", func(t *testing.T) {
+					id := create(32, 33)
+					res, err := svc.AcceptPaymentPartial(ctx, connect.NewRequest(&invoice_iface.AcceptPaymentPartialRequest{
+						TeamId: 32, ForTeamId: 33, PaymentId: id, AcceptedAmount: 30,
+					}))
+					assert.NoError(t, err)
+					assert.Equal(t, accepted, res.Msg.GetPayment().Status)
+
+					// no debt: the whole payment is an overpayment credit.
+					credit, _ := balanceOf(32, 33, receivable)
+					assert.Equal(t, float64(30), credit.Balance)
+				})
+
+				t.Run("reverse: undoes settlement and credit exactly", func(t *testing.T) {
+					// seed: payer 50 owes receiver 51 by 30 -> PAYABLE(50,51) = -30.
+					_, err := svc.CreateBalanceLog(ctx, connect.NewRequest(&invoice_iface.CreateBalanceLogRequest{
+						TeamId:       51,
+						ForTeamId:    50,
+						ChangeType:   invoice_iface.BalanceChangeType_BALANCE_CHANGE_TYPE_ADJUSTMENT,
+						ChangeAmount: 30,
+						BalanceType:  receivable,
+					}))
+					assert.NoError(t, err)
+
+					// 100 against the 30 debt: 30 settled, 70 credited.
+					res, err := svc.CreatePayment(ctx, connect.NewRequest(&invoice_iface.CreatePaymentRequest{
+						TeamId: 50, ForTeamId: 51, Amount: 100, Note: "n",
+					}))
+					assert.NoError(t, err)
+					id := res.Msg.Id
+					_, err = svc.AcceptPayment(ctx, connect.NewRequest(&invoice_iface.AcceptPaymentRequest{
+						TeamId: 50, ForTeamId: 51, PaymentId: id,
+					}))
+					assert.NoError(t, err)
+
+					var linked int64
+					assert.NoError(t, tx.Model(&invoice_models.BalanceChangePaymentSource{}).
+						Where("payment_id = ? AND NOT reversal", id).Count(&linked).Error)
+					assert.Equal(t, int64(4), linked)
+
+					t.Run("reason required", func(t *testing.T) {
+						_, err := svc.ReversePayment(ctx, connect.NewRequest(&invoice_iface.ReversePaymentRequest{
+							TeamId: 50, ForTeamId: 51, PaymentId: id,
+						}))
+						assert.Equal(t, connect.CodeInvalidArgument, connect.CodeOf(err))
+					})
+
+					rev, err := svc.ReversePayment(ctx, connect.NewRequest(&invoice_iface.ReversePaymentRequest{
+						TeamId: 50, ForTeamId: 51, PaymentId: id, Reason: "transfer bounced",
+					}))
+					assert.NoError(t, err)
+					assert.Equal(t, invoice_iface.PaymentStatus_PAYMENT_STATUS_REVERSED, rev.Msg.GetPayment().Status)
+					assert.Equal(t, "transfer bounced", rev.Msg.GetPayment().ReversalReason)
+					assert.Equal(t, uint64(7), rev.Msg.GetPayment().ReversedById)
+
+					// back to the pre-acceptance position: the debt is owed again, no credit.
+					pyb, _ := balanceOf(50, 51, payable)
+					assert.Equal(t, float64(-30), pyb.Balance)
+					rcv, _ := balanceOf(51, 50, receivable)
+					assert.Equal(t, float64(30), rcv.Balance)
+					credit, _ := balanceOf(50, 51, receivable)
+					assert.Equal(t, float64(0), credit.Balance)
+					mirror, _ := balanceOf(51, 50, payable)
+					assert.Equal(t, float64(0), mirror.Balance)
+
+					var reversal int64
+					assert.NoError(t, tx.Model(&invoice_models.BalanceChangePaymentSource{}).
+						Where("payment_id = ? AND reversal", id).Count(&reversal).Error)
+					assert.Equal(t, int64(4), reversal)
+
+					t.Run("double reverse rejected", func(t *testing.T) {
+						_, err := svc.ReversePayment(ctx, connect.NewRequest(&invoice_iface.ReversePaymentRequest{
+							TeamId: 50, ForTeamId: 51, PaymentId: id, Reason: "again",
+						}))
+						assert.Equal(t, connect.CodeFailedPrecondition, connect.CodeOf(err))
+					})
+				})
+
+				t.Run("reverse of a pending payment rejected", func(t *testing.T) {
+					id := create(52, 53)
+					_, err := svc.ReversePayment(ctx, connect.NewRequest(&invoice_iface.ReversePaymentRequest{
+						TeamId: 52, ForTeamId: 53, PaymentId: id, Reason: "r",
+					}))
+					assert.Equal(t, connect.CodeFailedPrecondition, connect.CodeOf(err))
+				})
 			})
 		},
 	)
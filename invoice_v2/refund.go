@@ -0,0 +1,78 @@
+package invoice_v2
+
+import (
+	"errors"
+	"fmt"
+
+	"connectrpc.com/connect"
+	"github.com/pdcgo/invoice_service/invoice_models"
+	invoice_iface "github.com/pdcgo/schema/services/invoice_iface/v2"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"gorm.io/gorm"
+)
+
+// refundableCredit locks and returns the credit forTeamID holds on teamID (the
+// refunding team), RECEIVABLE(forTeamID, teamID), and the sum of the refunds already
+// on their way (PENDING) from teamID to forTeamID.
+func refundableCredit(tx *gorm.DB, teamID, forTeamID uint64) (credit, pending float64, err error) {
+	var bal invoice_models.TeamBalance
+	res := lockForUpdate(tx).
+		Where("team_id = ? AND for_team_id = ? AND balance_type = ?", forTeamID, teamID, invoice_iface.BalanceType_BALANCE_TYPE_RECEIVABLE).
+		Limit(1).
+		Find(&bal)
+	if res.Error != nil {
+		return 0, 0, res.Error
+	}
+
+	err = tx.Model(&invoice_models.InvoiceRefund{}).
+		Select("COALESCE(SUM(amount), 0)").
+		Where("team_id = ? AND for_team_id = ? AND status = ?", teamID, forTeamID, invoice_iface.RefundStatus_REFUND_STATUS_PENDING).
+		Scan(&pending).Error
+	return bal.Balance, pending, err
+}
+
+// loadPendingRefund locks a refund, checks it belongs to the (team_id, for_team_id)
+// pair and is still PENDING.
+func loadPendingRefund(tx *gorm.DB, refundID, teamID, forTeamID uint64) (*invoice_models.InvoiceRefund, error) {
+	var r invoice_models.InvoiceRefund
+	err := lockForUpdate(tx).Where("id = ?", refundID).First(&r).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, connect.NewError(connect.CodeNotFound, errors.New("refund not found"))
+		}
+		return nil, err
+	}
+	if r.TeamID != teamID || r.ForTeamID != forTeamID {
+		return nil, connect.NewError(connect.CodeInvalidArgument, errors.New("refund does not match team_id/for_team_id"))
+	}
+	if r.Status != invoice_iface.RefundStatus_REFUND_STATUS_PENDING {
+		return nil, connect.NewError(connect.CodeFailedPrecondition, fmt.Errorf("refund already %s", r.Status))
+	}
+	return &r, nil
+}
+
+// toProtoRefund maps a stored Refund to its proto representation.
+func toProtoRefund(r *invoice_models.InvoiceRefund) *invoice_iface.Refund {
+	out := &invoice_iface.Refund{
+		Id:           r.ID,
+		TeamId:       r.TeamID,
+		ForTeamId:    r.ForTeamID,
+		Amount:       r.Amount,
+		Note:         r.Note,
+		DocumentId:   r.DocumentID,
+		Status:       r.Status,
+		RejectReason: r.RejectReason,
+		CreatedById:  r.CreatedByID,
+		CreatedAt:    timestamppb.New(r.CreatedAt),
+	}
+	if r.CompletedByID != nil {
+		out.CompletedById = *r.CompletedByID
+	}
+	if r.ConfirmedAt != nil {
+		out.ConfirmedAt = timestamppb.New(*r.ConfirmedAt)
+	}
+	if r.RejectedAt != nil {
+		out.RejectedAt = timestamppb.New(*r.RejectedAt)
+	}
+	return out
+}
@@ -0,0 +1,151 @@
+package invoice_v2_test
+
+import (
+	"context"
+	"testing"
+
+	"connectrpc.com/connect"
+	"github.com/pdcgo/invoice_service/invoice_models"
+	"github.com/pdcgo/invoice_service/invoice_v2"
+	"github.com/pdcgo/schema/services/common/v1"
+	invoice_iface "github.com/pdcgo/schema/services/invoice_iface/v2"
+	role_base "github.com/pdcgo/schema/services/role_base/v1"
+	"github.com/pdcgo/shared/pkg/moretest"
+	"github.com/pdcgo/shared/pkg/moretest/moretest_mock"
+	"github.com/pdcgo/user_service/access_interceptors"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func TestRefund(t *testing.T) {
+	var scenario moretest_mock.DbScenario
+
+	moretest.Suite(t, "refund",
+		moretest.SetupListFunc{
+			moretest_mock.MockPostgresDatabase(&scenario),
+		},
+		func(t *testing.T) {
+			scenario(t, func(tx *gorm.DB) {
+				assert.NoError(t, tx.AutoMigrate(
+					&invoice_models.InvoicePayment{},
+					&invoice_models.InvoicePaymentSelection{},
+					&invoice_models.InvoiceRefund{},
+					&invoice_models.TeamBalance{},
+					&invoice_models.BalanceChangeLog{},
+					&invoice_models.OweLimitAlertLevel{},
+					&invoice_models.BalanceOpenItem{},
+					&invoice_models.BalanceOpenItemAllocation{},
+					&invoice_models.BalanceChangePaymentSource{},
+					&invoice_models.TeamBalanceDailyLog{},
+					&invoice_models.InvoiceApprovalPolicy{},
+					&invoice_models.InvoiceApproval{},
+				))
+
+				svc := invoice_v2.NewInvoiceService(tx)
+				ctx := access_interceptors.SetIdentityToCtx(
+					context.Background(),
+					&role_base.Identity{IdentityId: 7},
+				)
+
+				balanceOf := func(teamID, forTeamID uint64, bt invoice_iface.BalanceType) float64 {
+					var b invoice_models.TeamBalance
+					assert.NoError(t, tx.Where("team_id = ? AND for_team_id = ? AND balance_type = ?", teamID, forTeamID, bt).Limit(1).Find(&b).Error)
+					return b.Balance
+				}
+
+				// team 1 pays team 2 100 with no debt: a credit of 100 on team 2.
+				res, err := svc.CreatePayment(ctx, connect.NewRequest(&invoice_iface.CreatePaymentRequest{
+					TeamId: 1, ForTeamId: 2, Amount: 100,
+				}))
+				assert.NoError(t, err)
+				_, err = svc.AcceptPayment(ctx, connect.NewRequest(&invoice_iface.AcceptPaymentRequest{
+					TeamId: 1, ForTeamId: 2, PaymentId: res.Msg.Id,
+				}))
+				assert.NoError(t, err)
+				assert.Equal(t, float64(100), balanceOf(1, 2, receivable))
+
+				refund := func(amount float64) (*invoice_iface.Refund, error) {
+					res, err := svc.CreateRefund(ctx, connect.NewRequest(&invoice_iface.CreateRefundRequest{
+						TeamId: 2, ForTeamId: 1, Amount: amount, Note: "refund",
+					}))
+					if err != nil {
+						return nil, err
+					}
+					return res.Msg.GetRefund(), nil
+				}
+
+				var first, second *invoice_iface.Refund
+				t.Run("create: pending refund within the credit, balances untouched", func(t *testing.T) {
+					first, err = refund(60)
+					assert.NoError(t, err)
+					assert.Equal(t, invoice_iface.RefundStatus_REFUND_STATUS_PENDING, first.Status)
+					assert.Equal(t, float64(100), balanceOf(1, 2, receivable))
+
+					// only 40 left once the pending 60 is counted.
+					_, err = refund(50)
+					assert.Equal(t, connect.CodeFailedPrecondition, connect.CodeOf(err))
+					second, err = refund(40)
+					assert.NoError(t, err)
+				})
+
+				t.Run("confirm: posts REFUND and clears the credit", func(t *testing.T) {
+					res, err := svc.ConfirmRefund(ctx, connect.NewRequest(&invoice_iface.ConfirmRefundRequest{
+						TeamId: 2, ForTeamId: 1, RefundId: first.Id,
+					}))
+					assert.NoError(t, err)
+					assert.Equal(t, invoice_iface.RefundStatus_REFUND_STATUS_CONFIRMED, res.Msg.GetRefund().Status)
+
+					assert.Equal(t, float64(40), balanceOf(1, 2, receivable))
+					assert.Equal(t, float64(-40), balanceOf(2, 1, payable))
+
+					var n int64
+					assert.NoError(t, tx.Model(&invoice_models.BalanceChangeLog{}).
+						Where("change_type = ?", invoice_iface.BalanceChangeType_BALANCE_CHANGE_TYPE_REFUND).
+						Count(&n).Error)
+					assert.Equal(t, int64(2), n)
+
+					_, err = svc.ConfirmRefund(ctx, connect.NewRequest(&invoice_iface.ConfirmRefundRequest{
+						TeamId: 2, ForTeamId: 1, RefundId: first.Id,
+					}))
+					assert.Equal(t, connect.CodeFailedPrecondition, connect.CodeOf(err))
+				})
+
+				t.Run("reject: no balance moves, amount refundable again", func(t *testing.T) {
+					_, err := svc.RejectRefund(ctx, connect.NewRequest(&invoice_iface.RejectRefundRequest{
+						TeamId: 2, ForTeamId: 1, RefundId: second.Id,
+					}))
+					assert.Equal(t, connect.CodeInvalidArgument, connect.CodeOf(err))
+
+					res, err := svc.RejectRefund(ctx, connect.NewRequest(&invoice_iface.RejectRefundRequest{
+						TeamId: 2, ForTeamId: 1, RefundId: second.Id, Reason: "not received",
+					}))
+					assert.NoError(t, err)
+					assert.Equal(t, invoice_iface.RefundStatus_REFUND_STATUS_REJECTED, res.Msg.GetRefund().Status)
+					assert.Equal(t, float64(40), balanceOf(1, 2, receivable))
+
+					_, err = refund(40)
+					assert.NoError(t, err)
+				})
+
+				t.Run("list outgoing and incoming", func(t *testing.T) {
+					out, err := svc.ListRefund(ctx, connect.NewRequest(&invoice_iface.ListRefundRequest{
+						TeamId: 2,
+						Page:   &common.PageFilter{Page: 1, Limit: 10},
+					}))
+					assert.NoError(t, err)
+					assert.Len(t, out.Msg.Refunds, 3)
+
+					in, err := svc.ListIncomingRefund(ctx, connect.NewRequest(&invoice_iface.ListIncomingRefundRequest{
+						ForTeamId: 1,
+						Status:    invoice_iface.RefundStatus_REFUND_STATUS_CONFIRMED,
+						Page:      &common.PageFilter{Page: 1, Limit: 10},
+					}))
+					assert.NoError(t, err)
+					if assert.Len(t, in.Msg.Refunds, 1) {
+						assert.Equal(t, first.Id, in.Msg.Refunds[0].Id)
+					}
+				})
+			})
+		},
+	)
+}
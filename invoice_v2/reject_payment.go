@@ -36,10 +36,7 @@ func (s *invoiceServiceImpl) RejectPayment(
 		}
 
 		// Release the in-flight amount; balances are untouched.
-		if err := adjustPending(tx, p.TeamID, p.ForTeamID, invoice_iface.BalanceType_BALANCE_TYPE_PAYABLE, -p.Amount, now); err != nil {
-			return err
-		}
-		if err := adjustPending(tx, p.ForTeamID, p.TeamID, invoice_iface.BalanceType_BALANCE_TYPE_RECEIVABLE, -p.Amount, now); err != nil {
+		if err := releasePending(tx, p, now); err != nil {
 			return err
 		}
 
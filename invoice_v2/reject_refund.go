@@ -0,0 +1,66 @@
+package invoice_v2
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"connectrpc.com/connect"
+	"github.com/pdcgo/invoice_service/invoice_models"
+	invoice_iface "github.com/pdcgo/schema/services/invoice_iface/v2"
+	"github.com/pdcgo/user_service/access_interceptors"
+	"gorm.io/gorm"
+)
+
+// RejectRefund implements [invoice_ifaceconnect.InvoiceServiceHandler].
+//
+// The original payer (for_team_id) reports a pending refund as not received. No
+// balance moves; the refund is marked REJECTED with the reason, and its amount is
+// refundable again.
+func (s *invoiceServiceImpl) RejectRefund(
+	ctx context.Context,
+	req *connect.Request[invoice_iface.RejectRefundRequest],
+) (*connect.Response[invoice_iface.RejectRefundResponse], error) {
+	pay := req.Msg
+
+	reason := strings.TrimSpace(pay.Reason)
+	if reason == "" {
+		return nil, connect.NewError(connect.CodeInvalidArgument, errors.New("reason is required"))
+	}
+
+	caller, err := access_interceptors.GetIdentityFromCtx(ctx)
+	if err != nil {
+		return nil, connect.NewError(connect.CodeUnauthenticated, err)
+	}
+	completedBy := uint64(caller.IdentityId)
+
+	now := time.Now()
+	var r *invoice_models.InvoiceRefund
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		r, err = loadPendingRefund(tx, pay.RefundId, pay.TeamId, pay.ForTeamId)
+		if err != nil {
+			return err
+		}
+
+		r.Status = invoice_iface.RefundStatus_REFUND_STATUS_REJECTED
+		r.RejectReason = reason
+		r.CompletedByID = &completedBy
+		r.RejectedAt = &now
+		r.UpdatedAt = now
+		return tx.Model(&invoice_models.InvoiceRefund{}).
+			Where("id = ?", r.ID).
+			Updates(map[string]interface{}{
+				"status":          r.Status,
+				"reject_reason":   reason,
+				"rejected_at":     now,
+				"completed_by_id": completedBy,
+				"updated_at":      now,
+			}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return connect.NewResponse(&invoice_iface.RejectRefundResponse{Refund: toProtoRefund(r)}), nil
+}
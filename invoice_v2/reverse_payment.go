@@ -0,0 +1,160 @@
+package invoice_v2
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"connectrpc.com/connect"
+	"github.com/pdcgo/invoice_service/invoice_models"
+	invoice_iface "github.com/pdcgo/schema/services/invoice_iface/v2"
+	"github.com/pdcgo/user_service/access_interceptors"
+	"gorm.io/gorm"
+)
+
+// ReversePayment implements [invoice_ifaceconnect.InvoiceServiceHandler]. Finance
+// only (see the RPC's request policy): it charges back an ACCEPTED or
+// PARTIALLY_ACCEPTED payment whose transfer bounced or was accepted by mistake.
+//
+// The payer-side legs settlePayment posted for the payment (the PAYABLE settlement
+// and the RECEIVABLE overpayment credit) are reversed exactly, as double entries of
+// type PAYMENT linked back to the payment, so the payer owes again what the payment
+// settled and loses any credit it created. The payment becomes REVERSED.
+//
+// If that credit was already refunded (ConfirmRefund), the reversal still takes it back
+// in full and the payer's RECEIVABLE goes negative: the refunded money came from the
+// bounced transfer, so the payer owes it back to the creditor.
+func (s *invoiceServiceImpl) ReversePayment(
+	ctx context.Context,
+	req *connect.Request[invoice_iface.ReversePaymentRequest],
+) (*connect.Response[invoice_iface.ReversePaymentResponse], error) {
+	pay := req.Msg
+
+	caller, err := access_interceptors.GetIdentityFromCtx(ctx)
+	if err != nil {
+		return nil, connect.NewError(connect.CodeUnauthenticated, err)
+	}
+	reversedBy := uint64(caller.IdentityId)
+
+	reason := strings.TrimSpace(pay.Reason)
+	if reason == "" {
+		return nil, connect.NewError(connect.CodeInvalidArgument, errors.New("reason is required"))
+	}
+
+	now := time.Now()
+	var p invoice_models.InvoicePayment
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := lockForUpdate(tx).Where("id = ?", pay.PaymentId).First(&p).Error
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return connect.NewError(connect.CodeNotFound, errors.New("payment not found"))
+			}
+			return err
+		}
+		if p.TeamID != pay.TeamId || p.ForTeamID != pay.ForTeamId {
+			return connect.NewError(connect.CodeInvalidArgument, errors.New("payment does not match team_id/for_team_id"))
+		}
+		switch p.Status {
+		case invoice_iface.PaymentStatus_PAYMENT_STATUS_ACCEPTED,
+			invoice_iface.PaymentStatus_PAYMENT_STATUS_PARTIALLY_ACCEPTED:
+		default:
+			return connect.NewError(connect.CodeFailedPrecondition, fmt.Errorf("payment is %s, only accepted payments can be reversed", p.Status))
+		}
+
+		settled, credited, err := postedPaymentLegs(tx, &p)
+		if err != nil {
+			return err
+		}
+
+		note := fmt.Sprintf("payment #%d reversal", p.ID)
+		src := &PaymentSource{PaymentID: p.ID, Reversal: true}
+		if settled != 0 {
+			if err := postDoubleEntry(tx, p.TeamID, p.ForTeamID, invoice_iface.BalanceType_BALANCE_TYPE_PAYABLE, invoice_iface.BalanceChangeType_BALANCE_CHANGE_TYPE_PAYMENT, -settled, note, reversedBy, now, src); err != nil {
+				return err
+			}
+		}
+		if credited != 0 {
+			if err := postDoubleEntry(tx, p.TeamID, p.ForTeamID, invoice_iface.BalanceType_BALANCE_TYPE_RECEIVABLE, invoice_iface.BalanceChangeType_BALANCE_CHANGE_TYPE_PAYMENT, -credited, note, reversedBy, now, src); err != nil {
+				return err
+			}
+		}
+
+		// The payer owes again; see whether that crossed an alert level.
+		if err := checkOweLimitAlert(tx, p.TeamID, p.ForTeamID, now); err != nil {
+			return err
+		}
+
+		p.Status = invoice_iface.PaymentStatus_PAYMENT_STATUS_REVERSED
+		p.ReversedAt = &now
+		p.ReversedByID = &reversedBy
+		p.ReversalReason = reason
+		p.UpdatedAt = now
+		return tx.Model(&invoice_models.InvoicePayment{}).
+			Where("id = ?", p.ID).
+			Updates(map[string]interface{}{
+				"status":          p.Status,
+				"reversed_at":     now,
+				"reversed_by_id":  reversedBy,
+				"reversal_reason": reason,
+				"updated_at":      now,
+			}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return connect.NewResponse(&invoice_iface.ReversePaymentResponse{Payment: toProtoPayment(&p)}), nil
+}
+
+// postedPaymentLegs returns what accepting p actually posted on the payer side: the
+// PAYABLE settlement and the RECEIVABLE overpayment credit. Legs are found through
+// their BalanceChangePaymentSource; payments accepted before that link existed fall
+// back to the notes settlePayment wrote.
+func postedPaymentLegs(tx *gorm.DB, p *invoice_models.InvoicePayment) (settled, credited float64, err error) {
+	type legSum struct {
+		BalanceType invoice_iface.BalanceType
+		Amount      float64
+	}
+
+	base := func() *gorm.DB {
+		return tx.Table("balance_change_logs l").
+			Select("l.balance_type, SUM(l.change_amount) AS amount").
+			Where("l.team_id = ? AND l.for_team_id = ?", p.TeamID, p.ForTeamID).
+			Where("l.change_type = ?", invoice_iface.BalanceChangeType_BALANCE_CHANGE_TYPE_PAYMENT).
+			Group("l.balance_type")
+	}
+
+	var sums []legSum
+	err = base().
+		Joins("JOIN balance_change_payment_sources ps ON ps.balance_change_log_id = l.id").
+		Where("ps.payment_id = ? AND NOT ps.reversal", p.ID).
+		Scan(&sums).Error
+	if err != nil {
+		return 0, 0, err
+	}
+	if len(sums) == 0 {
+		err = base().
+			Where("NOT EXISTS (SELECT 1 FROM balance_change_payment_sources ps WHERE ps.balance_change_log_id = l.id)").
+			Where(
+				"(l.balance_type = ? AND l.note = ?) OR (l.balance_type = ? AND l.note = ?)",
+				invoice_iface.BalanceType_BALANCE_TYPE_PAYABLE, fmt.Sprintf("payment #%d", p.ID),
+				invoice_iface.BalanceType_BALANCE_TYPE_RECEIVABLE, fmt.Sprintf("payment #%d overpayment credit", p.ID),
+			).
+			Scan(&sums).Error
+		if err != nil {
+			return 0, 0, err
+		}
+	}
+
+	for _, s := range sums {
+		switch s.BalanceType {
+		case invoice_iface.BalanceType_BALANCE_TYPE_PAYABLE:
+			settled = s.Amount
+		case invoice_iface.BalanceType_BALANCE_TYPE_RECEIVABLE:
+			credited = s.Amount
+		}
+	}
+	return settled, credited, nil
+}
@@ -9,11 +9,37 @@ import (
 // [invoice_ifaceconnect.InvoiceServiceHandler]. Handlers live one-per-file and
 // currently return CodeUnimplemented; fill them in as the features land.
 type invoiceServiceImpl struct {
-	db *gorm.DB
+	db            *gorm.DB
+	eventApplier  EventApplier
+	oweLimitCache *OweLimitCache
 }
 
-func NewInvoiceService(db *gorm.DB) *invoiceServiceImpl {
-	return &invoiceServiceImpl{db: db}
+// ServiceOption wires an optional collaborator into the service. Collaborators that
+// live outside invoice_v2 (e.g. the push-event logic in the root package, which imports
+// this one) are injected this way instead of imported.
+type ServiceOption func(s *invoiceServiceImpl)
+
+// WithEventApplier enables SimulateEvent with the push handler's event logic.
+func WithEventApplier(apply EventApplier) ServiceOption {
+	return func(s *invoiceServiceImpl) {
+		s.eventApplier = apply
+	}
+}
+
+// WithOweLimitCache serves CheckOweLimit from cache. Mount cache.Interceptor() on the
+// handler too, so the service's own writes invalidate it.
+func WithOweLimitCache(cache *OweLimitCache) ServiceOption {
+	return func(s *invoiceServiceImpl) {
+		s.oweLimitCache = cache
+	}
+}
+
+func NewInvoiceService(db *gorm.DB, opts ...ServiceOption) *invoiceServiceImpl {
+	s := &invoiceServiceImpl{db: db}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
 }
 
 // Compile-time assertion that the skeleton satisfies the generated handler.
@@ -0,0 +1,156 @@
+package invoice_v2
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"connectrpc.com/connect"
+	"github.com/pdcgo/invoice_service/invoice_models"
+	invoice_iface "github.com/pdcgo/schema/services/invoice_iface/v2"
+	"google.golang.org/protobuf/proto"
+	"gorm.io/gorm"
+)
+
+// EventApplier applies the balance work of one selling or stock event inside tx, exactly
+// as the push handler derives it but without the exactly-once inbox. The root package
+// provides it (it owns the fee derivation); see WithEventApplier.
+type EventApplier func(tx *gorm.DB, event proto.Message) error
+
+// EventSimulation is everything an event would have written to the ledger: the
+// BalanceChangeLog legs in posting order, their order-source rows, and the resulting
+// TeamBalance of every account a leg touched. Ids are the ones the rolled-back
+// transaction assigned; they are not reserved.
+type EventSimulation struct {
+	Logs         []*invoice_models.BalanceChangeLog
+	OrderSources []*invoice_models.BalanceChangeOrderSource
+	Balances     []*invoice_models.TeamBalance
+}
+
+var errSimulationRollback = errors.New("simulation rollback")
+
+// SimulateEvent runs apply inside a transaction that is always rolled back and reports
+// what it wrote. It runs at REPEATABLE READ, so the "everything after the last visible
+// log id" read only sees this transaction's own legs, never a concurrent commit.
+func SimulateEvent(db *gorm.DB, apply EventApplier, event proto.Message) (*EventSimulation, error) {
+	sim := &EventSimulation{}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var lastID uint64
+		err := tx.
+			Model(&invoice_models.BalanceChangeLog{}).
+			Select("COALESCE(MAX(id), 0)").
+			Scan(&lastID).
+			Error
+		if err != nil {
+			return err
+		}
+
+		if err := apply(tx, event); err != nil {
+			return err
+		}
+
+		if err := tx.Where("id > ?", lastID).Order("id").Find(&sim.Logs).Error; err != nil {
+			return err
+		}
+		if len(sim.Logs) == 0 {
+			return errSimulationRollback
+		}
+
+		logIDs := make([]uint64, 0, len(sim.Logs))
+		for _, l := range sim.Logs {
+			logIDs = append(logIDs, l.ID)
+		}
+		err = tx.
+			Where("balance_change_log_id IN ?", logIDs).
+			Order("balance_change_log_id").
+			Find(&sim.OrderSources).
+			Error
+		if err != nil {
+			return err
+		}
+
+		// One resulting balance per touched account, in first-touched order.
+		type account struct {
+			teamID, forTeamID uint64
+			bt                invoice_iface.BalanceType
+		}
+		seen := map[account]bool{}
+		for _, l := range sim.Logs {
+			key := account{l.TeamID, l.ForTeamID, l.BalanceType}
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+
+			var bal invoice_models.TeamBalance
+			err := tx.
+				Where("team_id = ? AND for_team_id = ? AND balance_type = ?", key.teamID, key.forTeamID, key.bt).
+				First(&bal).
+				Error
+			if err != nil {
+				return err
+			}
+			sim.Balances = append(sim.Balances, &bal)
+		}
+
+		return errSimulationRollback
+	}, &sql.TxOptions{Isolation: sql.LevelRepeatableRead})
+	if !errors.Is(err, errSimulationRollback) {
+		return nil, err
+	}
+	return sim, nil
+}
+
+// SimulateEvent implements [invoice_ifaceconnect.InvoiceServiceHandler]. Admin only (see
+// the RPC's request policy): it dry-runs a selling or stock event through the push
+// handler's posting logic and returns the legs, order-source rows and resulting balances
+// it would have written. Nothing is committed and the exactly-once inbox is not touched,
+// so the same event can still be delivered for real afterwards.
+func (s *invoiceServiceImpl) SimulateEvent(
+	ctx context.Context,
+	req *connect.Request[invoice_iface.SimulateEventRequest],
+) (*connect.Response[invoice_iface.SimulateEventResponse], error) {
+	if s.eventApplier == nil {
+		return nil, connect.NewError(connect.CodeUnimplemented, errors.New("event simulation is not configured"))
+	}
+
+	var event proto.Message
+	switch ev := req.Msg.Event.(type) {
+	case *invoice_iface.SimulateEventRequest_SellingEvent:
+		event = ev.SellingEvent
+	case *invoice_iface.SimulateEventRequest_StockEvent:
+		event = ev.StockEvent
+	default:
+		return nil, connect.NewError(connect.CodeInvalidArgument, errors.New("event is required"))
+	}
+
+	sim, err := SimulateEvent(s.db.WithContext(ctx), s.eventApplier, event)
+	if err != nil {
+		return nil, err
+	}
+
+	sourceOf := map[uint64]*invoice_models.BalanceChangeOrderSource{}
+	result := &invoice_iface.SimulateEventResponse{
+		Logs:         make([]*invoice_iface.BalanceChangeLog, 0, len(sim.Logs)),
+		OrderSources: make([]*invoice_iface.BalanceChangeOrderSource, 0, len(sim.OrderSources)),
+		Balances:     make([]*invoice_iface.TeamBalance, 0, len(sim.Balances)),
+	}
+	for _, src := range sim.OrderSources {
+		sourceOf[src.BalanceChangeLogID] = src
+		result.OrderSources = append(result.OrderSources, toProtoOrderSource(src))
+	}
+	for _, l := range sim.Logs {
+		out := toProtoBalanceChangeLog(l)
+		if src := sourceOf[l.ID]; src != nil {
+			out.OrderId = src.OrderID
+			out.WarehouseId = src.WarehouseID
+			out.OrderSystem = src.OrderSystem
+		}
+		result.Logs = append(result.Logs, out)
+	}
+	for _, b := range sim.Balances {
+		result.Balances = append(result.Balances, toProtoTeamBalance(b))
+	}
+
+	return connect.NewResponse(result), nil
+}
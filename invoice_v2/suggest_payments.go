@@ -0,0 +1,211 @@
+package invoice_v2
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sort"
+	"time"
+
+	"connectrpc.com/connect"
+	"github.com/pdcgo/invoice_service/invoice_models"
+	invoice_iface "github.com/pdcgo/schema/services/invoice_iface/v2"
+)
+
+// SuggestPayments implements [invoice_ifaceconnect.InvoiceServiceHandler]. It proposes
+// what the debtor (team_id) should pay, and to whom, to get under its owe limits.
+//
+// Each creditor's outstanding debt is its PAYABLE less the payments already pending,
+// assuming those will be accepted; thresholds are the ones EvaluateOweLimits resolves.
+// The plan is built in two passes, at most one payment per creditor:
+//
+//  1. Unblock: for every creditor whose limit blocks the debtor, the smallest amount
+//     that brings the debt under the threshold and, for a limit blocking on age, pays
+//     off every debit older than max_age_days (payments settle the oldest debits
+//     first, pending ones included). The cheapest unblocks go first, so a budget
+//     unblocks as many limits as it can; one it cannot afford in full is skipped.
+//  2. Pay down: leftover budget goes to creditors already in the plan first (no extra
+//     transfer), then to the rest, the oldest unpaid debt first when use_aging is set
+//     (aged the way AgingReport and the AGE condition age it), otherwise the largest
+//     debt first.
+//
+// A budget of 0 plans only the unblocking amounts. Each line carries the
+// CreatePaymentRequest that submits it.
+func (s *invoiceServiceImpl) SuggestPayments(
+	ctx context.Context,
+	req *connect.Request[invoice_iface.SuggestPaymentsRequest],
+) (*connect.Response[invoice_iface.SuggestPaymentsResponse], error) {
+	pay := req.Msg
+	if pay.TeamId == 0 {
+		return nil, connect.NewError(connect.CodeInvalidArgument, errors.New("team_id is required"))
+	}
+	if pay.Budget < 0 {
+		return nil, connect.NewError(connect.CodeInvalidArgument, errors.New("budget must not be negative"))
+	}
+	db := s.db.WithContext(ctx)
+	now := time.Now()
+
+	query := db.
+		Where("team_id = ? AND balance_type = ? AND balance < 0", pay.TeamId, invoice_iface.BalanceType_BALANCE_TYPE_PAYABLE)
+	if len(pay.ForTeamIds) > 0 {
+		query = query.Where("for_team_id IN ?", pay.ForTeamIds)
+	}
+	var balances []invoice_models.TeamBalance
+	if err := query.Order("for_team_id").Find(&balances).Error; err != nil {
+		return nil, err
+	}
+
+	type creditor struct {
+		line        *invoice_iface.SuggestedPayment
+		outstanding int64 // cents, after pending payments
+		need        int64 // cents to get under the threshold; 0 when not blocked
+		oldest      time.Time
+	}
+	creditors := make([]*creditor, 0, len(balances))
+	ids := make([]uint64, 0, len(balances))
+	for _, b := range balances {
+		outstanding := toCents(-b.Balance) - toCents(b.PendingPaymentAmount)
+		if outstanding <= 0 {
+			continue
+		}
+		creditors = append(creditors, &creditor{
+			line: &invoice_iface.SuggestedPayment{
+				ForTeamId:     b.ForTeamID,
+				Debt:          -b.Balance,
+				PendingAmount: b.PendingPaymentAmount,
+			},
+			outstanding: outstanding,
+		})
+		ids = append(ids, b.ForTeamID)
+	}
+
+	limits, err := EvaluateOweLimits(db, pay.TeamId, ids)
+	if err != nil {
+		return nil, err
+	}
+	// the same replay the AGE condition and AgingReport use, so they agree on ages.
+	unsettled, err := unsettledDebits(db, pay.TeamId, ids, now)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, c := range creditors {
+		debits := unsettled[c.line.ForTeamId]
+		if len(debits) > 0 {
+			c.oldest = debits[0].at
+			c.line.OldestDebtDays = ageDays(now, c.oldest)
+		}
+		l := limits[c.line.ForTeamId]
+		c.line.Threshold = l.GetThreshold()
+		if l.GetThreshold() > 0 {
+			// the debt must end strictly below the threshold.
+			c.need = max(c.outstanding-toCents(l.GetThreshold())+1, 0)
+		}
+		if slices.Contains(l.GetFailedConditions(), invoice_iface.OweLimitCondition_OWE_LIMIT_CONDITION_AGE) {
+			tooOld := int64(0)
+			for _, d := range debits {
+				if ageDays(now, d.at) > l.MaxAgeDays {
+					tooOld += toCents(d.amount)
+				}
+			}
+			c.need = max(c.need, tooOld-toCents(c.line.PendingAmount))
+		}
+	}
+	olderFirst := func(a, b *creditor) bool {
+		if pay.UseAging && !a.oldest.Equal(b.oldest) {
+			if a.oldest.IsZero() || b.oldest.IsZero() {
+				return !a.oldest.IsZero()
+			}
+			return a.oldest.Before(b.oldest)
+		}
+		return a.line.ForTeamId < b.line.ForTeamId
+	}
+
+	budget := toCents(pay.Budget)
+	unlimited := pay.Budget == 0
+	planned := map[*creditor]int64{}
+	var order []*creditor
+
+	// 1. Unblock, cheapest first.
+	blocked := make([]*creditor, 0)
+	for _, c := range creditors {
+		if c.need > 0 {
+			blocked = append(blocked, c)
+		}
+	}
+	sort.SliceStable(blocked, func(i, j int) bool {
+		if blocked[i].need != blocked[j].need {
+			return blocked[i].need < blocked[j].need
+		}
+		return olderFirst(blocked[i], blocked[j])
+	})
+	resp := &invoice_iface.SuggestPaymentsResponse{
+		Lines:        []*invoice_iface.SuggestedPayment{},
+		StillBlocked: []uint64{},
+	}
+	for _, c := range blocked {
+		if !unlimited && c.need > budget {
+			resp.StillBlocked = append(resp.StillBlocked, c.line.ForTeamId)
+			continue
+		}
+		planned[c] = c.need
+		c.line.Unblocks = true
+		order = append(order, c)
+		if !unlimited {
+			budget -= c.need
+		}
+	}
+
+	// 2. Pay down with what is left: planned creditors first, then the rest.
+	if !unlimited && budget > 0 {
+		rest := make([]*creditor, 0, len(creditors))
+		for _, c := range creditors {
+			if _, ok := planned[c]; !ok {
+				rest = append(rest, c)
+			}
+		}
+		sort.SliceStable(rest, func(i, j int) bool {
+			if pay.UseAging {
+				return olderFirst(rest[i], rest[j])
+			}
+			if rest[i].outstanding != rest[j].outstanding {
+				return rest[i].outstanding > rest[j].outstanding
+			}
+			return rest[i].line.ForTeamId < rest[j].line.ForTeamId
+		})
+		for _, c := range append(append([]*creditor{}, order...), rest...) {
+			if budget <= 0 {
+				break
+			}
+			extra := min(c.outstanding-planned[c], budget)
+			if extra <= 0 {
+				continue
+			}
+			if _, ok := planned[c]; !ok {
+				order = append(order, c)
+			}
+			planned[c] += extra
+			budget -= extra
+		}
+	}
+
+	total := int64(0)
+	for i, c := range order {
+		amount := float64(planned[c]) / 100
+		c.line.Priority = int64(i + 1)
+		c.line.Amount = amount
+		c.line.Payment = &invoice_iface.CreatePaymentRequest{
+			TeamId:    pay.TeamId,
+			ForTeamId: c.line.ForTeamId,
+			Amount:    amount,
+			Note:      "suggested payment",
+		}
+		total += planned[c]
+		resp.Lines = append(resp.Lines, c.line)
+	}
+	resp.TotalAmount = float64(total) / 100
+	if !unlimited {
+		resp.RemainingBudget = float64(budget) / 100
+	}
+	return connect.NewResponse(resp), nil
+}
@@ -0,0 +1,140 @@
+package invoice_v2_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"connectrpc.com/connect"
+	"github.com/pdcgo/invoice_service/invoice_models"
+	"github.com/pdcgo/invoice_service/invoice_v2"
+	invoice_iface "github.com/pdcgo/schema/services/invoice_iface/v2"
+	"github.com/pdcgo/shared/db_models"
+	"github.com/pdcgo/shared/pkg/moretest"
+	"github.com/pdcgo/shared/pkg/moretest/moretest_mock"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func TestSuggestPayments(t *testing.T) {
+	var scenario moretest_mock.DbScenario
+
+	moretest.Suite(t, "suggest payments",
+		moretest.SetupListFunc{
+			moretest_mock.MockPostgresDatabase(&scenario),
+		},
+		func(t *testing.T) {
+			scenario(t, func(tx *gorm.DB) {
+				assert.NoError(t, tx.AutoMigrate(
+					&invoice_models.TeamBalance{},
+					&invoice_models.BalanceChangeLog{},
+					&db_models.OweLimitConfiguration{},
+					&invoice_models.OweLimitPolicy{},
+					&invoice_models.OweLimitOverride{},
+					&invoice_models.OweLimitAgeRule{},
+					&invoice_models.OweLimitSoftThreshold{},
+					&invoice_models.OweLimitTeamTypeRule{},
+				))
+
+				debtor := uint64(1)
+				assert.NoError(t, tx.Create(&[]*db_models.OweLimitConfiguration{
+					{TeamID: 8, IsDefault: true, Threshold: 100},
+					{TeamID: 9, IsDefault: true, Threshold: 100},
+					{TeamID: 10, IsDefault: true, Threshold: 0}, // unlimited
+					{TeamID: 11, IsDefault: true, Threshold: 50},
+					{TeamID: 12, IsDefault: false, ForTeamID: &debtor, Threshold: 100},
+				}).Error)
+				assert.NoError(t, tx.Create(&[]*invoice_models.TeamBalance{
+					{TeamID: 1, ForTeamID: 8, BalanceType: payable, Balance: -150},
+					{TeamID: 1, ForTeamID: 9, BalanceType: payable, Balance: -120},
+					{TeamID: 1, ForTeamID: 10, BalanceType: payable, Balance: -300},
+					// under the limit once the pending 160 is accepted.
+					{TeamID: 1, ForTeamID: 11, BalanceType: payable, Balance: -200, PendingPaymentAmount: 160},
+					{TeamID: 1, ForTeamID: 12, BalanceType: payable, Balance: -400},
+				}).Error)
+				now := time.Now()
+				leg := func(creditor uint64, amount, balance float64, daysAgo int) *invoice_models.BalanceChangeLog {
+					return &invoice_models.BalanceChangeLog{
+						TeamID: 1, ForTeamID: creditor, BalanceType: payable,
+						ChangeType:   invoice_iface.BalanceChangeType_BALANCE_CHANGE_TYPE_ADJUSTMENT,
+						ChangeAmount: amount, Balance: balance, CreatedAt: now.AddDate(0, 0, -daysAgo),
+					}
+				}
+				assert.NoError(t, tx.Create(&[]*invoice_models.BalanceChangeLog{
+					leg(10, -300, -300, 5),
+					leg(11, -200, -200, 40),
+				}).Error)
+
+				svc := invoice_v2.NewInvoiceService(tx)
+				suggest := func(req *invoice_iface.SuggestPaymentsRequest) *invoice_iface.SuggestPaymentsResponse {
+					req.TeamId = debtor
+					res, err := svc.SuggestPayments(context.Background(), connect.NewRequest(req))
+					assert.NoError(t, err)
+					return res.Msg
+				}
+				amounts := func(res *invoice_iface.SuggestPaymentsResponse) map[uint64]float64 {
+					out := map[uint64]float64{}
+					for _, l := range res.Lines {
+						out[l.ForTeamId] = l.Amount
+					}
+					return out
+				}
+
+				t.Run("no budget: just enough to unblock every limit", func(t *testing.T) {
+					res := suggest(&invoice_iface.SuggestPaymentsRequest{})
+					assert.Equal(t, map[uint64]float64{9: 20.01, 8: 50.01, 12: 300.01}, amounts(res))
+					assert.Empty(t, res.StillBlocked)
+					if assert.Len(t, res.Lines, 3) {
+						assert.Equal(t, uint64(9), res.Lines[0].ForTeamId)
+						assert.True(t, res.Lines[0].Unblocks)
+						assert.Equal(t, float64(100), res.Lines[0].Threshold)
+						assert.Equal(t, float64(20.01), res.Lines[0].Payment.Amount)
+						assert.Equal(t, uint64(9), res.Lines[0].Payment.ForTeamId)
+					}
+				})
+
+				t.Run("budget unblocks the cheapest limits, leftover tops up planned creditors", func(t *testing.T) {
+					res := suggest(&invoice_iface.SuggestPaymentsRequest{Budget: 100})
+					assert.Equal(t, map[uint64]float64{9: 49.99, 8: 50.01}, amounts(res))
+					assert.Equal(t, []uint64{12}, res.StillBlocked)
+					assert.Equal(t, float64(100), res.TotalAmount)
+					assert.Zero(t, res.RemainingBudget)
+				})
+
+				t.Run("pay down by size, or by age with aging", func(t *testing.T) {
+					res := suggest(&invoice_iface.SuggestPaymentsRequest{Budget: 30, ForTeamIds: []uint64{10, 11}})
+					assert.Equal(t, map[uint64]float64{10: 30}, amounts(res))
+
+					res = suggest(&invoice_iface.SuggestPaymentsRequest{Budget: 30, ForTeamIds: []uint64{10, 11}, UseAging: true})
+					assert.Equal(t, map[uint64]float64{11: 30}, amounts(res))
+					assert.Equal(t, int64(40), res.Lines[0].OldestDebtDays)
+				})
+
+				t.Run("a limit blocking on age is unblocked by paying the overdue debits", func(t *testing.T) {
+					// creditor 13 takes any amount, but nothing older than 30 days: 40 and
+					// 25 are overdue, 10 is not, and a pending 10 will settle part of the 40.
+					ageOnly := db_models.OweLimitConfiguration{TeamID: 13, IsDefault: true}
+					assert.NoError(t, tx.Create(&ageOnly).Error)
+					assert.NoError(t, tx.Create(&invoice_models.OweLimitAgeRule{ConfigurationID: ageOnly.ID, MaxAgeDays: 30}).Error)
+					assert.NoError(t, tx.Create(&invoice_models.TeamBalance{
+						TeamID: 1, ForTeamID: 13, BalanceType: payable, Balance: -75, PendingPaymentAmount: 10,
+					}).Error)
+					assert.NoError(t, tx.Create(&[]*invoice_models.BalanceChangeLog{
+						leg(13, -40, -40, 50),
+						leg(13, -25, -65, 45),
+						leg(13, -10, -75, 5),
+					}).Error)
+
+					res := suggest(&invoice_iface.SuggestPaymentsRequest{ForTeamIds: []uint64{13}})
+					assert.Equal(t, map[uint64]float64{13: 55}, amounts(res))
+					assert.True(t, res.Lines[0].Unblocks)
+					assert.Equal(t, int64(50), res.Lines[0].OldestDebtDays) // the age that blocks
+					assert.Empty(t, res.StillBlocked)
+
+					res = suggest(&invoice_iface.SuggestPaymentsRequest{ForTeamIds: []uint64{13}, Budget: 30})
+					assert.Equal(t, []uint64{13}, res.StillBlocked)
+				})
+			})
+		},
+	)
+}
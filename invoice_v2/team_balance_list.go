@@ -16,8 +16,15 @@ const (
 	btPayable    = invoice_iface.BalanceType_BALANCE_TYPE_PAYABLE
 	btReceivable = invoice_iface.BalanceType_BALANCE_TYPE_RECEIVABLE
 	psAccepted   = invoice_iface.PaymentStatus_PAYMENT_STATUS_ACCEPTED
+	psPartial    = invoice_iface.PaymentStatus_PAYMENT_STATUS_PARTIALLY_ACCEPTED
 )
 
+// psSettled are the statuses whose payments moved money; they count with
+// sqlAcceptedAmount (the accepted, not the requested, amount).
+var psSettled = []invoice_iface.PaymentStatus{psAccepted, psPartial}
+
+const sqlAcceptedAmount = "COALESCE(accepted_amount, amount)"
+
 // TeamBalanceList implements [invoice_ifaceconnect.InvoiceServiceHandler]. For the
 // scoped team (filter.team_id) it returns its counterparty teams (for_team_id)
 // sorted by the requested column and paginated — the sort defines membership — plus
@@ -124,8 +131,8 @@ func sortForTeamIDs(
 
 	case *invoice_iface.TeamBalanceListSort_TotalPayment:
 		err = scope(db.Table("invoice_payments x").
-			Where("x.status = ? AND x.accepted_at BETWEEN ? AND ?", psAccepted, start, end)).
-			Group("x.for_team_id").Order("SUM(x.amount) "+dir).
+			Where("x.status IN ? AND x.accepted_at BETWEEN ? AND ?", psSettled, start, end)).
+			Group("x.for_team_id").Order("SUM(COALESCE(x.accepted_amount, x.amount)) "+dir).
 			Limit(limit).Offset(offset).Pluck("x.for_team_id", &ids).Error
 	case *invoice_iface.TeamBalanceListSort_TotalPayable:
 		err = scope(db.Table("balance_change_logs x").
@@ -228,8 +235,8 @@ func fetchTeamBalanceData(
 
 	case invoice_iface.TeamBalanceListDataType_TEAM_BALANCE_LIST_DATA_TYPE_TOTAL_PAYMENT:
 		m, err := scalarMap(scoped(db.Table("invoice_payments"), teamID, ids).
-			Where("status = ? AND accepted_at BETWEEN ? AND ?", psAccepted, start, end).
-			Select("for_team_id, SUM(amount) as val").Group("for_team_id"))
+			Where("status IN ? AND accepted_at BETWEEN ? AND ?", psSettled, start, end).
+			Select("for_team_id, SUM(" + sqlAcceptedAmount + ") as val").Group("for_team_id"))
 		if err != nil {
 			return nil, err
 		}
@@ -37,6 +37,9 @@ func TestTeamBalanceList(t *testing.T) {
 				assert.NoError(t, tx.AutoMigrate(
 					&invoice_models.TeamBalance{},
 					&invoice_models.BalanceChangeLog{},
+					&invoice_models.OweLimitAlertLevel{},
+					&invoice_models.BalanceOpenItem{},
+					&invoice_models.BalanceOpenItemAllocation{},
 					&invoice_models.InvoicePayment{},
 					&teamRow{},
 				))
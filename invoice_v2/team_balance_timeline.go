@@ -163,8 +163,8 @@ func (s *invoiceServiceImpl) TeamBalanceTimeline(
 		Val float64
 	}
 	err = scope(db.Table("invoice_payments")).
-		Where("status = ? AND accepted_at >= ? AND accepted_at < ?", psAccepted, startDay, end).
-		Select(bucketExpr("accepted_at") + " as t, SUM(amount) as val").
+		Where("status IN ? AND accepted_at >= ? AND accepted_at < ?", psSettled, startDay, end).
+		Select(bucketExpr("accepted_at") + " as t, SUM(" + sqlAcceptedAmount + ") as val").
 		Group("t").
 		Scan(&payRows).
 		Error
@@ -35,6 +35,9 @@ func TestTeamBalanceTimeline(t *testing.T) {
 			scenario(t, func(tx *gorm.DB) {
 				assert.NoError(t, tx.AutoMigrate(
 					&invoice_models.BalanceChangeLog{},
+					&invoice_models.OweLimitAlertLevel{},
+					&invoice_models.BalanceOpenItem{},
+					&invoice_models.BalanceOpenItemAllocation{},
 					&invoice_models.InvoicePayment{},
 					&invoice_models.TeamBalanceDailyLog{},
 				))
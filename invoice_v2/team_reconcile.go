@@ -4,9 +4,12 @@ import (
 	"context"
 	"log/slog"
 	"math"
+	"time"
 
 	"connectrpc.com/connect"
 	invoice_iface "github.com/pdcgo/schema/services/invoice_iface/v2"
+	"github.com/pdcgo/user_service/access_interceptors"
+	"gorm.io/gorm"
 )
 
 func (s *invoiceServiceImpl) TeamReconcile(
@@ -66,10 +69,18 @@ WHERE (d.source_balance + COALESCE(tb.balance, 0)) != 0
 // reconcileTeamPayable reconciles the team's PAYABLE balances to the legacy unpaid-invoice
 // totals: for each (from_team -> to_team) pair where the team is the debtor, it posts the delta
 // as an ADJUSTMENT so the stored PAYABLE matches -source. Because it posts only the delta,
-// re-running converges (delta -> 0) and is idempotent.
+// re-running converges (delta -> 0) and is idempotent. The adjustments post directly,
+// bypassing the approval policy: they only mirror the legacy source, and holding them
+// would queue a fresh approval on every re-run.
 func (s *invoiceServiceImpl) reconcileTeamPayable(ctx context.Context, teamID uint64) (int, error) {
+	caller, err := access_interceptors.GetIdentityFromCtx(ctx)
+	if err != nil {
+		return 0, connect.NewError(connect.CodeUnauthenticated, err)
+	}
+	createdByID := uint64(caller.IdentityId)
+
 	var list []*payableReconcile
-	err := s.db.WithContext(ctx).
+	err = s.db.WithContext(ctx).
 		Raw(reconcilePayableSQL,
 			teamID,
 			int32(invoice_iface.BalanceType_BALANCE_TYPE_PAYABLE),
@@ -103,7 +114,10 @@ func (s *invoiceServiceImpl) reconcileTeamPayable(ctx context.Context, teamID ui
 			req.ChangeAmount = -diff
 		}
 
-		if _, err := s.CreateBalanceLog(ctx, connect.NewRequest(req)); err != nil {
+		err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			return PostBalanceLog(tx, req.TeamId, req.ForTeamId, req.ChangeType, req.ChangeAmount, req.BalanceType, req.Note, createdByID, time.Now())
+		})
+		if err != nil {
 			return count, err
 		}
 		count++
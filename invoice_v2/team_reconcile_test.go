@@ -29,6 +29,9 @@ func TestTeamReconcile(t *testing.T) {
 				assert.NoError(t, tx.AutoMigrate(
 					&db_models.Invoice{},
 					&invoice_models.BalanceChangeLog{},
+					&invoice_models.OweLimitAlertLevel{},
+					&invoice_models.BalanceOpenItem{},
+					&invoice_models.BalanceOpenItemAllocation{},
 					&invoice_models.TeamBalance{},
 					&invoice_models.TeamBalanceDailyLog{},
 				))
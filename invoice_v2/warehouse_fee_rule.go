@@ -0,0 +1,127 @@
+package invoice_v2
+
+import (
+	"errors"
+
+	"github.com/pdcgo/invoice_service/invoice_models"
+	invoice_iface "github.com/pdcgo/schema/services/invoice_iface/v2"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"gorm.io/gorm"
+)
+
+// FeeOrderFacts is what the warehouse fee rules price an order on.
+type FeeOrderFacts struct {
+	WarehouseID uint64
+	TeamID      uint64 // ordering team, the counterparty of the warehouse
+	OrderFrom   string
+	ItemCount   int
+}
+
+// FeeRuleMatch is the rule version that priced an order and the fee it computed.
+type FeeRuleMatch struct {
+	RuleID  uint64
+	Version int
+	Fee     float64
+}
+
+// EvaluateWarehouseFee prices an order with the warehouse's active fee rules, taking the
+// current version of each in priority order (highest first, ties by id) and returning the
+// first that matches. nil means no rule matched and the caller keeps its own fee.
+func EvaluateWarehouseFee(tx *gorm.DB, facts *FeeOrderFacts) (*FeeRuleMatch, error) {
+	var versions []*invoice_models.WarehouseFeeRuleVersion
+	err := tx.
+		Table("warehouse_fee_rules r").
+		Joins("join warehouse_fee_rule_versions v on v.rule_id = r.id and v.version = r.current_version").
+		Where("r.warehouse_id = ? AND r.active = ?", facts.WarehouseID, true).
+		Order("r.priority DESC, r.id").
+		Select("v.*").
+		Find(&versions).
+		Error
+	if err != nil {
+		return nil, err
+	}
+
+	for _, v := range versions {
+		if !feeRuleMatches(v, facts) {
+			continue
+		}
+		return &FeeRuleMatch{
+			RuleID:  v.RuleID,
+			Version: v.Version,
+			Fee:     v.BaseFee + v.PerItemFee*float64(facts.ItemCount),
+		}, nil
+	}
+	return nil, nil
+}
+
+func feeRuleMatches(v *invoice_models.WarehouseFeeRuleVersion, facts *FeeOrderFacts) bool {
+	if v.OrderFrom != "" && v.OrderFrom != facts.OrderFrom {
+		return false
+	}
+	if v.ForTeamID != nil && *v.ForTeamID != facts.TeamID {
+		return false
+	}
+	if facts.ItemCount < v.MinItems || (v.MaxItems > 0 && facts.ItemCount > v.MaxItems) {
+		return false
+	}
+	return true
+}
+
+// validateFeeRuleSpec rejects specs that could never match or would price negatively.
+// That includes weight bands: orders carry no weight, so rules don't store one.
+func validateFeeRuleSpec(spec *invoice_iface.WarehouseFeeRuleSpec) error {
+	if spec == nil {
+		return errors.New("spec is required")
+	}
+	if spec.MinWeightGram != 0 || spec.MaxWeightGram != 0 {
+		return errors.New("weight bands are not supported: orders carry no weight")
+	}
+	if spec.MinItems < 0 || spec.MaxItems < 0 {
+		return errors.New("bounds must not be negative")
+	}
+	if spec.MaxItems > 0 && spec.MaxItems < spec.MinItems {
+		return errors.New("max_items must not be below min_items")
+	}
+	if spec.BaseFee < 0 || spec.PerItemFee < 0 {
+		return errors.New("fees must not be negative")
+	}
+	if spec.BaseFee == 0 && spec.PerItemFee == 0 {
+		return errors.New("base_fee or per_item_fee is required")
+	}
+	return nil
+}
+
+func toModelFeeRuleVersion(spec *invoice_iface.WarehouseFeeRuleSpec) invoice_models.WarehouseFeeRuleVersion {
+	return invoice_models.WarehouseFeeRuleVersion{
+		OrderFrom:  spec.OrderFrom,
+		ForTeamID:  spec.ForTeamId,
+		MinItems:   int(spec.MinItems),
+		MaxItems:   int(spec.MaxItems),
+		BaseFee:    spec.BaseFee,
+		PerItemFee: spec.PerItemFee,
+	}
+}
+
+func toProtoFeeRuleSpec(v *invoice_models.WarehouseFeeRuleVersion) *invoice_iface.WarehouseFeeRuleSpec {
+	return &invoice_iface.WarehouseFeeRuleSpec{
+		OrderFrom:  v.OrderFrom,
+		ForTeamId:  v.ForTeamID,
+		MinItems:   int32(v.MinItems),
+		MaxItems:   int32(v.MaxItems),
+		BaseFee:    v.BaseFee,
+		PerItemFee: v.PerItemFee,
+	}
+}
+
+func toProtoFeeRule(r *invoice_models.WarehouseFeeRule, v *invoice_models.WarehouseFeeRuleVersion) *invoice_iface.WarehouseFeeRule {
+	return &invoice_iface.WarehouseFeeRule{
+		Id:          r.ID,
+		WarehouseId: r.WarehouseID,
+		Name:        r.Name,
+		Priority:    int32(r.Priority),
+		Active:      r.Active,
+		Version:     int32(r.CurrentVersion),
+		Spec:        toProtoFeeRuleSpec(v),
+		UpdatedAt:   timestamppb.New(r.UpdatedAt),
+	}
+}
@@ -0,0 +1,70 @@
+package invoice_v2
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"connectrpc.com/connect"
+	"github.com/pdcgo/invoice_service/invoice_models"
+	invoice_iface "github.com/pdcgo/schema/services/invoice_iface/v2"
+	"github.com/pdcgo/user_service/access_interceptors"
+	"gorm.io/gorm"
+)
+
+// WarehouseFeeRuleCreate implements [invoice_ifaceconnect.InvoiceServiceHandler]. It adds
+// a fee rule for the warehouse team (warehouse_id) with its first version. The rule takes
+// effect for the next order event of that warehouse; orders already posted keep the fee
+// (and the rule attribution) they were posted with.
+func (s *invoiceServiceImpl) WarehouseFeeRuleCreate(
+	ctx context.Context,
+	req *connect.Request[invoice_iface.WarehouseFeeRuleCreateRequest],
+) (*connect.Response[invoice_iface.WarehouseFeeRuleCreateResponse], error) {
+	pay := req.Msg
+
+	if pay.WarehouseId == 0 {
+		return nil, connect.NewError(connect.CodeInvalidArgument, errors.New("warehouse_id is required"))
+	}
+	if pay.Name == "" {
+		return nil, connect.NewError(connect.CodeInvalidArgument, errors.New("name is required"))
+	}
+	if err := validateFeeRuleSpec(pay.Spec); err != nil {
+		return nil, connect.NewError(connect.CodeInvalidArgument, err)
+	}
+
+	caller, err := access_interceptors.GetIdentityFromCtx(ctx)
+	if err != nil {
+		return nil, connect.NewError(connect.CodeUnauthenticated, err)
+	}
+
+	now := time.Now()
+	rule := invoice_models.WarehouseFeeRule{
+		WarehouseID:    pay.WarehouseId,
+		Name:           pay.Name,
+		Priority:       int(pay.Priority),
+		Active:         true,
+		CurrentVersion: 1,
+		CreatedByID:    uint64(caller.IdentityId),
+		CreatedAt:      now,
+		UpdatedAt:      now,
+	}
+	version := toModelFeeRuleVersion(pay.Spec)
+
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&rule).Error; err != nil {
+			return err
+		}
+		version.RuleID = rule.ID
+		version.Version = 1
+		version.CreatedByID = rule.CreatedByID
+		version.CreatedAt = now
+		return tx.Create(&version).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return connect.NewResponse(&invoice_iface.WarehouseFeeRuleCreateResponse{
+		Rule: toProtoFeeRule(&rule, &version),
+	}), nil
+}
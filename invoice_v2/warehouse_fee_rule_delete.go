@@ -0,0 +1,38 @@
+package invoice_v2
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"connectrpc.com/connect"
+	"github.com/pdcgo/invoice_service/invoice_models"
+	invoice_iface "github.com/pdcgo/schema/services/invoice_iface/v2"
+)
+
+// WarehouseFeeRuleDelete implements [invoice_ifaceconnect.InvoiceServiceHandler]. It
+// deactivates the rule so it no longer prices new orders. The rule and its versions are
+// kept (posted order sources reference them); WarehouseFeeRuleUpdate brings it back.
+func (s *invoiceServiceImpl) WarehouseFeeRuleDelete(
+	ctx context.Context,
+	req *connect.Request[invoice_iface.WarehouseFeeRuleDeleteRequest],
+) (*connect.Response[invoice_iface.WarehouseFeeRuleDeleteResponse], error) {
+	pay := req.Msg
+
+	res := s.db.
+		WithContext(ctx).
+		Model(&invoice_models.WarehouseFeeRule{}).
+		Where("id = ? AND warehouse_id = ?", pay.RuleId, pay.WarehouseId).
+		Updates(map[string]interface{}{
+			"active":     false,
+			"updated_at": time.Now(),
+		})
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	if res.RowsAffected == 0 {
+		return nil, connect.NewError(connect.CodeNotFound, errors.New("fee rule not found"))
+	}
+
+	return connect.NewResponse(&invoice_iface.WarehouseFeeRuleDeleteResponse{}), nil
+}
@@ -0,0 +1,77 @@
+package invoice_v2
+
+import (
+	"context"
+	"errors"
+
+	"connectrpc.com/connect"
+	"github.com/pdcgo/invoice_service/invoice_models"
+	"github.com/pdcgo/schema/services/common/v1"
+	invoice_iface "github.com/pdcgo/schema/services/invoice_iface/v2"
+	"github.com/pdcgo/shared/db_connect"
+	"gorm.io/gorm"
+)
+
+// WarehouseFeeRuleList implements [invoice_ifaceconnect.InvoiceServiceHandler]. It lists
+// the warehouse team's fee rules with their current version, in evaluation order
+// (priority first), paginated. Inactive rules are included only on request.
+func (s *invoiceServiceImpl) WarehouseFeeRuleList(
+	ctx context.Context,
+	req *connect.Request[invoice_iface.WarehouseFeeRuleListRequest],
+) (*connect.Response[invoice_iface.WarehouseFeeRuleListResponse], error) {
+	pay := req.Msg
+	if pay.Page == nil {
+		return nil, connect.NewError(connect.CodeInvalidArgument, errors.New("page is required"))
+	}
+
+	result := &invoice_iface.WarehouseFeeRuleListResponse{
+		Items:    []*invoice_iface.WarehouseFeeRule{},
+		PageInfo: &common.PageInfo{},
+	}
+	db := s.db.WithContext(ctx)
+
+	var rules []*invoice_models.WarehouseFeeRule
+	paginated, pageInfo, err := db_connect.SetPaginationQuery(db, func() (*gorm.DB, error) {
+		query := db.
+			Model(&invoice_models.WarehouseFeeRule{}).
+			Where("warehouse_id = ?", pay.WarehouseId)
+		if !pay.IncludeInactive {
+			query = query.Where("active = ?", true)
+		}
+		return query, nil
+	}, pay.Page)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := paginated.Order("priority DESC, id").Find(&rules).Error; err != nil {
+		return nil, err
+	}
+	result.PageInfo = pageInfo
+	if len(rules) == 0 {
+		return connect.NewResponse(result), nil
+	}
+
+	keys := make([][]interface{}, 0, len(rules))
+	for _, r := range rules {
+		keys = append(keys, []interface{}{r.ID, r.CurrentVersion})
+	}
+	var versions []*invoice_models.WarehouseFeeRuleVersion
+	if err := db.Where("(rule_id, version) IN ?", keys).Find(&versions).Error; err != nil {
+		return nil, err
+	}
+	current := make(map[uint64]*invoice_models.WarehouseFeeRuleVersion, len(versions))
+	for _, v := range versions {
+		current[v.RuleID] = v
+	}
+
+	for _, r := range rules {
+		v := current[r.ID]
+		if v == nil {
+			v = &invoice_models.WarehouseFeeRuleVersion{}
+		}
+		result.Items = append(result.Items, toProtoFeeRule(r, v))
+	}
+
+	return connect.NewResponse(result), nil
+}
@@ -0,0 +1,132 @@
+package invoice_v2_test
+
+import (
+	"context"
+	"testing"
+
+	"connectrpc.com/connect"
+	"github.com/pdcgo/invoice_service/invoice_models"
+	"github.com/pdcgo/invoice_service/invoice_v2"
+	"github.com/pdcgo/schema/services/common/v1"
+	invoice_iface "github.com/pdcgo/schema/services/invoice_iface/v2"
+	role_base "github.com/pdcgo/schema/services/role_base/v1"
+	"github.com/pdcgo/shared/pkg/moretest"
+	"github.com/pdcgo/shared/pkg/moretest/moretest_mock"
+	"github.com/pdcgo/user_service/access_interceptors"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func TestWarehouseFeeRuleCRUD(t *testing.T) {
+	var scenario moretest_mock.DbScenario
+
+	moretest.Suite(t, "warehouse fee rule crud",
+		moretest.SetupListFunc{
+			moretest_mock.MockPostgresDatabase(&scenario),
+		},
+		func(t *testing.T) {
+			scenario(t, func(tx *gorm.DB) {
+				assert.NoError(t, tx.AutoMigrate(
+					&invoice_models.WarehouseFeeRule{},
+					&invoice_models.WarehouseFeeRuleVersion{},
+				))
+
+				svc := invoice_v2.NewInvoiceService(tx)
+				ctx := access_interceptors.SetIdentityToCtx(
+					context.Background(),
+					&role_base.Identity{IdentityId: 7},
+				)
+				const warehouse = uint64(9)
+
+				list := func(inactive bool) []*invoice_iface.WarehouseFeeRule {
+					res, err := svc.WarehouseFeeRuleList(ctx, connect.NewRequest(&invoice_iface.WarehouseFeeRuleListRequest{
+						WarehouseId:     warehouse,
+						IncludeInactive: inactive,
+						Page:            &common.PageFilter{Page: 1, Limit: 20},
+					}))
+					assert.NoError(t, err)
+					return res.Msg.GetItems()
+				}
+				evaluate := func(items int) *invoice_v2.FeeRuleMatch {
+					match, err := invoice_v2.EvaluateWarehouseFee(tx, &invoice_v2.FeeOrderFacts{
+						WarehouseID: warehouse, TeamID: 1, OrderFrom: "shopee", ItemCount: items,
+					})
+					assert.NoError(t, err)
+					return match
+				}
+
+				var bulkID, flatID uint64
+
+				t.Run("create validates and stores version 1", func(t *testing.T) {
+					_, err := svc.WarehouseFeeRuleCreate(ctx, connect.NewRequest(&invoice_iface.WarehouseFeeRuleCreateRequest{
+						WarehouseId: warehouse, Name: "bad", Spec: &invoice_iface.WarehouseFeeRuleSpec{MinItems: 5, MaxItems: 2, BaseFee: 1},
+					}))
+					assert.Equal(t, connect.CodeInvalidArgument, connect.CodeOf(err))
+
+					// orders carry no weight, so weight bands are refused.
+					_, err = svc.WarehouseFeeRuleCreate(ctx, connect.NewRequest(&invoice_iface.WarehouseFeeRuleCreateRequest{
+						WarehouseId: warehouse, Name: "heavy", Spec: &invoice_iface.WarehouseFeeRuleSpec{MinWeightGram: 1000, BaseFee: 1},
+					}))
+					assert.Equal(t, connect.CodeInvalidArgument, connect.CodeOf(err))
+
+					res, err := svc.WarehouseFeeRuleCreate(ctx, connect.NewRequest(&invoice_iface.WarehouseFeeRuleCreateRequest{
+						WarehouseId: warehouse, Name: "flat", Priority: 0,
+						Spec: &invoice_iface.WarehouseFeeRuleSpec{BaseFee: 10},
+					}))
+					assert.NoError(t, err)
+					flatID = res.Msg.GetRule().Id
+
+					res, err = svc.WarehouseFeeRuleCreate(ctx, connect.NewRequest(&invoice_iface.WarehouseFeeRuleCreateRequest{
+						WarehouseId: warehouse, Name: "bulk", Priority: 5,
+						Spec: &invoice_iface.WarehouseFeeRuleSpec{MinItems: 10, PerItemFee: 1},
+					}))
+					assert.NoError(t, err)
+					bulkID = res.Msg.GetRule().Id
+					assert.Equal(t, int32(1), res.Msg.GetRule().Version)
+
+					items := list(false)
+					assert.Len(t, items, 2)
+					assert.Equal(t, bulkID, items[0].Id) // higher priority first
+				})
+
+				t.Run("evaluator takes the first matching rule by priority", func(t *testing.T) {
+					assert.Equal(t, &invoice_v2.FeeRuleMatch{RuleID: bulkID, Version: 1, Fee: 12}, evaluate(12))
+					assert.Equal(t, &invoice_v2.FeeRuleMatch{RuleID: flatID, Version: 1, Fee: 10}, evaluate(2))
+				})
+
+				t.Run("update appends a version and keeps history", func(t *testing.T) {
+					res, err := svc.WarehouseFeeRuleUpdate(ctx, connect.NewRequest(&invoice_iface.WarehouseFeeRuleUpdateRequest{
+						WarehouseId: warehouse, RuleId: flatID, Name: "flat", Priority: 0,
+						Spec: &invoice_iface.WarehouseFeeRuleSpec{BaseFee: 8},
+					}))
+					assert.NoError(t, err)
+					assert.Equal(t, int32(2), res.Msg.GetRule().Version)
+					assert.Equal(t, &invoice_v2.FeeRuleMatch{RuleID: flatID, Version: 2, Fee: 8}, evaluate(2))
+
+					hist, err := svc.WarehouseFeeRuleVersionList(ctx, connect.NewRequest(&invoice_iface.WarehouseFeeRuleVersionListRequest{
+						WarehouseId: warehouse, RuleId: flatID,
+					}))
+					assert.NoError(t, err)
+					assert.Len(t, hist.Msg.GetItems(), 2)
+					assert.Equal(t, float64(10), hist.Msg.GetItems()[1].Spec.BaseFee)
+
+					// another warehouse cannot touch the rule.
+					_, err = svc.WarehouseFeeRuleUpdate(ctx, connect.NewRequest(&invoice_iface.WarehouseFeeRuleUpdateRequest{
+						WarehouseId: 99, RuleId: flatID, Name: "x", Spec: &invoice_iface.WarehouseFeeRuleSpec{BaseFee: 1},
+					}))
+					assert.Equal(t, connect.CodeNotFound, connect.CodeOf(err))
+				})
+
+				t.Run("delete deactivates", func(t *testing.T) {
+					_, err := svc.WarehouseFeeRuleDelete(ctx, connect.NewRequest(&invoice_iface.WarehouseFeeRuleDeleteRequest{
+						WarehouseId: warehouse, RuleId: flatID,
+					}))
+					assert.NoError(t, err)
+					assert.Len(t, list(false), 1)
+					assert.Len(t, list(true), 2)
+					assert.Nil(t, evaluate(2))
+				})
+			})
+		},
+	)
+}
@@ -0,0 +1,86 @@
+package invoice_v2
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"connectrpc.com/connect"
+	"github.com/pdcgo/invoice_service/invoice_models"
+	invoice_iface "github.com/pdcgo/schema/services/invoice_iface/v2"
+	"github.com/pdcgo/user_service/access_interceptors"
+	"gorm.io/gorm"
+)
+
+// WarehouseFeeRuleUpdate implements [invoice_ifaceconnect.InvoiceServiceHandler]. It
+// appends a new version of the rule with the given spec and makes it current (name and
+// priority are updated in place); earlier versions stay so posted fees remain explainable.
+// Updating an inactive rule reactivates it.
+func (s *invoiceServiceImpl) WarehouseFeeRuleUpdate(
+	ctx context.Context,
+	req *connect.Request[invoice_iface.WarehouseFeeRuleUpdateRequest],
+) (*connect.Response[invoice_iface.WarehouseFeeRuleUpdateResponse], error) {
+	pay := req.Msg
+
+	if pay.Name == "" {
+		return nil, connect.NewError(connect.CodeInvalidArgument, errors.New("name is required"))
+	}
+	if err := validateFeeRuleSpec(pay.Spec); err != nil {
+		return nil, connect.NewError(connect.CodeInvalidArgument, err)
+	}
+
+	caller, err := access_interceptors.GetIdentityFromCtx(ctx)
+	if err != nil {
+		return nil, connect.NewError(connect.CodeUnauthenticated, err)
+	}
+
+	now := time.Now()
+	var rule invoice_models.WarehouseFeeRule
+	version := toModelFeeRuleVersion(pay.Spec)
+
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		res := lockForUpdate(tx).
+			Where("id = ? AND warehouse_id = ?", pay.RuleId, pay.WarehouseId).
+			Limit(1).
+			Find(&rule)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return connect.NewError(connect.CodeNotFound, errors.New("fee rule not found"))
+		}
+
+		rule.Name = pay.Name
+		rule.Priority = int(pay.Priority)
+		rule.Active = true
+		rule.CurrentVersion++
+		rule.UpdatedAt = now
+
+		version.RuleID = rule.ID
+		version.Version = rule.CurrentVersion
+		version.CreatedByID = uint64(caller.IdentityId)
+		version.CreatedAt = now
+		if err := tx.Create(&version).Error; err != nil {
+			return err
+		}
+
+		return tx.
+			Model(&invoice_models.WarehouseFeeRule{}).
+			Where("id = ?", rule.ID).
+			Updates(map[string]interface{}{
+				"name":            rule.Name,
+				"priority":        rule.Priority,
+				"active":          rule.Active,
+				"current_version": rule.CurrentVersion,
+				"updated_at":      rule.UpdatedAt,
+			}).
+			Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return connect.NewResponse(&invoice_iface.WarehouseFeeRuleUpdateResponse{
+		Rule: toProtoFeeRule(&rule, &version),
+	}), nil
+}
@@ -0,0 +1,48 @@
+package invoice_v2
+
+import (
+	"context"
+
+	"connectrpc.com/connect"
+	"github.com/pdcgo/invoice_service/invoice_models"
+	invoice_iface "github.com/pdcgo/schema/services/invoice_iface/v2"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// WarehouseFeeRuleVersionList implements [invoice_ifaceconnect.InvoiceServiceHandler]. It
+// returns every version of one of the warehouse's fee rules, newest first — the history
+// an order source's (fee_rule_id, fee_rule_version) points into.
+func (s *invoiceServiceImpl) WarehouseFeeRuleVersionList(
+	ctx context.Context,
+	req *connect.Request[invoice_iface.WarehouseFeeRuleVersionListRequest],
+) (*connect.Response[invoice_iface.WarehouseFeeRuleVersionListResponse], error) {
+	pay := req.Msg
+
+	var versions []*invoice_models.WarehouseFeeRuleVersion
+	err := s.db.
+		WithContext(ctx).
+		Table("warehouse_fee_rule_versions v").
+		Joins("join warehouse_fee_rules r on r.id = v.rule_id").
+		Where("r.id = ? AND r.warehouse_id = ?", pay.RuleId, pay.WarehouseId).
+		Order("v.version DESC").
+		Select("v.*").
+		Find(&versions).
+		Error
+	if err != nil {
+		return nil, err
+	}
+
+	result := &invoice_iface.WarehouseFeeRuleVersionListResponse{
+		Items: make([]*invoice_iface.WarehouseFeeRuleVersion, 0, len(versions)),
+	}
+	for _, v := range versions {
+		result.Items = append(result.Items, &invoice_iface.WarehouseFeeRuleVersion{
+			Version:     int32(v.Version),
+			Spec:        toProtoFeeRuleSpec(v),
+			CreatedById: v.CreatedByID,
+			CreatedAt:   timestamppb.New(v.CreatedAt),
+		})
+	}
+
+	return connect.NewResponse(result), nil
+}
@@ -2,10 +2,12 @@ package invoice_service
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/http"
 	"time"
 
+	"connectrpc.com/connect"
 	"github.com/pdcgo/event_source"
 	"github.com/pdcgo/invoice_service/invoice_models"
 	"github.com/pdcgo/invoice_service/invoice_v2"
@@ -14,6 +16,7 @@ import (
 	"github.com/pdcgo/schema/services/selling_iface/v1"
 	"github.com/pdcgo/schema/services/warehouse_iface/v1"
 	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
 	"gorm.io/gorm"
 	"gorm.io/gorm/clause"
 )
@@ -25,13 +28,23 @@ type InvoicePushHandler event_source.PushHandler
 // same transaction as the balance work: if it already exists the message was applied
 // before and we skip; if the work fails the whole transaction (inbox row included) rolls
 // back so a redelivery reprocesses it. This guards against Pub/Sub redelivery
-// double-posting balances. Mirrors inventory_service.NewInventoryPushHandler.
+// double-posting balances. The owe limits of the pairs an event posted to are dropped
+// from oweLimitCache afterwards. Mirrors inventory_service.NewInventoryPushHandler.
 func NewInvoicePushHandler(
 	db *gorm.DB,
 	projectCfg *san_config.ProjectConfig,
+	oweLimitCache *invoice_v2.OweLimitCache,
 ) InvoicePushHandler {
 
 	return func(ctx context.Context, msg *event_source.PushRequest) error {
+		post, err := decodeInvoiceEvent(projectCfg, msg)
+		if err != nil {
+			return err
+		}
+
+		ctx, done := oweLimitCache.Track(ctx)
+		defer done()
+
 		return db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
 			seen := invoice_models.InvoiceExactlyOnceLog{
 				ID:           msg.Message.MessageID,
@@ -45,50 +58,108 @@ func NewInvoicePushHandler(
 			if res.RowsAffected == 0 {
 				return nil // already processed
 			}
+			if post == nil {
+				return nil // not an event the ledger acts on
+			}
+			return post(tx)
+		})
+	}
+}
 
-			switch msg.Subscription {
-			case projectCfg.PubsubSubscriberPath("invoice-selling-sub"):
-				var event selling_iface.SellingEvent
-				if err := protojson.Unmarshal(msg.Message.Data, &event); err != nil {
-					return err
-				}
-
-				switch data := event.Data.(type) {
-				case *selling_iface.SellingEvent_OrderCreated:
-					oc := data.OrderCreated
-					return postOrderBalances(tx, oc.OrderId, false, oc.TransactionTime.AsTime())
-				case *selling_iface.SellingEvent_OrderCanceled:
-					oc := data.OrderCanceled
-					return postOrderBalances(tx, oc.OrderId, true, oc.TransactionTime.AsTime())
-
-				case *selling_iface.SellingEvent_PaymentAccept:
-					pa := data.PaymentAccept
-					return postPaymentAcceptBalance(tx, pa.SubmissionId, time.Now())
-				}
-			case projectCfg.PubsubSubscriberPath("invoice-stock-sub"):
-				var event warehouse_iface.StockEvent
-				if err := protojson.Unmarshal(msg.Message.Data, &event); err != nil {
-					return err
-				}
-
-				switch data := event.Data.(type) {
-				case *warehouse_iface.StockEvent_RestockAccepted:
-					ra := data.RestockAccepted
-					return postCodFeeBalance(tx, float64(ra.TransactionId), time.Now())
-				case *warehouse_iface.StockEvent_StockProblem:
-					sp := data.StockProblem
-					return postProblemStockBalance(tx, sp.TransactionId, time.Now())
-
-					// schema for foundback unsupproted
-					// case *warehouse_iface.StockEvent_StockFoundBack:
-					// 	debugtool.LogJson(data)
-					// 	return errors.New("unimplemented")
-				}
+// invoiceEventPost is the balance work a pushed event drives, run inside the caller's
+// transaction.
+type invoiceEventPost func(tx *gorm.DB) error
 
-			}
+// decodeInvoiceEvent decodes a pushed message into the balance work it drives, without
+// touching the database. A nil post (and nil error) means the subscription or event type
+// is not one the invoice ledger acts on. Shared by the push handler, event replay and
+// event simulation so they all derive postings the same way.
+func decodeInvoiceEvent(projectCfg *san_config.ProjectConfig, msg *event_source.PushRequest) (invoiceEventPost, error) {
+	switch msg.Subscription {
+	case projectCfg.PubsubSubscriberPath("invoice-selling-sub"):
+		var event selling_iface.SellingEvent
+		if err := protojson.Unmarshal(msg.Message.Data, &event); err != nil {
+			return nil, err
+		}
+
+		switch data := event.Data.(type) {
+		case *selling_iface.SellingEvent_OrderCreated:
+			oc := data.OrderCreated
+			return func(tx *gorm.DB) error {
+				return postOrderBalances(tx, oc.OrderId, false, oc.TransactionTime.AsTime())
+			}, nil
+		case *selling_iface.SellingEvent_OrderCanceled:
+			oc := data.OrderCanceled
+			return func(tx *gorm.DB) error {
+				return postOrderBalances(tx, oc.OrderId, true, oc.TransactionTime.AsTime())
+			}, nil
+
+		case *selling_iface.SellingEvent_PaymentAccept:
+			pa := data.PaymentAccept
+			return func(tx *gorm.DB) error {
+				return postPaymentAcceptBalance(tx, pa.SubmissionId, time.Now())
+			}, nil
+		}
+	case projectCfg.PubsubSubscriberPath("invoice-stock-sub"):
+		var event warehouse_iface.StockEvent
+		if err := protojson.Unmarshal(msg.Message.Data, &event); err != nil {
+			return nil, err
+		}
 
-			return nil
+		switch data := event.Data.(type) {
+		case *warehouse_iface.StockEvent_RestockAccepted:
+			ra := data.RestockAccepted
+			return func(tx *gorm.DB) error {
+				return postCodFeeBalance(tx, float64(ra.TransactionId), time.Now())
+			}, nil
+		case *warehouse_iface.StockEvent_StockProblem:
+			sp := data.StockProblem
+			return func(tx *gorm.DB) error {
+				return proposeProblemStockCompensation(tx, sp.TransactionId, time.Now())
+			}, nil
+
+			// schema for foundback unsupproted
+			// case *warehouse_iface.StockEvent_StockFoundBack:
+			// 	debugtool.LogJson(data)
+			// 	return errors.New("unimplemented")
+		}
+
+	}
+
+	return nil, nil
+}
+
+// NewInvoiceEventApplier adapts the push handler's event logic to
+// [invoice_v2.EventApplier] for SimulateEvent: the event is encoded the way Pub/Sub
+// would deliver it and posted through decodeInvoiceEvent, so a simulation derives fees
+// exactly like a real delivery, minus the inbox.
+func NewInvoiceEventApplier(projectCfg *san_config.ProjectConfig) invoice_v2.EventApplier {
+	return func(tx *gorm.DB, event proto.Message) error {
+		var sub string
+		switch event.(type) {
+		case *selling_iface.SellingEvent:
+			sub = "invoice-selling-sub"
+		case *warehouse_iface.StockEvent:
+			sub = "invoice-stock-sub"
+		default:
+			return connect.NewError(connect.CodeInvalidArgument, fmt.Errorf("unsupported event %T", event))
+		}
+
+		data, err := protojson.Marshal(event)
+		if err != nil {
+			return err
+		}
+		post, err := decodeInvoiceEvent(projectCfg, &event_source.PushRequest{
+			Subscription: projectCfg.PubsubSubscriberPath(sub),
+			Message:      event_source.PushMessage{Data: data},
 		})
+		if err != nil {
+			return connect.NewError(connect.CodeInvalidArgument, err)
+		}
+		if post == nil {
+			return connect.NewError(connect.CodeInvalidArgument, errors.New("event type is not one the invoice ledger acts on"))
+		}
+		return post(tx)
 	}
 }
 
@@ -97,31 +168,55 @@ type ProblemStock struct {
 	Amount      float64
 	ForTeamID   uint64
 	ProductName string
+	ProblemType string
+	InvTxItemID uint64
+	SkuID       string
+	Count       int
+}
+
+// problemCompensationTypes maps the warehouse-side legacy problem types to the
+// compensation they raise. Shipping-side problems (lost_s, broken_s) are not the
+// warehouse's to compensate.
+var problemCompensationTypes = map[string]invoice_iface.CompensationType{
+	"lost_w":   invoice_iface.CompensationType_COMPENSATION_TYPE_LOST,
+	"broken_w": invoice_iface.CompensationType_COMPENSATION_TYPE_DAMAGED,
 }
 
-// postProblemStockBalance posts a STOCK_PROBLEM double entry for each warehouse-side
+// proposeProblemStockCompensation proposes a compensation for each warehouse-side
 // lost/broken item of a transaction: the warehouse (team_id) owes the product team
-// (for_team_id) the value of the lost/broken stock. It is forward-only — recovery
+// (for_team_id) for the stock, valued by the warehouse's policy (cost is the line
+// value). Nothing posts until the product team accepts it (CompensationAccept posts
+// the STOCK_PROBLEM entry). Items already proposed are skipped, so a transaction
+// that reports problems twice is not double-counted. It is forward-only — recovery
 // (StockFoundBack) is handled separately.
-func postProblemStockBalance(tx *gorm.DB, transactionId uint64, now time.Time) error {
+func proposeProblemStockCompensation(tx *gorm.DB, transactionId uint64, now time.Time) error {
 	items, err := getProblemStock(tx, transactionId)
 	if err != nil {
 		return err
 	}
 	for _, item := range items {
 		// skip degenerate rows so a bad row isn't a poison message.
-		if item.TeamID == 0 || item.ForTeamID == 0 || item.TeamID == item.ForTeamID || item.Amount <= 0 {
+		if item.TeamID == 0 || item.ForTeamID == 0 || item.TeamID == item.ForTeamID {
 			continue
 		}
-		note := fmt.Sprintf("stock problem tx %d %s", transactionId, item.ProductName)
-		// The warehouse (team_id) owes the product team (for_team_id): a RECEIVABLE on
-		// the product-team side mirrors to a PAYABLE on the warehouse side.
-		if err := invoice_v2.PostBalanceLog(
-			tx, item.ForTeamID, item.TeamID,
-			invoice_iface.BalanceChangeType_BALANCE_CHANGE_TYPE_STOCK_PROBLEM,
-			item.Amount, invoice_iface.BalanceType_BALANCE_TYPE_RECEIVABLE,
-			note, 0, now,
-		); err != nil {
+		count := item.Count
+		if count <= 0 {
+			count = 1
+		}
+		txID, itemID := transactionId, item.InvTxItemID
+		_, err := invoice_v2.ProposeCompensation(tx, &invoice_v2.CompensationProposal{
+			WarehouseID:      item.TeamID,
+			TeamID:           item.ForTeamID,
+			Type:             problemCompensationTypes[item.ProblemType],
+			InvTransactionID: &txID,
+			InvTxItemID:      &itemID,
+			SkuID:            item.SkuID,
+			ProductName:      item.ProductName,
+			Count:            count,
+			Cost:             item.Amount,
+			Note:             fmt.Sprintf("stock problem tx %d %s", transactionId, item.ProductName),
+		}, now)
+		if err != nil {
 			return err
 		}
 	}
@@ -130,7 +225,8 @@ func postProblemStockBalance(tx *gorm.DB, transactionId uint64, now time.Time) e
 
 // getProblemStock returns the warehouse-side problem items (lost/broken at the
 // warehouse) of an inv transaction: the warehouse that holds the stock (team_id),
-// the line value (amount), the product-owning team (for_team_id) and product name.
+// the line value (amount), the product-owning team (for_team_id), product name,
+// problem type and the problem tx item.
 func getProblemStock(tx *gorm.DB, transactionId uint64) ([]*ProblemStock, error) {
 	items := []*ProblemStock{}
 	err := tx.
@@ -146,6 +242,10 @@ func getProblemStock(tx *gorm.DB, transactionId uint64) ([]*ProblemStock, error)
 			"iti.total as amount",
 			"s.team_id as for_team_id",
 			"p.name as product_name",
+			"iip.problem_type",
+			"iip.tx_item_id as inv_tx_item_id",
+			"iti.sku_id",
+			"iti.count",
 		}).
 		Find(&items).
 		Error
@@ -306,17 +406,57 @@ func getProductCrossItem(tx *gorm.DB, orderID uint64) ([]*ProductCrossItem, erro
 
 // postWarehouseFeeBalance posts (or reverses) the WAREHOUSE_FEE double entry for
 // an order: the ordering team A owes the warehouse team B the order's warehouse
-// fee. reverse=true undoes it (swaps the pair and the balance type), so
-// create+cancel for the same order nets to zero.
+// fee. On create the fee comes from the warehouse's fee rules (EvaluateWarehouseFee)
+// and falls back to orders.warehouse_fee when no rule matches. reverse=true undoes
+// the fee that was actually posted for the order, with the same rule attribution,
+// so create+cancel nets to zero even if the rules changed in between.
 func postWarehouseFeeBalance(tx *gorm.DB, orderID uint64, reverse bool, now time.Time) error {
 	info, err := getWarehouseFee(tx, orderID)
 	if err != nil {
 		return err
 	}
-	// skip degenerate rows (no warehouse, zero fee, etc.) so a bad row isn't a poison message.
-	if info.TeamID == 0 || info.WarehouseID == 0 || info.TeamID == info.WarehouseID || info.Fee <= 0 {
+	// skip degenerate rows (no warehouse, etc.) so a bad row isn't a poison message.
+	if info.TeamID == 0 || info.WarehouseID == 0 || info.TeamID == info.WarehouseID {
+		return nil
+	}
+
+	src := &invoice_v2.OrderSource{
+		OrderSystem: invoice_iface.OrderSystem_ORDER_SYSTEM_LEGACY,
+		OrderID:     orderID,
+		TeamID:      info.TeamID, // ordering team, constant on create + reverse
+		WarehouseID: info.WarehouseID,
+	}
+	fee := info.Fee
+
+	if reverse {
+		posted, err := getPostedWarehouseFee(tx, orderID, info)
+		if err != nil {
+			return err
+		}
+		// no attributed leg: posted before order sources existed, reverse orders.warehouse_fee.
+		if posted != nil {
+			fee = posted.ChangeAmount
+			src.FeeRuleID, src.FeeRuleVersion = posted.FeeRuleID, posted.FeeRuleVersion
+		}
+	} else {
+		match, err := invoice_v2.EvaluateWarehouseFee(tx, &invoice_v2.FeeOrderFacts{
+			WarehouseID: info.WarehouseID,
+			TeamID:      info.TeamID,
+			OrderFrom:   info.OrderFrom,
+			ItemCount:   info.ItemCount,
+		})
+		if err != nil {
+			return err
+		}
+		if match != nil {
+			fee = match.Fee
+			src.FeeRuleID, src.FeeRuleVersion = &match.RuleID, &match.Version
+		}
+	}
+	if fee <= 0 {
 		return nil
 	}
+
 	team, forTeam := info.WarehouseID, info.TeamID // B owed by A
 	bt := invoice_iface.BalanceType_BALANCE_TYPE_RECEIVABLE
 	verb := ""
@@ -329,13 +469,8 @@ func postWarehouseFeeBalance(tx *gorm.DB, orderID uint64, reverse bool, now time
 	return invoice_v2.PostBalanceLog(
 		tx, team, forTeam,
 		invoice_iface.BalanceChangeType_BALANCE_CHANGE_TYPE_WAREHOUSE_FEE,
-		info.Fee, bt, note, info.CreatedByID, now,
-		&invoice_v2.OrderSource{
-			OrderSystem: invoice_iface.OrderSystem_ORDER_SYSTEM_LEGACY,
-			OrderID:     orderID,
-			TeamID:      info.TeamID, // ordering team, constant on create + reverse
-			WarehouseID: info.WarehouseID,
-		},
+		fee, bt, note, info.CreatedByID, now,
+		src,
 	)
 }
 
@@ -344,12 +479,15 @@ type OrderWarehouseFee struct {
 	WarehouseID     uint64
 	CreatedByID     uint64
 	OrderExternalID string
+	OrderFrom       string
+	ItemCount       int
 	Fee             float64
 }
 
 // getWarehouseFee returns the ordering team, the warehouse team that charged the
-// fee (the inv transaction's warehouse_id, used as a team id), and the fee amount
-// for an order. Zero values (e.g. no inv transaction) signal "nothing to post".
+// fee (the inv transaction's warehouse_id, used as a team id), the order facts the
+// fee rules price on, and orders.warehouse_fee. Zero values (e.g. no inv
+// transaction) signal "nothing to post".
 func getWarehouseFee(tx *gorm.DB, orderID uint64) (*OrderWarehouseFee, error) {
 	info := OrderWarehouseFee{}
 	err := tx.
@@ -361,6 +499,8 @@ func getWarehouseFee(tx *gorm.DB, orderID uint64) (*OrderWarehouseFee, error) {
 			"it.warehouse_id",
 			"o.created_by_id",
 			"o.order_ref_id as order_external_id",
+			"o.order_from",
+			"(select coalesce(sum(oi.count), 0) from order_items oi where oi.order_id = o.id) as item_count",
 			"o.warehouse_fee as fee",
 		}).
 		Find(&info).
@@ -371,6 +511,37 @@ func getWarehouseFee(tx *gorm.DB, orderID uint64) (*OrderWarehouseFee, error) {
 	return &info, nil
 }
 
+type PostedWarehouseFee struct {
+	ChangeAmount   float64
+	FeeRuleID      *uint64
+	FeeRuleVersion *int
+}
+
+// getPostedWarehouseFee returns the latest WAREHOUSE_FEE leg posted for the order's
+// create (the warehouse's receivable leg) with its rule attribution, or nil if the
+// order has no attributed leg.
+func getPostedWarehouseFee(tx *gorm.DB, orderID uint64, info *OrderWarehouseFee) (*PostedWarehouseFee, error) {
+	var posted PostedWarehouseFee
+	res := tx.
+		Table("balance_change_order_sources s").
+		Joins("join balance_change_logs l on l.id = s.balance_change_log_id").
+		Where("s.order_id = ? AND s.order_system = ?", orderID, invoice_iface.OrderSystem_ORDER_SYSTEM_LEGACY).
+		Where("l.change_type = ?", invoice_iface.BalanceChangeType_BALANCE_CHANGE_TYPE_WAREHOUSE_FEE).
+		Where("l.team_id = ? AND l.for_team_id = ?", info.WarehouseID, info.TeamID).
+		Where("l.balance_type = ? AND l.change_amount > 0", invoice_iface.BalanceType_BALANCE_TYPE_RECEIVABLE).
+		Order("l.id DESC").
+		Limit(1).
+		Select("l.change_amount, s.fee_rule_id, s.fee_rule_version").
+		Find(&posted)
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	if res.RowsAffected == 0 {
+		return nil, nil
+	}
+	return &posted, nil
+}
+
 type PaymentAcceptInfo struct {
 	TeamID    uint64 // payer (invoices.from_team_id, the debtor)
 	ForTeamID uint64 // receiver (invoices.to_team_id, the creditor)
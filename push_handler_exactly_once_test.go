@@ -34,6 +34,9 @@ func TestInvoicePushHandlerExactlyOnce(t *testing.T) {
 					&db_models.RestockCost{},
 					&invoice_models.TeamBalance{},
 					&invoice_models.BalanceChangeLog{},
+					&invoice_models.OweLimitAlertLevel{},
+					&invoice_models.BalanceOpenItem{},
+					&invoice_models.BalanceOpenItemAllocation{},
 					&invoice_models.TeamBalanceDailyLog{},
 					&invoice_models.InvoiceExactlyOnceLog{},
 				))
@@ -43,7 +46,7 @@ func TestInvoicePushHandlerExactlyOnce(t *testing.T) {
 				assert.NoError(t, db.Create(&db_models.RestockCost{InvTransactionID: 40, CodFee: 25}).Error)
 
 				projectCfg := &san_config.ProjectConfig{ProjectID: "test"}
-				handler := invoice_service.NewInvoicePushHandler(db, projectCfg)
+				handler := invoice_service.NewInvoicePushHandler(db, projectCfg, nil)
 				stockSub := projectCfg.PubsubSubscriberPath("invoice-stock-sub")
 
 				restock := &warehouse_iface.StockEvent{
@@ -37,6 +37,9 @@ func TestInvoicePushHandlerPaymentAccept(t *testing.T) {
 					&db_models.PSubmissionInv{},
 					&invoice_models.TeamBalance{},
 					&invoice_models.BalanceChangeLog{},
+					&invoice_models.OweLimitAlertLevel{},
+					&invoice_models.BalanceOpenItem{},
+					&invoice_models.BalanceOpenItemAllocation{},
 					&invoice_models.TeamBalanceDailyLog{},
 					&invoice_models.InvoiceExactlyOnceLog{},
 				))
@@ -74,7 +77,7 @@ func TestInvoicePushHandlerPaymentAccept(t *testing.T) {
 				}).Error)
 
 				projectCfg := &san_config.ProjectConfig{ProjectID: "test"}
-				handler := invoice_service.NewInvoicePushHandler(db, projectCfg)
+				handler := invoice_service.NewInvoicePushHandler(db, projectCfg, nil)
 				sellingSub := projectCfg.PubsubSubscriberPath("invoice-selling-sub")
 
 				accept := &selling_iface.SellingEvent{
@@ -4,16 +4,20 @@ import (
 	"testing"
 	"time"
 
+	"connectrpc.com/connect"
 	"github.com/pdcgo/event_source/event_source_mock"
 	"github.com/pdcgo/invoice_service"
 	"github.com/pdcgo/invoice_service/invoice_models"
+	"github.com/pdcgo/invoice_service/invoice_v2"
 	"github.com/pdcgo/san_collection/san_config"
 	invoice_iface "github.com/pdcgo/schema/services/invoice_iface/v2"
+	role_base "github.com/pdcgo/schema/services/role_base/v1"
 	"github.com/pdcgo/schema/services/selling_iface/v1"
 	"github.com/pdcgo/schema/services/warehouse_iface/v1"
 	"github.com/pdcgo/shared/db_models"
 	"github.com/pdcgo/shared/pkg/moretest"
 	"github.com/pdcgo/shared/pkg/moretest/moretest_mock"
+	"github.com/pdcgo/user_service/access_interceptors"
 	"github.com/stretchr/testify/assert"
 	"google.golang.org/protobuf/types/known/timestamppb"
 	"gorm.io/gorm"
@@ -58,9 +62,14 @@ func TestInvoicePushHandler(t *testing.T) {
 					&db_models.InvTransaction{},
 					&invoice_models.TeamBalance{},
 					&invoice_models.BalanceChangeLog{},
+					&invoice_models.OweLimitAlertLevel{},
+					&invoice_models.BalanceOpenItem{},
+					&invoice_models.BalanceOpenItemAllocation{},
 					&invoice_models.TeamBalanceDailyLog{},
 					&invoice_models.BalanceChangeOrderSource{},
 					&invoice_models.InvoiceExactlyOnceLog{},
+					&invoice_models.WarehouseFeeRule{},
+					&invoice_models.WarehouseFeeRuleVersion{},
 				))
 
 				// order team 1 sells products owned by team 2 (cross items), plus one owned item.
@@ -93,7 +102,7 @@ func TestInvoicePushHandler(t *testing.T) {
 				assert.NoError(t, db.Create(order).Error)
 
 				projectCfg := &san_config.ProjectConfig{ProjectID: "test"}
-				handler := invoice_service.NewInvoicePushHandler(db, projectCfg)
+				handler := invoice_service.NewInvoicePushHandler(db, projectCfg, nil)
 				txTime := time.Date(2026, 6, 8, 10, 0, 0, 0, time.UTC)
 
 				balanceOf := func(teamID, forTeamID uint64, bt invoice_iface.BalanceType) (invoice_models.TeamBalance, bool) {
@@ -226,6 +235,9 @@ func TestInvoicePushHandlerRestockCodFee(t *testing.T) {
 					&db_models.RestockCost{},
 					&invoice_models.TeamBalance{},
 					&invoice_models.BalanceChangeLog{},
+					&invoice_models.OweLimitAlertLevel{},
+					&invoice_models.BalanceOpenItem{},
+					&invoice_models.BalanceOpenItemAllocation{},
 					&invoice_models.TeamBalanceDailyLog{},
 					&invoice_models.InvoiceExactlyOnceLog{},
 				))
@@ -235,7 +247,7 @@ func TestInvoicePushHandlerRestockCodFee(t *testing.T) {
 				assert.NoError(t, db.Create(&db_models.RestockCost{InvTransactionID: 20, CodFee: 25}).Error)
 
 				projectCfg := &san_config.ProjectConfig{ProjectID: "test"}
-				handler := invoice_service.NewInvoicePushHandler(db, projectCfg)
+				handler := invoice_service.NewInvoicePushHandler(db, projectCfg, nil)
 
 				balanceOf := func(teamID, forTeamID uint64, bt invoice_iface.BalanceType) (invoice_models.TeamBalance, bool) {
 					var b invoice_models.TeamBalance
@@ -309,8 +321,13 @@ func TestInvoicePushHandlerStockProblem(t *testing.T) {
 					&testInvItemProblem{},
 					&invoice_models.TeamBalance{},
 					&invoice_models.BalanceChangeLog{},
+					&invoice_models.OweLimitAlertLevel{},
+					&invoice_models.BalanceOpenItem{},
+					&invoice_models.BalanceOpenItemAllocation{},
 					&invoice_models.TeamBalanceDailyLog{},
 					&invoice_models.InvoiceExactlyOnceLog{},
+					&invoice_models.StockCompensation{},
+					&invoice_models.WarehouseCompensationPolicy{},
 				))
 
 				// transaction 30 at warehouse 9; product 5 owned by team 2.
@@ -324,7 +341,7 @@ func TestInvoicePushHandlerStockProblem(t *testing.T) {
 				assert.NoError(t, db.Create(&testInvItemProblem{TxID: 30, TxItemID: 51, ProblemType: "lost_s"}).Error)
 
 				projectCfg := &san_config.ProjectConfig{ProjectID: "test"}
-				handler := invoice_service.NewInvoicePushHandler(db, projectCfg)
+				handler := invoice_service.NewInvoicePushHandler(db, projectCfg, nil)
 
 				balanceOf := func(teamID, forTeamID uint64, bt invoice_iface.BalanceType) (invoice_models.TeamBalance, bool) {
 					var b invoice_models.TeamBalance
@@ -333,15 +350,42 @@ func TestInvoicePushHandlerStockProblem(t *testing.T) {
 					return b, res.RowsAffected > 0
 				}
 
-				msg := event_source_mock.NewMockEvent(t, &warehouse_iface.StockEvent{
-					Data: &warehouse_iface.StockEvent_StockProblem{
-						StockProblem: &warehouse_iface.StockProblem{TransactionId: 30},
-					},
-				})
-				msg.Subscription = projectCfg.PubsubSubscriberPath("invoice-stock-sub")
-				assert.NoError(t, handler(t.Context(), msg))
+				push := func() {
+					msg := event_source_mock.NewMockEvent(t, &warehouse_iface.StockEvent{
+						Data: &warehouse_iface.StockEvent_StockProblem{
+							StockProblem: &warehouse_iface.StockProblem{TransactionId: 30},
+						},
+					})
+					msg.Subscription = projectCfg.PubsubSubscriberPath("invoice-stock-sub")
+					assert.NoError(t, handler(t.Context(), msg))
+				}
+				push()
+				push() // a second report of the same transaction is not re-proposed
+
+				// only the lost_w item (40) is proposed (lost_s excluded), and nothing posts
+				// before the product team reviews it.
+				var comps []invoice_models.StockCompensation
+				assert.NoError(t, db.Find(&comps).Error)
+				assert.Len(t, comps, 1)
+				comp := comps[0]
+				assert.Equal(t, uint64(9), comp.WarehouseID)
+				assert.Equal(t, uint64(2), comp.TeamID)
+				assert.Equal(t, invoice_iface.CompensationType_COMPENSATION_TYPE_LOST, comp.Type)
+				assert.Equal(t, invoice_iface.CompensationStatus_COMPENSATION_STATUS_PROPOSED, comp.Status)
+				assert.Equal(t, float64(40), comp.Amount)
+
+				var n int64
+				assert.NoError(t, db.Model(&invoice_models.BalanceChangeLog{}).Count(&n).Error)
+				assert.Equal(t, int64(0), n)
+
+				// accepting posts it: warehouse 9 owes product team 2.
+				svc := invoice_v2.NewInvoiceService(db)
+				ctx := access_interceptors.SetIdentityToCtx(t.Context(), &role_base.Identity{IdentityId: 7})
+				_, err := svc.CompensationAccept(ctx, connect.NewRequest(&invoice_iface.CompensationAcceptRequest{
+					TeamId: 2, CompensationId: comp.ID,
+				}))
+				assert.NoError(t, err)
 
-				// only the lost_w item (40) posts: warehouse 9 owes product team 2.
 				rcv, ok := balanceOf(2, 9, receivable)
 				assert.True(t, ok)
 				assert.Equal(t, float64(40), rcv.Balance)
@@ -349,8 +393,6 @@ func TestInvoicePushHandlerStockProblem(t *testing.T) {
 				assert.True(t, ok)
 				assert.Equal(t, float64(-40), pyb.Balance)
 
-				// one warehouse-side item x 2 legs (lost_s excluded).
-				var n int64
 				assert.NoError(t, db.Model(&invoice_models.BalanceChangeLog{}).Count(&n).Error)
 				assert.Equal(t, int64(2), n)
 
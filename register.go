@@ -6,6 +6,7 @@ import (
 	"connectrpc.com/connect"
 	"github.com/pdcgo/invoice_service/invoice_v2"
 	"github.com/pdcgo/san_collection/san_caches"
+	"github.com/pdcgo/san_collection/san_config"
 	"github.com/pdcgo/schema/services/invoice_iface/v2/invoice_ifaceconnect"
 	"github.com/pdcgo/shared/configs"
 	"github.com/pdcgo/shared/custom_connect"
@@ -20,23 +21,30 @@ type RegisterHandler func() ServiceReflectNames
 // gRPC-reflection service names. Only the v2 service is registered here; the
 // legacy grpc-gateway service is intentionally left out. The access interceptor
 // enforces each request's (role_base.v1.request_policy) and injects the caller
-// identity into context. It also mounts the Pub/Sub push endpoint.
+// identity into context; the owe-limit cache interceptor drops the cached owe limits
+// each request's writes touched. It also mounts the Pub/Sub push endpoint.
 func NewRegister(
 	mux *http.ServeMux,
 	db *gorm.DB,
 	cfg *configs.AppConfig,
 	defaultInterceptor custom_connect.DefaultInterceptor,
 	cacheMgr san_caches.CacheManager,
+	projectCfg *san_config.ProjectConfig,
 	invoicePushHttpHandler InvoicePushHttpHandler,
+	oweLimitCache *invoice_v2.OweLimitCache,
 ) RegisterHandler {
 	return func() ServiceReflectNames {
 		grpcReflects := ServiceReflectNames{}
 
 		roleOpt := connect.WithInterceptors(access_interceptors.NewAccessInterceptor(db, cfg.JwtSecret, cacheMgr))
 		path, handler := invoice_ifaceconnect.NewInvoiceServiceHandler(
-			invoice_v2.NewInvoiceService(db),
+			invoice_v2.NewInvoiceService(db,
+				invoice_v2.WithEventApplier(NewInvoiceEventApplier(projectCfg)),
+				invoice_v2.WithOweLimitCache(oweLimitCache),
+			),
 			defaultInterceptor,
 			roleOpt,
+			connect.WithInterceptors(oweLimitCache.Interceptor()),
 		)
 		mux.Handle(path, handler)
 		grpcReflects = append(grpcReflects, invoice_ifaceconnect.InvoiceServiceName)
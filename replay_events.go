@@ -0,0 +1,230 @@
+package invoice_service
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/pdcgo/event_source"
+	"github.com/pdcgo/invoice_service/invoice_models"
+	"github.com/pdcgo/san_collection/san_config"
+	"github.com/pdcgo/schema/services/selling_iface/v1"
+	"github.com/pdcgo/schema/services/warehouse_iface/v1"
+	"google.golang.org/protobuf/encoding/protojson"
+	"gorm.io/gorm"
+)
+
+// errReplayRollback aborts a dry-run replay transaction after the event has been applied.
+var errReplayRollback = errors.New("replay dry run rollback")
+
+// replayMaxLineSize bounds one JSONL line (a single pushed event).
+const replayMaxLineSize = 16 * 1024 * 1024
+
+// ReplayOptions controls a replay run. FromOffset skips the first lines (0-based line
+// offsets, so a previous summary's NextOffset resumes exactly). Rate is the maximum number
+// of events per second (0 = unlimited).
+type ReplayOptions struct {
+	DryRun      bool
+	Rate        float64
+	StopOnError bool
+	FromOffset  int
+}
+
+// ReplaySummary counts what a replay run did. Posted are events the ledger applied (or,
+// in a dry run, would apply); Duplicate were already in the exactly-once inbox; Skipped
+// decoded fine but are not events the ledger acts on; Failed could not be decoded or
+// applied. NextOffset is the line offset to resume from.
+type ReplaySummary struct {
+	Read       int
+	Posted     int
+	Duplicate  int
+	Skipped    int
+	Failed     int
+	NextOffset int
+}
+
+// ReplayEvents feeds historical events, one per JSONL line, through the push handler in
+// file order. A line is either a PushRequest envelope ({"subscription", "message":
+// {"messageId", "data"}}, data base64 as Pub/Sub pushes it) or a raw SellingEvent /
+// StockEvent in protojson. Short subscription names (invoice-selling-sub) are resolved
+// against the project; raw events get a content-derived message id, so replaying the same
+// file twice is deduplicated by the inbox like a Pub/Sub redelivery.
+//
+// A dry run applies each event in a transaction that is always rolled back, so nothing
+// (inbox included) is written; each event is simulated on its own, without the effects of
+// the earlier lines.
+func ReplayEvents(
+	ctx context.Context,
+	db *gorm.DB,
+	projectCfg *san_config.ProjectConfig,
+	handler InvoicePushHandler,
+	r io.Reader,
+	opt ReplayOptions,
+) (*ReplaySummary, error) {
+	summary := &ReplaySummary{NextOffset: opt.FromOffset}
+
+	var tick <-chan time.Time
+	if opt.Rate > 0 {
+		ticker := time.NewTicker(time.Duration(float64(time.Second) / opt.Rate))
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), replayMaxLineSize)
+
+	for offset := 0; scanner.Scan(); offset++ {
+		if offset < opt.FromOffset {
+			continue
+		}
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			summary.NextOffset = offset + 1
+			continue
+		}
+
+		if tick != nil {
+			select {
+			case <-ctx.Done():
+				return summary, ctx.Err()
+			case <-tick:
+			}
+		} else if err := ctx.Err(); err != nil {
+			return summary, err
+		}
+
+		summary.Read++
+		err := replayLine(ctx, db, projectCfg, handler, []byte(line), opt.DryRun, summary)
+		if err != nil {
+			summary.Failed++
+			if opt.StopOnError {
+				return summary, fmt.Errorf("replay line %d: %w", offset, err)
+			}
+			slog.Error("replay event failed", slog.Int("offset", offset), slog.String("err", err.Error()))
+		}
+		summary.NextOffset = offset + 1
+	}
+	if err := scanner.Err(); err != nil {
+		return summary, err
+	}
+
+	return summary, nil
+}
+
+// replayLine decodes and applies one line, counting it into summary on success.
+func replayLine(
+	ctx context.Context,
+	db *gorm.DB,
+	projectCfg *san_config.ProjectConfig,
+	handler InvoicePushHandler,
+	line []byte,
+	dryRun bool,
+	summary *ReplaySummary,
+) error {
+	msg, err := decodeReplayLine(projectCfg, line)
+	if err != nil {
+		return err
+	}
+	post, err := decodeInvoiceEvent(projectCfg, msg)
+	if err != nil {
+		return err
+	}
+	if post == nil {
+		summary.Skipped++
+		return nil
+	}
+
+	var seen int64
+	err = db.
+		WithContext(ctx).
+		Model(&invoice_models.InvoiceExactlyOnceLog{}).
+		Where("id = ? AND subscription = ?", msg.Message.MessageID, msg.Subscription).
+		Count(&seen).
+		Error
+	if err != nil {
+		return err
+	}
+	if seen > 0 {
+		summary.Duplicate++
+		return nil
+	}
+
+	if dryRun {
+		err = db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			if err := post(tx); err != nil {
+				return err
+			}
+			return errReplayRollback
+		})
+		if !errors.Is(err, errReplayRollback) {
+			return err
+		}
+	} else if err := handler(ctx, msg); err != nil {
+		return err
+	}
+
+	summary.Posted++
+	return nil
+}
+
+// decodeReplayLine turns one JSONL line into a PushRequest: an envelope is used as-is
+// (subscription resolved, message id synthesized when missing); a raw SellingEvent or
+// StockEvent is wrapped for the subscription that normally delivers it.
+func decodeReplayLine(projectCfg *san_config.ProjectConfig, line []byte) (*event_source.PushRequest, error) {
+	var probe map[string]json.RawMessage
+	if err := json.Unmarshal(line, &probe); err != nil {
+		return nil, err
+	}
+
+	if _, ok := probe["message"]; ok {
+		var msg event_source.PushRequest
+		if err := json.Unmarshal(line, &msg); err != nil {
+			return nil, err
+		}
+		if msg.Subscription == "" {
+			return nil, errors.New("envelope has no subscription")
+		}
+		if !strings.Contains(msg.Subscription, "/") {
+			msg.Subscription = projectCfg.PubsubSubscriberPath(msg.Subscription)
+		}
+		if msg.Message.MessageID == "" {
+			msg.Message.MessageID = replayMessageID(msg.Message.Data)
+		}
+		return &msg, nil
+	}
+
+	wrap := func(sub string) *event_source.PushRequest {
+		return &event_source.PushRequest{
+			Subscription: projectCfg.PubsubSubscriberPath(sub),
+			Message: event_source.PushMessage{
+				Data:      line,
+				MessageID: replayMessageID(line),
+			},
+		}
+	}
+
+	var selling selling_iface.SellingEvent
+	if err := protojson.Unmarshal(line, &selling); err == nil && selling.Data != nil {
+		return wrap("invoice-selling-sub"), nil
+	}
+	var stock warehouse_iface.StockEvent
+	if err := protojson.Unmarshal(line, &stock); err == nil && stock.Data != nil {
+		return wrap("invoice-stock-sub"), nil
+	}
+
+	return nil, errors.New("line is neither a push envelope nor a selling/stock event")
+}
+
+// replayMessageID derives a stable message id from the event payload.
+func replayMessageID(data []byte) string {
+	sum := sha256.Sum256(data)
+	return "replay-" + hex.EncodeToString(sum[:16])
+}
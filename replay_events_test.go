@@ -0,0 +1,142 @@
+package invoice_service_test
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/pdcgo/event_source"
+	"github.com/pdcgo/invoice_service"
+	"github.com/pdcgo/invoice_service/invoice_models"
+	"github.com/pdcgo/san_collection/san_config"
+	invoice_iface "github.com/pdcgo/schema/services/invoice_iface/v2"
+	"github.com/pdcgo/schema/services/warehouse_iface/v1"
+	"github.com/pdcgo/shared/db_models"
+	"github.com/pdcgo/shared/pkg/moretest"
+	"github.com/pdcgo/shared/pkg/moretest/moretest_mock"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/encoding/protojson"
+	"gorm.io/gorm"
+)
+
+// TestReplayEvents replays a JSONL file through the real push handler: envelopes and raw
+// events both post, a repeated raw event is deduplicated by the inbox, unsupported events
+// are skipped, bad lines fail, and dry run / resume-from-offset behave.
+func TestReplayEvents(t *testing.T) {
+	var scenario moretest_mock.DbScenario
+
+	moretest.Suite(t, "replay events",
+		moretest.SetupListFunc{
+			moretest_mock.MockPostgresDatabase(&scenario),
+		},
+		func(t *testing.T) {
+			scenario(t, func(db *gorm.DB) {
+				assert.NoError(t, db.AutoMigrate(
+					&db_models.InvTransaction{},
+					&db_models.RestockCost{},
+					&invoice_models.TeamBalance{},
+					&invoice_models.BalanceChangeLog{},
+					&invoice_models.OweLimitAlertLevel{},
+					&invoice_models.BalanceOpenItem{},
+					&invoice_models.BalanceOpenItemAllocation{},
+					&invoice_models.TeamBalanceDailyLog{},
+					&invoice_models.InvoiceExactlyOnceLog{},
+				))
+
+				// restock transactions 40 and 41: team 1 at warehouse 9, COD fee 25 / 10.
+				assert.NoError(t, db.Create(&db_models.InvTransaction{ID: 40, TeamID: 1, WarehouseID: 9}).Error)
+				assert.NoError(t, db.Create(&db_models.RestockCost{InvTransactionID: 40, CodFee: 25}).Error)
+				assert.NoError(t, db.Create(&db_models.InvTransaction{ID: 41, TeamID: 1, WarehouseID: 9}).Error)
+				assert.NoError(t, db.Create(&db_models.RestockCost{InvTransactionID: 41, CodFee: 10}).Error)
+
+				projectCfg := &san_config.ProjectConfig{ProjectID: "test"}
+				handler := invoice_service.NewInvoicePushHandler(db, projectCfg, nil)
+
+				rawStock := func(ev *warehouse_iface.StockEvent) string {
+					data, err := protojson.Marshal(ev)
+					assert.NoError(t, err)
+					return string(data)
+				}
+				restock := func(txID uint64) string {
+					return rawStock(&warehouse_iface.StockEvent{
+						Data: &warehouse_iface.StockEvent_RestockAccepted{
+							RestockAccepted: &warehouse_iface.RestockAccepted{TransactionId: txID},
+						},
+					})
+				}
+				envelope := func(sub, id, data string) string {
+					line, err := json.Marshal(&event_source.PushRequest{
+						Subscription: sub,
+						Message:      event_source.PushMessage{MessageID: id, Data: []byte(data)},
+					})
+					assert.NoError(t, err)
+					return string(line)
+				}
+
+				file := strings.Join([]string{
+					envelope("invoice-stock-sub", "msg-1", restock(40)), // 0: posted (short sub name)
+					restock(41), // 1: posted (raw event)
+					"",          // 2: blank, ignored
+					restock(41), // 3: duplicate of line 1
+					rawStock(&warehouse_iface.StockEvent{ // 4: skipped, ledger ignores returns
+						Data: &warehouse_iface.StockEvent_ReturnAccepted{
+							ReturnAccepted: &warehouse_iface.ReturnAccepted{TransactionId: 40},
+						},
+					}),
+					`{"not":"an event"}`, // 5: failed
+				}, "\n")
+
+				owedToWarehouse := func() float64 {
+					var b invoice_models.TeamBalance
+					assert.NoError(t, db.
+						Where("team_id = ? AND for_team_id = ? AND balance_type = ?",
+							uint64(9), uint64(1), invoice_iface.BalanceType_BALANCE_TYPE_RECEIVABLE).
+						Limit(1).Find(&b).Error)
+					return b.Balance
+				}
+
+				t.Run("dry run writes nothing", func(t *testing.T) {
+					summary, err := invoice_service.ReplayEvents(t.Context(), db, projectCfg, handler,
+						strings.NewReader(file), invoice_service.ReplayOptions{DryRun: true})
+					assert.NoError(t, err)
+					assert.Equal(t, 3, summary.Posted) // each dry-run line is simulated alone
+					assert.Equal(t, float64(0), owedToWarehouse())
+
+					var inbox int64
+					assert.NoError(t, db.Model(&invoice_models.InvoiceExactlyOnceLog{}).Count(&inbox).Error)
+					assert.Equal(t, int64(0), inbox)
+				})
+
+				t.Run("stop on error halts at the bad line", func(t *testing.T) {
+					summary, err := invoice_service.ReplayEvents(t.Context(), db, projectCfg, handler,
+						strings.NewReader(file), invoice_service.ReplayOptions{DryRun: true, StopOnError: true, FromOffset: 5})
+					assert.Error(t, err)
+					assert.Equal(t, 1, summary.Failed)
+					assert.Equal(t, 5, summary.NextOffset)
+				})
+
+				t.Run("replay posts, dedups and skips", func(t *testing.T) {
+					summary, err := invoice_service.ReplayEvents(t.Context(), db, projectCfg, handler,
+						strings.NewReader(file), invoice_service.ReplayOptions{})
+					assert.NoError(t, err)
+					assert.Equal(t, 5, summary.Read)
+					assert.Equal(t, 2, summary.Posted)
+					assert.Equal(t, 1, summary.Duplicate)
+					assert.Equal(t, 1, summary.Skipped)
+					assert.Equal(t, 1, summary.Failed)
+					assert.Equal(t, 6, summary.NextOffset)
+					assert.Equal(t, float64(35), owedToWarehouse())
+				})
+
+				t.Run("resume from offset replays only the tail, deduplicated", func(t *testing.T) {
+					summary, err := invoice_service.ReplayEvents(t.Context(), db, projectCfg, handler,
+						strings.NewReader(file), invoice_service.ReplayOptions{FromOffset: 1})
+					assert.NoError(t, err)
+					assert.Equal(t, 0, summary.Posted)
+					assert.Equal(t, 2, summary.Duplicate)
+					assert.Equal(t, float64(35), owedToWarehouse())
+				})
+			})
+		},
+	)
+}
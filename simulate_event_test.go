@@ -0,0 +1,110 @@
+package invoice_service_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pdcgo/invoice_service"
+	"github.com/pdcgo/invoice_service/invoice_models"
+	"github.com/pdcgo/invoice_service/invoice_v2"
+	"github.com/pdcgo/san_collection/san_config"
+	"github.com/pdcgo/schema/services/selling_iface/v1"
+	"github.com/pdcgo/schema/services/warehouse_iface/v1"
+	"github.com/pdcgo/shared/db_models"
+	"github.com/pdcgo/shared/pkg/moretest"
+	"github.com/pdcgo/shared/pkg/moretest/moretest_mock"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"gorm.io/gorm"
+)
+
+// TestSimulateEvent dry-runs an OrderCreated through the push handler's posting logic:
+// the legs, order sources and resulting balances come back, and nothing is persisted.
+func TestSimulateEvent(t *testing.T) {
+	var scenario moretest_mock.DbScenario
+
+	moretest.Suite(t, "simulate event",
+		moretest.SetupListFunc{
+			moretest_mock.MockPostgresDatabase(&scenario),
+		},
+		func(t *testing.T) {
+			scenario(t, func(db *gorm.DB) {
+				assert.NoError(t, db.AutoMigrate(
+					&db_models.Order{},
+					&db_models.OrderItem{},
+					&db_models.Product{},
+					&db_models.InvTransaction{},
+					&invoice_models.TeamBalance{},
+					&invoice_models.BalanceChangeLog{},
+					&invoice_models.OweLimitAlertLevel{},
+					&invoice_models.BalanceOpenItem{},
+					&invoice_models.BalanceOpenItemAllocation{},
+					&invoice_models.TeamBalanceDailyLog{},
+					&invoice_models.BalanceChangeOrderSource{},
+					&invoice_models.InvoiceExactlyOnceLog{},
+					&invoice_models.WarehouseFeeRule{},
+					&invoice_models.WarehouseFeeRuleVersion{},
+				))
+
+				assert.NoError(t, db.Create(&db_models.Product{ID: 1, TeamID: 2}).Error)
+				assert.NoError(t, db.Create(&db_models.InvTransaction{ID: 10, TeamID: 1, WarehouseID: 9}).Error)
+				invTxID := uint(10)
+				assert.NoError(t, db.Create(&db_models.Order{
+					ID:            1,
+					TeamID:        1,
+					OrderRefID:    "ORD-1",
+					CreatedByID:   7,
+					InvertoryTxID: &invTxID,
+					WarehouseFee:  15,
+					Items: []*db_models.OrderItem{
+						{OrderID: 1, ProductID: 1, Owned: false, Total: 30, Count: 1, ProductName: "A"},
+					},
+				}).Error)
+
+				projectCfg := &san_config.ProjectConfig{ProjectID: "test"}
+				apply := invoice_service.NewInvoiceEventApplier(projectCfg)
+
+				t.Run("order created returns legs without persisting", func(t *testing.T) {
+					sim, err := invoice_v2.SimulateEvent(db, apply, &selling_iface.SellingEvent{
+						Data: &selling_iface.SellingEvent_OrderCreated{
+							OrderCreated: &selling_iface.OrderCreated{
+								OrderId:         1,
+								TransactionTime: timestamppb.New(time.Date(2026, 6, 8, 10, 0, 0, 0, time.UTC)),
+							},
+						},
+					})
+					assert.NoError(t, err)
+
+					// product fee 30 and warehouse fee 15, each a receivable/payable pair.
+					assert.Len(t, sim.Logs, 4)
+					assert.Len(t, sim.OrderSources, 4)
+					assert.Len(t, sim.Balances, 4)
+
+					got := map[uint64]float64{}
+					for _, b := range sim.Balances {
+						if b.BalanceType == receivable {
+							got[b.TeamID] = b.Balance
+						}
+					}
+					assert.Equal(t, float64(30), got[2])
+					assert.Equal(t, float64(15), got[9])
+
+					var logs, inbox int64
+					assert.NoError(t, db.Model(&invoice_models.BalanceChangeLog{}).Count(&logs).Error)
+					assert.NoError(t, db.Model(&invoice_models.InvoiceExactlyOnceLog{}).Count(&inbox).Error)
+					assert.Equal(t, int64(0), logs)
+					assert.Equal(t, int64(0), inbox)
+				})
+
+				t.Run("events the ledger ignores are rejected", func(t *testing.T) {
+					_, err := invoice_v2.SimulateEvent(db, apply, &warehouse_iface.StockEvent{
+						Data: &warehouse_iface.StockEvent_ReturnAccepted{
+							ReturnAccepted: &warehouse_iface.ReturnAccepted{TransactionId: 10},
+						},
+					})
+					assert.Error(t, err)
+				})
+			})
+		},
+	)
+}
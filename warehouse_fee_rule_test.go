@@ -0,0 +1,141 @@
+package invoice_service_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pdcgo/event_source/event_source_mock"
+	"github.com/pdcgo/invoice_service"
+	"github.com/pdcgo/invoice_service/invoice_models"
+	"github.com/pdcgo/san_collection/san_config"
+	"github.com/pdcgo/schema/services/selling_iface/v1"
+	"github.com/pdcgo/shared/db_models"
+	"github.com/pdcgo/shared/pkg/moretest"
+	"github.com/pdcgo/shared/pkg/moretest/moretest_mock"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"gorm.io/gorm"
+)
+
+// TestWarehouseFeeRules prices the WAREHOUSE_FEE of an order with the warehouse's fee
+// rules: the matching rule version is recorded on both order-source legs, and a cancel
+// reverses the fee that was posted even after the rule changed.
+func TestWarehouseFeeRules(t *testing.T) {
+	var scenario moretest_mock.DbScenario
+
+	moretest.Suite(t, "warehouse fee rules",
+		moretest.SetupListFunc{
+			moretest_mock.MockPostgresDatabase(&scenario),
+		},
+		func(t *testing.T) {
+			scenario(t, func(db *gorm.DB) {
+				assert.NoError(t, db.AutoMigrate(
+					&db_models.Order{},
+					&db_models.OrderItem{},
+					&db_models.Product{},
+					&db_models.InvTransaction{},
+					&invoice_models.TeamBalance{},
+					&invoice_models.BalanceChangeLog{},
+					&invoice_models.OweLimitAlertLevel{},
+					&invoice_models.BalanceOpenItem{},
+					&invoice_models.BalanceOpenItemAllocation{},
+					&invoice_models.TeamBalanceDailyLog{},
+					&invoice_models.BalanceChangeOrderSource{},
+					&invoice_models.InvoiceExactlyOnceLog{},
+					&invoice_models.WarehouseFeeRule{},
+					&invoice_models.WarehouseFeeRuleVersion{},
+				))
+
+				// owned items only (no product fee): team 1 ships 3 items via warehouse 9.
+				assert.NoError(t, db.Create(&db_models.Product{ID: 1, TeamID: 1}).Error)
+				assert.NoError(t, db.Create(&db_models.InvTransaction{ID: 10, TeamID: 1, WarehouseID: 9}).Error)
+				invTxID := uint(10)
+				assert.NoError(t, db.Create(&db_models.Order{
+					ID:            1,
+					TeamID:        1,
+					OrderRefID:    "ORD-1",
+					CreatedByID:   7,
+					InvertoryTxID: &invTxID,
+					OrderFrom:     db_models.OrderMpShopee,
+					WarehouseFee:  15,
+					Items: []*db_models.OrderItem{
+						{OrderID: 1, ProductID: 1, Owned: true, Total: 30, Count: 3, ProductName: "A"},
+					},
+				}).Error)
+
+				now := time.Date(2026, 6, 8, 10, 0, 0, 0, time.UTC)
+				teamOne := uint64(1)
+				rules := []any{
+					// priority 10, shopee orders of team 1: 5 + 2/item.
+					&invoice_models.WarehouseFeeRule{ID: 1, WarehouseID: 9, Name: "shopee contract", Priority: 10, Active: true, CurrentVersion: 2, CreatedAt: now, UpdatedAt: now},
+					&invoice_models.WarehouseFeeRuleVersion{RuleID: 1, Version: 1, OrderFrom: "shopee", BaseFee: 99, CreatedAt: now},
+					&invoice_models.WarehouseFeeRuleVersion{RuleID: 1, Version: 2, OrderFrom: "shopee", ForTeamID: &teamOne, BaseFee: 5, PerItemFee: 2, CreatedAt: now},
+					// bulk rule does not match a 3-item order.
+					&invoice_models.WarehouseFeeRule{ID: 2, WarehouseID: 9, Name: "bulk", Priority: 20, Active: true, CurrentVersion: 1, CreatedAt: now, UpdatedAt: now},
+					&invoice_models.WarehouseFeeRuleVersion{RuleID: 2, Version: 1, MinItems: 10, BaseFee: 50, CreatedAt: now},
+					// inactive rule is ignored.
+					&invoice_models.WarehouseFeeRule{ID: 3, WarehouseID: 9, Name: "old", Priority: 30, Active: false, CurrentVersion: 1, CreatedAt: now, UpdatedAt: now},
+					&invoice_models.WarehouseFeeRuleVersion{RuleID: 3, Version: 1, BaseFee: 70, CreatedAt: now},
+				}
+				for _, r := range rules {
+					assert.NoError(t, db.Create(r).Error)
+				}
+
+				projectCfg := &san_config.ProjectConfig{ProjectID: "test"}
+				handler := invoice_service.NewInvoicePushHandler(db, projectCfg, nil)
+
+				push := func(ev *selling_iface.SellingEvent) {
+					msg := event_source_mock.NewMockEvent(t, ev)
+					msg.Subscription = projectCfg.PubsubSubscriberPath("invoice-selling-sub")
+					assert.NoError(t, handler(t.Context(), msg))
+				}
+				owed := func() float64 {
+					var b invoice_models.TeamBalance
+					assert.NoError(t, db.
+						Where("team_id = ? AND for_team_id = ? AND balance_type = ?", uint64(9), uint64(1), receivable).
+						Limit(1).Find(&b).Error)
+					return b.Balance
+				}
+
+				t.Run("matching rule version prices the fee", func(t *testing.T) {
+					push(&selling_iface.SellingEvent{
+						Data: &selling_iface.SellingEvent_OrderCreated{
+							OrderCreated: &selling_iface.OrderCreated{OrderId: 1, TransactionTime: timestamppb.New(now)},
+						},
+					})
+					assert.Equal(t, float64(11), owed()) // 5 + 3*2, not orders.warehouse_fee
+
+					var sources []invoice_models.BalanceChangeOrderSource
+					assert.NoError(t, db.Where("order_id = ?", 1).Find(&sources).Error)
+					assert.Len(t, sources, 2)
+					for _, s := range sources {
+						if assert.NotNil(t, s.FeeRuleID) && assert.NotNil(t, s.FeeRuleVersion) {
+							assert.Equal(t, uint64(1), *s.FeeRuleID)
+							assert.Equal(t, 2, *s.FeeRuleVersion)
+						}
+					}
+				})
+
+				t.Run("cancel reverses the posted fee after the rule changed", func(t *testing.T) {
+					assert.NoError(t, db.Create(&invoice_models.WarehouseFeeRuleVersion{
+						RuleID: 1, Version: 3, OrderFrom: "shopee", BaseFee: 40, CreatedAt: now,
+					}).Error)
+					assert.NoError(t, db.Model(&invoice_models.WarehouseFeeRule{}).
+						Where("id = ?", 1).Update("current_version", 3).Error)
+
+					push(&selling_iface.SellingEvent{
+						Data: &selling_iface.SellingEvent_OrderCanceled{
+							OrderCanceled: &selling_iface.OrderCanceled{OrderId: 1, TransactionTime: timestamppb.New(now)},
+						},
+					})
+					assert.Equal(t, float64(0), owed())
+
+					var versions []int
+					assert.NoError(t, db.Model(&invoice_models.BalanceChangeOrderSource{}).
+						Where("order_id = ?", 1).Pluck("fee_rule_version", &versions).Error)
+					assert.Equal(t, []int{2, 2, 2, 2}, versions)
+				})
+			})
+		},
+	)
+}